@@ -8,8 +8,11 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
 	"github.com/gastownhall/tmux-adapter/internal/converter"
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
 )
 
 func main() {
@@ -23,15 +26,65 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  tmux-converter --gt-dir ~/gt\n")
 		fmt.Fprintf(os.Stderr, "  tmux-converter --gt-dir ~/gt --listen :9090\n")
+		fmt.Fprintf(os.Stderr, "  tmux-converter --gt-dir ~/gt --jwt-keys jwks.pem --jwt-audience tmux-converter\n")
+		fmt.Fprintf(os.Stderr, "  tmux-converter --gt-dir ~/gt --tls-cert cert.pem --tls-key key.pem\n")
 		fmt.Fprintf(os.Stderr, "  tmux-converter --gt-dir ~/gt --debug-serve-dir ./samples\n")
 	}
 
 	gtDir := flag.String("gt-dir", filepath.Join(os.Getenv("HOME"), "gt"), "gastown town directory")
 	listen := flag.String("listen", ":8081", "HTTP/WebSocket listen address")
 	debugServeDir := flag.String("debug-serve-dir", "", "serve static files from this directory at / (development only)")
+	promptTimings := flag.String("prompt-timings", "", "JSON file of per-runtime send-prompt timing overrides")
+	pastePolicy := flag.String("paste-policy", "", "JSON file of per-runtime upload paste policies")
+	tokensFile := flag.String("tokens", "", "JSON file of named access tokens with scopes and agent selectors (default: no auth)")
+	jwtKeys := flag.String("jwt-keys", "", "JWKS or PEM file of public keys for verifying JWT bearer tokens (reloaded on change)")
+	jwtIssuer := flag.String("jwt-issuer", "", "required JWT iss claim (default: any)")
+	jwtAudience := flag.String("jwt-audience", "", "required JWT aud claim (default: any)")
+	jwtClockSkew := flag.Duration("jwt-clock-skew", wsbase.DefaultJWTClockSkew, "leeway for JWT exp, nbf and iat")
+	jwtScopeClaim := flag.String("jwt-scope-claim", "scope", "JWT claim holding scopes (space-separated string or array)")
+	jwtAgentClaim := flag.String("jwt-agent-claim", "agents", "JWT claim holding agent selectors")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate chain; serve HTTPS/WSS (reloaded on change)")
+	tlsKey := flag.String("tls-key", "", "PEM private key for --tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", "", "PEM CA bundle for verifying client certificates (mutual TLS)")
+	tlsClientAuth := flag.String("tls-client-auth", wsbase.ClientAuthRequire, "with --tls-client-ca: require or optional client certificates")
+	uploadQuotaMB := flag.Int64("upload-quota-mb", 256, "per-agent upload storage quota in MB (0 = unlimited)")
+	uploadMaxFiles := flag.Int("upload-max-files", 200, "per-agent maximum number of stored uploads (0 = unlimited)")
+	uploadMaxAge := flag.Duration("upload-max-age", 7*24*time.Hour, "delete uploads not re-uploaded within this duration (0 = keep forever)")
 	flag.Parse()
 
-	c := converter.New(*gtDir, *listen, *debugServeDir)
+	uploadPolicy := agentio.UploadPolicy{
+		MaxBytesPerAgent: *uploadQuotaMB * 1024 * 1024,
+		MaxFilesPerAgent: *uploadMaxFiles,
+		MaxAge:           *uploadMaxAge,
+	}
+
+	jwtConfig := wsbase.JWTConfig{
+		KeyFile:    *jwtKeys,
+		Issuer:     *jwtIssuer,
+		Audience:   *jwtAudience,
+		ClockSkew:  *jwtClockSkew,
+		ScopeClaim: *jwtScopeClaim,
+		AgentClaim: *jwtAgentClaim,
+	}
+
+	tlsConfig := wsbase.TLSConfig{
+		CertFile:     *tlsCert,
+		KeyFile:      *tlsKey,
+		ClientCAFile: *tlsClientCA,
+		ClientAuth:   *tlsClientAuth,
+	}
+
+	c := converter.New(converter.Options{
+		GtDir:         *gtDir,
+		Listen:        *listen,
+		DebugServeDir: *debugServeDir,
+		PromptTimings: *promptTimings,
+		PastePolicy:   *pastePolicy,
+		TokensFile:    *tokensFile,
+		JWT:           jwtConfig,
+		TLS:           tlsConfig,
+		Uploads:       uploadPolicy,
+	})
 	if err := c.Start(); err != nil {
 		log.Fatal(err)
 	}
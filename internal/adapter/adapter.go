@@ -9,40 +9,60 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
 	"github.com/gastownhall/tmux-adapter/internal/agents"
 	"github.com/gastownhall/tmux-adapter/internal/tmux"
 	"github.com/gastownhall/tmux-adapter/internal/wsadapter"
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
 	"github.com/gastownhall/tmux-adapter/web"
 )
 
 // Adapter wires together tmux control mode, agent registry, pipe-pane streaming,
 // and the WebSocket server.
 type Adapter struct {
-	ctrl           *tmux.ControlMode
-	registry       *agents.Registry
-	pipeMgr        *tmux.PipePaneManager
-	wsSrv          *wsadapter.Server
-	httpSrv        *http.Server
-	gtDir          string
-	port           int
-	authToken      string
-	originPatterns []string
-	debugServeDir  string
+	ctrl     *tmux.ControlMode
+	registry *agents.Registry
+	pipeMgr  *tmux.PipePaneManager
+	wsSrv    *wsadapter.Server
+	httpSrv  *http.Server
+	tls      *wsbase.TLSReloader
+	opts     Options
+}
+
+// Options configures an Adapter. Empty fields keep the defaults.
+type Options struct {
+	GtDir           string
+	Port            int
+	AuthToken       string
+	OriginPatterns  []string
+	DebugServeDir   string
+	PromptTimings   string // JSON file of per-runtime prompt timing overrides
+	PastePolicy     string // JSON file of per-runtime paste policies
+	TokensFile      string // JSON file of named, scoped tokens
+	JWT             wsbase.JWTConfig
+	TLS             wsbase.TLSConfig
+	Uploads         agentio.UploadPolicy
+	Files           agentio.FilePolicy
+	MirrorClipboard bool
+	ControlPolicy   string
+	SizePolicy      string
 }
 
 // New creates a new Adapter.
-func New(gtDir string, port int, authToken string, originPatterns []string, debugServeDir string) *Adapter {
-	return &Adapter{
-		gtDir:          gtDir,
-		port:           port,
-		authToken:      authToken,
-		originPatterns: originPatterns,
-		debugServeDir:  debugServeDir,
-	}
+func New(opts Options) *Adapter {
+	return &Adapter{opts: opts}
 }
 
 // Start initializes all components and starts the HTTP/WebSocket server.
 func (a *Adapter) Start() error {
+	if a.opts.TLS.Enabled() {
+		reloader, err := wsbase.NewTLSReloader(a.opts.TLS)
+		if err != nil {
+			return err
+		}
+		a.tls = reloader
+	}
+
 	// 1. Connect to tmux in control mode
 	ctrl, err := tmux.NewControlMode("adapter-monitor")
 	if err != nil {
@@ -52,28 +72,72 @@ func (a *Adapter) Start() error {
 	log.Println("connected to tmux control mode")
 
 	// 2. Create agent registry
-	a.registry = agents.NewRegistry(ctrl, a.gtDir, []string{"adapter-monitor"})
+	a.registry = agents.NewRegistry(ctrl, a.opts.GtDir, []string{"adapter-monitor"})
 
 	// 3. Create pipe-pane manager
 	a.pipeMgr = tmux.NewPipePaneManager(ctrl)
 
 	// 4. Create WebSocket server
-	a.wsSrv = wsadapter.NewServer(a.registry, a.pipeMgr, ctrl, a.authToken, a.originPatterns)
+	a.wsSrv = wsadapter.NewServer(a.registry, a.pipeMgr, ctrl, a.opts.AuthToken, a.opts.OriginPatterns)
+	a.wsSrv.SetUploadPolicy(a.opts.Uploads)
+	a.wsSrv.SetFilePolicy(a.opts.Files)
+	a.wsSrv.SetClipboardMirror(a.opts.MirrorClipboard)
+
+	// fail undoes the steps above when a later one fails.
+	fail := func(err error) error {
+		a.wsSrv.Stop()
+		ctrl.Close()
+		return err
+	}
+	if a.opts.ControlPolicy != "" {
+		if err := a.wsSrv.SetControlPolicy(a.opts.ControlPolicy); err != nil {
+			return fail(err)
+		}
+	}
+	if a.opts.SizePolicy != "" {
+		if err := a.wsSrv.SetSizePolicy(a.opts.SizePolicy); err != nil {
+			return fail(err)
+		}
+	}
+	if a.opts.PromptTimings != "" {
+		if err := a.wsSrv.LoadPromptTimings(a.opts.PromptTimings); err != nil {
+			return fail(err)
+		}
+	}
+	if a.opts.PastePolicy != "" {
+		if err := a.wsSrv.LoadPastePolicies(a.opts.PastePolicy); err != nil {
+			return fail(err)
+		}
+	}
+	if a.opts.TokensFile != "" {
+		if err := a.wsSrv.LoadTokens(a.opts.TokensFile); err != nil {
+			return fail(err)
+		}
+	}
+	if a.opts.JWT.KeyFile != "" {
+		if err := a.wsSrv.LoadJWTKeys(a.opts.JWT); err != nil {
+			return fail(err)
+		}
+	}
 
 	// 5. Start registry watching
 	if err := a.registry.Start(); err != nil {
-		ctrl.Close()
-		return fmt.Errorf("start registry (gtDir=%s): %w", a.gtDir, err)
+		return fail(fmt.Errorf("start registry (gtDir=%s): %w", a.opts.GtDir, err))
 	}
 	log.Printf("agent registry started (%d agents found)", len(a.registry.GetAgents()))
 
 	// 6. Forward registry events to WebSocket clients
 	go a.forwardEvents()
+	go a.wsSrv.ForwardPromptQueueEvents()
+	go a.wsSrv.ForwardCommandChanges()
+	go a.wsSrv.RunUploadCleanup(time.Hour)
 
 	// 7. Start HTTP server
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", a.handleHealth)
 	mux.HandleFunc("/readyz", a.handleReady)
+	mux.Handle("/agent-history", a.wsSrv.RequireGrant(wsbase.ScopeView, http.HandlerFunc(a.handleAgentHistory)))
+	mux.Handle("/files", a.wsSrv.FileHandler())
 	mux.Handle("/ws", a.wsSrv)
 
 	// Serve embedded web component files at /tmux-adapter-web/
@@ -89,7 +153,7 @@ func (a *Adapter) Start() error {
 	))
 
 	// Debug: remote console log endpoint
-	if a.debugServeDir != "" {
+	if a.opts.DebugServeDir != "" {
 		mux.HandleFunc("/debug/log", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			if r.Method == "OPTIONS" {
@@ -108,20 +172,32 @@ func (a *Adapter) Start() error {
 	}
 
 	// Debug: serve static files from a local directory (development only)
-	if a.debugServeDir != "" {
-		log.Printf("serving static files from %s at /", a.debugServeDir)
-		mux.Handle("/", http.FileServer(http.Dir(a.debugServeDir)))
+	if a.opts.DebugServeDir != "" {
+		log.Printf("serving static files from %s at /", a.opts.DebugServeDir)
+		mux.Handle("/", http.FileServer(http.Dir(a.opts.DebugServeDir)))
 	}
 
 	a.httpSrv = &http.Server{
-		Addr:    fmt.Sprintf(":%d", a.port),
+		Addr:    fmt.Sprintf(":%d", a.opts.Port),
 		Handler: mux,
 	}
 
+	scheme := "ws"
+	if a.tls != nil {
+		scheme = "wss"
+		a.httpSrv.TLSConfig = a.tls.ServerConfig()
+	}
+
 	go func() {
-		log.Printf("WebSocket server listening on ws://localhost:%d/ws", a.port)
-		log.Printf("watching gastown at %s", a.gtDir)
-		if err := a.httpSrv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Printf("WebSocket server listening on %s://localhost:%d/ws", scheme, a.opts.Port)
+		log.Printf("watching gastown at %s", a.opts.GtDir)
+		var err error
+		if a.tls != nil {
+			err = a.httpSrv.ListenAndServeTLS("", "")
+		} else {
+			err = a.httpSrv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			log.Fatalf("http server: %v", err)
 		}
 	}()
@@ -140,8 +216,9 @@ func (a *Adapter) Stop() {
 		log.Printf("http shutdown: %v", err)
 	}
 
-	// 2. Close all WebSocket connections
+	// 2. Close all WebSocket connections and stop the server's background work
 	a.wsSrv.CloseAll()
+	a.wsSrv.Stop()
 
 	// 3. Stop registry
 	a.registry.Stop()
@@ -156,11 +233,27 @@ func (a *Adapter) Stop() {
 }
 
 // forwardEvents reads agent lifecycle events from the registry and pushes them to
-// subscribed WebSocket clients.
+// subscribed WebSocket clients. If it falls behind, it resubscribes and
+// forwards the events it missed. Exits when the registry stops.
 func (a *Adapter) forwardEvents() {
-	for event := range a.registry.Events() {
-		msg := wsadapter.MakeAgentEvent(event.Type, event.Agent)
-		a.wsSrv.BroadcastToAgentSubscribers(msg)
+	known := make(map[string]agents.Agent)
+	_, events := a.registry.Subscribe(true)
+	for {
+		for event := range events {
+			if event.Type == "removed" {
+				delete(known, event.Agent.Name)
+			} else {
+				known[event.Agent.Name] = event.Agent
+			}
+			a.wsSrv.BroadcastAgentEvent(event)
+		}
+		select {
+		case <-a.registry.Done():
+			return
+		default:
+		}
+		log.Println("agent events fell behind; resubscribing")
+		_, events = a.registry.Resubscribe(known)
 	}
 }
 
@@ -186,6 +279,28 @@ func (a *Adapter) handleReady(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
+// handleAgentHistory serves lifecycle history for all agents, or for a single
+// agent when ?agent= is given. Guarded by the same tokens as /ws.
+func (a *Adapter) handleAgentHistory(w http.ResponseWriter, r *http.Request) {
+	if name := r.URL.Query().Get("agent"); name != "" {
+		history, ok := a.registry.GetAgentHistory(name)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]any{"ok": false, "error": "agent not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "agentHistory": []agents.AgentHistory{history}})
+		return
+	}
+	grant := wsbase.GrantFromContext(r.Context())
+	history := []agents.AgentHistory{}
+	for _, h := range a.registry.GetHistory() {
+		if grant.SeesName(a.registry, h.Name) {
+			history = append(history, h)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "agentHistory": history})
+}
+
 func corsHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -12,6 +12,7 @@ const (
 	BinaryResize           byte = 0x03 // client → server: resize
 	BinaryFileUpload       byte = 0x04 // client → server: file upload for paste
 	BinaryTerminalSnapshot byte = 0x05 // server → client: terminal snapshot/refresh
+	BinaryUploadChunk      byte = 0x06 // client → server: chunked upload data
 )
 
 // ParseBinaryEnvelope parses a binary WebSocket frame into its components.
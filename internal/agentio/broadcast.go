@@ -0,0 +1,153 @@
+package agentio
+
+import (
+	"path"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+// Agent status values accepted by AgentSelector.Status.
+const (
+	AgentStatusAttached = "attached"
+	AgentStatusDetached = "detached"
+)
+
+// AgentSelector picks agents for a broadcast. Every non-empty field must
+// match; an empty selector is rejected so a broadcast never targets every
+// agent by accident (use "name": "*" for that).
+type AgentSelector struct {
+	Role    string `json:"role,omitempty"`
+	Rig     string `json:"rig,omitempty"`
+	Runtime string `json:"runtime,omitempty"`
+	Name    string `json:"name,omitempty"`   // glob, e.g. "gt-gastown-*"
+	Status  string `json:"status,omitempty"` // "attached" or "detached"
+}
+
+// Validate checks that the selector has at least one criterion and that its
+// name glob and status are well-formed.
+func (s AgentSelector) Validate() error {
+	if s == (AgentSelector{}) {
+		return errorf(ErrInvalidArgument, "selector must set at least one of role, rig, runtime, name, status")
+	}
+	if s.Name != "" {
+		if _, err := path.Match(s.Name, ""); err != nil {
+			return errorf(ErrInvalidArgument, "invalid name glob %q: %w", s.Name, err)
+		}
+	}
+	switch s.Status {
+	case "", AgentStatusAttached, AgentStatusDetached:
+	default:
+		return errorf(ErrInvalidArgument, "invalid status %q (want attached or detached)", s.Status)
+	}
+	return nil
+}
+
+// Matches reports whether the agent satisfies every criterion. Town-level
+// agents (no rig) never match a rig criterion.
+func (s AgentSelector) Matches(a agents.Agent) bool {
+	if s.Role != "" && a.Role != s.Role {
+		return false
+	}
+	if s.Rig != "" && (a.Rig == nil || *a.Rig != s.Rig) {
+		return false
+	}
+	if s.Runtime != "" && a.Runtime != s.Runtime {
+		return false
+	}
+	if s.Name != "" {
+		if ok, _ := path.Match(s.Name, a.Name); !ok {
+			return false
+		}
+	}
+	switch s.Status {
+	case AgentStatusAttached:
+		return a.Attached
+	case AgentStatusDetached:
+		return !a.Attached
+	}
+	return true
+}
+
+// SelectAgents returns the registry's agents matching the selector, sorted by name.
+func SelectAgents(registry *agents.Registry, sel AgentSelector) ([]agents.Agent, error) {
+	if err := sel.Validate(); err != nil {
+		return nil, err
+	}
+	var matched []agents.Agent
+	for _, a := range registry.GetAgents() {
+		if sel.Matches(a) {
+			matched = append(matched, a)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Name < matched[j].Name })
+	return matched, nil
+}
+
+// BroadcastResult is the outcome of a broadcast for one agent.
+type BroadcastResult struct {
+	Agent    string          `json:"agent"`
+	OK       bool            `json:"ok"`
+	PromptID string          `json:"promptId,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Delivery *DeliveryResult `json:"delivery,omitempty"`
+}
+
+// Broadcast enqueues req.Prompt for every agent matching sel and blocks until
+// each delivery finishes. Agents have independent queue workers, so delivery
+// runs in parallel while each agent stays serialized behind its own lock.
+// req.Agent is ignored. Results are sorted by agent name. A non-nil visible
+// limits the broadcast to the agents it admits, as if the others did not exist.
+// A non-nil admit is asked before each agent's prompt is queued; its error is
+// reported as that agent's result.
+func (q *PromptQueue) Broadcast(sel AgentSelector, req PromptRequest, visible func(agents.Agent) bool, admit func(agent string) error) ([]BroadcastResult, error) {
+	targets, err := SelectAgents(q.prompter.Registry, sel)
+	if err != nil {
+		return nil, err
+	}
+	if visible != nil {
+		targets = slices.DeleteFunc(targets, func(a agents.Agent) bool { return !visible(a) })
+	}
+	if len(targets) == 0 {
+		return nil, errorf(ErrInvalidArgument, "no agents match selector")
+	}
+	if len(req.Prompt) > MaxPromptBytes {
+		return nil, errorf(ErrTooLarge, "prompt too large: %d bytes (max %d)", len(req.Prompt), MaxPromptBytes)
+	}
+
+	results := make([]BroadcastResult, len(targets))
+	var wg sync.WaitGroup
+	for i, a := range targets {
+		results[i].Agent = a.Name
+		if admit != nil {
+			if err := admit(a.Name); err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+		}
+		agentReq := req
+		agentReq.Agent = a.Name
+
+		wg.Add(1)
+		_, err := q.Enqueue(agentReq, func(out PromptOutcome) {
+			defer wg.Done()
+			results[i].OK = out.Err == nil && !out.Cancelled
+			results[i].PromptID = out.Item.ID
+			results[i].Delivery = out.Delivery
+			switch {
+			case out.Cancelled:
+				results[i].Error = "prompt cancelled"
+			case out.Err != nil:
+				results[i].Error = out.Err.Error()
+			}
+		})
+		if err != nil {
+			results[i].Error = err.Error()
+			wg.Done()
+		}
+	}
+	wg.Wait()
+	return results, nil
+}
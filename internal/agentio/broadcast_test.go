@@ -0,0 +1,125 @@
+package agentio
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+func TestAgentSelectorMatches(t *testing.T) {
+	rig := "gastown"
+	polecat := agents.Agent{Name: "gt-gastown-toast", Role: "polecat", Runtime: "claude", Rig: &rig}
+	mayor := agents.Agent{Name: "hq-mayor", Role: "mayor", Runtime: "codex", Attached: true}
+
+	cases := []struct {
+		sel     AgentSelector
+		polecat bool
+		mayor   bool
+	}{
+		{AgentSelector{Role: "polecat"}, true, false},
+		{AgentSelector{Rig: "gastown"}, true, false},
+		{AgentSelector{Runtime: "codex"}, false, true},
+		{AgentSelector{Name: "gt-*"}, true, false},
+		{AgentSelector{Name: "*"}, true, true},
+		{AgentSelector{Status: AgentStatusDetached}, true, false},
+		{AgentSelector{Rig: "gastown", Runtime: "codex"}, false, false},
+	}
+	for _, tc := range cases {
+		if got := tc.sel.Matches(polecat); got != tc.polecat {
+			t.Errorf("%+v.Matches(polecat) = %v, want %v", tc.sel, got, tc.polecat)
+		}
+		if got := tc.sel.Matches(mayor); got != tc.mayor {
+			t.Errorf("%+v.Matches(mayor) = %v, want %v", tc.sel, got, tc.mayor)
+		}
+	}
+}
+
+func TestAgentSelectorValidate(t *testing.T) {
+	for _, sel := range []AgentSelector{{}, {Name: "["}, {Status: "busy"}} {
+		if err := sel.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", sel)
+		}
+	}
+	if err := (AgentSelector{Role: "witness", Status: AgentStatusAttached}).Validate(); err != nil {
+		t.Fatalf("Validate() error: %v", err)
+	}
+}
+
+func TestBroadcastDeliversToMatchingAgents(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("gt-alpha-witness", "gemini", true)
+	fake.addAgent("gt-beta-witness", "gemini", true)
+	fake.addAgent("gt-alpha-refinery", "gemini", true)
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("gemini", instant); err != nil {
+		t.Fatal(err)
+	}
+	q := NewPromptQueue(p)
+
+	results, err := q.Broadcast(AgentSelector{Role: "witness"}, PromptRequest{Prompt: "status?", Submitter: "tester"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Broadcast() error: %v", err)
+	}
+	if len(results) != 2 || results[0].Agent != "gt-alpha-witness" || results[1].Agent != "gt-beta-witness" {
+		t.Fatalf("results = %+v", results)
+	}
+	for _, r := range results {
+		if !r.OK || r.PromptID == "" || r.Error != "" {
+			t.Fatalf("unexpected result: %+v", r)
+		}
+	}
+	for _, c := range literalCalls(fake) {
+		if strings.Contains(c, "refinery") {
+			t.Fatalf("prompt delivered to non-matching agent: %s", c)
+		}
+	}
+	if got := len(literalCalls(fake)); got != 2 {
+		t.Fatalf("literal calls = %d, want 2", got)
+	}
+}
+
+func TestBroadcastReportsRefusedAgents(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("gt-alpha-witness", "gemini", true)
+	fake.addAgent("gt-beta-witness", "gemini", true)
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("gemini", instant); err != nil {
+		t.Fatal(err)
+	}
+	q := NewPromptQueue(p)
+
+	admit := func(agent string) error {
+		if agent == "gt-beta-witness" {
+			return errors.New("gt-beta-witness is driven by alice")
+		}
+		return nil
+	}
+	results, err := q.Broadcast(AgentSelector{Role: "witness"}, PromptRequest{Prompt: "status?"}, nil, admit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].OK || results[1].OK || results[1].Error != "gt-beta-witness is driven by alice" {
+		t.Fatalf("results = %+v", results)
+	}
+	for _, c := range literalCalls(fake) {
+		if strings.Contains(c, "gt-beta-witness") {
+			t.Fatalf("prompt delivered to a refused agent: %s", c)
+		}
+	}
+}
+
+func TestBroadcastNoMatches(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-mayor", "claude", true)
+	q := NewPromptQueue(newTestPrompter(t, fake))
+
+	if _, err := q.Broadcast(AgentSelector{Role: "polecat"}, PromptRequest{Prompt: "hi"}, nil, nil); err == nil {
+		t.Fatal("expected error when no agents match")
+	}
+	hidden := func(agents.Agent) bool { return false }
+	if _, err := q.Broadcast(AgentSelector{Name: "*"}, PromptRequest{Prompt: "hi"}, hidden, nil); err == nil {
+		t.Fatal("expected error when no visible agents match")
+	}
+}
@@ -0,0 +1,310 @@
+package agentio
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxChunkedUploadBytes bounds the declared size of a chunked upload.
+	MaxChunkedUploadBytes = 2 * 1024 * 1024 * 1024
+	// UploadChunkBytes is the chunk size clients are asked to use. Chunks may be
+	// smaller; anything up to MaxFileUploadBytes fits the connection read limit.
+	UploadChunkBytes = 1024 * 1024
+	// ChunkedUploadIdleTimeout is how long an unfinished upload can sit idle
+	// before its partial file is discarded.
+	ChunkedUploadIdleTimeout = 24 * time.Hour
+)
+
+// ErrChunkedUploadNotFound is returned for unknown or expired upload IDs.
+var ErrChunkedUploadNotFound = errors.New("chunked upload not found")
+
+// ChunkedUpload is the client-visible state of an in-progress chunked upload.
+type ChunkedUpload struct {
+	ID        string    `json:"uploadId"`
+	Agent     string    `json:"agent"`
+	FileName  string    `json:"fileName"`
+	MimeType  string    `json:"mimeType,omitempty"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	Received  int64     `json:"received"`
+	ChunkSize int       `json:"chunkSize"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type chunkedUpload struct {
+	ChunkedUpload
+	path       string // partial file
+	finalizing bool   // Finalize is hashing the file; no writes until it's done
+}
+
+// ChunkedUploads tracks in-progress chunked uploads. Uploads are keyed by
+// server-generated IDs and survive client reconnects, so a client can resume
+// from Received after an interruption. Partial files live under dir.
+type ChunkedUploads struct {
+	mu      sync.Mutex
+	dir     string
+	uploads map[string]*chunkedUpload
+	now     func() time.Time
+}
+
+// NewChunkedUploads creates a tracker storing partial files under dir
+// (default: <tmp>/tmux-adapter/partial).
+func NewChunkedUploads(dir string) *ChunkedUploads {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "tmux-adapter", "partial")
+	}
+	return &ChunkedUploads{dir: dir, uploads: make(map[string]*chunkedUpload), now: time.Now}
+}
+
+// Init starts a chunked upload, or resumes the unfinished one for the same
+// agent, file size and checksum.
+func (u *ChunkedUploads) Init(agent, fileName, mimeType string, size int64, sha256Hex string) (ChunkedUpload, error) {
+	sha256Hex = strings.ToLower(strings.TrimSpace(sha256Hex))
+	if _, err := hex.DecodeString(sha256Hex); err != nil || len(sha256Hex) != sha256.Size*2 {
+		return ChunkedUpload{}, errorf(ErrInvalidArgument, "sha256 must be %d hex digits", sha256.Size*2)
+	}
+	if size <= 0 {
+		return ChunkedUpload{}, errorf(ErrInvalidArgument, "size must be between 1 and %d bytes", int64(MaxChunkedUploadBytes))
+	}
+	if size > MaxChunkedUploadBytes {
+		return ChunkedUpload{}, errorf(ErrTooLarge, "size must be between 1 and %d bytes", int64(MaxChunkedUploadBytes))
+	}
+	if strings.TrimSpace(fileName) == "" {
+		fileName = "attachment.bin"
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, up := range u.uploads {
+		if up.Agent == agent && up.Size == size && up.SHA256 == sha256Hex {
+			up.UpdatedAt = u.now()
+			return up.ChunkedUpload, nil
+		}
+	}
+
+	if err := os.MkdirAll(u.dir, 0o700); err != nil {
+		return ChunkedUpload{}, err
+	}
+	id, err := newChunkedUploadID()
+	if err != nil {
+		return ChunkedUpload{}, err
+	}
+	path := filepath.Join(u.dir, id+".part")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return ChunkedUpload{}, err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return ChunkedUpload{}, err
+	}
+
+	up := &chunkedUpload{
+		ChunkedUpload: ChunkedUpload{
+			ID:        id,
+			Agent:     agent,
+			FileName:  fileName,
+			MimeType:  mimeType,
+			Size:      size,
+			SHA256:    sha256Hex,
+			ChunkSize: UploadChunkBytes,
+			UpdatedAt: u.now(),
+		},
+		path: path,
+	}
+	u.uploads[id] = up
+	return up.ChunkedUpload, nil
+}
+
+// WriteChunk writes data at offset. offset may not skip past what has been
+// received; rewriting earlier bytes (a retried chunk) truncates back to offset.
+func (u *ChunkedUploads) WriteChunk(id, agent string, offset int64, data []byte) (ChunkedUpload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	up, ok := u.uploads[id]
+	if !ok || up.Agent != agent {
+		return ChunkedUpload{}, ErrChunkedUploadNotFound
+	}
+	if up.finalizing {
+		return up.ChunkedUpload, errorf(ErrInvalidArgument, "upload %s is being finalized", id)
+	}
+	if offset < 0 || offset > up.Received {
+		return up.ChunkedUpload, errorf(ErrInvalidArgument, "chunk offset %d out of order (received %d)", offset, up.Received)
+	}
+	if offset+int64(len(data)) > up.Size {
+		return up.ChunkedUpload, errorf(ErrInvalidArgument, "chunk at %d (%d bytes) exceeds declared size %d", offset, len(data), up.Size)
+	}
+
+	f, err := os.OpenFile(up.path, os.O_WRONLY, 0o600)
+	if err != nil {
+		return up.ChunkedUpload, err
+	}
+	if err := f.Truncate(offset); err != nil {
+		_ = f.Close()
+		return up.ChunkedUpload, err
+	}
+	if _, err := f.WriteAt(data, offset); err != nil {
+		_ = f.Close()
+		return up.ChunkedUpload, err
+	}
+	if err := f.Close(); err != nil {
+		return up.ChunkedUpload, err
+	}
+	up.Received = offset + int64(len(data))
+	up.UpdatedAt = u.now()
+	return up.ChunkedUpload, nil
+}
+
+// Status returns the upload's state, including how much has been received.
+func (u *ChunkedUploads) Status(id string) (ChunkedUpload, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	up, ok := u.uploads[id]
+	if !ok {
+		return ChunkedUpload{}, ErrChunkedUploadNotFound
+	}
+	return up.ChunkedUpload, nil
+}
+
+// Finalize verifies that the upload is complete and matches its checksum,
+// then hands back the partial file path. The upload is forgotten on success;
+// on a checksum mismatch it is discarded so the client must start over.
+// The file is hashed without holding the tracker lock: the upload is marked
+// finalizing instead, which refuses further chunks and a second Finalize.
+func (u *ChunkedUploads) Finalize(id string) (ChunkedUpload, string, error) {
+	u.mu.Lock()
+	up, ok := u.uploads[id]
+	if !ok {
+		u.mu.Unlock()
+		return ChunkedUpload{}, "", ErrChunkedUploadNotFound
+	}
+	if up.finalizing {
+		u.mu.Unlock()
+		return up.ChunkedUpload, "", errorf(ErrInvalidArgument, "upload %s is already being finalized", id)
+	}
+	if up.Received != up.Size {
+		u.mu.Unlock()
+		return up.ChunkedUpload, "", errorf(ErrInvalidArgument, "upload incomplete: received %d of %d bytes", up.Received, up.Size)
+	}
+	up.finalizing = true
+	u.mu.Unlock()
+
+	got, err := fileSHA256(up.path)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	up.finalizing = false
+	if u.uploads[id] != up {
+		// Aborted while hashing.
+		return up.ChunkedUpload, "", ErrChunkedUploadNotFound
+	}
+	if err != nil {
+		return up.ChunkedUpload, "", err
+	}
+	if got != up.SHA256 {
+		u.removeLocked(up)
+		return up.ChunkedUpload, "", errorf(ErrInvalidArgument, "checksum mismatch: got %s, want %s", got, up.SHA256)
+	}
+	delete(u.uploads, id)
+	return up.ChunkedUpload, up.path, nil
+}
+
+// Requeue puts back a complete upload that Finalize handed out but that
+// could not be stored, so upload-finalize can be retried. It is discarded
+// by Abort or Expire like any other upload.
+func (u *ChunkedUploads) Requeue(up ChunkedUpload, path string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	up.UpdatedAt = u.now()
+	u.uploads[up.ID] = &chunkedUpload{ChunkedUpload: up, path: path}
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Abort discards an upload and its partial file.
+func (u *ChunkedUploads) Abort(id string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	up, ok := u.uploads[id]
+	if !ok {
+		return ErrChunkedUploadNotFound
+	}
+	u.removeLocked(up)
+	return nil
+}
+
+// Expire discards uploads idle for longer than ChunkedUploadIdleTimeout.
+func (u *ChunkedUploads) Expire() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	cutoff := u.now().Add(-ChunkedUploadIdleTimeout)
+	for _, up := range u.uploads {
+		if up.UpdatedAt.Before(cutoff) && !up.finalizing {
+			u.removeLocked(up)
+		}
+	}
+}
+
+func (u *ChunkedUploads) removeLocked(up *chunkedUpload) {
+	delete(u.uploads, up.ID)
+	if err := os.Remove(up.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("chunked upload %s: remove %s: %v", up.ID, up.path, err)
+	}
+}
+
+func newChunkedUploadID() (string, error) {
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "u" + hex.EncodeToString(b[:]), nil
+}
+
+// ParseUploadChunkPayload parses a 0x06 chunk payload.
+// Format: uploadId + \0 + offset (decimal) + \0 + chunkBytes
+func ParseUploadChunkPayload(payload []byte) (id string, offset int64, data []byte, err error) {
+	first := bytes.IndexByte(payload, 0)
+	if first < 0 {
+		return "", 0, nil, errorf(ErrInvalidArgument, "invalid chunk payload: missing upload ID separator")
+	}
+	secondRel := bytes.IndexByte(payload[first+1:], 0)
+	if secondRel < 0 {
+		return "", 0, nil, errorf(ErrInvalidArgument, "invalid chunk payload: missing offset separator")
+	}
+	second := first + 1 + secondRel
+
+	id = string(payload[:first])
+	if id == "" {
+		return "", 0, nil, errorf(ErrInvalidArgument, "invalid chunk payload: empty upload ID")
+	}
+	offset, err = strconv.ParseInt(string(payload[first+1:second]), 10, 64)
+	if err != nil {
+		return "", 0, nil, errorf(ErrInvalidArgument, "invalid chunk payload: bad offset: %w", err)
+	}
+	return id, offset, payload[second+1:], nil
+}
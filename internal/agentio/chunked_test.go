@@ -0,0 +1,214 @@
+package agentio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestChunkedUploadResumeAndFinalize(t *testing.T) {
+	chunks := NewChunkedUploads(t.TempDir())
+	data := []byte("0123456789abcdefghij")
+
+	up, err := chunks.Init("hq-agent", "data.bin", "", int64(len(data)), sha256Hex(data))
+	if err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	if up.Received != 0 || up.ChunkSize != UploadChunkBytes {
+		t.Fatalf("Init() = %+v", up)
+	}
+	if _, err := chunks.WriteChunk(up.ID, "hq-agent", 0, data[:8]); err != nil {
+		t.Fatalf("WriteChunk() error: %v", err)
+	}
+
+	// A client reconnecting with the same file resumes the same upload.
+	resumed, err := chunks.Init("hq-agent", "data.bin", "", int64(len(data)), strings.ToUpper(sha256Hex(data)))
+	if err != nil {
+		t.Fatalf("Init() resume error: %v", err)
+	}
+	if resumed.ID != up.ID || resumed.Received != 8 {
+		t.Fatalf("resume = %+v, want id %s received 8", resumed, up.ID)
+	}
+
+	// Retrying an earlier chunk rewinds; skipping ahead is rejected.
+	if _, err := chunks.WriteChunk(up.ID, "hq-agent", 12, data[12:]); err == nil {
+		t.Fatal("WriteChunk() past received offset should fail")
+	}
+	if got, err := chunks.WriteChunk(up.ID, "hq-agent", 4, data[4:12]); err != nil || got.Received != 12 {
+		t.Fatalf("WriteChunk() retry = %+v, err %v", got, err)
+	}
+	if _, _, err := chunks.Finalize(up.ID); err == nil {
+		t.Fatal("Finalize() of incomplete upload should fail")
+	}
+	if _, err := chunks.WriteChunk(up.ID, "hq-agent", 12, data[12:]); err != nil {
+		t.Fatal(err)
+	}
+
+	final, path, err := chunks.Finalize(up.ID)
+	if err != nil {
+		t.Fatalf("Finalize() error: %v", err)
+	}
+	got, _ := os.ReadFile(path)
+	if !bytes.Equal(got, data) || final.Received != final.Size {
+		t.Fatalf("finalized file = %q, upload %+v", got, final)
+	}
+	if _, err := chunks.Status(up.ID); !errors.Is(err, ErrChunkedUploadNotFound) {
+		t.Fatalf("Status() after Finalize err = %v, want ErrChunkedUploadNotFound", err)
+	}
+}
+
+func TestChunkedUploadChecksumMismatchDiscards(t *testing.T) {
+	dir := t.TempDir()
+	chunks := NewChunkedUploads(dir)
+	up, err := chunks.Init("hq-agent", "data.bin", "", 5, sha256Hex([]byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chunks.WriteChunk(up.ID, "hq-agent", 0, []byte("jello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := chunks.Finalize(up.ID); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Finalize() err = %v, want checksum mismatch", err)
+	}
+	if _, err := chunks.Status(up.ID); !errors.Is(err, ErrChunkedUploadNotFound) {
+		t.Fatalf("mismatched upload still tracked: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("partial file left behind: %d entries", len(entries))
+	}
+}
+
+func TestChunkedUploadRejectsOtherAgent(t *testing.T) {
+	chunks := NewChunkedUploads(t.TempDir())
+	up, err := chunks.Init("hq-agent", "data.bin", "", 3, sha256Hex([]byte("abc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chunks.WriteChunk(up.ID, "other-agent", 0, []byte("abc")); !errors.Is(err, ErrChunkedUploadNotFound) {
+		t.Fatalf("WriteChunk() for another agent err = %v", err)
+	}
+	if _, err := chunks.WriteChunk(up.ID, "hq-agent", 0, []byte("abcd")); err == nil {
+		t.Fatal("WriteChunk() beyond declared size should fail")
+	}
+}
+
+func TestFinishChunkedUploadPastesPath(t *testing.T) {
+	fake, p, workDir := newWorkDirPrompter(t, "claude")
+	p.Chunks = NewChunkedUploads(t.TempDir())
+
+	data := bytes.Repeat([]byte("log line\n"), (MaxFileUploadBytes/9)+1)
+	up, err := p.Chunks.Init("hq-agent", "big.log", "text/plain", int64(len(data)), sha256Hex(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for off := 0; off < len(data); off += up.ChunkSize {
+		end := min(off+up.ChunkSize, len(data))
+		if _, err := p.Chunks.WriteChunk(up.ID, "hq-agent", int64(off), data[off:end]); err != nil {
+			t.Fatalf("WriteChunk(%d) error: %v", off, err)
+		}
+	}
+
+	result, err := p.FinishChunkedUpload(up.ID, "10.0.0.5:1")
+	if err != nil {
+		t.Fatalf("FinishChunkedUpload() error: %v", err)
+	}
+	if result.Action != PastePath || result.Category != FileText {
+		t.Fatalf("result = %+v, want a text file pasted as a path", result)
+	}
+	record := result.Upload
+	if record.Size != int64(len(data)) || record.SHA256 != up.SHA256 {
+		t.Fatalf("record = %+v", record)
+	}
+	if !strings.HasPrefix(record.Path, filepath.Join(workDir, ".tmux-adapter", "uploads")) {
+		t.Fatalf("stored at %s", record.Path)
+	}
+	calls := fake.Calls()
+	if len(calls) == 0 || !strings.HasPrefix(calls[0], "paste hq-agent ") || strings.Contains(calls[0], "log line") {
+		t.Fatalf("expected a path paste, got calls %v", calls)
+	}
+}
+
+func TestParseUploadChunkPayload(t *testing.T) {
+	id, offset, data, err := ParseUploadChunkPayload([]byte("uabc\x001048576\x00\x00bytes"))
+	if err != nil {
+		t.Fatalf("ParseUploadChunkPayload() error: %v", err)
+	}
+	if id != "uabc" || offset != 1048576 || string(data) != "\x00bytes" {
+		t.Fatalf("got id %q offset %d data %q", id, offset, data)
+	}
+
+	for _, payload := range []string{"uabc", "uabc\x0012", "\x000\x00x", "uabc\x00x\x00y"} {
+		if _, _, _, err := ParseUploadChunkPayload([]byte(payload)); err == nil {
+			t.Errorf("ParseUploadChunkPayload(%q) should fail", payload)
+		}
+	}
+}
+
+func TestChunkedUploadFinalizingRefusesChunks(t *testing.T) {
+	chunks := NewChunkedUploads(t.TempDir())
+	up, err := chunks.Init("hq-agent", "data.bin", "", 3, sha256Hex([]byte("abc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chunks.WriteChunk(up.ID, "hq-agent", 0, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+
+	// While Finalize hashes, the tracker stays usable but the upload is frozen.
+	chunks.uploads[up.ID].finalizing = true
+	if _, err := chunks.Status(up.ID); err != nil {
+		t.Fatalf("Status() during finalize: %v", err)
+	}
+	if _, err := chunks.WriteChunk(up.ID, "hq-agent", 0, []byte("xyz")); err == nil {
+		t.Fatal("WriteChunk() during finalize should fail")
+	}
+	if _, _, err := chunks.Finalize(up.ID); err == nil {
+		t.Fatal("second Finalize() should fail")
+	}
+	chunks.uploads[up.ID].finalizing = false
+
+	if _, _, err := chunks.Finalize(up.ID); err != nil {
+		t.Fatalf("Finalize() error: %v", err)
+	}
+}
+
+func TestFinishChunkedUploadKeepsFileWhenSaveFails(t *testing.T) {
+	_, p, _ := newWorkDirPrompter(t, "claude")
+	p.Chunks = NewChunkedUploads(t.TempDir())
+	p.Uploads.SetPolicy(UploadPolicy{MaxBytesPerAgent: 4})
+
+	data := []byte("more than four bytes")
+	up, err := p.Chunks.Init("hq-agent", "notes.txt", "text/plain", int64(len(data)), sha256Hex(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Chunks.WriteChunk(up.ID, "hq-agent", 0, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.FinishChunkedUpload(up.ID, ""); err == nil {
+		t.Fatal("FinishChunkedUpload() over quota = nil error")
+	}
+	status, err := p.Chunks.Status(up.ID)
+	if err != nil || status.Received != status.Size {
+		t.Fatalf("upload after failed save = %+v, %v; want it kept for a retry", status, err)
+	}
+
+	p.Uploads.SetPolicy(UploadPolicy{})
+	if _, err := p.FinishChunkedUpload(up.ID, ""); err != nil {
+		t.Fatalf("retried FinishChunkedUpload() error: %v", err)
+	}
+	if entries, _ := os.ReadDir(p.Chunks.dir); len(entries) != 0 {
+		t.Fatalf("partial file left behind after retry: %d entries", len(entries))
+	}
+}
@@ -0,0 +1,520 @@
+package agentio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+// Slash command sources.
+const (
+	CommandSourceBuiltin = "builtin"
+	CommandSourceUser    = "user"
+	CommandSourceProject = "project"
+)
+
+const (
+	// maxCommandsPerDir bounds how many custom commands are read from one directory tree.
+	maxCommandsPerDir = 500
+	// commandHeaderBytes is how much of each command file is read for its metadata.
+	commandHeaderBytes = 4 * 1024
+	// maxCommandDescription bounds descriptions taken from a command body.
+	maxCommandDescription = 120
+
+	commandSubscriberBufferSize = 100
+)
+
+// SlashCommand is one /command an agent accepts.
+type SlashCommand struct {
+	Name         string `json:"name"` // without the leading slash, e.g. "review" or "git:commit"
+	Description  string `json:"description,omitempty"`
+	ArgumentHint string `json:"argumentHint,omitempty"`
+	Source       string `json:"source"`         // "builtin", "user" or "project"
+	Path         string `json:"path,omitempty"` // command file for custom commands
+}
+
+// commandDirs describes where a runtime keeps custom commands.
+type commandDirs struct {
+	user    []string // relative to the home directory
+	project []string // relative to the agent's workDir
+	ext     string   // command file extension
+	prefix  string   // prepended to custom command names
+}
+
+// runtimeCommandDirs maps runtimes to their custom command locations.
+// Subdirectories namespace commands with ':' (git/commit.md -> git:commit).
+var runtimeCommandDirs = map[string]commandDirs{
+	"claude":   {user: []string{".claude/commands"}, project: []string{".claude/commands"}, ext: ".md"},
+	"gemini":   {user: []string{".gemini/commands"}, project: []string{".gemini/commands"}, ext: ".toml"},
+	"codex":    {user: []string{".codex/prompts"}, ext: ".md", prefix: "prompts:"},
+	"cursor":   {user: []string{".cursor/commands"}, project: []string{".cursor/commands"}, ext: ".md"},
+	"auggie":   {user: []string{".augment/commands"}, project: []string{".augment/commands"}, ext: ".md"},
+	"amp":      {user: []string{".config/amp/commands"}, project: []string{".agents/commands"}, ext: ".md"},
+	"opencode": {user: []string{".config/opencode/command"}, project: []string{".opencode/command"}, ext: ".md"},
+}
+
+// builtinCommands lists each runtime's built-in slash commands.
+var builtinCommands = map[string][]SlashCommand{
+	"claude": {
+		{Name: "add-dir", Description: "Add a working directory", ArgumentHint: "<path>"},
+		{Name: "agents", Description: "Manage subagents"},
+		{Name: "clear", Description: "Clear conversation history"},
+		{Name: "compact", Description: "Compact the conversation", ArgumentHint: "[instructions]"},
+		{Name: "config", Description: "Open settings"},
+		{Name: "context", Description: "Show context usage"},
+		{Name: "cost", Description: "Show token usage and cost"},
+		{Name: "doctor", Description: "Check the installation"},
+		{Name: "export", Description: "Export the conversation", ArgumentHint: "[filename]"},
+		{Name: "help", Description: "Show help"},
+		{Name: "hooks", Description: "Manage hooks"},
+		{Name: "init", Description: "Create a CLAUDE.md for the project"},
+		{Name: "mcp", Description: "Manage MCP servers"},
+		{Name: "memory", Description: "Edit memory files"},
+		{Name: "model", Description: "Change the model", ArgumentHint: "[model]"},
+		{Name: "permissions", Description: "Manage tool permissions"},
+		{Name: "resume", Description: "Resume a conversation"},
+		{Name: "review", Description: "Review a pull request"},
+		{Name: "status", Description: "Show status"},
+		{Name: "vim", Description: "Toggle vim mode"},
+	},
+	"codex": {
+		{Name: "approvals", Description: "Choose what Codex may do without approval"},
+		{Name: "compact", Description: "Summarize the conversation"},
+		{Name: "diff", Description: "Show the git diff"},
+		{Name: "init", Description: "Create an AGENTS.md for the project"},
+		{Name: "mcp", Description: "List MCP tools"},
+		{Name: "mention", Description: "Mention a file", ArgumentHint: "<path>"},
+		{Name: "model", Description: "Choose the model and reasoning effort"},
+		{Name: "new", Description: "Start a new chat"},
+		{Name: "quit", Description: "Exit Codex"},
+		{Name: "review", Description: "Review current changes"},
+		{Name: "status", Description: "Show session configuration and token usage"},
+	},
+	"gemini": {
+		{Name: "about", Description: "Show version info"},
+		{Name: "chat", Description: "Save, resume or list conversation checkpoints", ArgumentHint: "<save|resume|list> [tag]"},
+		{Name: "clear", Description: "Clear the screen and history"},
+		{Name: "compress", Description: "Replace the context with a summary"},
+		{Name: "copy", Description: "Copy the last output"},
+		{Name: "directory", Description: "Manage workspace directories", ArgumentHint: "<add|show> [path]"},
+		{Name: "help", Description: "Show help"},
+		{Name: "init", Description: "Create a GEMINI.md for the project"},
+		{Name: "mcp", Description: "List MCP servers and tools"},
+		{Name: "memory", Description: "Manage instructional context", ArgumentHint: "<add|show|refresh>"},
+		{Name: "quit", Description: "Exit Gemini CLI"},
+		{Name: "restore", Description: "Restore files to a checkpoint", ArgumentHint: "[tool_call_id]"},
+		{Name: "settings", Description: "Open settings"},
+		{Name: "stats", Description: "Show session statistics"},
+		{Name: "tools", Description: "List available tools"},
+	},
+	"cursor": {
+		{Name: "clear", Description: "Start a new chat"},
+		{Name: "help", Description: "Show help"},
+		{Name: "model", Description: "Change the model", ArgumentHint: "[model]"},
+		{Name: "quit", Description: "Exit"},
+	},
+	"auggie": {
+		{Name: "clear", Description: "Clear conversation history"},
+		{Name: "help", Description: "Show help"},
+		{Name: "new", Description: "Start a new conversation"},
+		{Name: "exit", Description: "Exit Auggie"},
+	},
+	"amp": {
+		{Name: "help", Description: "Show help"},
+		{Name: "new", Description: "Start a new thread"},
+		{Name: "quit", Description: "Exit Amp"},
+	},
+	"opencode": {
+		{Name: "compact", Description: "Compact the session"},
+		{Name: "exit", Description: "Exit opencode"},
+		{Name: "help", Description: "Show help"},
+		{Name: "init", Description: "Create an AGENTS.md for the project"},
+		{Name: "models", Description: "List models"},
+		{Name: "new", Description: "Start a new session"},
+		{Name: "sessions", Description: "List sessions"},
+		{Name: "undo", Description: "Undo the last message"},
+	},
+}
+
+// commandRoot is one custom command directory for an agent.
+type commandRoot struct {
+	dir    string
+	source string
+}
+
+type commandCacheEntry struct {
+	runtime  string
+	workDir  string
+	roots    []commandRoot
+	commands []SlashCommand
+}
+
+// CommandCatalog discovers the slash commands each agent accepts: the
+// runtime's built-ins plus custom command files in user- and project-level
+// directories. Results are cached per agent and invalidated by fsnotify when
+// command files change; subscribers are told which agent's list changed.
+type CommandCatalog struct {
+	registry *agents.Registry
+	home     string
+
+	mu      sync.Mutex
+	cache   map[string]*commandCacheEntry // agent name -> cached commands
+	watcher *fsnotify.Watcher
+	watched map[string]bool
+
+	subs      map[int]chan string
+	nextSubID int
+}
+
+// NewCommandCatalog creates a catalog for the registry's agents. home
+// defaults to $HOME.
+func NewCommandCatalog(registry *agents.Registry, home string) *CommandCatalog {
+	if home == "" {
+		home = os.Getenv("HOME")
+	}
+	return &CommandCatalog{
+		registry: registry,
+		home:     home,
+		cache:    make(map[string]*commandCacheEntry),
+		watched:  make(map[string]bool),
+		subs:     make(map[int]chan string),
+	}
+}
+
+// Commands returns the agent's slash commands sorted by name. A project
+// command shadows a user command of the same name, and both shadow built-ins.
+func (c *CommandCatalog) Commands(agentName string) ([]SlashCommand, error) {
+	agent, ok := c.registry.GetAgent(agentName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.cache[agentName]; ok && entry.runtime == agent.Runtime && entry.workDir == agent.WorkDir {
+		return entry.commands, nil
+	}
+
+	roots := c.commandRoots(agent)
+	commands := scanCommands(agent.Runtime, roots)
+	c.cache[agentName] = &commandCacheEntry{
+		runtime:  agent.Runtime,
+		workDir:  agent.WorkDir,
+		roots:    roots,
+		commands: commands,
+	}
+	c.watchRootsLocked(roots)
+	return commands, nil
+}
+
+// Subscribe returns a channel receiving the names of agents whose command
+// list changed since it was last listed.
+func (c *CommandCatalog) Subscribe() (int, <-chan string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextSubID
+	c.nextSubID++
+	ch := make(chan string, commandSubscriberBufferSize)
+	c.subs[id] = ch
+	return id, ch
+}
+
+// Unsubscribe removes a subscriber and closes its channel.
+func (c *CommandCatalog) Unsubscribe(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ch, ok := c.subs[id]; ok {
+		delete(c.subs, id)
+		close(ch)
+	}
+}
+
+// Close stops watching command directories.
+func (c *CommandCatalog) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watcher != nil {
+		if err := c.watcher.Close(); err != nil {
+			log.Printf("commands: close watcher: %v", err)
+		}
+		c.watcher = nil
+	}
+}
+
+// commandRoots returns the custom command directories for an agent, project first.
+func (c *CommandCatalog) commandRoots(agent agents.Agent) []commandRoot {
+	dirs, ok := runtimeCommandDirs[agent.Runtime]
+	if !ok {
+		return nil
+	}
+	var roots []commandRoot
+	if agent.WorkDir != "" {
+		for _, rel := range dirs.project {
+			roots = append(roots, commandRoot{dir: filepath.Join(agent.WorkDir, rel), source: CommandSourceProject})
+		}
+	}
+	if c.home != "" {
+		for _, rel := range dirs.user {
+			roots = append(roots, commandRoot{dir: filepath.Join(c.home, rel), source: CommandSourceUser})
+		}
+	}
+	return roots
+}
+
+// watchRootsLocked watches every directory under each root, or the nearest
+// existing ancestor of a missing root so its creation is noticed.
+func (c *CommandCatalog) watchRootsLocked(roots []commandRoot) {
+	if c.watcher == nil {
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Printf("commands: fsnotify unavailable, lists will not refresh: %v", err)
+			return
+		}
+		c.watcher = w
+		go c.watchLoop(w)
+	}
+
+	for _, root := range roots {
+		dir := root.dir
+		for {
+			if _, err := os.Stat(dir); err == nil {
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+		if dir != root.dir {
+			c.addWatchLocked(dir)
+			continue
+		}
+		err := filepath.WalkDir(root.dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Printf("commands: watch %s: %v", path, err)
+				return nil
+			}
+			if d.IsDir() {
+				c.addWatchLocked(path)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("commands: watch %s: %v", root.dir, err)
+		}
+	}
+}
+
+func (c *CommandCatalog) addWatchLocked(dir string) {
+	if c.watched[dir] {
+		return
+	}
+	if err := c.watcher.Add(dir); err != nil {
+		log.Printf("commands: watch %s: %v", dir, err)
+		return
+	}
+	c.watched[dir] = true
+}
+
+func (c *CommandCatalog) watchLoop(w *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			c.invalidate(event.Name)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("commands: watcher error: %v", err)
+		}
+	}
+}
+
+// invalidate drops cached lists for agents with a command root containing
+// path (or path itself being a root or one of its ancestors) and notifies
+// subscribers.
+func (c *CommandCatalog) invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, entry := range c.cache {
+		for _, root := range entry.roots {
+			if pathWithin(path, root.dir) || pathWithin(root.dir, path) {
+				delete(c.cache, name)
+				for _, ch := range c.subs {
+					select {
+					case ch <- name:
+					default:
+					}
+				}
+				break
+			}
+		}
+	}
+}
+
+// pathWithin reports whether path is dir or inside it.
+func pathWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// scanCommands merges a runtime's built-ins with the custom commands under
+// roots. Earlier roots take precedence.
+func scanCommands(runtime string, roots []commandRoot) []SlashCommand {
+	byName := make(map[string]SlashCommand)
+	for _, cmd := range builtinCommands[runtime] {
+		cmd.Source = CommandSourceBuiltin
+		byName[cmd.Name] = cmd
+	}
+	dirs := runtimeCommandDirs[runtime]
+	for i := len(roots) - 1; i >= 0; i-- {
+		for _, cmd := range scanCommandDir(roots[i], dirs) {
+			byName[cmd.Name] = cmd
+		}
+	}
+
+	commands := make([]SlashCommand, 0, len(byName))
+	for _, cmd := range byName {
+		commands = append(commands, cmd)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// scanCommandDir reads the command files under one root.
+func scanCommandDir(root commandRoot, dirs commandDirs) []SlashCommand {
+	var commands []SlashCommand
+	err := filepath.WalkDir(root.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Most agents have no command directories at all.
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("commands: scan %s: %v", path, err)
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root.dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), dirs.ext) {
+			return nil
+		}
+		if len(commands) >= maxCommandsPerDir {
+			return filepath.SkipAll
+		}
+
+		rel, err := filepath.Rel(root.dir, path)
+		if err != nil {
+			return nil
+		}
+		rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+		cmd := SlashCommand{
+			Name:   dirs.prefix + strings.ReplaceAll(filepath.ToSlash(rel), "/", ":"),
+			Source: root.source,
+			Path:   path,
+		}
+		cmd.Description, cmd.ArgumentHint = readCommandHeader(path, dirs.ext)
+		commands = append(commands, cmd)
+		return nil
+	})
+	if err != nil {
+		log.Printf("commands: scan %s: %v", root.dir, err)
+	}
+	return commands
+}
+
+// readCommandHeader extracts the description and argument hint from the
+// start of a command file: YAML frontmatter (description, argument-hint) for
+// Markdown, top-level description for TOML. Markdown without a description
+// falls back to its first line of text.
+func readCommandHeader(path, ext string) (description, argumentHint string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", ""
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(io.LimitReader(f, commandHeaderBytes))
+	if ext == ".toml" {
+		for scanner.Scan() {
+			if key, value, ok := splitHeaderLine(scanner.Text(), "="); ok && key == "description" {
+				return value, ""
+			}
+		}
+		return "", ""
+	}
+
+	inFrontmatter := false
+	first := true
+	var firstLine string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			first = false
+			if line == "---" {
+				inFrontmatter = true
+				continue
+			}
+		}
+		if inFrontmatter {
+			if line == "---" {
+				inFrontmatter = false
+				continue
+			}
+			if key, value, ok := splitHeaderLine(line, ":"); ok {
+				switch key {
+				case "description":
+					description = value
+				case "argument-hint":
+					argumentHint = value
+				}
+			}
+			continue
+		}
+		if firstLine == "" && line != "" {
+			firstLine = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+		if description != "" || firstLine != "" {
+			break
+		}
+	}
+	if description == "" {
+		description = firstLine
+	}
+	if runes := []rune(description); len(runes) > maxCommandDescription {
+		description = string(runes[:maxCommandDescription-1]) + "…"
+	}
+	return description, argumentHint
+}
+
+// splitHeaderLine splits "key<sep> value" and unquotes the value.
+func splitHeaderLine(line, sep string) (key, value string, ok bool) {
+	key, value, ok = strings.Cut(line, sep)
+	if !ok {
+		return "", "", false
+	}
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return key, value, true
+}
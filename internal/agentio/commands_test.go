@@ -0,0 +1,117 @@
+package agentio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newCommandTestCatalog builds a catalog over one agent whose workDir and
+// home are temp directories.
+func newCommandTestCatalog(t *testing.T, runtime string) (catalog *CommandCatalog, home, workDir string) {
+	t.Helper()
+	_, p, workDir := newWorkDirPrompter(t, runtime)
+	home = t.TempDir()
+	catalog = NewCommandCatalog(p.Registry, home)
+	t.Cleanup(catalog.Close)
+	return catalog, home, workDir
+}
+
+func findCommand(commands []SlashCommand, name string) (SlashCommand, bool) {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return SlashCommand{}, false
+}
+
+func TestCommandCatalogMergesBuiltinUserAndProject(t *testing.T) {
+	catalog, home, workDir := newCommandTestCatalog(t, "claude")
+	writeFile(t, filepath.Join(home, ".claude/commands/deploy.md"), "---\ndescription: Deploy the app\nargument-hint: \"[env]\"\n---\nDeploy to $ARGUMENTS\n")
+	writeFile(t, filepath.Join(home, ".claude/commands/shared.md"), "User version\n")
+	writeFile(t, filepath.Join(workDir, ".claude/commands/shared.md"), "# Project version\n\nbody\n")
+	writeFile(t, filepath.Join(workDir, ".claude/commands/frontend/lint.md"), "Lint the frontend\n")
+	writeFile(t, filepath.Join(workDir, ".claude/commands/notes.txt"), "not a command")
+
+	commands, err := catalog.Commands("hq-agent")
+	if err != nil {
+		t.Fatalf("Commands() error: %v", err)
+	}
+
+	checks := []SlashCommand{
+		{Name: "compact", Source: CommandSourceBuiltin, ArgumentHint: "[instructions]"},
+		{Name: "deploy", Source: CommandSourceUser, Description: "Deploy the app", ArgumentHint: "[env]"},
+		{Name: "shared", Source: CommandSourceProject, Description: "Project version"},
+		{Name: "frontend:lint", Source: CommandSourceProject, Description: "Lint the frontend"},
+	}
+	for _, want := range checks {
+		got, ok := findCommand(commands, want.Name)
+		if !ok {
+			t.Fatalf("command %q missing from %+v", want.Name, commands)
+		}
+		if got.Source != want.Source || got.ArgumentHint != want.ArgumentHint || (want.Description != "" && got.Description != want.Description) {
+			t.Fatalf("command %q = %+v, want %+v", want.Name, got, want)
+		}
+	}
+	if _, ok := findCommand(commands, "notes"); ok {
+		t.Fatal("non-command file listed")
+	}
+}
+
+func TestCommandCatalogGeminiToml(t *testing.T) {
+	catalog, home, _ := newCommandTestCatalog(t, "gemini")
+	writeFile(t, filepath.Join(home, ".gemini/commands/git/commit.toml"), "description = \"Write a commit message\"\nprompt = \"...\"\n")
+
+	commands, err := catalog.Commands("hq-agent")
+	if err != nil {
+		t.Fatalf("Commands() error: %v", err)
+	}
+	got, ok := findCommand(commands, "git:commit")
+	if !ok || got.Description != "Write a commit message" || got.Source != CommandSourceUser {
+		t.Fatalf("git:commit = %+v (found %v)", got, ok)
+	}
+}
+
+func TestCommandCatalogRefreshesOnChange(t *testing.T) {
+	catalog, _, workDir := newCommandTestCatalog(t, "claude")
+	_, changes := catalog.Subscribe()
+
+	if _, err := catalog.Commands("hq-agent"); err != nil {
+		t.Fatalf("Commands() error: %v", err)
+	}
+	// The commands directory does not exist yet; creating it must be noticed.
+	writeFile(t, filepath.Join(workDir, ".claude/commands/ship.md"), "Ship it\n")
+
+	select {
+	case name := <-changes:
+		if name != "hq-agent" {
+			t.Fatalf("changed agent = %q", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for commands change")
+	}
+	waitFor(t, func() bool {
+		commands, _ := catalog.Commands("hq-agent")
+		_, ok := findCommand(commands, "ship")
+		return ok
+	})
+}
+
+func TestCommandCatalogUnknownAgent(t *testing.T) {
+	catalog, _, _ := newCommandTestCatalog(t, "claude")
+	if _, err := catalog.Commands("nope"); err == nil {
+		t.Fatal("expected error for unknown agent")
+	}
+}
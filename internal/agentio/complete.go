@@ -0,0 +1,134 @@
+package agentio
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxPathCompletions bounds the number of entries complete-path returns.
+	MaxPathCompletions = 50
+	// maxCompletionScan bounds how many entries matching the prefix are
+	// examined (stat, .gitignore) before ranking.
+	maxCompletionScan = 5000
+)
+
+// PathCompletion is one candidate for an @file mention.
+type PathCompletion struct {
+	Path    string    `json:"path"` // as the user would type it; directories end in '/'
+	Dir     bool      `json:"dir,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// CompletePath completes a partial path against the agent pane's current
+// working directory. Entries ignored by .gitignore (and .git) are skipped,
+// hidden entries are offered only when the partial name starts with '.',
+// and the most recently modified entries come first. Paths outside the
+// agent's workDir are rejected before touching the filesystem, and a missing
+// directory gets the same error, so completion can't probe the host.
+func (p *Prompter) CompletePath(agentName, partial string) ([]PathCompletion, error) {
+	agent, ok := p.Registry.GetAgent(agentName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
+	}
+	root, err := filepath.EvalSymlinks(agent.WorkDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve workDir: %w", err)
+	}
+
+	// The pane may have cd'd elsewhere; completion follows it while it stays
+	// inside the workDir.
+	cwd := root
+	if info, err := p.Ctrl.GetPaneInfo(agentName); err == nil && info.WorkDir != "" {
+		if resolved, err := filepath.EvalSymlinks(info.WorkDir); err == nil && pathWithin(resolved, root) {
+			cwd = resolved
+		}
+	}
+
+	partial = strings.TrimPrefix(partial, "@")
+	typedDir, prefix := "", partial
+	if i := strings.LastIndex(partial, "/"); i >= 0 {
+		typedDir, prefix = partial[:i+1], partial[i+1:]
+	}
+
+	denied := errorf(ErrFileDenied, "path not found or outside agent workDir: %s", partial)
+	dir := cwd
+	if typedDir != "" {
+		if filepath.IsAbs(typedDir) {
+			dir = filepath.Clean(typedDir)
+		} else {
+			dir = filepath.Join(cwd, typedDir)
+		}
+	}
+	if !pathWithin(dir, root) && !pathWithin(dir, filepath.Clean(agent.WorkDir)) {
+		return nil, denied
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil || !pathWithin(resolved, root) {
+		return nil, denied
+	}
+
+	entries, err := os.ReadDir(resolved)
+	if err != nil {
+		return nil, denied
+	}
+
+	ignore := loadGitIgnore(root, resolved)
+	relDir, _ := filepath.Rel(root, resolved)
+	relDir = filepath.ToSlash(relDir)
+
+	lowerPrefix := strings.ToLower(prefix)
+	showHidden := strings.HasPrefix(prefix, ".")
+	results := []PathCompletion{}
+	scanned := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(strings.ToLower(name), lowerPrefix) {
+			continue
+		}
+		if strings.HasPrefix(name, ".") && !showHidden {
+			continue
+		}
+		if scanned++; scanned > maxCompletionScan {
+			break
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(filepath.Join(resolved, name)); err == nil {
+				isDir = target.IsDir()
+			}
+		}
+		if ignore.Ignored(path.Join(relDir, name), isDir) {
+			continue
+		}
+
+		c := PathCompletion{Path: typedDir + name, Dir: isDir, ModTime: info.ModTime()}
+		if isDir {
+			c.Path += "/"
+		} else {
+			c.Size = info.Size()
+		}
+		results = append(results, c)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].ModTime.Equal(results[j].ModTime) {
+			return results[i].ModTime.After(results[j].ModTime)
+		}
+		return results[i].Path < results[j].Path
+	})
+	if len(results) > MaxPathCompletions {
+		results = results[:MaxPathCompletions]
+	}
+	return results, nil
+}
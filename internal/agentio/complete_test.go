@@ -0,0 +1,154 @@
+package agentio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+// newWorkDirPrompter builds a Prompter over one agent of the given runtime
+// whose workDir is a temp directory.
+func newWorkDirPrompter(t *testing.T, runtime string) (*fakeTmux, *Prompter, string) {
+	t.Helper()
+	workDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", runtime, true)
+	pane := fake.panes["hq-agent"]
+	pane.WorkDir = workDir
+	fake.panes["hq-agent"] = pane
+
+	// No town root: the temp workDir lives outside /tmp/gt.
+	registry := agents.NewRegistry(fake, "", nil)
+	if err := registry.Start(); err != nil {
+		t.Fatalf("registry Start() error: %v", err)
+	}
+	t.Cleanup(registry.Stop)
+	return fake, NewPrompter(fake, registry), workDir
+}
+
+func completionPaths(results []PathCompletion) []string {
+	paths := make([]string, len(results))
+	for i, r := range results {
+		paths[i] = r.Path
+	}
+	return paths
+}
+
+func TestCompletePathRanksRecentAndRespectsGitignore(t *testing.T) {
+	_, p, workDir := newWorkDirPrompter(t, "claude")
+	writeFile(t, filepath.Join(workDir, ".gitignore"), "*.log\n")
+	writeFile(t, filepath.Join(workDir, "src/old.go"), "package src")
+	writeFile(t, filepath.Join(workDir, "src/new.go"), "package src")
+	writeFile(t, filepath.Join(workDir, "src/debug.log"), "noise")
+	writeFile(t, filepath.Join(workDir, "src/sub/x.go"), "package sub")
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(workDir, "src/old.go"), past, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(workDir, "src/sub"), past.Add(-time.Hour), past.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := p.CompletePath("hq-agent", "@src/")
+	if err != nil {
+		t.Fatalf("CompletePath() error: %v", err)
+	}
+	got := strings.Join(completionPaths(results), ",")
+	if got != "src/new.go,src/old.go,src/sub/" {
+		t.Fatalf("completions = %s", got)
+	}
+	if !results[2].Dir || results[0].Size == 0 {
+		t.Fatalf("unexpected metadata: %+v", results)
+	}
+}
+
+func TestCompletePathPrefixAndHidden(t *testing.T) {
+	_, p, workDir := newWorkDirPrompter(t, "claude")
+	writeFile(t, filepath.Join(workDir, "README.md"), "hi")
+	writeFile(t, filepath.Join(workDir, "Makefile"), "all:")
+	writeFile(t, filepath.Join(workDir, ".env"), "X=1")
+
+	results, _ := p.CompletePath("hq-agent", "re")
+	if got := strings.Join(completionPaths(results), ","); got != "README.md" {
+		t.Fatalf("completions for 're' = %s", got)
+	}
+	results, _ = p.CompletePath("hq-agent", "")
+	for _, r := range results {
+		if r.Path == ".env" {
+			t.Fatal("hidden file offered without a '.' prefix")
+		}
+	}
+	results, _ = p.CompletePath("hq-agent", ".e")
+	if got := strings.Join(completionPaths(results), ","); got != ".env" {
+		t.Fatalf("completions for '.e' = %s", got)
+	}
+}
+
+func TestCompletePathFollowsPaneCwd(t *testing.T) {
+	fake, p, workDir := newWorkDirPrompter(t, "claude")
+	writeFile(t, filepath.Join(workDir, "pkg/api.go"), "package pkg")
+	writeFile(t, filepath.Join(workDir, "top.go"), "package main")
+
+	// The registry snapshot keeps the original workDir; the pane has moved.
+	pane := fake.panes["hq-agent"]
+	pane.WorkDir = filepath.Join(workDir, "pkg")
+	fake.panes["hq-agent"] = pane
+
+	results, err := p.CompletePath("hq-agent", "a")
+	if err != nil || strings.Join(completionPaths(results), ",") != "api.go" {
+		t.Fatalf("completions = %v, err %v", completionPaths(results), err)
+	}
+	results, err = p.CompletePath("hq-agent", "../t")
+	if err != nil || strings.Join(completionPaths(results), ",") != "../top.go" {
+		t.Fatalf("completions = %v, err %v", completionPaths(results), err)
+	}
+}
+
+func TestCompletePathBlocksTraversal(t *testing.T) {
+	_, p, workDir := newWorkDirPrompter(t, "claude")
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(workDir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, partial := range []string{"../", "/etc/", "escape/"} {
+		if _, err := p.CompletePath("hq-agent", partial); err == nil {
+			t.Errorf("CompletePath(%q) = nil error, want traversal error", partial)
+		}
+	}
+
+	// Existing and missing paths outside the workDir get the same error.
+	for _, partial := range []string{outside + "/", outside + "/no-such-dir/", "escape/", "escape/no-such-dir/"} {
+		_, err := p.CompletePath("hq-agent", partial)
+		if !errors.Is(err, ErrFileDenied) || err.Error() != "path not found or outside agent workDir: "+partial {
+			t.Errorf("CompletePath(%q) error = %v, want the shared denial", partial, err)
+		}
+	}
+}
+
+func TestCompletePathFiltersBeforeScanLimit(t *testing.T) {
+	_, p, workDir := newWorkDirPrompter(t, "claude")
+	for i := range maxCompletionScan + 10 {
+		if err := os.WriteFile(filepath.Join(workDir, fmt.Sprintf("a%05d", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Sorts after every a* entry.
+	if err := os.WriteFile(filepath.Join(workDir, "zebra.go"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := p.CompletePath("hq-agent", "z")
+	if err != nil || strings.Join(completionPaths(results), ",") != "zebra.go" {
+		t.Fatalf("completions = %v, err %v", completionPaths(results), err)
+	}
+}
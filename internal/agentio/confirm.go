@@ -0,0 +1,202 @@
+package agentio
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Delivery statuses reported by SendPromptConfirmed.
+const (
+	DeliveryDelivered = "delivered" // the agent accepted the prompt
+	DeliveryPending   = "pending"   // keys were sent but acceptance was not observed before the timeout
+	DeliveryFailed    = "failed"    // the prompt could not be sent
+)
+
+// Delivery evidence sources.
+const (
+	DeliverySourcePane         = "pane"
+	DeliverySourceConversation = "conversation"
+)
+
+const (
+	// DefaultConfirmTimeout is used when a confirm request gives no timeout.
+	DefaultConfirmTimeout = 10 * time.Second
+	// MaxConfirmTimeout caps how long a confirm request may hold the agent lock.
+	MaxConfirmTimeout = 60 * time.Second
+
+	confirmPollInterval = 200 * time.Millisecond
+	// inputRegionLines is how many trailing non-empty screen lines are treated
+	// as the agent's input area (box top, input, box bottom, status line).
+	inputRegionLines = 4
+	// promptNeedleRunes is how much of the prompt's last line is matched on screen.
+	promptNeedleRunes = 40
+)
+
+// DeliveryResult describes whether a prompt was accepted and why we think so.
+type DeliveryResult struct {
+	Status    string `json:"status"`
+	Source    string `json:"source,omitempty"`
+	Evidence  string `json:"evidence,omitempty"`
+	ElapsedMs int64  `json:"elapsedMs"`
+}
+
+// PromptEchoWatcher watches a structured source, such as a conversation
+// buffer, for the agent recording a submitted prompt as a user event.
+type PromptEchoWatcher interface {
+	// WatchPromptEcho starts watching for a user event matching prompt. The
+	// returned channel yields evidence once a match is seen; stop releases
+	// resources. ok is false when the agent has no structured source.
+	WatchPromptEcho(agentName, prompt string) (evidence <-chan string, stop func(), ok bool)
+}
+
+// ConfirmTimeout converts a client-supplied timeout in milliseconds into a
+// confirm wait, applying DefaultConfirmTimeout and capping at MaxConfirmTimeout.
+func ConfirmTimeout(ms int) time.Duration {
+	if ms <= 0 {
+		return DefaultConfirmTimeout
+	}
+	return min(time.Duration(ms)*time.Millisecond, MaxConfirmTimeout)
+}
+
+// SendPromptConfirmed sends a prompt and waits up to timeout for evidence that
+// the agent accepted it: a matching user event from echo (when non-nil), or
+// the visible pane showing the input line cleared or the prompt echoed.
+// The pane is compared against a capture taken after the text was typed and
+// before it was submitted.
+// The caller must hold the per-agent lock for the whole call.
+func (p *Prompter) SendPromptConfirmed(agentName, prompt string, timeout time.Duration, echo PromptEchoWatcher) DeliveryResult {
+	start := time.Now()
+	elapsed := func() int64 { return time.Since(start).Milliseconds() }
+
+	var before string
+	captureTyped := func() {
+		if screen, err := p.Ctrl.CapturePaneVisible(agentName); err == nil {
+			before = screen
+		}
+	}
+
+	var echoCh <-chan string
+	if echo != nil {
+		if ch, stop, ok := echo.WatchPromptEcho(agentName, prompt); ok {
+			echoCh = ch
+			defer stop()
+		}
+	}
+
+	if err := p.sendPromptStaged(agentName, prompt, captureTyped); err != nil {
+		return DeliveryResult{Status: DeliveryFailed, Evidence: err.Error(), ElapsedMs: elapsed()}
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(confirmPollInterval)
+	defer ticker.Stop()
+
+	lastObservation := "no pane change observed"
+	for {
+		select {
+		case evidence := <-echoCh:
+			return DeliveryResult{Status: DeliveryDelivered, Source: DeliverySourceConversation, Evidence: evidence, ElapsedMs: elapsed()}
+		case <-ticker.C:
+			after, err := p.Ctrl.CapturePaneVisible(agentName)
+			if err != nil {
+				lastObservation = "capture pane: " + err.Error()
+				continue
+			}
+			accepted, observation := ClassifyPromptScreen(before, after, prompt)
+			if accepted {
+				return DeliveryResult{Status: DeliveryDelivered, Source: DeliverySourcePane, Evidence: observation, ElapsedMs: elapsed()}
+			}
+			lastObservation = observation
+		case <-deadline.C:
+			return DeliveryResult{
+				Status:    DeliveryPending,
+				Source:    DeliverySourcePane,
+				Evidence:  fmt.Sprintf("timed out after %s: %s", timeout, lastObservation),
+				ElapsedMs: elapsed(),
+			}
+		}
+	}
+}
+
+// ClassifyPromptScreen compares the visible pane with the prompt typed
+// (before) and after it was submitted. It reports acceptance when the prompt
+// text shows up in the transcript more often than before (echoed), or when
+// the prompt was in the input area before and no longer is (input line
+// cleared). Any other screen change is not evidence: a before screen taken
+// without the prompt visible in the input area can't show it being cleared.
+func ClassifyPromptScreen(before, after, prompt string) (accepted bool, observation string) {
+	needle := promptNeedle(prompt)
+	if needle == "" {
+		return false, "empty prompt"
+	}
+
+	beforeText := normalizeScreen(before)
+	beforeLines := nonEmptyLines(beforeText)
+	_, beforeInput := splitInputRegion(beforeLines)
+	afterLines := nonEmptyLines(normalizeScreen(after))
+	transcript, input := splitInputRegion(afterLines)
+
+	if strings.Contains(input, needle) {
+		if strings.Count(transcript, needle) > strings.Count(beforeText, needle) {
+			return true, "prompt echoed in transcript"
+		}
+		return false, "prompt still in input line"
+	}
+	if strings.Count(transcript, needle) > strings.Count(beforeText, needle) {
+		return true, "prompt echoed in transcript"
+	}
+	if strings.Join(afterLines, "\n") == strings.Join(beforeLines, "\n") {
+		return false, "no pane change observed"
+	}
+	if strings.Contains(beforeInput, needle) {
+		return true, "input line cleared"
+	}
+	return false, "pane changed but the prompt was not seen typed or echoed"
+}
+
+// splitInputRegion splits screen lines into the transcript and the trailing
+// input area.
+func splitInputRegion(lines []string) (transcript, input string) {
+	split := max(len(lines)-inputRegionLines, 0)
+	return strings.Join(lines[:split], "\n"), strings.Join(lines[split:], "\n")
+}
+
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[()][0-9A-Za-z]|\x1b[=>78]`)
+
+// normalizeScreen strips ANSI sequences and collapses runs of spaces so box
+// drawing padding and cursor styling don't affect matching.
+func normalizeScreen(s string) string {
+	s = ansiPattern.ReplaceAllString(s, "")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func nonEmptyLines(s string) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// promptNeedle returns the tail of the prompt's last non-empty line — the part
+// most likely to still be visible in a wrapped input box.
+func promptNeedle(prompt string) string {
+	lines := nonEmptyLines(normalizeScreen(prompt))
+	if len(lines) == 0 {
+		return ""
+	}
+	last := []rune(lines[len(lines)-1])
+	if len(last) > promptNeedleRunes {
+		last = last[len(last)-promptNeedleRunes:]
+	}
+	return strings.TrimSpace(string(last))
+}
@@ -0,0 +1,157 @@
+package agentio
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const claudeIdleScreen = "\x1b[1m╭────────────────────╮\x1b[0m\n│ >                  │\n╰────────────────────╯\n  ? for shortcuts"
+
+func TestClassifyPromptScreen(t *testing.T) {
+	typed := "╭────────────────────╮\n│ > please rebase on main │\n╰────────────────────╯\n  ? for shortcuts"
+	echoed := "> please rebase on main\n\n● Rebasing now...\n\n" + claudeIdleScreen
+
+	cases := []struct {
+		name         string
+		before       string
+		after        string
+		wantAccepted bool
+		wantObs      string
+	}{
+		{name: "still_typed", before: claudeIdleScreen, after: typed, wantAccepted: false, wantObs: "prompt still in input line"},
+		{name: "echoed", before: claudeIdleScreen, after: echoed, wantAccepted: true, wantObs: "prompt echoed in transcript"},
+		{name: "cleared", before: typed, after: claudeIdleScreen, wantAccepted: true, wantObs: "input line cleared"},
+		{name: "unchanged", before: claudeIdleScreen, after: claudeIdleScreen, wantAccepted: false, wantObs: "no pane change observed"},
+		// Typed but never submitted: the input box wrapped the prompt, so the
+		// needle isn't found anywhere, yet the screen differs from the idle one.
+		{name: "typed_wrapped_not_submitted", before: claudeIdleScreen, after: "╭──────────╮\n│ > please rebase │\n│ on main │\n╰──────────╯\n  ? for shortcuts", wantAccepted: false, wantObs: "pane changed but the prompt was not seen typed or echoed"},
+		{name: "ansi_only_change", before: claudeIdleScreen, after: strings.ReplaceAll(claudeIdleScreen, "\x1b[1m", "\x1b[2m"), wantAccepted: false, wantObs: "no pane change observed"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			accepted, obs := ClassifyPromptScreen(tc.before, tc.after, "please rebase on main")
+			if accepted != tc.wantAccepted || obs != tc.wantObs {
+				t.Fatalf("ClassifyPromptScreen() = (%v, %q), want (%v, %q)", accepted, obs, tc.wantAccepted, tc.wantObs)
+			}
+		})
+	}
+}
+
+func TestPromptNeedleUsesTailOfLastLine(t *testing.T) {
+	got := promptNeedle("first line\n\nsecond   line with a fairly long tail that wraps in the input box\n")
+	if want := "ly long tail that wraps in the input box"; got != want {
+		t.Fatalf("promptNeedle() = %q, want %q", got, want)
+	}
+}
+
+func TestSendPromptConfirmedViaPane(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "gemini", true)
+	fake.screens = []string{
+		claudeIdleScreen,                                     // before
+		"│ > please rebase on main │",                        // first poll: still typed
+		"> please rebase on main\n● ok\n" + claudeIdleScreen, // second poll: echoed
+	}
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("gemini", instant); err != nil {
+		t.Fatal(err)
+	}
+
+	result := p.SendPromptConfirmed("hq-agent", "please rebase on main", time.Second, nil)
+	if result.Status != DeliveryDelivered || result.Source != DeliverySourcePane {
+		t.Fatalf("result = %+v, want delivered via pane", result)
+	}
+	if result.Evidence != "prompt echoed in transcript" {
+		t.Fatalf("evidence = %q", result.Evidence)
+	}
+}
+
+func TestSendPromptConfirmedTimesOutPending(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "gemini", true)
+	fake.screens = []string{claudeIdleScreen, "│ > stuck prompt │"}
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("gemini", instant); err != nil {
+		t.Fatal(err)
+	}
+
+	result := p.SendPromptConfirmed("hq-agent", "stuck prompt", 500*time.Millisecond, nil)
+	if result.Status != DeliveryPending {
+		t.Fatalf("status = %q, want %q", result.Status, DeliveryPending)
+	}
+	if !strings.Contains(result.Evidence, "prompt still in input line") {
+		t.Fatalf("evidence = %q, want last observation", result.Evidence)
+	}
+}
+
+func TestSendPromptConfirmedComparesAgainstTypedScreen(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "gemini", true)
+	typed := "╭────╮\n│ > never sent │\n╰────╯\n  ? for shortcuts"
+	// The prompt sits in the input box and stays there: the screen changed
+	// from idle only because the text was typed.
+	fake.screens = []string{typed}
+	fake.recordCaptures = true
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("gemini", instant); err != nil {
+		t.Fatal(err)
+	}
+
+	result := p.SendPromptConfirmed("hq-agent", "never sent", 500*time.Millisecond, nil)
+	if result.Status != DeliveryPending {
+		t.Fatalf("result = %+v, want pending", result)
+	}
+	calls := strings.Join(fake.Calls(), "\n")
+	if i, j := strings.Index(calls, "capture hq-agent"), strings.Index(calls, "keys hq-agent Enter"); i < strings.Index(calls, "literal hq-agent") || i > j {
+		t.Fatalf("before screen not captured between typing and Enter:\n%s", calls)
+	}
+}
+
+func TestSendPromptConfirmedFailed(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "gemini", true)
+	fake.failKeys["Enter"] = 10
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("gemini", instant); err != nil {
+		t.Fatal(err)
+	}
+
+	result := p.SendPromptConfirmed("hq-agent", "hi", time.Second, nil)
+	if result.Status != DeliveryFailed {
+		t.Fatalf("status = %q, want %q", result.Status, DeliveryFailed)
+	}
+}
+
+// fakeEcho reports a conversation match immediately.
+type fakeEcho struct {
+	stopped bool
+}
+
+func (e *fakeEcho) WatchPromptEcho(agentName, prompt string) (<-chan string, func(), bool) {
+	ch := make(chan string, 1)
+	ch <- "user event evt-1"
+	return ch, func() { e.stopped = true }, true
+}
+
+func TestSendPromptConfirmedViaConversation(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "claude", true)
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("claude", instant); err != nil {
+		t.Fatal(err)
+	}
+
+	echo := &fakeEcho{}
+	result := p.SendPromptConfirmed("hq-agent", "hello", time.Second, echo)
+	if result.Status != DeliveryDelivered || result.Source != DeliverySourceConversation {
+		t.Fatalf("result = %+v, want delivered via conversation", result)
+	}
+	if result.Evidence != "user event evt-1" {
+		t.Fatalf("evidence = %q", result.Evidence)
+	}
+	if !echo.stopped {
+		t.Fatal("expected echo watcher to be stopped")
+	}
+}
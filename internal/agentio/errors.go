@@ -0,0 +1,38 @@
+package agentio
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+// Error kinds. Match them with errors.Is; the servers map them to the
+// structured error codes sent to clients.
+var (
+	// ErrAgentNotFound is returned when the named agent is not registered.
+	// It is the registry's own error, so lookups through it match too.
+	ErrAgentNotFound = agents.ErrAgentNotFound
+	// ErrInvalidArgument marks errors the caller can fix by changing the request.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrTooLarge marks prompts, uploads and key batches over a size limit.
+	ErrTooLarge = errors.New("too large")
+	// ErrQueueFull is returned when an agent's prompt queue has no room.
+	ErrQueueFull = errors.New("prompt queue full")
+	// ErrDeliveryFailed is returned when a confirmed prompt was not accepted.
+	ErrDeliveryFailed = errors.New("delivery failed")
+)
+
+// kindError keeps its own message while also matching kind with errors.Is.
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.err, e.kind} }
+
+// errorf formats an error like fmt.Errorf and tags it with kind.
+func errorf(kind error, format string, args ...any) error {
+	return &kindError{err: fmt.Errorf(format, args...), kind: kind}
+}
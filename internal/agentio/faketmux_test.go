@@ -0,0 +1,138 @@
+package agentio
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+	"github.com/gastownhall/tmux-adapter/internal/tmux"
+)
+
+// fakeTmux records tmux operations and serves a fixed set of agent sessions.
+// It implements both ControlModeInterface and agents.ControlModeInterface so a
+// real Registry can be built on top of it.
+type fakeTmux struct {
+	mu             sync.Mutex
+	calls          []string
+	sessions       []tmux.SessionInfo
+	panes          map[string]tmux.PaneInfo
+	env            map[string]map[string]string
+	failKeys       map[string]int // key name -> remaining failures
+	screens        []string       // successive CapturePaneVisible results; the last one repeats
+	recordCaptures bool           // record CapturePaneVisible calls as "capture <session>"
+	notifCh        chan tmux.Notification
+}
+
+func newFakeTmux() *fakeTmux {
+	return &fakeTmux{
+		panes:    make(map[string]tmux.PaneInfo),
+		env:      make(map[string]map[string]string),
+		failKeys: make(map[string]int),
+		notifCh:  make(chan tmux.Notification),
+	}
+}
+
+// addAgent registers a live agent session with the given runtime.
+func (f *fakeTmux) addAgent(name, runtime string, attached bool) {
+	f.sessions = append(f.sessions, tmux.SessionInfo{Name: name, Attached: attached})
+	f.panes[name] = tmux.PaneInfo{PaneID: "%1", Command: agents.GetProcessNames(runtime)[0], PID: "100", WorkDir: "/tmp/gt/" + name}
+	f.env[name] = map[string]string{"GT_AGENT": runtime}
+}
+
+// setScreens replaces the scripted CapturePaneVisible results.
+func (f *fakeTmux) setScreens(screens ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.screens = screens
+}
+
+func (f *fakeTmux) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+// Calls returns a copy of the recorded operations.
+func (f *fakeTmux) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *fakeTmux) SendKeysLiteral(target, text string) error {
+	f.record(fmt.Sprintf("literal %s %q", target, text))
+	return nil
+}
+
+func (f *fakeTmux) SendKeysRaw(target string, keys ...string) error {
+	f.record(fmt.Sprintf("keys %s %s", target, strings.Join(keys, " ")))
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range keys {
+		if f.failKeys[k] > 0 {
+			f.failKeys[k]--
+			return fmt.Errorf("tmux: send-keys %s failed", k)
+		}
+	}
+	return nil
+}
+
+func (f *fakeTmux) ResizePane(target, delta string) error {
+	f.record(fmt.Sprintf("resize %s %s", target, delta))
+	return nil
+}
+
+func (f *fakeTmux) PasteBytes(target string, data []byte) error {
+	f.record(fmt.Sprintf("paste %s %q", target, data))
+	return nil
+}
+
+func (f *fakeTmux) PasteBytesBracketed(target string, data []byte) error {
+	f.record(fmt.Sprintf("bpaste %s %q", target, data))
+	return nil
+}
+
+func (f *fakeTmux) GetPaneInfo(session string) (tmux.PaneInfo, error) {
+	return f.panes[session], nil
+}
+
+func (f *fakeTmux) CapturePaneVisible(session string) (string, error) {
+	if f.recordCaptures {
+		f.record("capture " + session)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.screens) == 0 {
+		return "", nil
+	}
+	screen := f.screens[0]
+	if len(f.screens) > 1 {
+		f.screens = f.screens[1:]
+	}
+	return screen, nil
+}
+
+func (f *fakeTmux) ListSessions() ([]tmux.SessionInfo, error) {
+	return f.sessions, nil
+}
+
+func (f *fakeTmux) ShowEnvironment(session, key string) (string, error) {
+	return f.env[session][key], nil
+}
+
+func (f *fakeTmux) Notifications() <-chan tmux.Notification {
+	return f.notifCh
+}
+
+// newTestPrompter builds a Prompter over a started Registry backed by fake.
+func newTestPrompter(t *testing.T, fake *fakeTmux) *Prompter {
+	t.Helper()
+	registry := agents.NewRegistry(fake, "/tmp/gt", nil)
+	if err := registry.Start(); err != nil {
+		t.Fatalf("registry Start() error: %v", err)
+	}
+	t.Cleanup(registry.Stop)
+	return NewPrompter(fake, registry)
+}
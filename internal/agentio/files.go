@@ -0,0 +1,276 @@
+package agentio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+// MaxReadFileBytes bounds files returned inline by ReadFile (the read-file
+// WebSocket request). Larger files are downloaded over HTTP.
+const MaxReadFileBytes = 8 * 1024 * 1024
+
+var (
+	// ErrFileDenied is returned for paths outside the agent's workDir or
+	// matching a deny glob.
+	ErrFileDenied = errors.New("path not allowed")
+	// ErrFileTooLarge is returned when a download exceeds MaxFileBytes.
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+// FilePolicy limits read-only access to agent workDirs.
+type FilePolicy struct {
+	MaxFileBytes int64    // largest downloadable file (0 = unlimited)
+	MaxEntries   int      // most entries returned per directory listing (0 = unlimited)
+	Deny         []string // globs hidden from listings and downloads
+}
+
+// DefaultFilePolicy returns the limits used when none are configured.
+func DefaultFilePolicy() FilePolicy {
+	return FilePolicy{
+		MaxFileBytes: 50 * 1024 * 1024,
+		MaxEntries:   1000,
+		Deny:         []string{".env", ".env.*", ".git/objects"},
+	}
+}
+
+// FileEntry describes a file or directory under an agent's workDir.
+type FileEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"` // slash-separated, relative to the workDir
+	Dir     bool      `json:"dir,omitempty"`
+	Symlink bool      `json:"symlink,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// FileBrowser gives read-only access to files under agent workDirs.
+// Every path is resolved through symlinks and must stay inside the workDir.
+//
+// Deny globs use gitignore-style matching against the slash-separated path
+// relative to the workDir: a glob without '/' matches a name at any depth
+// (".env"), one with '/' matches consecutive path segments at any depth
+// (".git/objects"). A denied directory denies everything below it.
+type FileBrowser struct {
+	registry *agents.Registry
+	mu       sync.Mutex
+	policy   FilePolicy
+}
+
+// NewFileBrowser creates a browser over the registry's agents.
+func NewFileBrowser(registry *agents.Registry, policy FilePolicy) *FileBrowser {
+	return &FileBrowser{registry: registry, policy: policy}
+}
+
+// SetPolicy replaces the size limits and deny globs.
+func (b *FileBrowser) SetPolicy(policy FilePolicy) {
+	b.mu.Lock()
+	b.policy = policy
+	b.mu.Unlock()
+}
+
+// Policy returns the current limits.
+func (b *FileBrowser) Policy() FilePolicy {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.policy
+}
+
+// Stat describes rel ("" for the workDir itself).
+func (b *FileBrowser) Stat(agentName, rel string) (FileEntry, error) {
+	root, resolved, relPath, err := b.resolve(agentName, rel)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	entry := fileEntry(relPath, info)
+	if resolved == root {
+		entry.Name = filepath.Base(root)
+	}
+	return entry, nil
+}
+
+// List returns the entries of the directory rel, directories first, then by
+// name. Denied entries and symlinks leading outside the workDir are omitted.
+// truncated reports whether MaxEntries cut the listing short.
+func (b *FileBrowser) List(agentName, rel string) (entries []FileEntry, truncated bool, err error) {
+	root, resolved, relPath, err := b.resolve(agentName, rel)
+	if err != nil {
+		return nil, false, err
+	}
+	policy := b.Policy()
+
+	dirEntries, err := os.ReadDir(resolved)
+	if err != nil {
+		return nil, false, err
+	}
+	entries = []FileEntry{}
+	for _, de := range dirEntries {
+		childRel := joinRel(relPath, de.Name())
+		if denied(policy.Deny, childRel) {
+			continue
+		}
+		full := filepath.Join(resolved, de.Name())
+		symlink := de.Type()&os.ModeSymlink != 0
+		if symlink {
+			target, err := filepath.EvalSymlinks(full)
+			if err != nil || !pathWithin(target, root) || denied(policy.Deny, relTo(root, target)) {
+				continue
+			}
+		}
+		info, err := os.Stat(full)
+		if err != nil {
+			continue
+		}
+		entry := fileEntry(childRel, info)
+		entry.Symlink = symlink
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Dir != entries[j].Dir {
+			return entries[i].Dir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	if policy.MaxEntries > 0 && len(entries) > policy.MaxEntries {
+		return entries[:policy.MaxEntries], true, nil
+	}
+	return entries, false, nil
+}
+
+// Open opens the regular file rel for reading. The caller closes it.
+func (b *FileBrowser) Open(agentName, rel string) (*os.File, FileEntry, error) {
+	_, resolved, relPath, err := b.resolve(agentName, rel)
+	if err != nil {
+		return nil, FileEntry{}, err
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, FileEntry{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, FileEntry{}, err
+	}
+	if !info.Mode().IsRegular() {
+		_ = f.Close()
+		return nil, FileEntry{}, errorf(ErrInvalidArgument, "not a regular file: %s", relPath)
+	}
+	if limit := b.Policy().MaxFileBytes; limit > 0 && info.Size() > limit {
+		_ = f.Close()
+		return nil, FileEntry{}, fmt.Errorf("%w: %d bytes (max %d)", ErrFileTooLarge, info.Size(), limit)
+	}
+	return f, fileEntry(relPath, info), nil
+}
+
+// ReadFile returns the contents of the regular file rel, which may be at
+// most MaxReadFileBytes (and within MaxFileBytes).
+func (b *FileBrowser) ReadFile(agentName, rel string) (FileEntry, []byte, error) {
+	f, entry, err := b.Open(agentName, rel)
+	if err != nil {
+		return FileEntry{}, nil, err
+	}
+	defer func() { _ = f.Close() }()
+	if entry.Size > MaxReadFileBytes {
+		return FileEntry{}, nil, fmt.Errorf("%w: %d bytes (max %d over WebSocket; download it over HTTP)", ErrFileTooLarge, entry.Size, MaxReadFileBytes)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, MaxReadFileBytes+1))
+	if err != nil {
+		return FileEntry{}, nil, err
+	}
+	if len(data) > MaxReadFileBytes {
+		return FileEntry{}, nil, fmt.Errorf("%w: grew past %d bytes while reading", ErrFileTooLarge, MaxReadFileBytes)
+	}
+	entry.Size = int64(len(data))
+	return entry, data, nil
+}
+
+// resolve maps rel to an absolute path inside the agent's workDir, following
+// symlinks, and checks it against the deny globs. It returns the resolved
+// workDir, the resolved path, and the path relative to the workDir.
+func (b *FileBrowser) resolve(agentName, rel string) (root, resolved, relPath string, err error) {
+	agent, ok := b.registry.GetAgent(agentName)
+	if !ok {
+		return "", "", "", fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
+	}
+	root, err = filepath.EvalSymlinks(agent.WorkDir)
+	if err != nil {
+		return "", "", "", fmt.Errorf("resolve workDir: %w", err)
+	}
+
+	rel = strings.TrimPrefix(filepath.ToSlash(rel), "/")
+	requested := filepath.Join(root, filepath.FromSlash(rel))
+	if !pathWithin(requested, root) {
+		return "", "", "", ErrFileDenied
+	}
+	resolved, err = filepath.EvalSymlinks(requested)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !pathWithin(resolved, root) {
+		return "", "", "", ErrFileDenied
+	}
+
+	deny := b.Policy().Deny
+	relPath = relTo(root, requested)
+	if denied(deny, relPath) || denied(deny, relTo(root, resolved)) {
+		return "", "", "", ErrFileDenied
+	}
+	return root, resolved, relPath, nil
+}
+
+func fileEntry(relPath string, info os.FileInfo) FileEntry {
+	entry := FileEntry{Name: info.Name(), Path: relPath, Dir: info.IsDir(), ModTime: info.ModTime()}
+	if !entry.Dir {
+		entry.Size = info.Size()
+	}
+	return entry
+}
+
+// relTo returns p relative to root, slash-separated ("" for root itself).
+func relTo(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func joinRel(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// denied reports whether rel, or any directory above it, matches a deny glob.
+func denied(globs []string, rel string) bool {
+	if rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for _, glob := range globs {
+		pattern := strings.Split(strings.Trim(glob, "/"), "/")
+		for start := range parts {
+			for end := start + 1; end <= len(parts); end++ {
+				if matchSegments(pattern, parts[start:end]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
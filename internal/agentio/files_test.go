@@ -0,0 +1,146 @@
+package agentio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestFileBrowser(t *testing.T, policy FilePolicy) (*FileBrowser, string) {
+	t.Helper()
+	_, p, workDir := newWorkDirPrompter(t, "claude")
+	return NewFileBrowser(p.Registry, policy), workDir
+}
+
+func entryPaths(entries []FileEntry) []string {
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.Path
+	}
+	return paths
+}
+
+func TestFileBrowserListHidesDeniedAndEscapes(t *testing.T) {
+	files, workDir := newTestFileBrowser(t, DefaultFilePolicy())
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "secret.txt"), "secret")
+
+	writeFile(t, filepath.Join(workDir, "report.md"), "# report")
+	writeFile(t, filepath.Join(workDir, ".env"), "TOKEN=x")
+	writeFile(t, filepath.Join(workDir, ".env.local"), "TOKEN=y")
+	writeFile(t, filepath.Join(workDir, ".git", "HEAD"), "ref: refs/heads/main")
+	writeFile(t, filepath.Join(workDir, ".git", "objects", "ab", "cdef"), "blob")
+	writeFile(t, filepath.Join(workDir, "out", "patch.diff"), "diff")
+	if err := os.Symlink(outside, filepath.Join(workDir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(workDir, "out"), filepath.Join(workDir, "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, truncated, err := files.List("hq-agent", "")
+	if err != nil || truncated {
+		t.Fatalf("List() truncated %v, err %v", truncated, err)
+	}
+	got := entryPaths(entries)
+	want := []string{".git", "latest", "out", "report.md"}
+	if len(got) != len(want) {
+		t.Fatalf("List() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("List() = %v, want %v", got, want)
+		}
+	}
+	if !entries[1].Symlink || !entries[1].Dir {
+		t.Fatalf("latest entry = %+v, want symlinked dir", entries[1])
+	}
+
+	gitEntries, _, err := files.List("hq-agent", ".git")
+	if err != nil || len(gitEntries) != 1 || gitEntries[0].Path != ".git/HEAD" {
+		t.Fatalf("List(.git) = %v, err %v", entryPaths(gitEntries), err)
+	}
+}
+
+func TestFileBrowserRejectsEscapesAndDenied(t *testing.T) {
+	files, workDir := newTestFileBrowser(t, DefaultFilePolicy())
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "secret.txt"), "secret")
+	writeFile(t, filepath.Join(workDir, "sub", ".env"), "TOKEN=x")
+	writeFile(t, filepath.Join(workDir, ".git", "objects", "ab", "cdef"), "blob")
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(workDir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(workDir, "sub", ".env"), filepath.Join(workDir, "env-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rel := range []string{
+		"../" + filepath.Base(outside) + "/secret.txt",
+		"link.txt",
+		"sub/.env",
+		"env-link",
+		".git/objects/ab/cdef",
+		".git/objects",
+	} {
+		if _, err := files.Stat("hq-agent", rel); !errors.Is(err, ErrFileDenied) {
+			t.Errorf("Stat(%q) err = %v, want ErrFileDenied", rel, err)
+		}
+	}
+	if _, err := files.Stat("missing-agent", ""); !errors.Is(err, ErrAgentNotFound) {
+		t.Errorf("Stat() for unknown agent err = %v", err)
+	}
+}
+
+func TestFileBrowserOpenAndSizeLimit(t *testing.T) {
+	files, workDir := newTestFileBrowser(t, FilePolicy{MaxFileBytes: 8})
+	writeFile(t, filepath.Join(workDir, "small.txt"), "tiny")
+	writeFile(t, filepath.Join(workDir, "big.txt"), "far too large")
+
+	entry, data, err := files.ReadFile("hq-agent", "/small.txt")
+	if err != nil || string(data) != "tiny" || entry.Path != "small.txt" || entry.Size != 4 {
+		t.Fatalf("ReadFile() = %+v %q, err %v", entry, data, err)
+	}
+	if _, _, err := files.Open("hq-agent", "big.txt"); !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("Open(big.txt) err = %v, want ErrFileTooLarge", err)
+	}
+	if _, _, err := files.Open("hq-agent", ""); err == nil {
+		t.Fatal("Open() of the workDir itself should fail")
+	}
+}
+
+func TestFileBrowserListTruncates(t *testing.T) {
+	files, workDir := newTestFileBrowser(t, FilePolicy{MaxEntries: 2})
+	for _, name := range []string{"a", "b", "c"} {
+		writeFile(t, filepath.Join(workDir, name), name)
+	}
+	entries, truncated, err := files.List("hq-agent", "")
+	if err != nil || !truncated || len(entries) != 2 {
+		t.Fatalf("List() = %v, truncated %v, err %v", entryPaths(entries), truncated, err)
+	}
+}
+
+func TestDenied(t *testing.T) {
+	globs := []string{".env", "*.pem", ".git/objects", "/build/secret"}
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{".env", true},
+		{"app/.env", true},
+		{"app/.envrc", false},
+		{"certs/server.pem", true},
+		{".git/objects/ab/cdef", true},
+		{"vendor/x/.git/objects", true},
+		{".git/HEAD", false},
+		{"build/secret/key", true},
+		{"build/public", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := denied(globs, tt.rel); got != tt.want {
+			t.Errorf("denied(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
@@ -3,14 +3,16 @@ package agentio
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
 )
 
 // MaxFileUploadBytes is the maximum allowed file upload size.
@@ -18,44 +20,154 @@ const MaxFileUploadBytes = 8 * 1024 * 1024
 
 const maxInlinePasteBytes = 256 * 1024
 
-// HandleFileUpload stores an uploaded file server-side, copies a pasteable
-// payload to the local clipboard when possible, and pastes into the tmux target.
-// The caller must hold the per-agent lock.
-func (p *Prompter) HandleFileUpload(agentName string, payload []byte) error {
+// HandleFileUpload sniffs an uploaded file, applies the agent runtime's paste
+// policy, stores the file in the agent's upload store, copies the pasteable
+// payload to the local clipboard when possible, and pastes into the tmux
+// target. client identifies the uploader in the store's manifest. The result
+// describes the decision, including refusals. The caller must hold the
+// per-agent lock.
+func (p *Prompter) HandleFileUpload(agentName string, payload []byte, client string) (UploadResult, error) {
 	fileName, mimeType, fileBytes, err := ParseFileUploadPayload(payload)
 	if err != nil {
-		return err
+		return UploadResult{}, err
 	}
 	if len(fileBytes) > MaxFileUploadBytes {
-		return fmt.Errorf("file %q too large: %d bytes (max %d)", fileName, len(fileBytes), MaxFileUploadBytes)
+		return UploadResult{}, errorf(ErrTooLarge, "file %q too large: %d bytes (max %d)", fileName, len(fileBytes), MaxFileUploadBytes)
 	}
 
 	agent, ok := p.Registry.GetAgent(agentName)
 	if !ok {
-		return fmt.Errorf("agent not found: %s", agentName)
+		return UploadResult{}, fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
 	}
 
-	savedPath, err := SaveUploadedFile(agent.WorkDir, agentName, fileName, fileBytes)
+	result := p.planUpload(agent, fileName, mimeType, int64(len(fileBytes)), fileBytes)
+	if result.Action == PasteRefuse {
+		return result, fmt.Errorf("%w: %s files are not accepted for %s", ErrUploadRefused, result.Category, agent.Runtime)
+	}
+	record, deduped, err := p.Uploads.Save(agentName, fileName, result.MimeType, fileBytes, client)
 	if err != nil {
-		return fmt.Errorf("save uploaded file: %w", err)
+		return result, fmt.Errorf("save uploaded file: %w", err)
 	}
+	return p.pasteUpload(agent, result, record, deduped, fileBytes)
+}
+
+// FinishChunkedUpload verifies a completed chunked upload, moves it into the
+// agent's upload store and pastes it like a single-frame upload.
+// The caller must hold the per-agent lock.
+func (p *Prompter) FinishChunkedUpload(id, client string) (UploadResult, error) {
+	up, partPath, err := p.Chunks.Finalize(id)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	agent, ok := p.Registry.GetAgent(up.Agent)
+	if !ok {
+		_ = os.Remove(partPath)
+		return UploadResult{}, fmt.Errorf("%w: %s", ErrAgentNotFound, up.Agent)
+	}
+
+	// Only the head is needed to sniff the file and apply the paste policy:
+	// anything longer than the inline limit pastes a path.
+	policy := p.PastePolicyFor(agent.Runtime)
+	head, err := readFileHead(partPath, max(policy.MaxInlineBytes+1, sniffBytes))
+	if err != nil {
+		_ = os.Remove(partPath)
+		return UploadResult{}, fmt.Errorf("read uploaded file: %w", err)
+	}
+	if int64(len(head)) < up.Size {
+		head = trimPartialRune(head)
+	}
+
+	result := p.planUpload(agent, up.FileName, up.MimeType, up.Size, head)
+	if result.Action == PasteRefuse {
+		_ = os.Remove(partPath)
+		return result, fmt.Errorf("%w: %s files are not accepted for %s", ErrUploadRefused, result.Category, agent.Runtime)
+	}
+	record, deduped, err := p.Uploads.SaveFile(up.Agent, up.FileName, result.MimeType, partPath, up.SHA256, up.Size, client)
+	if err != nil {
+		// The complete file is still in place: keep it so the client can
+		// retry upload-finalize (or abort) instead of uploading again.
+		p.Chunks.Requeue(up, partPath)
+		return result, fmt.Errorf("save uploaded file: %w", err)
+	}
+	return p.pasteUpload(agent, result, record, deduped, head)
+}
+
+// planUpload sniffs a file and decides how the agent's paste policy handles
+// it. head holds the file bytes, or at least the first MaxInlineBytes+1.
+func (p *Prompter) planUpload(agent agents.Agent, fileName, clientMimeType string, size int64, head []byte) UploadResult {
+	mimeType := SniffMimeType(fileName, head)
+	category := ClassifyFile(mimeType, head)
+	action, reason := decidePaste(p.PastePolicyFor(agent.Runtime), category, size)
+	return UploadResult{
+		FileName:       fileName,
+		Size:           size,
+		ClientMimeType: clientMimeType,
+		MimeType:       mimeType,
+		Category:       category,
+		Action:         action,
+		Reason:         reason,
+	}
+}
+
+// pasteUpload pastes a stored upload into the agent's pane as planned.
+// content holds the file bytes, or at least all of them that an inline or
+// fenced paste can include.
+func (p *Prompter) pasteUpload(agent agents.Agent, result UploadResult, record UploadRecord, deduped bool, content []byte) (UploadResult, error) {
+	result.Upload = &record
+	savedPath := record.Path
 
 	pasteBaseDir := agent.WorkDir
-	if paneInfo, err := p.Ctrl.GetPaneInfo(agentName); err == nil && strings.TrimSpace(paneInfo.WorkDir) != "" {
+	if paneInfo, err := p.Ctrl.GetPaneInfo(agent.Name); err == nil && strings.TrimSpace(paneInfo.WorkDir) != "" {
 		pasteBaseDir = paneInfo.WorkDir
 	}
 	pastePath := BuildServerPastePath(pasteBaseDir, savedPath)
-	pastePayload := BuildPastePayload(savedPath, pastePath, mimeType, fileBytes)
+	switch result.Action {
+	case PastePath:
+		result.PastePath = pastePath
+	case PasteAbsolutePath:
+		result.PastePath = savedPath
+	}
+	pastePayload := renderPaste(result.Action, result.FileName, savedPath, pastePath, content)
+	result.PastedBytes = len(pastePayload)
 
 	if err := CopyToLocalClipboard(pastePayload); err != nil {
-		log.Printf("clipboard copy %s: %v", agentName, err)
+		log.Printf("clipboard copy %s: %v", agent.Name, err)
+	}
+	if err := p.Ctrl.PasteBytes(agent.Name, pastePayload); err != nil {
+		result.PastedBytes = 0
+		return result, fmt.Errorf("paste into tmux: %w", err)
 	}
-	if err := p.Ctrl.PasteBytes(agentName, pastePayload); err != nil {
-		return fmt.Errorf("paste into tmux: %w", err)
+
+	log.Printf("file upload %s: name=%q mime=%q (client %q) bytes=%d saved=%s deduped=%v action=%s pastedBytes=%d", agent.Name, result.FileName, result.MimeType, result.ClientMimeType, result.Size, savedPath, deduped, result.Action, len(pastePayload))
+	return result, nil
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence cut off at the end of a
+// file head, so a truncated read of a text file still looks like text.
+func trimPartialRune(head []byte) []byte {
+	for i := 1; i <= utf8.UTFMax-1 && i <= len(head); i++ {
+		b := head[len(head)-i]
+		if b < utf8.RuneSelf {
+			return head
+		}
+		if utf8.RuneStart(b) {
+			if !utf8.FullRune(head[len(head)-i:]) {
+				return head[:len(head)-i]
+			}
+			return head
+		}
 	}
+	return head
+}
 
-	log.Printf("file upload %s: name=%q mime=%q bytes=%d saved=%s pastePath=%s pastedBytes=%d", agentName, fileName, mimeType, len(fileBytes), savedPath, pastePath, len(pastePayload))
-	return nil
+// readFileHead reads up to n bytes from the start of a file.
+func readFileHead(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return io.ReadAll(io.LimitReader(f, int64(n)))
 }
 
 // ParseFileUploadPayload parses the binary file upload payload.
@@ -63,12 +175,12 @@ func (p *Prompter) HandleFileUpload(agentName string, payload []byte) error {
 func ParseFileUploadPayload(payload []byte) (fileName string, mimeType string, data []byte, err error) {
 	first := bytes.IndexByte(payload, 0)
 	if first < 0 {
-		return "", "", nil, fmt.Errorf("invalid file payload: missing filename separator")
+		return "", "", nil, errorf(ErrInvalidArgument, "invalid file payload: missing filename separator")
 	}
 
 	secondRel := bytes.IndexByte(payload[first+1:], 0)
 	if secondRel < 0 {
-		return "", "", nil, fmt.Errorf("invalid file payload: missing mime separator")
+		return "", "", nil, errorf(ErrInvalidArgument, "invalid file payload: missing mime separator")
 	}
 	second := first + 1 + secondRel
 
@@ -81,17 +193,12 @@ func ParseFileUploadPayload(payload []byte) (fileName string, mimeType string, d
 	return fileName, mimeType, data, nil
 }
 
-// BuildPastePayload determines what to paste into the tmux session.
+// BuildPastePayload determines what to paste into the tmux session under
+// DefaultPastePolicy, trusting mimeType as given.
 // File paths get a trailing space so multiple attachments don't run together.
 func BuildPastePayload(savedPath, pastePath, mimeType string, fileBytes []byte) []byte {
-	if len(fileBytes) <= maxInlinePasteBytes && IsTextLike(mimeType, fileBytes) {
-		return fileBytes
-	}
-	// Images need the absolute path so Claude Code can read and render them inline.
-	if strings.HasPrefix(mimeType, "image/") {
-		return []byte(savedPath + " ")
-	}
-	return []byte(pastePath + " ")
+	mode, _ := decidePaste(DefaultPastePolicy(), ClassifyFile(mimeType, fileBytes), int64(len(fileBytes)))
+	return renderPaste(mode, filepath.Base(savedPath), savedPath, pastePath, fileBytes)
 }
 
 // BuildServerPastePath returns a path string that is valid on the server-side
@@ -156,38 +263,6 @@ func IsUTF8Text(data []byte) bool {
 	return true
 }
 
-// SaveUploadedFile saves a file to disk in the agent's upload directory.
-func SaveUploadedFile(workDir, agentName, fileName string, data []byte) (string, error) {
-	safeName := SanitizePathComponent(fileName)
-	stampedName := fmt.Sprintf("%d-%s", time.Now().UnixNano(), safeName)
-
-	candidates := make([]string, 0, 2)
-	if strings.TrimSpace(workDir) != "" {
-		candidates = append(candidates, filepath.Join(workDir, ".tmux-adapter", "uploads"))
-	}
-	candidates = append(candidates, filepath.Join(os.TempDir(), "tmux-adapter", "uploads", SanitizePathComponent(agentName)))
-
-	var lastErr error
-	for _, dir := range candidates {
-		if err := os.MkdirAll(dir, 0o755); err != nil {
-			lastErr = err
-			continue
-		}
-
-		path := filepath.Join(dir, stampedName)
-		if err := os.WriteFile(path, data, 0o644); err != nil {
-			lastErr = err
-			continue
-		}
-		return path, nil
-	}
-
-	if lastErr == nil {
-		lastErr = fmt.Errorf("no upload path available")
-	}
-	return "", lastErr
-}
-
 // SanitizePathComponent makes a filename safe for use in paths.
 func SanitizePathComponent(s string) string {
 	base := filepath.Base(strings.TrimSpace(s))
@@ -0,0 +1,152 @@
+package agentio
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxGitignoreBytes bounds how much of a single .gitignore file is read.
+const maxGitignoreBytes = 256 * 1024
+
+// ignoreRule is one parsed .gitignore pattern.
+type ignoreRule struct {
+	base     string   // slash-separated directory of the .gitignore, relative to the root ("" for the root)
+	segments []string // pattern split on '/'
+	anchored bool     // pattern contains a '/' and so matches from base, not any depth
+	negate   bool     // "!pattern" re-includes
+	dirOnly  bool     // "pattern/" matches directories only
+}
+
+// gitIgnore matches paths against the .gitignore files between a root
+// directory and the directory being listed. It implements the common subset
+// of gitignore syntax: comments, negation, directory-only and anchored
+// patterns, and *, ?, [...] and ** globs. .git itself is always ignored.
+type gitIgnore struct {
+	rules []ignoreRule
+}
+
+// loadGitIgnore reads .gitignore files in root and every directory from root
+// down to dir (inclusive). dir must be root or inside it.
+func loadGitIgnore(root, dir string) *gitIgnore {
+	g := &gitIgnore{}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return g
+	}
+
+	current, base := root, ""
+	g.load(current, base)
+	if rel == "." {
+		return g
+	}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		current = filepath.Join(current, part)
+		base = path.Join(base, part)
+		g.load(current, base)
+	}
+	return g
+}
+
+func (g *gitIgnore) load(dir, base string) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(io.LimitReader(f, maxGitignoreBytes))
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text(), base); ok {
+			g.rules = append(g.rules, rule)
+		}
+	}
+}
+
+func parseIgnoreRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// Ignored reports whether rel (slash-separated, relative to the root) is ignored.
+func (g *gitIgnore) Ignored(rel string, isDir bool) bool {
+	if rel == ".git" || strings.HasSuffix(rel, "/.git") {
+		return true
+	}
+	ignored := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.matches(rel) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) matches(rel string) bool {
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	parts := strings.Split(rel, "/")
+	if !r.anchored {
+		// Unanchored patterns match the name at any depth.
+		return matchSegments(r.segments, parts[len(parts)-1:])
+	}
+	return matchSegments(r.segments, parts)
+}
+
+// matchSegments matches glob segments against path segments, with "**"
+// matching any number of segments.
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := range len(parts) + 1 {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
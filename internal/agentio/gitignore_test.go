@@ -0,0 +1,38 @@
+package agentio
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGitIgnore(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".gitignore"), "# build output\n*.log\n/dist\nnode_modules/\n!keep.log\ndocs/**/*.tmp\n")
+	writeFile(t, filepath.Join(root, "src/.gitignore"), "generated\n")
+
+	g := loadGitIgnore(root, filepath.Join(root, "src"))
+	cases := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"src/deep/app.log", false, true},
+		{"keep.log", false, false},
+		{"dist", true, true},
+		{"src/dist", true, false},
+		{"node_modules", true, true},
+		{"node_modules", false, false},
+		{"docs/a/b/x.tmp", false, true},
+		{"docs/x.tmp", false, true},
+		{"src/generated", false, true},
+		{"generated", false, false},
+		{".git", true, true},
+		{"main.go", false, false},
+	}
+	for _, tc := range cases {
+		if got := g.Ignored(tc.rel, tc.isDir); got != tc.want {
+			t.Errorf("Ignored(%q, dir=%v) = %v, want %v", tc.rel, tc.isDir, got, tc.want)
+		}
+	}
+}
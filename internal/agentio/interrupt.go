@@ -0,0 +1,148 @@
+package agentio
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// Interrupt levels.
+const (
+	InterruptSoft = "soft"         // the runtime's cancel key (Escape for Claude, otherwise Ctrl-C)
+	InterruptHard = "hard"         // Ctrl-C
+	InterruptKill = "kill-process" // SIGTERM to the agent process, then SIGKILL
+)
+
+const (
+	// DefaultInterruptTimeout is how long to watch for the agent stopping when
+	// the request gives no timeout.
+	DefaultInterruptTimeout = 5 * time.Second
+	// MaxInterruptTimeout caps how long an interrupt may hold the agent lock.
+	MaxInterruptTimeout = 30 * time.Second
+
+	interruptPollInterval = 100 * time.Millisecond
+	// interruptQuietFor is how long output must stay unchanged, with no busy
+	// marker, for a soft or hard interrupt to count as having stopped the agent.
+	interruptQuietFor = 500 * time.Millisecond
+	// killGracePeriod is how long the process has to exit after SIGTERM
+	// before it gets SIGKILL.
+	killGracePeriod = 2 * time.Second
+)
+
+// InterruptResult reports what an interrupt did and whether the agent stopped.
+type InterruptResult struct {
+	Level     string `json:"level"`
+	Stopped   bool   `json:"stopped"`
+	Evidence  string `json:"evidence"`
+	PID       int    `json:"pid,omitempty"` // kill-process only
+	ElapsedMs int64  `json:"elapsedMs"`
+}
+
+// InterruptTimeout converts a client-supplied timeout in milliseconds into an
+// interrupt wait, applying DefaultInterruptTimeout and capping at MaxInterruptTimeout.
+func InterruptTimeout(ms int) time.Duration {
+	if ms <= 0 {
+		return DefaultInterruptTimeout
+	}
+	return min(time.Duration(ms)*time.Millisecond, MaxInterruptTimeout)
+}
+
+// Interrupt stops an agent's current work at the given level and waits up to
+// timeout to judge whether it stopped. soft and hard are judged from output
+// activity (the pane goes quiet without a busy marker); kill-process is judged
+// by the process exiting. Returns an error only if the interrupt could not be
+// sent. The caller must hold the per-agent lock.
+func (p *Prompter) Interrupt(agentName, level string, timeout time.Duration) (InterruptResult, error) {
+	agent, ok := p.Registry.GetAgent(agentName)
+	if !ok {
+		return InterruptResult{}, fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
+	}
+	start := time.Now()
+	result := InterruptResult{Level: level}
+	finish := func() (InterruptResult, error) {
+		result.ElapsedMs = time.Since(start).Milliseconds()
+		return result, nil
+	}
+
+	var key string
+	switch level {
+	case InterruptSoft:
+		key = p.softInterruptKey(agent.Runtime)
+	case InterruptHard:
+		key = "C-c"
+	case InterruptKill:
+		pid, err := p.agentPID(agentName)
+		if err != nil {
+			return InterruptResult{}, err
+		}
+		result.PID = pid
+		result.Stopped, result.Evidence, err = p.killProcess(pid, timeout)
+		if err != nil {
+			return InterruptResult{}, err
+		}
+		return finish()
+	default:
+		return InterruptResult{}, errorf(ErrInvalidArgument, "unknown interrupt level %q (want %s, %s or %s)", level, InterruptSoft, InterruptHard, InterruptKill)
+	}
+
+	before, _ := p.Ctrl.CapturePaneVisible(agentName)
+	if err := p.Ctrl.SendKeysRaw(agentName, key); err != nil {
+		return InterruptResult{}, fmt.Errorf("send %s: %w", key, err)
+	}
+
+	if waitPaneQuiet(p.Ctrl, agentName, interruptPollInterval, interruptQuietFor, timeout, nil) == paneWaitQuiet {
+		result.Stopped = true
+		result.Evidence = "output stopped"
+		if !LooksBusy(before) {
+			result.Evidence = "output quiet; agent did not look busy before the interrupt"
+		}
+	} else {
+		result.Evidence = fmt.Sprintf("output still active after %s", timeout)
+	}
+	return finish()
+}
+
+// softInterruptKey returns the soft interrupt key of the runtime's own
+// strategy. Unknown runtimes get C-c rather than the claude fallback's Escape.
+func (p *Prompter) softInterruptKey(runtime string) string {
+	p.strategyMu.RLock()
+	s := p.strategies[runtime]
+	p.strategyMu.RUnlock()
+	if is, ok := s.(InterruptStrategy); ok {
+		return is.SoftInterruptKey()
+	}
+	return "C-c"
+}
+
+// killProcess sends SIGTERM, escalating to SIGKILL if the process is still
+// alive after the grace period (bounded by timeout).
+func (p *Prompter) killProcess(pid int, timeout time.Duration) (stopped bool, evidence string, err error) {
+	if err := p.signal(pid, syscall.SIGTERM); err != nil {
+		return false, "", fmt.Errorf("SIGTERM %d: %w", pid, err)
+	}
+	if p.waitExit(pid, min(killGracePeriod, timeout)) {
+		return true, "process exited after SIGTERM", nil
+	}
+	if err := p.signal(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return false, "", fmt.Errorf("SIGKILL %d: %w", pid, err)
+	}
+	if p.waitExit(pid, max(timeout-killGracePeriod, time.Second)) {
+		return true, "process killed with SIGKILL", nil
+	}
+	return false, "process still running after SIGKILL", nil
+}
+
+// waitExit polls with signal 0 until the process is gone or d passes.
+func (p *Prompter) waitExit(pid int, d time.Duration) bool {
+	deadline := time.Now().Add(d)
+	for {
+		if errors.Is(p.signal(pid, 0), syscall.ESRCH) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(interruptPollInterval)
+	}
+}
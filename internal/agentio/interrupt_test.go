@@ -0,0 +1,112 @@
+package agentio
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterruptSoftSendsEscape(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "claude", true)
+	fake.setScreens("✻ Working… (esc to interrupt)", "> ")
+	p := newTestPrompter(t, fake)
+
+	result, err := p.Interrupt("hq-agent", InterruptSoft, time.Second)
+	if err != nil {
+		t.Fatalf("Interrupt() error: %v", err)
+	}
+	if !result.Stopped || result.Evidence != "output stopped" {
+		t.Fatalf("result = %+v, want stopped", result)
+	}
+	if calls := fake.Calls(); len(calls) != 1 || calls[0] != "keys hq-agent Escape" {
+		t.Fatalf("calls = %v, want [keys hq-agent Escape]", calls)
+	}
+}
+
+func TestInterruptSoftUsesRuntimeKey(t *testing.T) {
+	for runtime, want := range map[string]string{"codex": "C-c", "gemini": "C-c", "mystery": "C-c"} {
+		fake := newFakeTmux()
+		fake.addAgent("hq-agent", runtime, true)
+		fake.setScreens("> ")
+		p := newTestPrompter(t, fake)
+
+		if _, err := p.Interrupt("hq-agent", InterruptSoft, time.Second); err != nil {
+			t.Fatalf("Interrupt(%s) error: %v", runtime, err)
+		}
+		if calls := fake.Calls(); len(calls) != 1 || calls[0] != "keys hq-agent "+want {
+			t.Fatalf("%s calls = %v, want [keys hq-agent %s]", runtime, calls, want)
+		}
+	}
+}
+
+func TestInterruptHardReportsStillBusy(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "codex", true)
+	fake.setScreens("Working (esc to interrupt)")
+	p := newTestPrompter(t, fake)
+
+	result, err := p.Interrupt("hq-agent", InterruptHard, 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Interrupt() error: %v", err)
+	}
+	if result.Stopped {
+		t.Fatalf("result = %+v, want not stopped", result)
+	}
+	if calls := fake.Calls(); len(calls) != 1 || calls[0] != "keys hq-agent C-c" {
+		t.Fatalf("calls = %v, want [keys hq-agent C-c]", calls)
+	}
+}
+
+func TestInterruptKillProcess(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "claude", true)
+	p := newTestPrompter(t, fake)
+	p.agentPID = func(string) (int, error) { return 4242, nil }
+
+	var sent []syscall.Signal
+	alive := true
+	p.signal = func(pid int, sig syscall.Signal) error {
+		if pid != 4242 {
+			t.Fatalf("signal sent to pid %d", pid)
+		}
+		if sig == 0 {
+			if alive {
+				return nil
+			}
+			return syscall.ESRCH
+		}
+		sent = append(sent, sig)
+		if sig == syscall.SIGTERM {
+			alive = false
+		}
+		return nil
+	}
+
+	result, err := p.Interrupt("hq-agent", InterruptKill, time.Second)
+	if err != nil {
+		t.Fatalf("Interrupt() error: %v", err)
+	}
+	if !result.Stopped || result.PID != 4242 || result.Evidence != "process exited after SIGTERM" {
+		t.Fatalf("result = %+v", result)
+	}
+	if len(sent) != 1 || sent[0] != syscall.SIGTERM {
+		t.Fatalf("signals = %v, want [SIGTERM]", sent)
+	}
+}
+
+func TestInterruptRejectsUnknownLevel(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "claude", true)
+	p := newTestPrompter(t, fake)
+
+	if _, err := p.Interrupt("hq-agent", "gentle", time.Second); err == nil {
+		t.Fatal("expected error for unknown level")
+	}
+	if _, err := p.Interrupt("missing", InterruptSoft, time.Second); err == nil {
+		t.Fatal("expected error for unknown agent")
+	}
+	if len(fake.Calls()) != 0 {
+		t.Fatalf("expected no tmux calls, got %v", fake.Calls())
+	}
+}
@@ -0,0 +1,218 @@
+package agentio
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// MaxKeyInputs bounds the number of entries in one send-keys request.
+	MaxKeyInputs = 256
+	// MaxKeyRepeat bounds the repeat count of a single key entry.
+	MaxKeyRepeat = 100
+)
+
+// KeyInput is one entry of a send-keys request: either a named key with
+// optional modifiers and repeat count, or a literal text segment.
+type KeyInput struct {
+	Key    string `json:"key,omitempty"`  // "Enter", "Up", "r", or a combo like "Ctrl-R"
+	Text   string `json:"text,omitempty"` // typed literally
+	Ctrl   bool   `json:"ctrl,omitempty"`
+	Alt    bool   `json:"alt,omitempty"`
+	Shift  bool   `json:"shift,omitempty"`
+	Repeat int    `json:"repeat,omitempty"` // default 1
+}
+
+// namedKeys maps lowercase key names and aliases to tmux key names.
+var namedKeys = map[string]string{
+	"enter": "Enter", "return": "Enter",
+	"escape": "Escape", "esc": "Escape",
+	"tab": "Tab", "btab": "BTab",
+	"space":     "Space",
+	"backspace": "BSpace", "bspace": "BSpace",
+	"delete": "DC", "del": "DC", "dc": "DC",
+	"insert": "IC", "ins": "IC", "ic": "IC",
+	"up": "Up", "down": "Down", "left": "Left", "right": "Right",
+	"home": "Home", "end": "End",
+	"pageup": "PgUp", "pgup": "PgUp", "ppage": "PgUp",
+	"pagedown": "PgDn", "pgdn": "PgDn", "npage": "PgDn",
+	"f1": "F1", "f2": "F2", "f3": "F3", "f4": "F4", "f5": "F5", "f6": "F6",
+	"f7": "F7", "f8": "F8", "f9": "F9", "f10": "F10", "f11": "F11", "f12": "F12",
+}
+
+// KeyNames returns the canonical named keys accepted by TmuxKeyName, sorted.
+// Aliases ("esc", "pgup", ...) are accepted too but not listed.
+func KeyNames() []string {
+	seen := make(map[string]bool, len(namedKeys))
+	var names []string
+	for _, name := range namedKeys {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// modifierPrefixes maps the combo prefixes accepted in a key name (lowercase)
+// to the modifier they set: 'c'trl, 'a'lt or 's'hift.
+var modifierPrefixes = []struct {
+	prefix   string
+	modifier byte
+}{
+	{"ctrl-", 'c'}, {"control-", 'c'}, {"c-", 'c'},
+	{"alt-", 'a'}, {"meta-", 'a'}, {"option-", 'a'}, {"m-", 'a'},
+	{"shift-", 's'}, {"s-", 's'},
+}
+
+// TmuxModifiers returns the tmux key-name prefix for a modifier set, in
+// tmux's canonical C-M-S order.
+func TmuxModifiers(ctrl, alt, shift bool) string {
+	var b strings.Builder
+	if ctrl {
+		b.WriteString("C-")
+	}
+	if alt {
+		b.WriteString("M-")
+	}
+	if shift {
+		b.WriteString("S-")
+	}
+	return b.String()
+}
+
+// TmuxKeyName maps a key name and modifiers to a tmux send-keys key name.
+// key may carry its own modifier prefixes ("Ctrl-R", "Alt-Enter", "S-Up"),
+// which are combined with the flags. Single characters are sent as-is:
+// Shift uppercases letters, Ctrl and Alt become C- and M- prefixes.
+func TmuxKeyName(key string, ctrl, alt, shift bool) (string, error) {
+	name := key
+	for {
+		stripped := false
+		lower := strings.ToLower(name)
+		for _, m := range modifierPrefixes {
+			if strings.HasPrefix(lower, m.prefix) && len(name) > len(m.prefix) {
+				switch m.modifier {
+				case 'c':
+					ctrl = true
+				case 'a':
+					alt = true
+				case 's':
+					shift = true
+				}
+				name = name[len(m.prefix):]
+				stripped = true
+				break
+			}
+		}
+		if !stripped {
+			break
+		}
+	}
+
+	if tmuxName, ok := namedKeys[strings.ToLower(name)]; ok {
+		if tmuxName == "Tab" && shift {
+			tmuxName, shift = "BTab", false
+		}
+		return TmuxModifiers(ctrl, alt, shift) + tmuxName, nil
+	}
+
+	runes := []rune(name)
+	if len(runes) != 1 {
+		return "", errorf(ErrInvalidArgument, "unknown key %q", key)
+	}
+	r := runes[0]
+	if r < 0x20 || r == 0x7f {
+		return "", errorf(ErrInvalidArgument, "control character %q must be sent as a named key", name)
+	}
+	isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	if shift {
+		if !isLetter {
+			return "", errorf(ErrInvalidArgument, "shift is only supported with letters and named keys, not %q", name)
+		}
+		if !ctrl {
+			return TmuxModifiers(false, alt, false) + strings.ToUpper(name), nil
+		}
+	}
+	if ctrl && isLetter {
+		// tmux has no distinct Ctrl+Shift+letter; C-r and C-R are the same byte.
+		name = strings.ToLower(name)
+		shift = false
+	}
+	return TmuxModifiers(ctrl, alt, shift) + name, nil
+}
+
+// keyStep is one tmux call: either literal text or a batch of key names.
+type keyStep struct {
+	literal string
+	keys    []string
+}
+
+// planKeys validates inputs and converts them into tmux calls, batching
+// consecutive keys into a single send-keys.
+func planKeys(inputs []KeyInput) ([]keyStep, error) {
+	if len(inputs) == 0 {
+		return nil, errorf(ErrInvalidArgument, "keys must not be empty")
+	}
+	if len(inputs) > MaxKeyInputs {
+		return nil, errorf(ErrTooLarge, "too many keys: %d (max %d)", len(inputs), MaxKeyInputs)
+	}
+
+	var steps []keyStep
+	for i, in := range inputs {
+		switch {
+		case in.Key != "" && in.Text != "":
+			return nil, errorf(ErrInvalidArgument, "keys[%d]: key and text are mutually exclusive", i)
+		case in.Text != "":
+			if in.Ctrl || in.Alt || in.Shift || in.Repeat > 1 {
+				return nil, errorf(ErrInvalidArgument, "keys[%d]: text does not take modifiers or repeat", i)
+			}
+			steps = append(steps, keyStep{literal: in.Text})
+		case in.Key != "":
+			repeat := max(in.Repeat, 1)
+			if repeat > MaxKeyRepeat {
+				return nil, errorf(ErrInvalidArgument, "keys[%d]: repeat %d exceeds max %d", i, repeat, MaxKeyRepeat)
+			}
+			name, err := TmuxKeyName(in.Key, in.Ctrl, in.Alt, in.Shift)
+			if err != nil {
+				return nil, fmt.Errorf("keys[%d]: %w", i, err)
+			}
+			if len(steps) == 0 || steps[len(steps)-1].keys == nil {
+				steps = append(steps, keyStep{keys: []string{}})
+			}
+			last := &steps[len(steps)-1]
+			for range repeat {
+				last.keys = append(last.keys, name)
+			}
+		default:
+			return nil, errorf(ErrInvalidArgument, "keys[%d]: key or text required", i)
+		}
+	}
+	return steps, nil
+}
+
+// SendKeys sends a validated key sequence to an agent. Nothing is sent if
+// any entry is invalid. The caller must hold the per-agent lock.
+func (p *Prompter) SendKeys(agentName string, inputs []KeyInput) error {
+	if _, ok := p.Registry.GetAgent(agentName); !ok {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
+	}
+	steps, err := planKeys(inputs)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if step.keys == nil {
+			if err := p.Ctrl.SendKeysLiteral(agentName, step.literal); err != nil {
+				return fmt.Errorf("send text: %w", err)
+			}
+			continue
+		}
+		if err := p.Ctrl.SendKeysRaw(agentName, step.keys...); err != nil {
+			return fmt.Errorf("send keys %s: %w", strings.Join(step.keys, " "), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package agentio
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTmuxKeyName(t *testing.T) {
+	cases := []struct {
+		key              string
+		ctrl, alt, shift bool
+		want             string
+	}{
+		{key: "Enter", want: "Enter"},
+		{key: "return", want: "Enter"},
+		{key: "Tab", want: "Tab"},
+		{key: "Tab", shift: true, want: "BTab"},
+		{key: "Up", shift: true, want: "S-Up"},
+		{key: "Shift-Up", want: "S-Up"},
+		{key: "r", ctrl: true, want: "C-r"},
+		{key: "Ctrl-R", want: "C-r"},
+		{key: "C-r", want: "C-r"},
+		{key: "Alt-Enter", want: "M-Enter"},
+		{key: "Enter", alt: true, want: "M-Enter"},
+		{key: "Ctrl-Alt-Delete", want: "C-M-DC"},
+		{key: "Right", ctrl: true, shift: true, want: "C-S-Right"},
+		{key: "a", shift: true, want: "A"},
+		{key: "b", alt: true, shift: true, want: "M-B"},
+		{key: "/", want: "/"},
+		{key: "-", want: "-"},
+		{key: "pgup", want: "PgUp"},
+		{key: "F5", ctrl: true, want: "C-F5"},
+	}
+
+	for _, tc := range cases {
+		got, err := TmuxKeyName(tc.key, tc.ctrl, tc.alt, tc.shift)
+		if err != nil {
+			t.Fatalf("TmuxKeyName(%q, ctrl=%v alt=%v shift=%v) error: %v", tc.key, tc.ctrl, tc.alt, tc.shift, err)
+		}
+		if got != tc.want {
+			t.Fatalf("TmuxKeyName(%q, ctrl=%v alt=%v shift=%v) = %q, want %q", tc.key, tc.ctrl, tc.alt, tc.shift, got, tc.want)
+		}
+	}
+}
+
+func TestTmuxKeyNameErrors(t *testing.T) {
+	for _, key := range []string{"Hyper", "ab", "\x01", "Ctrl-"} {
+		if _, err := TmuxKeyName(key, false, false, false); !errors.Is(err, ErrInvalidArgument) {
+			t.Fatalf("TmuxKeyName(%q) err = %v, want ErrInvalidArgument", key, err)
+		}
+	}
+	if _, err := TmuxKeyName("1", false, false, true); err == nil {
+		t.Fatal("expected error for shift with a non-letter character")
+	}
+}
+
+func TestSendKeysBatchesKeysAndText(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "claude", true)
+	p := newTestPrompter(t, fake)
+
+	err := p.SendKeys("hq-agent", []KeyInput{
+		{Key: "r", Ctrl: true},
+		{Text: "git log"},
+		{Key: "Up", Shift: true, Repeat: 3},
+		{Key: "Tab"},
+		{Key: "Alt-Enter"},
+	})
+	if err != nil {
+		t.Fatalf("SendKeys() error: %v", err)
+	}
+
+	want := []string{
+		"keys hq-agent C-r",
+		`literal hq-agent "git log"`,
+		"keys hq-agent S-Up S-Up S-Up Tab M-Enter",
+	}
+	if got := fake.Calls(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("calls:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSendKeysValidatesBeforeSending(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "claude", true)
+	p := newTestPrompter(t, fake)
+
+	invalid := [][]KeyInput{
+		nil,
+		{{Key: "Enter"}, {Key: "NoSuchKey"}},
+		{{Key: "Enter", Text: "both"}},
+		{{Text: "hi", Ctrl: true}},
+		{{Key: "Up", Repeat: MaxKeyRepeat + 1}},
+		{{}},
+	}
+	for _, inputs := range invalid {
+		if err := p.SendKeys("hq-agent", inputs); err == nil {
+			t.Fatalf("SendKeys(%+v) expected error", inputs)
+		}
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("expected nothing sent for invalid input, got %v", calls)
+	}
+}
@@ -0,0 +1,342 @@
+package agentio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PasteMode is what an upload turns into in the agent's input.
+type PasteMode string
+
+const (
+	PasteInline       PasteMode = "inline"        // the file contents
+	PasteFenced       PasteMode = "fenced"        // the contents in a fenced code block after the file name
+	PastePath         PasteMode = "path"          // a workdir-relative path (absolute fallback)
+	PasteAbsolutePath PasteMode = "absolute-path" // the absolute server-side path
+	PasteRefuse       PasteMode = "refuse"        // reject the upload; nothing is stored or pasted
+)
+
+// FileCategory classifies an upload by its sniffed content.
+type FileCategory string
+
+const (
+	FileText       FileCategory = "text"
+	FileImage      FileCategory = "image"
+	FileExecutable FileCategory = "executable" // native ELF, Mach-O and PE binaries
+	FileBinary     FileCategory = "binary"
+)
+
+// ErrUploadRefused is returned when the paste policy refuses an upload.
+var ErrUploadRefused = errors.New("upload refused by paste policy")
+
+// sniffBytes is how much of a file SniffMimeType looks at.
+const sniffBytes = 512
+
+// PastePolicy chooses a PasteMode for each file category.
+type PastePolicy struct {
+	Text           PasteMode `json:"text,omitempty"`
+	Image          PasteMode `json:"image,omitempty"`
+	Binary         PasteMode `json:"binary,omitempty"`
+	Executable     PasteMode `json:"executable,omitempty"`
+	MaxInlineBytes int       `json:"maxInlineBytes,omitempty"` // text larger than this pastes a path
+}
+
+// DefaultPastePolicy pastes text up to 256KB inline, images as absolute
+// paths (so agents like Claude Code can read and render them), and
+// everything else as a relative path.
+func DefaultPastePolicy() PastePolicy {
+	return PastePolicy{
+		Text:           PasteInline,
+		Image:          PasteAbsolutePath,
+		Binary:         PastePath,
+		Executable:     PastePath,
+		MaxInlineBytes: maxInlinePasteBytes,
+	}
+}
+
+// ModeFor returns the mode for a category.
+func (p PastePolicy) ModeFor(category FileCategory) PasteMode {
+	switch category {
+	case FileText:
+		return p.Text
+	case FileImage:
+		return p.Image
+	case FileExecutable:
+		return p.Executable
+	default:
+		return p.Binary
+	}
+}
+
+// Validate reports unknown modes.
+func (p PastePolicy) Validate() error {
+	for _, m := range []PasteMode{p.Text, p.Image, p.Binary, p.Executable} {
+		switch m {
+		case PasteInline, PasteFenced, PastePath, PasteAbsolutePath, PasteRefuse:
+		default:
+			return fmt.Errorf("unknown paste mode %q", m)
+		}
+	}
+	if p.MaxInlineBytes < 0 {
+		return fmt.Errorf("maxInlineBytes must not be negative")
+	}
+	return nil
+}
+
+// merge overlays the non-zero fields of o onto p.
+func (p PastePolicy) merge(o PastePolicy) PastePolicy {
+	if o.Text != "" {
+		p.Text = o.Text
+	}
+	if o.Image != "" {
+		p.Image = o.Image
+	}
+	if o.Binary != "" {
+		p.Binary = o.Binary
+	}
+	if o.Executable != "" {
+		p.Executable = o.Executable
+	}
+	if o.MaxInlineBytes != 0 {
+		p.MaxInlineBytes = o.MaxInlineBytes
+	}
+	return p
+}
+
+// UploadResult reports what the server made of an upload.
+type UploadResult struct {
+	FileName       string        `json:"fileName"`
+	Size           int64         `json:"size"`
+	ClientMimeType string        `json:"clientMimeType,omitempty"` // as sent by the client
+	MimeType       string        `json:"mimeType"`                 // sniffed by the server
+	Category       FileCategory  `json:"category"`
+	Action         PasteMode     `json:"action"`
+	Reason         string        `json:"reason,omitempty"` // why Action differs from the policy's mode
+	PastePath      string        `json:"pastePath,omitempty"`
+	PastedBytes    int           `json:"pastedBytes,omitempty"`
+	Upload         *UploadRecord `json:"upload,omitempty"`
+}
+
+// PastePolicyFor returns the paste policy for a runtime.
+func (p *Prompter) PastePolicyFor(runtime string) PastePolicy {
+	p.strategyMu.RLock()
+	defer p.strategyMu.RUnlock()
+	if policy, ok := p.pastePolicies[runtime]; ok {
+		return policy
+	}
+	return p.pastePolicies[""]
+}
+
+// SetPastePolicy replaces the paste policy for a runtime ("" for the default
+// used by runtimes without their own).
+func (p *Prompter) SetPastePolicy(runtime string, policy PastePolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	p.strategyMu.Lock()
+	defer p.strategyMu.Unlock()
+	p.pastePolicies[runtime] = policy
+	return nil
+}
+
+// LoadPastePolicies reads paste policy overrides from a JSON file of the form
+// {"default": {"executable": "refuse"}, "codex": {"text": "fenced"}}.
+// "default" applies to every runtime; per-runtime fields override it.
+func (p *Prompter) LoadPastePolicies(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read paste policy: %w", err)
+	}
+	var overrides map[string]PastePolicy
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("parse paste policy %s: %w", path, err)
+	}
+
+	base := DefaultPastePolicy().merge(overrides["default"])
+	if err := p.SetPastePolicy("", base); err != nil {
+		return fmt.Errorf("paste policy %s: default: %w", path, err)
+	}
+	for runtime, o := range overrides {
+		if runtime == "default" {
+			continue
+		}
+		if s, ok := p.StrategyFor(runtime).(KeySequenceStrategy); !ok || s.Runtime != runtime {
+			return fmt.Errorf("paste policy %s: unknown runtime %q", path, runtime)
+		}
+		policy := base.merge(o)
+		if err := p.SetPastePolicy(runtime, policy); err != nil {
+			return fmt.Errorf("paste policy %s: %s: %w", path, runtime, err)
+		}
+		log.Printf("paste policy: %s = %+v", runtime, policy)
+	}
+	return nil
+}
+
+// SniffMimeType determines a file's MIME type from its leading bytes,
+// falling back to the file extension when the content is not distinctive.
+// The client-supplied type is never trusted.
+func SniffMimeType(fileName string, head []byte) string {
+	if len(head) > sniffBytes {
+		head = head[:sniffBytes]
+	}
+	if m := executableMimeType(head); m != "" {
+		return m
+	}
+
+	detected, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	byExt := mimeTypeByExtension(fileName)
+	switch detected {
+	case "application/octet-stream":
+		if byExt != "" && !isTextMimeType(byExt) {
+			return byExt
+		}
+		return detected
+	case "text/plain":
+		// Plain text says little; a text-ish extension is more specific.
+		if byExt != "" && isTextMimeType(byExt) {
+			return byExt
+		}
+		return detected
+	default:
+		return detected
+	}
+}
+
+func mimeTypeByExtension(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext == "" {
+		return ""
+	}
+	if m, ok := textExtensions[ext]; ok {
+		return m
+	}
+	m, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	return m
+}
+
+// textExtensions covers source files the system MIME table often misses.
+var textExtensions = map[string]string{
+	".md":    "text/markdown",
+	".json":  "application/json",
+	".yaml":  "application/x-yaml",
+	".yml":   "application/x-yaml",
+	".toml":  "application/toml",
+	".go":    "text/x-go",
+	".py":    "text/x-python",
+	".rs":    "text/x-rust",
+	".ts":    "text/x-typescript",
+	".tsx":   "text/x-typescript",
+	".js":    "text/javascript",
+	".sh":    "text/x-shellscript",
+	".diff":  "text/x-diff",
+	".patch": "text/x-diff",
+	".log":   "text/plain",
+	".csv":   "text/csv",
+}
+
+func isTextMimeType(m string) bool {
+	if strings.HasPrefix(m, "text/") {
+		return true
+	}
+	switch m {
+	case "application/json", "application/xml", "application/x-yaml", "application/toml", "application/javascript":
+		return true
+	}
+	return false
+}
+
+// executableMimeType recognizes native executables by their magic bytes.
+func executableMimeType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		return "application/x-executable"
+	case bytes.HasPrefix(head, []byte{0xfe, 0xed, 0xfa, 0xce}), bytes.HasPrefix(head, []byte{0xfe, 0xed, 0xfa, 0xcf}),
+		bytes.HasPrefix(head, []byte{0xce, 0xfa, 0xed, 0xfe}), bytes.HasPrefix(head, []byte{0xcf, 0xfa, 0xed, 0xfe}):
+		return "application/x-mach-binary"
+	case bytes.HasPrefix(head, []byte("MZ")) && len(head) >= 0x40:
+		// MZ alone is too weak; require the PE header it points at.
+		off := int(binary.LittleEndian.Uint32(head[0x3c:]))
+		if off >= 0x40 && off+4 <= len(head) && bytes.Equal(head[off:off+4], []byte("PE\x00\x00")) {
+			return "application/vnd.microsoft.portable-executable"
+		}
+	}
+	return ""
+}
+
+// ClassifyFile puts a sniffed upload into a FileCategory. head holds the
+// first bytes of the file.
+func ClassifyFile(mimeType string, head []byte) FileCategory {
+	switch {
+	case executableMimeType(head) != "":
+		return FileExecutable
+	case strings.HasPrefix(mimeType, "image/") && mimeType != "image/svg+xml":
+		return FileImage
+	case IsUTF8Text(head):
+		return FileText
+	default:
+		return FileBinary
+	}
+}
+
+// decidePaste resolves the policy's mode for an upload. Text modes fall back
+// to a path when the file exceeds MaxInlineBytes or is not valid text.
+func decidePaste(policy PastePolicy, category FileCategory, size int64) (PasteMode, string) {
+	mode := policy.ModeFor(category)
+	if mode == PasteInline || mode == PasteFenced {
+		if category != FileText {
+			return PastePath, fmt.Sprintf("%s files cannot be pasted %s", category, mode)
+		}
+		if size > int64(policy.MaxInlineBytes) {
+			return PastePath, fmt.Sprintf("text larger than %d bytes", policy.MaxInlineBytes)
+		}
+	}
+	return mode, ""
+}
+
+// renderPaste builds the bytes to paste for a mode. File paths get a
+// trailing space so multiple attachments don't run together.
+func renderPaste(mode PasteMode, fileName, savedPath, pastePath string, content []byte) []byte {
+	switch mode {
+	case PasteInline:
+		return content
+	case PasteFenced:
+		return fenceText(fileName, content)
+	case PasteAbsolutePath:
+		return []byte(savedPath + " ")
+	default:
+		return []byte(pastePath + " ")
+	}
+}
+
+// fenceText wraps content in a Markdown code fence preceded by the file
+// name, using a fence longer than any backtick run inside the content.
+func fenceText(fileName string, content []byte) []byte {
+	longest, run := 0, 0
+	for _, b := range content {
+		if b == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+
+	var buf bytes.Buffer
+	buf.WriteString(filepath.Base(fileName) + ":\n" + fence + "\n")
+	buf.Write(content)
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(fence + "\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,170 @@
+package agentio
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func peHeader() []byte {
+	head := make([]byte, 0x90)
+	copy(head, "MZ")
+	binary.LittleEndian.PutUint32(head[0x3c:], 0x80)
+	copy(head[0x80:], "PE\x00\x00")
+	return head
+}
+
+func TestSniffMimeType(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		head []byte
+		want string
+	}{
+		{"png content beats extension", "notes.txt", pngHeader, "image/png"},
+		{"elf", "tool", []byte("\x7fELF\x02\x01\x01\x00"), "application/x-executable"},
+		{"mach-o", "tool", []byte{0xcf, 0xfa, 0xed, 0xfe, 0x07, 0x00}, "application/x-mach-binary"},
+		{"pe", "setup.txt", peHeader(), "application/vnd.microsoft.portable-executable"},
+		{"mz text is not pe", "notes", []byte("MZ is a prefix, not a binary"), "text/plain"},
+		{"text refined by extension", "main.go", []byte("package main\n"), "text/x-go"},
+		{"text ignores binary extension", "photo.png", []byte("not really a png\n"), "text/plain"},
+		{"pdf magic", "report", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"plain text", "README", []byte("hello\n"), "text/plain"},
+	}
+	for _, tt := range tests {
+		if got := SniffMimeType(tt.file, tt.head); got != tt.want {
+			t.Errorf("%s: SniffMimeType(%q) = %q, want %q", tt.name, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyFile(t *testing.T) {
+	tests := []struct {
+		mime string
+		head []byte
+		want FileCategory
+	}{
+		{"image/png", pngHeader, FileImage},
+		{"application/x-executable", []byte("\x7fELF\x02"), FileExecutable},
+		{"text/x-go", []byte("package main\n"), FileText},
+		{"image/svg+xml", []byte("<svg></svg>"), FileText},
+		{"application/octet-stream", []byte{0x00, 0x01}, FileBinary},
+	}
+	for _, tt := range tests {
+		if got := ClassifyFile(tt.mime, tt.head); got != tt.want {
+			t.Errorf("ClassifyFile(%q) = %q, want %q", tt.mime, got, tt.want)
+		}
+	}
+}
+
+func TestDecidePasteFallsBackToPath(t *testing.T) {
+	policy := DefaultPastePolicy()
+	policy.Binary = PasteInline
+	policy.MaxInlineBytes = 10
+
+	if mode, reason := decidePaste(policy, FileText, 10); mode != PasteInline || reason != "" {
+		t.Fatalf("small text = %s (%s), want inline", mode, reason)
+	}
+	if mode, reason := decidePaste(policy, FileText, 11); mode != PastePath || reason == "" {
+		t.Fatalf("large text = %s (%q), want path with a reason", mode, reason)
+	}
+	if mode, _ := decidePaste(policy, FileBinary, 3); mode != PastePath {
+		t.Fatalf("inline binary = %s, want path", mode)
+	}
+}
+
+func TestFenceText(t *testing.T) {
+	got := string(fenceText("/srv/out/notes.md", []byte("see ```go\nx\n```")))
+	want := "notes.md:\n````\nsee ```go\nx\n```\n````\n"
+	if got != want {
+		t.Fatalf("fenceText() = %q, want %q", got, want)
+	}
+}
+
+func TestTrimPartialRune(t *testing.T) {
+	text := []byte("naïve") // ï is two bytes
+	if got := trimPartialRune(text[:3]); string(got) != "na" {
+		t.Fatalf("trimPartialRune(cut rune) = %q, want %q", got, "na")
+	}
+	if got := trimPartialRune(text); string(got) != "naïve" {
+		t.Fatalf("trimPartialRune(whole) = %q", got)
+	}
+}
+
+func TestLoadPastePolicies(t *testing.T) {
+	p := newTestPrompter(t, newFakeTmux())
+	path := filepath.Join(t.TempDir(), "paste.json")
+	writeFile(t, path, `{"default": {"executable": "refuse"}, "codex": {"text": "fenced", "maxInlineBytes": 1024}}`)
+
+	if err := p.LoadPastePolicies(path); err != nil {
+		t.Fatalf("LoadPastePolicies() error: %v", err)
+	}
+	codex := p.PastePolicyFor("codex")
+	if codex.Text != PasteFenced || codex.MaxInlineBytes != 1024 || codex.Executable != PasteRefuse || codex.Image != PasteAbsolutePath {
+		t.Fatalf("codex policy = %+v", codex)
+	}
+	claude := p.PastePolicyFor("claude")
+	if claude.Text != PasteInline || claude.Executable != PasteRefuse {
+		t.Fatalf("claude policy = %+v", claude)
+	}
+
+	writeFile(t, path, `{"nope": {"text": "fenced"}}`)
+	if err := p.LoadPastePolicies(path); err == nil || !strings.Contains(err.Error(), "unknown runtime") {
+		t.Fatalf("unknown runtime err = %v", err)
+	}
+	writeFile(t, path, `{"codex": {"text": "shout"}}`)
+	if err := p.LoadPastePolicies(path); err == nil || !strings.Contains(err.Error(), "unknown paste mode") {
+		t.Fatalf("bad mode err = %v", err)
+	}
+}
+
+func TestHandleFileUploadRefusesExecutables(t *testing.T) {
+	fake, p, workDir := newWorkDirPrompter(t, "claude")
+	policy := DefaultPastePolicy()
+	policy.Executable = PasteRefuse
+	if err := p.SetPastePolicy("claude", policy); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := append([]byte("tool.png\x00image/png\x00"), "\x7fELF\x02\x01\x01\x00"...)
+	result, err := p.HandleFileUpload("hq-agent", payload, "10.0.0.5:1")
+	if !errors.Is(err, ErrUploadRefused) {
+		t.Fatalf("HandleFileUpload() err = %v, want ErrUploadRefused", err)
+	}
+	if result.Category != FileExecutable || result.Action != PasteRefuse || result.ClientMimeType != "image/png" || result.Upload != nil {
+		t.Fatalf("result = %+v", result)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("refused upload pasted: %v", calls)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, ".tmux-adapter", "uploads", "hq-agent")); !os.IsNotExist(err) {
+		t.Fatalf("refused upload was stored: %v", err)
+	}
+}
+
+func TestHandleFileUploadFencedText(t *testing.T) {
+	fake, p, _ := newWorkDirPrompter(t, "codex")
+	policy := DefaultPastePolicy()
+	policy.Text = PasteFenced
+	if err := p.SetPastePolicy("codex", policy); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte("main.go\x00application/octet-stream\x00package main\n")
+	result, err := p.HandleFileUpload("hq-agent", payload, "")
+	if err != nil {
+		t.Fatalf("HandleFileUpload() error: %v", err)
+	}
+	if result.MimeType != "text/x-go" || result.Category != FileText || result.Action != PasteFenced || result.Upload == nil {
+		t.Fatalf("result = %+v", result)
+	}
+	want := `paste hq-agent "main.go:\n` + "```" + `\npackage main\n` + "```" + `\n"`
+	if calls := fake.Calls(); len(calls) != 1 || calls[0] != want {
+		t.Fatalf("calls = %v, want [%s]", calls, want)
+	}
+}
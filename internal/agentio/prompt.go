@@ -2,29 +2,57 @@ package agentio
 
 import (
 	"fmt"
-	"log"
 	"sync"
-	"time"
+	"syscall"
 
 	"github.com/gastownhall/tmux-adapter/internal/agents"
 	"github.com/gastownhall/tmux-adapter/internal/tmux"
 )
 
+// ControlModeInterface abstracts the tmux control mode operations needed by
+// Prompter, enabling testing with a fake tmux.
+type ControlModeInterface interface {
+	SendKeysLiteral(target, text string) error
+	SendKeysRaw(target string, keys ...string) error
+	ResizePane(target, delta string) error
+	PasteBytes(target string, data []byte) error
+	PasteBytesBracketed(target string, data []byte) error
+	GetPaneInfo(session string) (tmux.PaneInfo, error)
+	CapturePaneVisible(session string) (string, error)
+}
+
 // Prompter handles sending prompts and file uploads to agents via tmux.
 // It owns per-agent mutexes for serializing sends.
 type Prompter struct {
-	Ctrl     *tmux.ControlMode
-	Registry *agents.Registry
-	locks    map[string]*sync.Mutex
-	locksMu  sync.Mutex
+	Ctrl       ControlModeInterface
+	Registry   *agents.Registry
+	Uploads    *UploadStore
+	Chunks     *ChunkedUploads
+	Files      *FileBrowser
+	locks      map[string]*sync.Mutex
+	locksMu    sync.Mutex
+	strategies map[string]PromptStrategy
+	strategyMu sync.RWMutex // guards strategies and pastePolicies
+
+	pastePolicies map[string]PastePolicy // by runtime; "" is the default
+
+	agentPID func(agentName string) (int, error)     // resolves the agent process for kill-process
+	signal   func(pid int, sig syscall.Signal) error // syscall.Kill, replaceable in tests
 }
 
-// NewPrompter creates a new Prompter.
-func NewPrompter(ctrl *tmux.ControlMode, registry *agents.Registry) *Prompter {
+// NewPrompter creates a new Prompter with the default per-runtime prompt strategies.
+func NewPrompter(ctrl ControlModeInterface, registry *agents.Registry) *Prompter {
 	return &Prompter{
-		Ctrl:     ctrl,
-		Registry: registry,
-		locks:    make(map[string]*sync.Mutex),
+		Ctrl:          ctrl,
+		Registry:      registry,
+		Uploads:       NewUploadStore(registry, DefaultUploadPolicy()),
+		Chunks:        NewChunkedUploads(""),
+		Files:         NewFileBrowser(registry, DefaultFilePolicy()),
+		locks:         make(map[string]*sync.Mutex),
+		strategies:    DefaultPromptStrategies(),
+		pastePolicies: map[string]PastePolicy{"": DefaultPastePolicy()},
+		agentPID:      registry.AgentPID,
+		signal:        syscall.Kill,
 	}
 }
 
@@ -38,59 +66,61 @@ func (p *Prompter) GetLock(agent string) *sync.Mutex {
 	return p.locks[agent]
 }
 
-// SendPrompt sends a prompt to an agent using the nudge sequence:
-// SendKeysLiteral → 500ms → Escape → 100ms → Enter (3x retry, 200ms) → SIGWINCH wake.
-// The caller must hold the per-agent lock.
-func (p *Prompter) SendPrompt(agentName, prompt string) error {
-	agent, ok := p.Registry.GetAgent(agentName)
-	if !ok {
-		return fmt.Errorf("agent not found: %s", agentName)
+// StrategyFor returns the prompt strategy for a runtime, falling back to
+// claude's strategy for unknown runtimes (matching agents.GetProcessNames).
+func (p *Prompter) StrategyFor(runtime string) PromptStrategy {
+	p.strategyMu.RLock()
+	defer p.strategyMu.RUnlock()
+	if s, ok := p.strategies[runtime]; ok {
+		return s
 	}
+	return p.strategies["claude"]
+}
 
-	session := agent.Name
+// SetStrategy replaces the prompt strategy used for a runtime.
+func (p *Prompter) SetStrategy(runtime string, strategy PromptStrategy) {
+	p.strategyMu.Lock()
+	defer p.strategyMu.Unlock()
+	p.strategies[runtime] = strategy
+}
 
-	// 1. Send text in literal mode
-	if err := p.Ctrl.SendKeysLiteral(session, prompt); err != nil {
-		return fmt.Errorf("send literal: %w", err)
+// SetPromptTiming overrides the timings of a runtime's key-sequence strategy.
+// Returns an error if the runtime has no strategy or its strategy is not timing-based.
+func (p *Prompter) SetPromptTiming(runtime string, timing PromptTiming) error {
+	p.strategyMu.Lock()
+	defer p.strategyMu.Unlock()
+	s, ok := p.strategies[runtime].(KeySequenceStrategy)
+	if !ok {
+		return fmt.Errorf("runtime %q has no key-sequence prompt strategy", runtime)
 	}
+	s.Timing = timing
+	p.strategies[runtime] = s
+	return nil
+}
 
-	// 2. Wait 500ms for paste to complete
-	time.Sleep(500 * time.Millisecond)
+// SendPrompt sends a prompt to an agent using the delivery strategy for the
+// agent's runtime (see DefaultPromptStrategies).
+// The caller must hold the per-agent lock.
+func (p *Prompter) SendPrompt(agentName, prompt string) error {
+	return p.sendPromptStaged(agentName, prompt, nil)
+}
 
-	// 3. Send Escape (for vim mode)
-	if err := p.Ctrl.SendKeysRaw(session, "Escape"); err != nil {
-		return fmt.Errorf("send Escape: %w", err)
+// sendPromptStaged is SendPrompt, calling typed between typing the prompt
+// and submitting it. Strategies that can't stage call typed before typing.
+func (p *Prompter) sendPromptStaged(agentName, prompt string, typed func()) error {
+	if len(prompt) > MaxPromptBytes {
+		return errorf(ErrTooLarge, "prompt too large: %d bytes (max %d)", len(prompt), MaxPromptBytes)
 	}
-	time.Sleep(100 * time.Millisecond)
-
-	// 4. Send Enter with 3x retry, 200ms backoff
-	var lastErr error
-	for attempt := range 3 {
-		if attempt > 0 {
-			time.Sleep(200 * time.Millisecond)
-		}
-		if err := p.Ctrl.SendKeysRaw(session, "Enter"); err != nil {
-			lastErr = err
-			continue
-		}
-
-		// 5. Wake detached sessions via SIGWINCH resize dance
-		if !agent.Attached {
-			if err := p.Ctrl.ResizePane(session, "-1"); err != nil {
-				log.Printf("send-prompt(%s): wake shrink resize failed: %v", session, err)
-			}
-			time.Sleep(50 * time.Millisecond)
-			if err := p.Ctrl.ResizePane(session, "+1"); err != nil {
-				log.Printf("send-prompt(%s): wake restore resize failed: %v", session, err)
-			}
-		}
-
-		return nil
+	agent, ok := p.Registry.GetAgent(agentName)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
 	}
-
-	errMsg := "failed to send Enter after 3 attempts"
-	if lastErr != nil {
-		errMsg += ": " + lastErr.Error()
+	strategy := p.StrategyFor(agent.Runtime)
+	if staged, ok := strategy.(StagedPromptStrategy); ok {
+		return staged.SendPromptStaged(p.Ctrl, agent, prompt, typed)
+	}
+	if typed != nil {
+		typed()
 	}
-	return fmt.Errorf("%s", errMsg)
+	return strategy.SendPrompt(p.Ctrl, agent, prompt)
 }
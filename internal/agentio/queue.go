@@ -0,0 +1,465 @@
+package agentio
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prompt queue item states.
+const (
+	PromptQueued      = "queued"
+	PromptWaitingIdle = "waiting-idle"
+	PromptDelivering  = "delivering"
+)
+
+// Prompt queue event actions.
+const (
+	QueueActionQueued    = "queued"
+	QueueActionStarted   = "started"
+	QueueActionDelivered = "delivered"
+	QueueActionFailed    = "failed"
+	QueueActionCancelled = "cancelled"
+	QueueActionReordered = "reordered"
+)
+
+const (
+	// MaxQueuedPromptsPerAgent bounds how many prompts may wait behind an agent.
+	MaxQueuedPromptsPerAgent = 50
+	// MaxIdleWait bounds how long a wait-idle prompt holds the queue before it
+	// is delivered anyway.
+	MaxIdleWait = 5 * time.Minute
+
+	queueSubscriberBufferSize = 100
+	idlePollInterval          = 250 * time.Millisecond
+	// idleStableFor is how long the visible pane must stay unchanged before the
+	// agent is considered idle.
+	idleStableFor = time.Second
+)
+
+// ErrPromptNotFound is returned when a queue operation names an unknown prompt ID.
+var ErrPromptNotFound = errors.New("prompt not found")
+
+// busyMarkers are status-line hints agent TUIs show while a turn is running.
+// Matched case-insensitively against the normalized visible pane.
+var busyMarkers = []string{"esc to interrupt", "esc to cancel", "ctrl+c to interrupt"}
+
+// QueuedPrompt is the client-visible view of a queued prompt.
+type QueuedPrompt struct {
+	ID         string    `json:"id"`
+	Agent      string    `json:"agent"`
+	Prompt     string    `json:"prompt"`
+	Submitter  string    `json:"submitter,omitempty"`
+	Priority   int       `json:"priority"`
+	WaitIdle   bool      `json:"waitIdle,omitempty"`
+	State      string    `json:"state"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+}
+
+// PromptRequest describes a prompt to enqueue.
+type PromptRequest struct {
+	Agent          string
+	Prompt         string
+	Submitter      string
+	Priority       int  // higher is delivered first; ties are FIFO
+	WaitIdle       bool // hold delivery until the agent's pane looks idle
+	Confirm        bool // deliver with SendPromptConfirmed
+	ConfirmTimeout time.Duration
+	Echo           PromptEchoWatcher
+}
+
+// PromptOutcome is reported once a queued prompt leaves the queue.
+type PromptOutcome struct {
+	Item      QueuedPrompt
+	Err       error
+	Cancelled bool
+	Delivery  *DeliveryResult // set when the request asked for confirmation
+}
+
+// QueueEvent describes a change to an agent's prompt queue.
+type QueueEvent struct {
+	Action string
+	Item   QueuedPrompt
+	Queue  []QueuedPrompt // the agent's queue after the change
+	Error  string         // for failed events
+}
+
+type queueItem struct {
+	QueuedPrompt
+	req       PromptRequest
+	done      func(PromptOutcome)
+	cancel    chan struct{} // closed to abort an idle wait
+	cancelled bool
+}
+
+type agentQueue struct {
+	running bool       // a worker goroutine owns this queue
+	active  *queueItem // popped and being waited on or delivered
+	pending []*queueItem
+}
+
+// PromptQueue serializes prompt delivery per agent with inspectable,
+// cancellable and reorderable pending items. One worker goroutine runs per
+// agent while it has queued prompts.
+type PromptQueue struct {
+	prompter *Prompter
+	mu       sync.Mutex
+	queues   map[string]*agentQueue
+	nextID   int64
+
+	subs      map[int]chan QueueEvent
+	nextSubID int
+
+	idlePoll    time.Duration
+	idleStable  time.Duration
+	maxIdleWait time.Duration
+}
+
+// NewPromptQueue creates a prompt queue delivering through p.
+func NewPromptQueue(p *Prompter) *PromptQueue {
+	return &PromptQueue{
+		prompter:    p,
+		queues:      make(map[string]*agentQueue),
+		subs:        make(map[int]chan QueueEvent),
+		idlePoll:    idlePollInterval,
+		idleStable:  idleStableFor,
+		maxIdleWait: MaxIdleWait,
+	}
+}
+
+// Enqueue adds a prompt to the agent's queue. done is called exactly once,
+// from the agent's worker goroutine or from Cancel, when the prompt is
+// delivered, fails or is cancelled.
+func (q *PromptQueue) Enqueue(req PromptRequest, done func(PromptOutcome)) (QueuedPrompt, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(req.Prompt) > MaxPromptBytes {
+		return QueuedPrompt{}, errorf(ErrTooLarge, "prompt too large: %d bytes (max %d)", len(req.Prompt), MaxPromptBytes)
+	}
+	aq, ok := q.queues[req.Agent]
+	if ok && len(aq.pending) >= MaxQueuedPromptsPerAgent {
+		return QueuedPrompt{}, errorf(ErrQueueFull, "prompt queue for %s is full (%d pending)", req.Agent, len(aq.pending))
+	}
+	if !ok {
+		aq = &agentQueue{}
+		q.queues[req.Agent] = aq
+	}
+
+	q.nextID++
+	item := &queueItem{
+		QueuedPrompt: QueuedPrompt{
+			ID:         fmt.Sprintf("p%d", q.nextID),
+			Agent:      req.Agent,
+			Prompt:     req.Prompt,
+			Submitter:  req.Submitter,
+			Priority:   req.Priority,
+			WaitIdle:   req.WaitIdle,
+			State:      PromptQueued,
+			EnqueuedAt: time.Now(),
+		},
+		req:    req,
+		done:   done,
+		cancel: make(chan struct{}),
+	}
+
+	// Insert after every item of equal or higher priority.
+	pos := len(aq.pending)
+	for i, other := range aq.pending {
+		if other.Priority < item.Priority {
+			pos = i
+			break
+		}
+	}
+	aq.pending = append(aq.pending, nil)
+	copy(aq.pending[pos+1:], aq.pending[pos:])
+	aq.pending[pos] = item
+
+	q.publishLocked(QueueActionQueued, item, "")
+	if !aq.running {
+		aq.running = true
+		go q.run(req.Agent)
+	}
+	return item.QueuedPrompt, nil
+}
+
+// List returns the queue for one agent, or for all agents when agent is empty.
+// The active prompt, if any, comes first.
+func (q *PromptQueue) List(agent string) []QueuedPrompt {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if agent != "" {
+		return q.snapshotLocked(agent)
+	}
+	names := make([]string, 0, len(q.queues))
+	for name := range q.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := []QueuedPrompt{}
+	for _, name := range names {
+		result = append(result, q.snapshotLocked(name)...)
+	}
+	return result
+}
+
+// Get returns a queued or active prompt by ID.
+func (q *PromptQueue) Get(id string) (QueuedPrompt, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, aq := range q.queues {
+		if aq.active != nil && aq.active.ID == id {
+			return aq.active.QueuedPrompt, true
+		}
+		for _, item := range aq.pending {
+			if item.ID == id {
+				return item.QueuedPrompt, true
+			}
+		}
+	}
+	return QueuedPrompt{}, false
+}
+
+// Cancel removes a queued prompt, or aborts one that is waiting for the
+// agent to go idle. Prompts already being delivered cannot be cancelled.
+func (q *PromptQueue) Cancel(id string) (QueuedPrompt, error) {
+	q.mu.Lock()
+	for _, aq := range q.queues {
+		if aq.active != nil && aq.active.ID == id {
+			item := aq.active
+			defer q.mu.Unlock()
+			if item.State != PromptWaitingIdle || item.cancelled {
+				return item.QueuedPrompt, errorf(ErrInvalidArgument, "prompt %s is already being delivered", id)
+			}
+			// The worker observes the closed channel and reports the outcome.
+			item.cancelled = true
+			close(item.cancel)
+			return item.QueuedPrompt, nil
+		}
+		for i, item := range aq.pending {
+			if item.ID != id {
+				continue
+			}
+			aq.pending = append(aq.pending[:i], aq.pending[i+1:]...)
+			q.publishLocked(QueueActionCancelled, item, "")
+			q.mu.Unlock()
+			item.done(PromptOutcome{Item: item.QueuedPrompt, Cancelled: true})
+			return item.QueuedPrompt, nil
+		}
+	}
+	q.mu.Unlock()
+	return QueuedPrompt{}, ErrPromptNotFound
+}
+
+// Reorder moves a queued prompt to position among the agent's pending
+// prompts (0 = next). Out-of-range positions are clamped.
+func (q *PromptQueue) Reorder(id string, position int) (QueuedPrompt, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, aq := range q.queues {
+		if aq.active != nil && aq.active.ID == id {
+			return aq.active.QueuedPrompt, errorf(ErrInvalidArgument, "prompt %s has already started", id)
+		}
+		for i, item := range aq.pending {
+			if item.ID != id {
+				continue
+			}
+			aq.pending = append(aq.pending[:i], aq.pending[i+1:]...)
+			position = min(max(position, 0), len(aq.pending))
+			aq.pending = append(aq.pending, nil)
+			copy(aq.pending[position+1:], aq.pending[position:])
+			aq.pending[position] = item
+			q.publishLocked(QueueActionReordered, item, "")
+			return item.QueuedPrompt, nil
+		}
+	}
+	return QueuedPrompt{}, ErrPromptNotFound
+}
+
+// Subscribe registers a consumer of queue events. Delivery is non-blocking:
+// a subscriber whose buffer is full misses events.
+func (q *PromptQueue) Subscribe() (int, <-chan QueueEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextSubID++
+	ch := make(chan QueueEvent, queueSubscriberBufferSize)
+	q.subs[q.nextSubID] = ch
+	return q.nextSubID, ch
+}
+
+// Unsubscribe removes a subscriber and closes its channel.
+func (q *PromptQueue) Unsubscribe(id int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if ch, ok := q.subs[id]; ok {
+		delete(q.subs, id)
+		close(ch)
+	}
+}
+
+// run is the per-agent worker: it delivers pending prompts in order until the
+// queue is empty.
+func (q *PromptQueue) run(agent string) {
+	for {
+		q.mu.Lock()
+		aq := q.queues[agent]
+		if len(aq.pending) == 0 {
+			delete(q.queues, agent)
+			q.mu.Unlock()
+			return
+		}
+		item := aq.pending[0]
+		aq.pending = aq.pending[1:]
+		aq.active = item
+		item.State = PromptDelivering
+		if item.WaitIdle {
+			item.State = PromptWaitingIdle
+		}
+		q.publishLocked(QueueActionStarted, item, "")
+		q.mu.Unlock()
+
+		outcome := q.deliver(item)
+
+		action := QueueActionDelivered
+		errMsg := ""
+		switch {
+		case outcome.Cancelled:
+			action = QueueActionCancelled
+		case outcome.Err != nil:
+			action = QueueActionFailed
+			errMsg = outcome.Err.Error()
+		}
+		q.mu.Lock()
+		aq.active = nil
+		q.publishLocked(action, item, errMsg)
+		outcome.Item = item.QueuedPrompt
+		q.mu.Unlock()
+
+		item.done(outcome)
+	}
+}
+
+func (q *PromptQueue) deliver(item *queueItem) PromptOutcome {
+	if item.WaitIdle && !q.waitIdle(item) {
+		return PromptOutcome{Cancelled: true}
+	}
+
+	q.mu.Lock()
+	if item.cancelled {
+		q.mu.Unlock()
+		return PromptOutcome{Cancelled: true}
+	}
+	item.State = PromptDelivering
+	q.mu.Unlock()
+
+	lock := q.prompter.GetLock(item.Agent)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if item.req.Confirm {
+		result := q.prompter.SendPromptConfirmed(item.Agent, item.Prompt, item.req.ConfirmTimeout, item.req.Echo)
+		outcome := PromptOutcome{Delivery: &result}
+		if result.Status == DeliveryFailed {
+			outcome.Err = errorf(ErrDeliveryFailed, "%s", result.Evidence)
+		}
+		return outcome
+	}
+	return PromptOutcome{Err: q.prompter.SendPrompt(item.Agent, item.Prompt)}
+}
+
+// waitIdle waits for the agent's pane to go quiet. Returns false if the item
+// was cancelled. Gives up waiting (and returns true) after maxIdleWait.
+func (q *PromptQueue) waitIdle(item *queueItem) bool {
+	switch waitPaneQuiet(q.prompter.Ctrl, item.Agent, q.idlePoll, q.idleStable, q.maxIdleWait, item.cancel) {
+	case paneWaitCancelled:
+		return false
+	case paneWaitTimeout:
+		log.Printf("prompt queue(%s): %s still busy after %s, delivering anyway", item.Agent, item.ID, q.maxIdleWait)
+	}
+	return true
+}
+
+// Outcomes of waitPaneQuiet.
+const (
+	paneWaitQuiet = iota
+	paneWaitTimeout
+	paneWaitCancelled
+)
+
+// waitPaneQuiet polls a session's visible pane until it has been unchanged
+// for stable without a busy marker, the timeout passes, or cancel is closed.
+func waitPaneQuiet(ctrl ControlModeInterface, session string, poll, stable, timeout time.Duration, cancel <-chan struct{}) int {
+	start := time.Now()
+	var last string
+	lastChange := start
+	for {
+		screen, err := ctrl.CapturePaneVisible(session)
+		if err == nil {
+			if screen != last {
+				last = screen
+				lastChange = time.Now()
+			} else if time.Since(lastChange) >= stable && !LooksBusy(screen) {
+				return paneWaitQuiet
+			}
+		}
+		if time.Since(start) >= timeout {
+			return paneWaitTimeout
+		}
+		select {
+		case <-cancel:
+			return paneWaitCancelled
+		case <-time.After(poll):
+		}
+	}
+}
+
+// LooksBusy reports whether a visible pane shows an agent mid-turn.
+func LooksBusy(screen string) bool {
+	text := strings.ToLower(normalizeScreen(screen))
+	for _, marker := range busyMarkers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *PromptQueue) snapshotLocked(agent string) []QueuedPrompt {
+	aq, ok := q.queues[agent]
+	if !ok {
+		return []QueuedPrompt{}
+	}
+	result := make([]QueuedPrompt, 0, len(aq.pending)+1)
+	if aq.active != nil {
+		result = append(result, aq.active.QueuedPrompt)
+	}
+	for _, item := range aq.pending {
+		result = append(result, item.QueuedPrompt)
+	}
+	return result
+}
+
+func (q *PromptQueue) publishLocked(action string, item *queueItem, errMsg string) {
+	event := QueueEvent{
+		Action: action,
+		Item:   item.QueuedPrompt,
+		Queue:  q.snapshotLocked(item.Agent),
+		Error:  errMsg,
+	}
+	for id, ch := range q.subs {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("prompt queue: dropped %s event for %s to slow subscriber %d", action, item.ID, id)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package agentio
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestQueue returns a queue on a fake gemini agent with instant timings
+// and fast idle polling.
+func newTestQueue(t *testing.T) (*fakeTmux, *Prompter, *PromptQueue) {
+	t.Helper()
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "gemini", true)
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("gemini", instant); err != nil {
+		t.Fatal(err)
+	}
+	q := NewPromptQueue(p)
+	q.idlePoll = 5 * time.Millisecond
+	q.idleStable = 20 * time.Millisecond
+	return fake, p, q
+}
+
+// outcomes collects PromptOutcomes from done callbacks.
+type outcomes chan PromptOutcome
+
+func (o outcomes) done(out PromptOutcome) { o <- out }
+
+func (o outcomes) next(t *testing.T) PromptOutcome {
+	t.Helper()
+	select {
+	case out := <-o:
+		return out
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for prompt outcome")
+		return PromptOutcome{}
+	}
+}
+
+func literalCalls(fake *fakeTmux) []string {
+	var out []string
+	for _, c := range fake.Calls() {
+		if strings.HasPrefix(c, "literal ") {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func queueIDs(items []QueuedPrompt) []string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+func TestPromptQueueOrdersByPriorityThenFIFO(t *testing.T) {
+	fake, p, q := newTestQueue(t)
+	done := make(outcomes, 10)
+
+	// Hold the agent lock so everything after the first prompt stays pending.
+	lock := p.GetLock("hq-agent")
+	lock.Lock()
+	first, _ := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "first"}, done.done)
+	waitDelivering(t, q)
+	low, _ := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "low"}, done.done)
+	high, _ := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "high", Priority: 5}, done.done)
+	high2, _ := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "high2", Priority: 5}, done.done)
+
+	got := queueIDs(q.List("hq-agent"))
+	want := []string{first.ID, high.ID, high2.ID, low.ID}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("queue = %v, want %v", got, want)
+	}
+	lock.Unlock()
+
+	for range 4 {
+		if out := done.next(t); out.Err != nil || out.Cancelled {
+			t.Fatalf("unexpected outcome: %+v", out)
+		}
+	}
+	literals := literalCalls(fake)
+	wantLiterals := []string{`literal hq-agent "first"`, `literal hq-agent "high"`, `literal hq-agent "high2"`, `literal hq-agent "low"`}
+	if strings.Join(literals, "\n") != strings.Join(wantLiterals, "\n") {
+		t.Fatalf("delivery order:\n%s\nwant:\n%s", strings.Join(literals, "\n"), strings.Join(wantLiterals, "\n"))
+	}
+	if items := q.List(""); len(items) != 0 {
+		t.Fatalf("expected empty queue, got %+v", items)
+	}
+}
+
+func TestPromptQueueCancelAndReorder(t *testing.T) {
+	fake, p, q := newTestQueue(t)
+	done := make(outcomes, 10)
+
+	lock := p.GetLock("hq-agent")
+	lock.Lock()
+	first, _ := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "first"}, done.done)
+	waitDelivering(t, q)
+	a, _ := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "a"}, done.done)
+	q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "b"}, done.done)
+	c, _ := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "c"}, done.done)
+
+	if _, err := q.Cancel(first.ID); err == nil {
+		t.Fatal("expected error cancelling a prompt being delivered")
+	}
+	if item, ok := q.Get(c.ID); !ok || item.Agent != "hq-agent" {
+		t.Fatalf("Get(%s) = %+v, %v", c.ID, item, ok)
+	}
+	if _, err := q.Reorder(c.ID, 0); err != nil {
+		t.Fatalf("Reorder() error: %v", err)
+	}
+	if _, err := q.Cancel(a.ID); err != nil {
+		t.Fatalf("Cancel() error: %v", err)
+	}
+	if out := done.next(t); !out.Cancelled || out.Item.ID != a.ID {
+		t.Fatalf("expected cancelled outcome for %s, got %+v", a.ID, out)
+	}
+	if _, err := q.Cancel("p999"); !errors.Is(err, ErrPromptNotFound) {
+		t.Fatalf("Cancel(unknown) error = %v, want ErrPromptNotFound", err)
+	}
+	lock.Unlock()
+
+	for range 3 {
+		done.next(t)
+	}
+	literals := literalCalls(fake)
+	wantLiterals := []string{`literal hq-agent "first"`, `literal hq-agent "c"`, `literal hq-agent "b"`}
+	if strings.Join(literals, "\n") != strings.Join(wantLiterals, "\n") {
+		t.Fatalf("delivery order:\n%s\nwant:\n%s", strings.Join(literals, "\n"), strings.Join(wantLiterals, "\n"))
+	}
+}
+
+func TestPromptQueueWaitsForIdle(t *testing.T) {
+	fake, _, q := newTestQueue(t)
+	done := make(outcomes, 1)
+	busy := "● Working… (esc to interrupt)"
+	fake.setScreens(busy)
+
+	item, _ := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "when idle", WaitIdle: true}, done.done)
+	waitFor(t, func() bool {
+		items := q.List("hq-agent")
+		return len(items) == 1 && items[0].State == PromptWaitingIdle
+	})
+	time.Sleep(50 * time.Millisecond)
+	if len(literalCalls(fake)) != 0 {
+		t.Fatal("prompt delivered while agent looked busy")
+	}
+
+	fake.setScreens("> ")
+	out := done.next(t)
+	if out.Err != nil || out.Cancelled || out.Item.ID != item.ID {
+		t.Fatalf("unexpected outcome: %+v", out)
+	}
+	if len(literalCalls(fake)) != 1 {
+		t.Fatalf("expected one delivery, got %v", fake.Calls())
+	}
+}
+
+func TestPromptQueueCancelWhileWaitingIdle(t *testing.T) {
+	fake, _, q := newTestQueue(t)
+	done := make(outcomes, 1)
+	fake.setScreens("esc to interrupt")
+
+	item, _ := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "never", WaitIdle: true}, done.done)
+	waitFor(t, func() bool {
+		items := q.List("hq-agent")
+		return len(items) == 1 && items[0].State == PromptWaitingIdle
+	})
+	if _, err := q.Cancel(item.ID); err != nil {
+		t.Fatalf("Cancel() error: %v", err)
+	}
+	if out := done.next(t); !out.Cancelled {
+		t.Fatalf("expected cancelled outcome, got %+v", out)
+	}
+	if len(literalCalls(fake)) != 0 {
+		t.Fatal("cancelled prompt was delivered")
+	}
+}
+
+func TestPromptQueueEvents(t *testing.T) {
+	_, _, q := newTestQueue(t)
+	_, events := q.Subscribe()
+	done := make(outcomes, 1)
+
+	q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "hi", Submitter: "tester"}, done.done)
+	done.next(t)
+
+	var actions []string
+	for len(actions) < 3 {
+		select {
+		case e := <-events:
+			actions = append(actions, e.Action)
+			if e.Item.Submitter != "tester" {
+				t.Fatalf("event item submitter = %q", e.Item.Submitter)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out; got actions %v", actions)
+		}
+	}
+	want := []string{QueueActionQueued, QueueActionStarted, QueueActionDelivered}
+	if strings.Join(actions, ",") != strings.Join(want, ",") {
+		t.Fatalf("actions = %v, want %v", actions, want)
+	}
+}
+
+func TestPromptQueueRejectsWhenFull(t *testing.T) {
+	_, p, q := newTestQueue(t)
+	lock := p.GetLock("hq-agent")
+	lock.Lock()
+	defer lock.Unlock()
+
+	noop := func(PromptOutcome) {}
+	if _, err := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "active"}, noop); err != nil {
+		t.Fatal(err)
+	}
+	waitDelivering(t, q)
+	for i := range MaxQueuedPromptsPerAgent {
+		if _, err := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "x"}, noop); err != nil {
+			t.Fatalf("Enqueue(%d) error: %v", i, err)
+		}
+	}
+	if _, err := q.Enqueue(PromptRequest{Agent: "hq-agent", Prompt: "overflow"}, noop); err == nil {
+		t.Fatal("expected error when queue is full")
+	}
+}
+
+func TestPromptQueueRejectsWithoutTrackingAgent(t *testing.T) {
+	_, _, q := newTestQueue(t)
+	big := strings.Repeat("x", MaxPromptBytes+1)
+	if _, err := q.Enqueue(PromptRequest{Agent: "hq-other", Prompt: big}, func(PromptOutcome) {}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Enqueue error = %v, want ErrTooLarge", err)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.queues["hq-other"]; ok {
+		t.Fatal("a rejected prompt left a queue entry behind")
+	}
+}
+
+func TestLooksBusy(t *testing.T) {
+	if !LooksBusy("\x1b[2m✻ Thinking… (Esc to interrupt)\x1b[0m") {
+		t.Fatal("expected busy for claude spinner")
+	}
+	if LooksBusy("> \n  ? for shortcuts") {
+		t.Fatal("expected idle prompt not to look busy")
+	}
+}
+
+// waitDelivering waits until the agent's head prompt is being delivered
+// (blocked on the agent lock in these tests).
+func waitDelivering(t *testing.T, q *PromptQueue) {
+	t.Helper()
+	waitFor(t, func() bool {
+		items := q.List("hq-agent")
+		return len(items) > 0 && items[0].State == PromptDelivering
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
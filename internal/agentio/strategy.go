@@ -0,0 +1,270 @@
+package agentio
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+const (
+	// MaxPromptBytes caps the size of a single prompt.
+	MaxPromptBytes = 1 << 20
+	// literalChunkBytes bounds each send-keys -l command line. Prompts larger
+	// than this count as large and are pasted when the runtime allows it.
+	literalChunkBytes = 4 * 1024
+	// pasteChunkBytes bounds each bracketed paste.
+	pasteChunkBytes = 64 * 1024
+	// pasteChunkSettle gives the TUI time to consume one paste chunk before the next.
+	pasteChunkSettle = 50 * time.Millisecond
+)
+
+// PromptStrategy delivers a prompt to an agent's tmux session.
+// Implementations are chosen per agent runtime.
+type PromptStrategy interface {
+	SendPrompt(ctrl ControlModeInterface, agent agents.Agent, prompt string) error
+}
+
+// StagedPromptStrategy is a PromptStrategy that can report when the prompt
+// has been typed but not yet submitted, so delivery confirmation can compare
+// the screen against the typed state.
+type StagedPromptStrategy interface {
+	PromptStrategy
+	SendPromptStaged(ctrl ControlModeInterface, agent agents.Agent, prompt string, typed func()) error
+}
+
+// InterruptStrategy is a PromptStrategy that knows the key cancelling the
+// runtime's current turn, used for a soft interrupt.
+type InterruptStrategy interface {
+	SoftInterruptKey() string
+}
+
+// PromptTiming holds the delays used by a key-sequence prompt strategy.
+type PromptTiming struct {
+	PasteSettle  time.Duration // after literal text, before any submit keys
+	EscapeSettle time.Duration // after Escape, before Enter
+	EnterRetries int           // total Enter attempts
+	RetryBackoff time.Duration // between Enter attempts
+	WakeSettle   time.Duration // between the wake shrink and restore resizes
+}
+
+// KeySequenceStrategy types the prompt literally (or pastes it), optionally
+// sends Escape, submits with Enter (retrying on tmux errors) and optionally
+// wakes detached sessions with a SIGWINCH resize dance.
+type KeySequenceStrategy struct {
+	Runtime           string
+	EscapeBeforeEnter bool   // send Escape before Enter (Claude's vim mode)
+	WakeDetached      bool   // resize-dance detached sessions after submit
+	BracketedPaste    bool   // paste multi-line and large prompts with paste-buffer -p
+	SoftInterrupt     string // key for a soft interrupt; empty = C-c
+	Timing            PromptTiming
+}
+
+// DefaultPromptStrategies returns the tuned prompt strategy for each known runtime.
+//
+// Only claude gets the Escape from gastown's NudgeSession sequence: it leaves
+// Claude's vim insert mode, but cancels or clears input in the other TUIs.
+// Escape also cancels Claude's turn, so it is Claude's soft interrupt; the
+// other runtimes get C-c.
+// codex gets a longer settle because it coalesces fast input into a paste burst
+// and ignores Enter until the burst window closes.
+// Bracketed paste is enabled for the TUIs known to turn on bracketed paste
+// mode; the rest keep literal send-keys, where a newline may submit early.
+func DefaultPromptStrategies() map[string]PromptStrategy {
+	standard := PromptTiming{
+		PasteSettle:  300 * time.Millisecond,
+		EnterRetries: 3,
+		RetryBackoff: 200 * time.Millisecond,
+		WakeSettle:   50 * time.Millisecond,
+	}
+	claude := standard
+	claude.PasteSettle = 500 * time.Millisecond
+	claude.EscapeSettle = 100 * time.Millisecond
+	codex := standard
+	codex.PasteSettle = 500 * time.Millisecond
+
+	return map[string]PromptStrategy{
+		"claude":   KeySequenceStrategy{Runtime: "claude", EscapeBeforeEnter: true, WakeDetached: true, BracketedPaste: true, SoftInterrupt: "Escape", Timing: claude},
+		"gemini":   KeySequenceStrategy{Runtime: "gemini", WakeDetached: true, BracketedPaste: true, Timing: standard},
+		"codex":    KeySequenceStrategy{Runtime: "codex", WakeDetached: true, BracketedPaste: true, Timing: codex},
+		"cursor":   KeySequenceStrategy{Runtime: "cursor", WakeDetached: true, Timing: standard},
+		"auggie":   KeySequenceStrategy{Runtime: "auggie", WakeDetached: true, Timing: standard},
+		"amp":      KeySequenceStrategy{Runtime: "amp", WakeDetached: true, Timing: standard},
+		"opencode": KeySequenceStrategy{Runtime: "opencode", WakeDetached: true, BracketedPaste: true, Timing: standard},
+	}
+}
+
+// SoftInterruptKey returns the key that cancels the runtime's current turn.
+func (s KeySequenceStrategy) SoftInterruptKey() string {
+	if s.SoftInterrupt == "" {
+		return "C-c"
+	}
+	return s.SoftInterrupt
+}
+
+// SendPrompt runs the key sequence against the agent's session.
+func (s KeySequenceStrategy) SendPrompt(ctrl ControlModeInterface, agent agents.Agent, prompt string) error {
+	return s.SendPromptStaged(ctrl, agent, prompt, nil)
+}
+
+// SendPromptStaged runs the key sequence, calling typed (when non-nil) once
+// the text has settled and before any submit key is sent.
+func (s KeySequenceStrategy) SendPromptStaged(ctrl ControlModeInterface, agent agents.Agent, prompt string, typed func()) error {
+	session := agent.Name
+
+	// 1. Send the text: bracketed paste for multi-line or large prompts when
+	// the runtime supports it, otherwise literal mode
+	if err := s.sendText(ctrl, session, prompt); err != nil {
+		return err
+	}
+
+	// 2. Wait for the paste to settle
+	time.Sleep(s.Timing.PasteSettle)
+	if typed != nil {
+		typed()
+	}
+
+	// 3. Send Escape (Claude vim mode only)
+	if s.EscapeBeforeEnter {
+		if err := ctrl.SendKeysRaw(session, "Escape"); err != nil {
+			return fmt.Errorf("send Escape: %w", err)
+		}
+		time.Sleep(s.Timing.EscapeSettle)
+	}
+
+	// 4. Send Enter with retry
+	retries := max(s.Timing.EnterRetries, 1)
+	var lastErr error
+	for attempt := range retries {
+		if attempt > 0 {
+			time.Sleep(s.Timing.RetryBackoff)
+		}
+		if err := ctrl.SendKeysRaw(session, "Enter"); err != nil {
+			lastErr = err
+			continue
+		}
+
+		// 5. Wake detached sessions via SIGWINCH resize dance
+		if s.WakeDetached && !agent.Attached {
+			if err := ctrl.ResizePane(session, "-1"); err != nil {
+				log.Printf("send-prompt(%s): wake shrink resize failed: %v", session, err)
+			}
+			time.Sleep(s.Timing.WakeSettle)
+			if err := ctrl.ResizePane(session, "+1"); err != nil {
+				log.Printf("send-prompt(%s): wake restore resize failed: %v", session, err)
+			}
+		}
+
+		return nil
+	}
+
+	errMsg := fmt.Sprintf("failed to send Enter after %d attempts", retries)
+	if lastErr != nil {
+		errMsg += ": " + lastErr.Error()
+	}
+	return fmt.Errorf("%s", errMsg)
+}
+
+// sendText delivers the prompt text without submitting it.
+func (s KeySequenceStrategy) sendText(ctrl ControlModeInterface, session, prompt string) error {
+	if s.BracketedPaste && (strings.Contains(prompt, "\n") || len(prompt) > literalChunkBytes) {
+		chunks := splitChunks(prompt, pasteChunkBytes)
+		for i, chunk := range chunks {
+			if i > 0 {
+				time.Sleep(pasteChunkSettle)
+			}
+			if err := ctrl.PasteBytesBracketed(session, []byte(chunk)); err != nil {
+				if i == 0 {
+					// Nothing reached the pane yet, so literal mode is still safe to try.
+					log.Printf("send-prompt(%s): bracketed paste failed, falling back to literal: %v", session, err)
+					break
+				}
+				return fmt.Errorf("bracketed paste chunk %d/%d: %w", i+1, len(chunks), err)
+			}
+			if i == len(chunks)-1 {
+				return nil
+			}
+		}
+	}
+
+	for _, chunk := range splitChunks(prompt, literalChunkBytes) {
+		if err := ctrl.SendKeysLiteral(session, chunk); err != nil {
+			return fmt.Errorf("send literal: %w", err)
+		}
+	}
+	return nil
+}
+
+// splitChunks splits s into pieces of at most n bytes without breaking UTF-8
+// sequences.
+func splitChunks(s string, n int) []string {
+	var chunks []string
+	for len(s) > n {
+		cut := n
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			// A single rune wider than n still goes out whole.
+			_, cut = utf8.DecodeRuneInString(s)
+		}
+		chunks = append(chunks, s[:cut])
+		s = s[cut:]
+	}
+	return append(chunks, s)
+}
+
+// promptTimingFile is the on-disk form of a PromptTiming override.
+// Omitted fields keep the runtime's default.
+type promptTimingFile struct {
+	PasteSettleMs  *int `json:"pasteSettleMs"`
+	EscapeSettleMs *int `json:"escapeSettleMs"`
+	EnterRetries   *int `json:"enterRetries"`
+	RetryBackoffMs *int `json:"retryBackoffMs"`
+	WakeSettleMs   *int `json:"wakeSettleMs"`
+}
+
+// LoadPromptTimings reads per-runtime timing overrides from a JSON file of the form
+// {"codex": {"pasteSettleMs": 800}, "claude": {"enterRetries": 5}}
+// and applies them to the Prompter's strategies.
+func (p *Prompter) LoadPromptTimings(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read prompt timings: %w", err)
+	}
+	var overrides map[string]promptTimingFile
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("parse prompt timings %s: %w", path, err)
+	}
+
+	for runtime, o := range overrides {
+		s, ok := p.StrategyFor(runtime).(KeySequenceStrategy)
+		if !ok || s.Runtime != runtime {
+			return fmt.Errorf("prompt timings %s: unknown runtime %q", path, runtime)
+		}
+		t := s.Timing
+		setMs(&t.PasteSettle, o.PasteSettleMs)
+		setMs(&t.EscapeSettle, o.EscapeSettleMs)
+		setMs(&t.RetryBackoff, o.RetryBackoffMs)
+		setMs(&t.WakeSettle, o.WakeSettleMs)
+		if o.EnterRetries != nil {
+			t.EnterRetries = *o.EnterRetries
+		}
+		if err := p.SetPromptTiming(runtime, t); err != nil {
+			return err
+		}
+		log.Printf("prompt timings: %s = %+v", runtime, t)
+	}
+	return nil
+}
+
+func setMs(d *time.Duration, ms *int) {
+	if ms != nil {
+		*d = time.Duration(*ms) * time.Millisecond
+	}
+}
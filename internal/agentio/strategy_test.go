@@ -0,0 +1,250 @@
+package agentio
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// instant strips all delays so key sequences can be asserted quickly.
+var instant = PromptTiming{EnterRetries: 3}
+
+func TestSendPromptKeySequences(t *testing.T) {
+	cases := []struct {
+		runtime  string
+		attached bool
+		want     []string
+	}{
+		{
+			runtime: "claude",
+			want: []string{
+				`literal hq-agent "fix the bug"`,
+				"keys hq-agent Escape",
+				"keys hq-agent Enter",
+				"resize hq-agent -1",
+				"resize hq-agent +1",
+			},
+		},
+		{
+			runtime:  "claude",
+			attached: true,
+			want: []string{
+				`literal hq-agent "fix the bug"`,
+				"keys hq-agent Escape",
+				"keys hq-agent Enter",
+			},
+		},
+	}
+	for _, runtime := range []string{"gemini", "codex", "cursor", "auggie", "amp", "opencode"} {
+		cases = append(cases, struct {
+			runtime  string
+			attached bool
+			want     []string
+		}{
+			runtime: runtime,
+			want: []string{
+				`literal hq-agent "fix the bug"`,
+				"keys hq-agent Enter",
+				"resize hq-agent -1",
+				"resize hq-agent +1",
+			},
+		})
+	}
+
+	for _, tc := range cases {
+		name := tc.runtime
+		if tc.attached {
+			name += "_attached"
+		}
+		t.Run(name, func(t *testing.T) {
+			fake := newFakeTmux()
+			fake.addAgent("hq-agent", tc.runtime, tc.attached)
+			p := newTestPrompter(t, fake)
+			if err := p.SetPromptTiming(tc.runtime, instant); err != nil {
+				t.Fatalf("SetPromptTiming() error: %v", err)
+			}
+
+			if err := p.SendPrompt("hq-agent", "fix the bug"); err != nil {
+				t.Fatalf("SendPrompt() error: %v", err)
+			}
+			if got := fake.Calls(); !slices.Equal(got, tc.want) {
+				t.Fatalf("calls =\n  %s\nwant\n  %s", strings.Join(got, "\n  "), strings.Join(tc.want, "\n  "))
+			}
+		})
+	}
+}
+
+func TestSendPromptRetriesEnter(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "gemini", true)
+	fake.failKeys["Enter"] = 2
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("gemini", instant); err != nil {
+		t.Fatalf("SetPromptTiming() error: %v", err)
+	}
+
+	if err := p.SendPrompt("hq-agent", "hi"); err != nil {
+		t.Fatalf("SendPrompt() error: %v", err)
+	}
+	want := []string{`literal hq-agent "hi"`, "keys hq-agent Enter", "keys hq-agent Enter", "keys hq-agent Enter"}
+	if got := fake.Calls(); !slices.Equal(got, want) {
+		t.Fatalf("calls = %q, want %q", got, want)
+	}
+}
+
+func TestSendPromptEnterExhausted(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "amp", true)
+	fake.failKeys["Enter"] = 5
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("amp", instant); err != nil {
+		t.Fatalf("SetPromptTiming() error: %v", err)
+	}
+
+	err := p.SendPrompt("hq-agent", "hi")
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Fatalf("SendPrompt() error = %v, want Enter exhaustion", err)
+	}
+}
+
+func TestSendPromptUnknownAgent(t *testing.T) {
+	p := newTestPrompter(t, newFakeTmux())
+	if err := p.SendPrompt("nope", "hi"); err == nil {
+		t.Fatal("expected error for unknown agent")
+	}
+}
+
+func TestSendPromptMultiLinePastesWhenSupported(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "claude", true)
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("claude", instant); err != nil {
+		t.Fatalf("SetPromptTiming() error: %v", err)
+	}
+
+	if err := p.SendPrompt("hq-agent", "line one\nline two"); err != nil {
+		t.Fatalf("SendPrompt() error: %v", err)
+	}
+	want := []string{`bpaste hq-agent "line one\nline two"`, "keys hq-agent Escape", "keys hq-agent Enter"}
+	if got := fake.Calls(); !slices.Equal(got, want) {
+		t.Fatalf("calls = %q, want %q", got, want)
+	}
+}
+
+func TestSendPromptMultiLineFallsBackToLiteral(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "cursor", true)
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("cursor", instant); err != nil {
+		t.Fatalf("SetPromptTiming() error: %v", err)
+	}
+
+	if err := p.SendPrompt("hq-agent", "line one\nline two"); err != nil {
+		t.Fatalf("SendPrompt() error: %v", err)
+	}
+	want := []string{`literal hq-agent "line one\nline two"`, "keys hq-agent Enter"}
+	if got := fake.Calls(); !slices.Equal(got, want) {
+		t.Fatalf("calls = %q, want %q", got, want)
+	}
+}
+
+func TestSendPromptLargeLiteralIsChunked(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "amp", true)
+	p := newTestPrompter(t, fake)
+	if err := p.SetPromptTiming("amp", instant); err != nil {
+		t.Fatalf("SetPromptTiming() error: %v", err)
+	}
+
+	prompt := strings.Repeat("x", literalChunkBytes*2+10)
+	if err := p.SendPrompt("hq-agent", prompt); err != nil {
+		t.Fatalf("SendPrompt() error: %v", err)
+	}
+	if got := len(literalCalls(fake)); got != 3 {
+		t.Fatalf("literal calls = %d, want 3", got)
+	}
+}
+
+func TestSendPromptTooLarge(t *testing.T) {
+	fake := newFakeTmux()
+	fake.addAgent("hq-agent", "claude", true)
+	p := newTestPrompter(t, fake)
+
+	err := p.SendPrompt("hq-agent", strings.Repeat("x", MaxPromptBytes+1))
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("SendPrompt() error = %v, want size error", err)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("expected no tmux calls, got %q", calls)
+	}
+}
+
+func TestSplitChunksKeepsRunesWhole(t *testing.T) {
+	chunks := splitChunks("aé€😀b", 3)
+	want := []string{"aé", "€", "😀", "b"}
+	if !slices.Equal(chunks, want) {
+		t.Fatalf("splitChunks() = %q, want %q", chunks, want)
+	}
+	if got := strings.Join(splitChunks("abc", 3), "|"); got != "abc" {
+		t.Fatalf("splitChunks(short) = %q", got)
+	}
+}
+
+func TestStrategyForUnknownRuntimeFallsBackToClaude(t *testing.T) {
+	p := NewPrompter(newFakeTmux(), nil)
+	got, ok := p.StrategyFor("mystery").(KeySequenceStrategy)
+	if !ok || got.Runtime != "claude" {
+		t.Fatalf("StrategyFor(unknown) = %+v, want claude strategy", got)
+	}
+}
+
+func TestDefaultPromptStrategiesCoverAllRuntimes(t *testing.T) {
+	strategies := DefaultPromptStrategies()
+	for _, runtime := range []string{"claude", "gemini", "codex", "cursor", "auggie", "amp", "opencode"} {
+		s, ok := strategies[runtime].(KeySequenceStrategy)
+		if !ok {
+			t.Fatalf("no key-sequence strategy for %s", runtime)
+		}
+		if s.EscapeBeforeEnter != (runtime == "claude") {
+			t.Fatalf("%s: EscapeBeforeEnter = %v, want only claude to send Escape", runtime, s.EscapeBeforeEnter)
+		}
+	}
+}
+
+func TestLoadPromptTimings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timings.json")
+	if err := os.WriteFile(path, []byte(`{"codex": {"pasteSettleMs": 800, "enterRetries": 5}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPrompter(newFakeTmux(), nil)
+	if err := p.LoadPromptTimings(path); err != nil {
+		t.Fatalf("LoadPromptTimings() error: %v", err)
+	}
+
+	got := p.StrategyFor("codex").(KeySequenceStrategy).Timing
+	if got.PasteSettle != 800*time.Millisecond {
+		t.Fatalf("PasteSettle = %v, want 800ms", got.PasteSettle)
+	}
+	if got.EnterRetries != 5 {
+		t.Fatalf("EnterRetries = %d, want 5", got.EnterRetries)
+	}
+	if got.RetryBackoff != 200*time.Millisecond {
+		t.Fatalf("RetryBackoff = %v, want default 200ms to be kept", got.RetryBackoff)
+	}
+}
+
+func TestLoadPromptTimingsUnknownRuntime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timings.json")
+	if err := os.WriteFile(path, []byte(`{"mystery": {"pasteSettleMs": 1}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPrompter(newFakeTmux(), nil)
+	if err := p.LoadPromptTimings(path); err == nil {
+		t.Fatal("expected error for unknown runtime")
+	}
+}
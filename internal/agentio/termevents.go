@@ -0,0 +1,163 @@
+package agentio
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// Terminal event types emitted to output subscribers.
+const (
+	TerminalClipboardSet = "clipboard-set"      // OSC 52
+	TerminalNotification = "agent-notification" // OSC 9 / OSC 777;notify
+	TerminalBell         = "bell"               // BEL outside any escape sequence
+)
+
+// maxOSCBytes bounds a buffered OSC payload; longer sequences are dropped.
+const maxOSCBytes = 1024 * 1024
+
+// TerminalEvent is a side-channel sequence found in an agent's output.
+type TerminalEvent struct {
+	Type      string `json:"-"`
+	Selection string `json:"selection,omitempty"` // OSC 52 target ("c", "p", ...)
+	Text      string `json:"text,omitempty"`      // clipboard contents
+	Title     string `json:"title,omitempty"`     // notification title (OSC 777)
+	Body      string `json:"body,omitempty"`      // notification body
+	Source    string `json:"source,omitempty"`    // "osc9" or "osc777" for notifications
+}
+
+type scanState int
+
+const (
+	scanGround    scanState = iota
+	scanEscape              // after ESC
+	scanOSC                 // inside ESC ] ... collecting the payload
+	scanString              // inside DCS/SOS/PM/APC, payload ignored
+	scanStringEsc           // ESC inside an OSC or string, maybe the ST terminator
+)
+
+// TerminalEventScanner finds OSC 52, OSC 9, OSC 777 and BEL sequences in a
+// terminal byte stream. Sequences may span calls to Scan; the bytes
+// themselves are not modified.
+type TerminalEventScanner struct {
+	state    scanState
+	inOSC    bool // the current string (for scanStringEsc) is an OSC
+	payload  []byte
+	overflow bool
+}
+
+// Scan consumes the next chunk of output and returns the events completed in
+// it. Consecutive bells within one chunk are reported once.
+func (s *TerminalEventScanner) Scan(data []byte) []TerminalEvent {
+	var events []TerminalEvent
+	lastBell := false
+	for _, b := range data {
+		switch s.state {
+		case scanGround:
+			switch b {
+			case 0x1b:
+				s.state = scanEscape
+			case 0x07:
+				if !lastBell {
+					events = append(events, TerminalEvent{Type: TerminalBell})
+				}
+				lastBell = true
+				continue
+			}
+		case scanEscape:
+			s.escape(b)
+		case scanOSC, scanString:
+			switch b {
+			case 0x07:
+				// BEL terminates an OSC (xterm style); it is not a bell here.
+				s.finish(&events)
+			case 0x1b:
+				s.state = scanStringEsc
+			default:
+				if s.state == scanOSC {
+					if len(s.payload) < maxOSCBytes {
+						s.payload = append(s.payload, b)
+					} else {
+						s.overflow = true
+					}
+				}
+			}
+		case scanStringEsc:
+			if b == '\\' {
+				s.finish(&events)
+			} else {
+				// Any other escape aborts the string and starts a new sequence.
+				s.inOSC = false
+				s.payload = s.payload[:0]
+				s.escape(b)
+			}
+		}
+		lastBell = false
+	}
+	return events
+}
+
+// escape handles the byte after ESC.
+func (s *TerminalEventScanner) escape(b byte) {
+	switch b {
+	case ']':
+		s.state, s.inOSC = scanOSC, true
+		s.payload, s.overflow = s.payload[:0], false
+	case 'P', 'X', '^', '_':
+		s.state, s.inOSC = scanString, false
+	case 0x1b:
+		s.state = scanEscape
+	default:
+		s.state = scanGround
+	}
+}
+
+// finish completes the current OSC or string and returns to ground.
+func (s *TerminalEventScanner) finish(events *[]TerminalEvent) {
+	if s.inOSC && !s.overflow {
+		if ev, ok := parseOSC(string(s.payload)); ok {
+			*events = append(*events, ev)
+		}
+	}
+	s.state, s.inOSC = scanGround, false
+	s.payload = s.payload[:0]
+	if cap(s.payload) > 64*1024 {
+		s.payload = nil
+	}
+}
+
+// parseOSC interprets an OSC payload (without ESC ] and the terminator).
+func parseOSC(payload string) (TerminalEvent, bool) {
+	code, rest, _ := strings.Cut(payload, ";")
+	switch code {
+	case "52":
+		selection, data, ok := strings.Cut(rest, ";")
+		if !ok || data == "?" {
+			return TerminalEvent{}, false // malformed, or a clipboard query
+		}
+		text, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return TerminalEvent{}, false
+		}
+		return TerminalEvent{Type: TerminalClipboardSet, Selection: selection, Text: string(text)}, true
+	case "9":
+		// ConEmu reuses OSC 9 with numeric subcommands (9;4 is progress).
+		if sub, _, _ := strings.Cut(rest, ";"); sub != "" && strings.Trim(sub, "0123456789") == "" {
+			return TerminalEvent{}, false
+		}
+		if rest == "" {
+			return TerminalEvent{}, false
+		}
+		return TerminalEvent{Type: TerminalNotification, Body: rest, Source: "osc9"}, true
+	case "777":
+		parts := strings.SplitN(rest, ";", 3)
+		if len(parts) < 2 || parts[0] != "notify" {
+			return TerminalEvent{}, false
+		}
+		ev := TerminalEvent{Type: TerminalNotification, Title: parts[1], Source: "osc777"}
+		if len(parts) == 3 {
+			ev.Body = parts[2]
+		}
+		return ev, true
+	}
+	return TerminalEvent{}, false
+}
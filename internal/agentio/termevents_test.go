@@ -0,0 +1,77 @@
+package agentio
+
+import (
+	"strings"
+	"testing"
+)
+
+func scanAll(s *TerminalEventScanner, chunks ...string) []TerminalEvent {
+	var events []TerminalEvent
+	for _, c := range chunks {
+		events = append(events, s.Scan([]byte(c))...)
+	}
+	return events
+}
+
+func TestTerminalEventScannerClipboard(t *testing.T) {
+	var s TerminalEventScanner
+	// "hello" split across chunks, terminated by ST.
+	events := scanAll(&s, "before\x1b]52;c;aGVs", "bG8=\x1b", "\\after")
+	if len(events) != 1 {
+		t.Fatalf("events = %+v, want one", events)
+	}
+	if ev := events[0]; ev.Type != TerminalClipboardSet || ev.Selection != "c" || ev.Text != "hello" {
+		t.Fatalf("event = %+v", ev)
+	}
+
+	// A clipboard query and invalid base64 produce nothing.
+	if events := scanAll(&s, "\x1b]52;c;?\x07\x1b]52;c;!!!\x07"); len(events) != 0 {
+		t.Fatalf("query/invalid events = %+v", events)
+	}
+}
+
+func TestTerminalEventScannerBell(t *testing.T) {
+	var s TerminalEventScanner
+	// The BEL terminating the OSC title is not a bell; the bare ones are,
+	// coalesced within the chunk.
+	events := scanAll(&s, "\x1b]0;title\x07done\x07\x07")
+	if len(events) != 1 || events[0].Type != TerminalBell {
+		t.Fatalf("events = %+v, want one bell", events)
+	}
+	if events := scanAll(&s, "\x07"); len(events) != 1 {
+		t.Fatalf("bell in next chunk = %+v", events)
+	}
+	// BEL inside a DCS string is a terminator, not a bell.
+	if events := scanAll(&s, "\x1bPq#0\x07"); len(events) != 0 {
+		t.Fatalf("DCS events = %+v", events)
+	}
+}
+
+func TestTerminalEventScannerNotifications(t *testing.T) {
+	var s TerminalEventScanner
+	events := scanAll(&s,
+		"\x1b]9;Build finished\x07",
+		"\x1b]9;4;1;50\x07", // ConEmu progress, ignored
+		"\x1b]777;notify;Claude;Needs input\x1b\\",
+	)
+	if len(events) != 2 {
+		t.Fatalf("events = %+v, want two", events)
+	}
+	if ev := events[0]; ev.Type != TerminalNotification || ev.Body != "Build finished" || ev.Source != "osc9" {
+		t.Fatalf("osc9 event = %+v", ev)
+	}
+	if ev := events[1]; ev.Title != "Claude" || ev.Body != "Needs input" || ev.Source != "osc777" {
+		t.Fatalf("osc777 event = %+v", ev)
+	}
+}
+
+func TestTerminalEventScannerDropsOversized(t *testing.T) {
+	var s TerminalEventScanner
+	big := "\x1b]52;c;" + strings.Repeat("A", maxOSCBytes) + "\x07"
+	if events := scanAll(&s, big); len(events) != 0 {
+		t.Fatalf("oversized events = %d, want none", len(events))
+	}
+	if events := scanAll(&s, "\x1b]52;c;aGk=\x07"); len(events) != 1 || events[0].Text != "hi" {
+		t.Fatalf("events after overflow = %+v", events)
+	}
+}
@@ -0,0 +1,516 @@
+package agentio
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+const (
+	uploadManifestName = "manifest.json"
+	// uploadIDLength is how many hex digits of the SHA-256 form an upload ID.
+	uploadIDLength = 16
+	// maxUploadEvents bounds the per-file upload history kept in the manifest.
+	maxUploadEvents = 20
+)
+
+// ErrUploadNotFound is returned when an upload ID is unknown for the agent.
+var ErrUploadNotFound = errors.New("upload not found")
+
+// UploadPolicy bounds what the upload store keeps per agent. Zero fields
+// disable the corresponding limit.
+type UploadPolicy struct {
+	MaxBytesPerAgent int64
+	MaxFilesPerAgent int
+	MaxAge           time.Duration // since the file was last uploaded
+}
+
+// DefaultUploadPolicy returns the limits used unless overridden by flags.
+func DefaultUploadPolicy() UploadPolicy {
+	return UploadPolicy{
+		MaxBytesPerAgent: 256 * 1024 * 1024,
+		MaxFilesPerAgent: 200,
+		MaxAge:           7 * 24 * time.Hour,
+	}
+}
+
+// UploadEvent records one upload of a stored file.
+type UploadEvent struct {
+	Client string    `json:"client,omitempty"`
+	Name   string    `json:"name"` // file name as uploaded
+	At     time.Time `json:"at"`
+}
+
+// UploadRecord is one stored file in an agent's upload manifest.
+type UploadRecord struct {
+	ID             string        `json:"id"`
+	Name           string        `json:"name"`
+	MimeType       string        `json:"mimeType,omitempty"`
+	Size           int64         `json:"size"`
+	SHA256         string        `json:"sha256"`
+	Path           string        `json:"path,omitempty"` // rebuilt from the store dir on load, never persisted
+	UploadedAt     time.Time     `json:"uploadedAt"`
+	LastUploadedAt time.Time     `json:"lastUploadedAt"`
+	Uploads        []UploadEvent `json:"uploads"` // oldest first, capped
+}
+
+type uploadManifest struct {
+	Files []UploadRecord `json:"files"`
+}
+
+// UploadStore keeps uploaded files per agent, named by content hash so a
+// re-upload of the same bytes reuses the stored file. A manifest next to the
+// files records who uploaded what and when. Quotas evict the least recently
+// uploaded files; expired files are removed on every access and by Cleanup.
+//
+// The manifest lives in the agent's workDir, so the agent can rewrite it.
+// File paths are therefore never read from it: they are rebuilt from the
+// store dir, the record ID and the sanitized name.
+type UploadStore struct {
+	registry *agents.Registry
+	mu       sync.Mutex
+	policy   UploadPolicy
+	dirs     map[string]string // upload dir -> agent name, for Cleanup after agents leave
+	tempRoot string            // parent of the fallback upload dirs
+	now      func() time.Time
+}
+
+// NewUploadStore creates an upload store for the registry's agents.
+func NewUploadStore(registry *agents.Registry, policy UploadPolicy) *UploadStore {
+	return &UploadStore{registry: registry, policy: policy, dirs: make(map[string]string), tempRoot: uploadTempRoot(), now: time.Now}
+}
+
+// SetPolicy replaces the store's limits.
+func (s *UploadStore) SetPolicy(policy UploadPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
+// Policy returns the store's limits.
+func (s *UploadStore) Policy() UploadPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.policy
+}
+
+// Save stores data for the agent and returns its record. deduped is true when
+// identical bytes were already stored and the existing file was reused.
+func (s *UploadStore) Save(agentName, fileName, mimeType string, data []byte, client string) (record UploadRecord, deduped bool, err error) {
+	sum := sha256.Sum256(data)
+	return s.store(agentName, fileName, mimeType, hex.EncodeToString(sum[:]), int64(len(data)), client, func(path string) error {
+		return os.WriteFile(path, data, 0o644)
+	})
+}
+
+// SaveFile stores an already assembled file whose SHA-256 (hex) is known,
+// moving it into the agent's upload directory. src is consumed on success
+// and left in place on failure.
+func (s *UploadStore) SaveFile(agentName, fileName, mimeType, src, sha256Hex string, size int64, client string) (record UploadRecord, deduped bool, err error) {
+	record, deduped, err = s.store(agentName, fileName, mimeType, sha256Hex, size, client, func(path string) error {
+		return linkFile(src, path)
+	})
+	if err == nil {
+		_ = os.Remove(src)
+	}
+	return record, deduped, err
+}
+
+// store records an upload of size bytes with the given content hash, calling
+// write to put the bytes at path unless an identical file is already stored.
+func (s *UploadStore) store(agentName, fileName, mimeType, hash string, size int64, client string, write func(path string) error) (record UploadRecord, deduped bool, err error) {
+	agent, ok := s.registry.GetAgent(agentName)
+	if !ok {
+		return UploadRecord{}, false, fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkQuotaLocked(fileName, size); err != nil {
+		return UploadRecord{}, false, err
+	}
+
+	dir, err := uploadDir(agent, true)
+	if err != nil {
+		return UploadRecord{}, false, err
+	}
+	s.dirs[dir] = agent.Name
+	manifest := loadUploadManifest(dir)
+	now := s.now()
+	s.pruneExpiredLocked(&manifest, now)
+
+	event := UploadEvent{Client: client, Name: fileName, At: now}
+
+	idx := -1
+	for i, rec := range manifest.Files {
+		if rec.SHA256 == hash {
+			idx = i
+			break
+		}
+	}
+	if idx >= 0 {
+		rec := &manifest.Files[idx]
+		if _, err := os.Stat(rec.Path); err != nil {
+			if err := write(rec.Path); err != nil {
+				return UploadRecord{}, false, err
+			}
+		} else {
+			deduped = true
+		}
+		rec.LastUploadedAt = now
+		rec.Uploads = appendUploadEvent(rec.Uploads, event)
+	} else {
+		id := hash[:uploadIDLength]
+		path, err := uploadPath(dir, id, fileName)
+		if err != nil {
+			return UploadRecord{}, false, err
+		}
+		if err := write(path); err != nil {
+			return UploadRecord{}, false, err
+		}
+		manifest.Files = append(manifest.Files, UploadRecord{
+			ID:             id,
+			Name:           fileName,
+			MimeType:       mimeType,
+			Size:           size,
+			SHA256:         hash,
+			Path:           path,
+			UploadedAt:     now,
+			LastUploadedAt: now,
+			Uploads:        []UploadEvent{event},
+		})
+		idx = len(manifest.Files) - 1
+	}
+	record = manifest.Files[idx]
+
+	s.enforceQuotaLocked(agentName, &manifest, record.ID)
+	if err := saveUploadManifest(dir, manifest); err != nil {
+		return UploadRecord{}, false, err
+	}
+	return record, deduped, nil
+}
+
+// CheckQuota reports whether a file of size bytes could ever fit the agent quota.
+func (s *UploadStore) CheckQuota(fileName string, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkQuotaLocked(fileName, size)
+}
+
+func (s *UploadStore) checkQuotaLocked(fileName string, size int64) error {
+	if s.policy.MaxBytesPerAgent > 0 && size > s.policy.MaxBytesPerAgent {
+		return errorf(ErrTooLarge, "file %q exceeds upload quota: %d bytes (max %d)", fileName, size, s.policy.MaxBytesPerAgent)
+	}
+	return nil
+}
+
+// List returns the agent's stored uploads, most recently uploaded first.
+func (s *UploadStore) List(agentName string) ([]UploadRecord, error) {
+	agent, ok := s.registry.GetAgent(agentName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir, err := uploadDir(agent, false)
+	if err != nil {
+		return []UploadRecord{}, nil
+	}
+	s.dirs[dir] = agent.Name
+	manifest := loadUploadManifest(dir)
+	if s.pruneExpiredLocked(&manifest, s.now()) {
+		if err := saveUploadManifest(dir, manifest); err != nil {
+			log.Printf("uploads %s: save manifest: %v", agentName, err)
+		}
+	}
+
+	records := append([]UploadRecord{}, manifest.Files...)
+	sort.Slice(records, func(i, j int) bool { return records[i].LastUploadedAt.After(records[j].LastUploadedAt) })
+	return records, nil
+}
+
+// Delete removes a stored upload and its manifest entry.
+func (s *UploadStore) Delete(agentName, id string) (UploadRecord, error) {
+	agent, ok := s.registry.GetAgent(agentName)
+	if !ok {
+		return UploadRecord{}, fmt.Errorf("%w: %s", ErrAgentNotFound, agentName)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir, err := uploadDir(agent, false)
+	if err != nil {
+		return UploadRecord{}, ErrUploadNotFound
+	}
+	s.dirs[dir] = agent.Name
+	manifest := loadUploadManifest(dir)
+	for i, rec := range manifest.Files {
+		if rec.ID != id {
+			continue
+		}
+		removeUploadFile(rec)
+		manifest.Files = append(manifest.Files[:i], manifest.Files[i+1:]...)
+		return rec, saveUploadManifest(dir, manifest)
+	}
+	return UploadRecord{}, ErrUploadNotFound
+}
+
+// Cleanup removes expired uploads and enforces the quotas in every upload
+// directory the store knows of, including those of agents that have left:
+// directories used since startup, those of live agents, and everything
+// under the temp fallback root.
+func (s *UploadStore) Cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, agent := range s.registry.GetAgents() {
+		if dir, err := uploadDir(agent, false); err == nil {
+			s.dirs[dir] = agent.Name
+		}
+	}
+	if entries, err := os.ReadDir(s.tempRoot); err == nil {
+		for _, e := range entries {
+			if e.IsDir() {
+				dir := filepath.Join(s.tempRoot, e.Name())
+				if _, known := s.dirs[dir]; !known {
+					s.dirs[dir] = e.Name()
+				}
+			}
+		}
+	}
+
+	now := s.now()
+	for dir, agentName := range s.dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			delete(s.dirs, dir)
+			continue
+		}
+		manifest := loadUploadManifest(dir)
+		before := len(manifest.Files)
+		s.pruneExpiredLocked(&manifest, now)
+		s.enforceQuotaLocked(agentName, &manifest, "")
+		if len(manifest.Files) != before {
+			if err := saveUploadManifest(dir, manifest); err != nil {
+				log.Printf("uploads %s: save manifest: %v", agentName, err)
+			}
+		}
+	}
+}
+
+// pruneExpiredLocked drops records older than MaxAge and reports whether any were removed.
+func (s *UploadStore) pruneExpiredLocked(manifest *uploadManifest, now time.Time) bool {
+	if s.policy.MaxAge <= 0 {
+		return false
+	}
+	kept := manifest.Files[:0]
+	for _, rec := range manifest.Files {
+		if now.Sub(rec.LastUploadedAt) > s.policy.MaxAge {
+			removeUploadFile(rec)
+			continue
+		}
+		kept = append(kept, rec)
+	}
+	changed := len(kept) != len(manifest.Files)
+	manifest.Files = kept
+	return changed
+}
+
+// enforceQuotaLocked evicts the least recently uploaded files, never keepID,
+// until the manifest fits the file count and byte quotas.
+func (s *UploadStore) enforceQuotaLocked(agentName string, manifest *uploadManifest, keepID string) {
+	sort.SliceStable(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].LastUploadedAt.Before(manifest.Files[j].LastUploadedAt)
+	})
+	var total int64
+	for _, rec := range manifest.Files {
+		total += rec.Size
+	}
+
+	over := func() bool {
+		return (s.policy.MaxFilesPerAgent > 0 && len(manifest.Files) > s.policy.MaxFilesPerAgent) ||
+			(s.policy.MaxBytesPerAgent > 0 && total > s.policy.MaxBytesPerAgent)
+	}
+	for i := 0; over() && i < len(manifest.Files); {
+		rec := manifest.Files[i]
+		if rec.ID == keepID {
+			i++
+			continue
+		}
+		log.Printf("uploads %s: evicting %s (%s, %d bytes) to stay within quota", agentName, rec.ID, rec.Name, rec.Size)
+		removeUploadFile(rec)
+		total -= rec.Size
+		manifest.Files = append(manifest.Files[:i], manifest.Files[i+1:]...)
+	}
+}
+
+func appendUploadEvent(events []UploadEvent, event UploadEvent) []UploadEvent {
+	events = append(events, event)
+	if len(events) > maxUploadEvents {
+		events = events[len(events)-maxUploadEvents:]
+	}
+	return events
+}
+
+// linkFile hard-links src to dst, copying when they are on different
+// filesystems. src is left in place.
+func linkFile(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return os.Chmod(dst, 0o644)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+func removeUploadFile(rec UploadRecord) {
+	if rec.Path == "" {
+		return
+	}
+	if err := os.Remove(rec.Path); err != nil && !os.IsNotExist(err) {
+		log.Printf("uploads: remove %s: %v", rec.Path, err)
+	}
+}
+
+// validUploadID reports whether id has the form of an upload ID.
+func validUploadID(id string) bool {
+	if len(id) != uploadIDLength {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// uploadPath returns where the upload id named name is stored in dir. It
+// refuses IDs not made by the store and entries that are not regular files,
+// so a rewritten manifest or a planted symlink can't lead outside dir.
+func uploadPath(dir, id, name string) (string, error) {
+	if !validUploadID(id) {
+		return "", fmt.Errorf("invalid upload id %q", id)
+	}
+	dir = filepath.Clean(dir)
+	path := filepath.Join(dir, id+"-"+SanitizePathComponent(name))
+	if filepath.Dir(path) != dir {
+		return "", fmt.Errorf("upload %s: path outside %s", id, dir)
+	}
+	if info, err := os.Lstat(path); err == nil && !info.Mode().IsRegular() {
+		return "", fmt.Errorf("upload %s: %s is not a regular file", id, path)
+	}
+	return path, nil
+}
+
+// uploadTempRoot is the parent of the fallback upload directories.
+func uploadTempRoot() string {
+	return filepath.Join(os.TempDir(), "tmux-adapter", "uploads")
+}
+
+// uploadDir returns the agent's upload directory: <workDir>/.tmux-adapter/uploads/<agent>,
+// falling back to the system temp directory when the workDir is unusable.
+// With create false, only an existing directory is returned.
+func uploadDir(agent agents.Agent, create bool) (string, error) {
+	safeAgent := SanitizePathComponent(agent.Name)
+	candidates := make([]string, 0, 2)
+	if strings.TrimSpace(agent.WorkDir) != "" {
+		candidates = append(candidates, filepath.Join(agent.WorkDir, ".tmux-adapter", "uploads", safeAgent))
+	}
+	candidates = append(candidates, filepath.Join(uploadTempRoot(), safeAgent))
+
+	var lastErr error
+	for _, dir := range candidates {
+		if !create {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				return dir, nil
+			}
+			continue
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			lastErr = err
+			continue
+		}
+		return dir, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no upload path available")
+	}
+	return "", lastErr
+}
+
+// loadUploadManifest reads dir's manifest, rebuilding each record's path.
+// Records that don't map to a file inside dir are dropped.
+func loadUploadManifest(dir string) uploadManifest {
+	var manifest uploadManifest
+	data, err := os.ReadFile(filepath.Join(dir, uploadManifestName))
+	if err != nil {
+		return manifest
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		log.Printf("uploads: ignoring unreadable manifest in %s: %v", dir, err)
+		return uploadManifest{}
+	}
+	kept := manifest.Files[:0]
+	for _, rec := range manifest.Files {
+		path, err := uploadPath(dir, rec.ID, rec.Name)
+		if err != nil {
+			log.Printf("uploads: dropping manifest entry in %s: %v", dir, err)
+			continue
+		}
+		rec.Path = path
+		kept = append(kept, rec)
+	}
+	manifest.Files = kept
+	return manifest
+}
+
+// saveUploadManifest writes the manifest atomically, without paths.
+func saveUploadManifest(dir string, manifest uploadManifest) error {
+	files := make([]UploadRecord, len(manifest.Files))
+	for i, rec := range manifest.Files {
+		rec.Path = ""
+		files[i] = rec
+	}
+	data, err := json.MarshalIndent(uploadManifest{Files: files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, uploadManifestName+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, uploadManifestName))
+}
@@ -0,0 +1,183 @@
+package agentio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+// newTestUploadStore returns a store over one agent with a temp workDir and
+// a controllable clock.
+func newTestUploadStore(t *testing.T, policy UploadPolicy) (*UploadStore, string, *time.Time) {
+	t.Helper()
+	_, p, workDir := newWorkDirPrompter(t, "claude")
+	store := NewUploadStore(p.Registry, policy)
+	store.tempRoot = t.TempDir()
+	now := time.Date(2026, 2, 14, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	return store, workDir, &now
+}
+
+func TestUploadStoreDedupesByContent(t *testing.T) {
+	store, workDir, now := newTestUploadStore(t, UploadPolicy{})
+
+	first, deduped, err := store.Save("hq-agent", "shot.png", "image/png", []byte("pixels"), "10.0.0.5:1")
+	if err != nil || deduped {
+		t.Fatalf("Save() = %+v, deduped %v, err %v", first, deduped, err)
+	}
+	if !strings.HasPrefix(first.Path, filepath.Join(workDir, ".tmux-adapter", "uploads", "hq-agent")) {
+		t.Fatalf("stored outside the agent upload dir: %s", first.Path)
+	}
+
+	*now = now.Add(time.Minute)
+	second, deduped, err := store.Save("hq-agent", "shot-again.png", "image/png", []byte("pixels"), "10.0.0.6:2")
+	if err != nil || !deduped {
+		t.Fatalf("Save() deduped %v, err %v", deduped, err)
+	}
+	if second.Path != first.Path || second.ID != first.ID {
+		t.Fatalf("re-upload stored a new copy: %s vs %s", second.Path, first.Path)
+	}
+	if len(second.Uploads) != 2 || second.Uploads[1].Client != "10.0.0.6:2" || second.Uploads[1].Name != "shot-again.png" {
+		t.Fatalf("upload history = %+v", second.Uploads)
+	}
+
+	records, err := store.List("hq-agent")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("List() = %+v, err %v", records, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(first.Path))
+	if len(entries) != 2 { // the file and manifest.json
+		t.Fatalf("upload dir has %d entries, want 2", len(entries))
+	}
+}
+
+func TestUploadStoreDelete(t *testing.T) {
+	store, _, _ := newTestUploadStore(t, UploadPolicy{})
+	rec, _, err := store.Save("hq-agent", "notes.txt", "text/plain", []byte("hello"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Delete("hq-agent", rec.ID); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if _, err := os.Stat(rec.Path); !os.IsNotExist(err) {
+		t.Fatalf("file still present after delete: %v", err)
+	}
+	if _, err := store.Delete("hq-agent", rec.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("second Delete() error = %v, want ErrUploadNotFound", err)
+	}
+	if records, _ := store.List("hq-agent"); len(records) != 0 {
+		t.Fatalf("List() after delete = %+v", records)
+	}
+}
+
+func TestUploadStoreQuotaEvictsLeastRecent(t *testing.T) {
+	store, _, now := newTestUploadStore(t, UploadPolicy{MaxBytesPerAgent: 10, MaxFilesPerAgent: 2})
+
+	a, _, _ := store.Save("hq-agent", "a.txt", "text/plain", []byte("aaaa"), "")
+	*now = now.Add(time.Second)
+	b, _, _ := store.Save("hq-agent", "b.txt", "text/plain", []byte("bbbb"), "")
+	*now = now.Add(time.Second)
+	// Re-uploading a makes b the least recently used.
+	store.Save("hq-agent", "a.txt", "text/plain", []byte("aaaa"), "")
+	*now = now.Add(time.Second)
+	c, _, err := store.Save("hq-agent", "c.txt", "text/plain", []byte("cccc"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, _ := store.List("hq-agent")
+	var ids []string
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	if strings.Join(ids, ",") != c.ID+","+a.ID {
+		t.Fatalf("kept %v, want [%s %s]", ids, c.ID, a.ID)
+	}
+	if _, err := os.Stat(b.Path); !os.IsNotExist(err) {
+		t.Fatal("evicted file still on disk")
+	}
+
+	if _, _, err := store.Save("hq-agent", "big.bin", "", make([]byte, 11), ""); err == nil {
+		t.Fatal("expected error for a file larger than the quota")
+	}
+}
+
+func TestUploadStoreExpiresOldFiles(t *testing.T) {
+	store, _, now := newTestUploadStore(t, UploadPolicy{MaxAge: time.Hour})
+	rec, _, _ := store.Save("hq-agent", "old.txt", "text/plain", []byte("old"), "")
+
+	*now = now.Add(2 * time.Hour)
+	store.Cleanup()
+	if _, err := os.Stat(rec.Path); !os.IsNotExist(err) {
+		t.Fatal("expired file still on disk after Cleanup")
+	}
+	if records, _ := store.List("hq-agent"); len(records) != 0 {
+		t.Fatalf("List() = %+v, want empty", records)
+	}
+}
+
+func TestUploadStoreIgnoresTamperedManifestPaths(t *testing.T) {
+	store, workDir, now := newTestUploadStore(t, UploadPolicy{MaxAge: time.Hour})
+	rec, _, err := store.Save("hq-agent", "notes.txt", "text/plain", []byte("hello"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(rec.Path)
+
+	victim := filepath.Join(t.TempDir(), "victim.txt")
+	if err := os.WriteFile(victim, []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(victim, filepath.Join(dir, "0123456789abcdef-link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	// The agent rewrites its manifest: the real record points at the victim,
+	// one ID tries to climb out of the dir and one entry is a planted symlink.
+	tampered := `{"files": [
+		{"id": "` + rec.ID + `", "name": "notes.txt", "path": "` + victim + `", "lastUploadedAt": "2026-02-14T12:00:00Z"},
+		{"id": "../../../victim", "name": "x", "path": "` + victim + `", "lastUploadedAt": "2026-02-14T12:00:00Z"},
+		{"id": "0123456789abcdef", "name": "link.txt", "lastUploadedAt": "2026-02-14T12:00:00Z"}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, uploadManifestName), []byte(tampered), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	records, _ := store.List("hq-agent")
+	if len(records) != 1 || records[0].Path != rec.Path {
+		t.Fatalf("List() = %+v, want only the real record at %s", records, rec.Path)
+	}
+	if _, err := store.Delete("hq-agent", rec.ID); err != nil {
+		t.Fatal(err)
+	}
+	*now = now.Add(2 * time.Hour)
+	store.Cleanup()
+
+	if data, err := os.ReadFile(victim); err != nil || string(data) != "keep me" {
+		t.Fatalf("victim file = %q, %v; a manifest path was trusted", data, err)
+	}
+	if manifest, _ := os.ReadFile(filepath.Join(dir, uploadManifestName)); strings.Contains(string(manifest), workDir) {
+		t.Fatalf("manifest persisted an absolute path: %s", manifest)
+	}
+}
+
+func TestUploadStoreCleanupReachesDepartedAgents(t *testing.T) {
+	store, _, now := newTestUploadStore(t, UploadPolicy{MaxAge: time.Hour})
+	rec, _, err := store.Save("hq-agent", "old.txt", "text/plain", []byte("old"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.registry = agents.NewRegistry(nil, "", nil)
+
+	*now = now.Add(2 * time.Hour)
+	store.Cleanup()
+	if _, err := os.Stat(rec.Path); !os.IsNotExist(err) {
+		t.Fatal("upload of a departed agent survived Cleanup")
+	}
+}
@@ -73,20 +73,26 @@ func CheckProcessBinary(pid string, processNames []string) bool {
 // CheckDescendants walks the process tree looking for a matching process name.
 // Max depth of 10 to prevent infinite loops.
 func CheckDescendants(pid string, processNames []string) bool {
-	return checkDescendantsDepth(pid, processNames, 0)
+	return FindDescendant(pid, processNames) != ""
 }
 
-func checkDescendantsDepth(pid string, processNames []string, depth int) bool {
+// FindDescendant walks the process tree below pid and returns the PID of the
+// first process whose name matches, or "" if none does.
+func FindDescendant(pid string, processNames []string) string {
+	return findDescendantDepth(pid, processNames, 0)
+}
+
+func findDescendantDepth(pid string, processNames []string, depth int) string {
 	if depth >= 10 {
-		return false
+		return ""
 	}
 
 	out, err := exec.Command("pgrep", "-P", pid, "-l").Output()
 	if err != nil {
 		if _, ok := err.(*exec.ExitError); !ok {
-			log.Printf("checkDescendantsDepth(%s): unexpected error: %v", pid, err)
+			log.Printf("findDescendantDepth(%s): unexpected error: %v", pid, err)
 		}
-		return false
+		return ""
 	}
 
 	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
@@ -101,13 +107,13 @@ func checkDescendantsDepth(pid string, processNames []string, depth int) bool {
 		childName := parts[1]
 
 		if IsAgentProcess(childName, processNames) {
-			return true
+			return childPID
 		}
-		if checkDescendantsDepth(childPID, processNames, depth+1) {
-			return true
+		if found := findDescendantDepth(childPID, processNames, depth+1); found != "" {
+			return found
 		}
 	}
-	return false
+	return ""
 }
 
 // ParseSessionName extracts role and rig from a gastown session name.
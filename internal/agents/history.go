@@ -0,0 +1,189 @@
+package agents
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// maxLifetimesPerAgent bounds how many runs are kept for a single agent name.
+	maxLifetimesPerAgent = 20
+	// maxHistoryAgents bounds how many agent names are tracked. When exceeded,
+	// the stopped agent that stopped longest ago is evicted, or the agent
+	// first seen longest ago if all are running.
+	maxHistoryAgents = 500
+)
+
+// AgentLifetime records one continuous run of an agent process.
+type AgentLifetime struct {
+	StartedAt  time.Time  `json:"startedAt"`
+	StoppedAt  *time.Time `json:"stoppedAt"` // nil while running
+	DurationMs int64      `json:"durationMs"`
+	WorkDir    string     `json:"workDir"`
+	Runtime    string     `json:"runtime"`
+}
+
+// AgentHistory summarizes the lifecycle of one agent name across restarts.
+type AgentHistory struct {
+	Name          string          `json:"name"`
+	Running       bool            `json:"running"`
+	Restarts      int             `json:"restarts"` // starts after the first one
+	FirstSeen     time.Time       `json:"firstSeen"`
+	LastStarted   time.Time       `json:"lastStarted"`
+	LastStopped   *time.Time      `json:"lastStopped"`
+	TotalUptimeMs int64           `json:"totalUptimeMs"`
+	LastWorkDir   string          `json:"lastWorkDir"`
+	LastRuntime   string          `json:"lastRuntime"`
+	Lifetimes     []AgentLifetime `json:"lifetimes"` // oldest first, bounded
+}
+
+// agentRecord is the mutable per-name history entry.
+type agentRecord struct {
+	name        string
+	restarts    int
+	firstSeen   time.Time
+	lastWorkDir string
+	lastRuntime string
+	priorUptime time.Duration // uptime of lifetimes evicted from the window
+	lifetimes   []AgentLifetime
+}
+
+// lifecycleHistory keeps bounded start/stop history per agent name.
+// Not safe for concurrent use; Registry guards it with its own mutex.
+type lifecycleHistory struct {
+	records map[string]*agentRecord
+}
+
+func newLifecycleHistory() *lifecycleHistory {
+	return &lifecycleHistory{records: make(map[string]*agentRecord)}
+}
+
+func (h *lifecycleHistory) recordStart(agent Agent, at time.Time) {
+	rec, ok := h.records[agent.Name]
+	if !ok {
+		h.evictIfFull()
+		rec = &agentRecord{name: agent.Name, firstSeen: at}
+		h.records[agent.Name] = rec
+	} else {
+		rec.restarts++
+	}
+	rec.lastWorkDir = agent.WorkDir
+	rec.lastRuntime = agent.Runtime
+
+	rec.lifetimes = append(rec.lifetimes, AgentLifetime{
+		StartedAt: at,
+		WorkDir:   agent.WorkDir,
+		Runtime:   agent.Runtime,
+	})
+	if len(rec.lifetimes) > maxLifetimesPerAgent {
+		dropped := rec.lifetimes[0]
+		if dropped.StoppedAt != nil {
+			rec.priorUptime += dropped.StoppedAt.Sub(dropped.StartedAt)
+		}
+		rec.lifetimes = append([]AgentLifetime(nil), rec.lifetimes[1:]...)
+	}
+}
+
+func (h *lifecycleHistory) recordUpdate(agent Agent) {
+	rec, ok := h.records[agent.Name]
+	if !ok {
+		return
+	}
+	rec.lastWorkDir = agent.WorkDir
+	rec.lastRuntime = agent.Runtime
+	if n := len(rec.lifetimes); n > 0 && rec.lifetimes[n-1].StoppedAt == nil {
+		rec.lifetimes[n-1].WorkDir = agent.WorkDir
+		rec.lifetimes[n-1].Runtime = agent.Runtime
+	}
+}
+
+func (h *lifecycleHistory) recordStop(agent Agent, at time.Time) {
+	rec, ok := h.records[agent.Name]
+	if !ok {
+		return
+	}
+	if n := len(rec.lifetimes); n > 0 && rec.lifetimes[n-1].StoppedAt == nil {
+		stopped := at
+		rec.lifetimes[n-1].StoppedAt = &stopped
+	}
+}
+
+// evictIfFull drops the stopped agent that stopped longest ago when the
+// number of tracked names has reached maxHistoryAgents. If every tracked
+// agent is running, it drops the one first seen longest ago instead.
+func (h *lifecycleHistory) evictIfFull() {
+	if len(h.records) < maxHistoryAgents {
+		return
+	}
+	var oldestName, firstName string
+	var oldestStop, firstSeen time.Time
+	for name, rec := range h.records {
+		if firstName == "" || rec.firstSeen.Before(firstSeen) {
+			firstName = name
+			firstSeen = rec.firstSeen
+		}
+		last := rec.lifetimes[len(rec.lifetimes)-1]
+		if last.StoppedAt == nil {
+			continue
+		}
+		if oldestName == "" || last.StoppedAt.Before(oldestStop) {
+			oldestName = name
+			oldestStop = *last.StoppedAt
+		}
+	}
+	if oldestName == "" {
+		oldestName = firstName
+	}
+	delete(h.records, oldestName)
+}
+
+// snapshot builds an immutable AgentHistory for one record as of now.
+func (rec *agentRecord) snapshot(now time.Time) AgentHistory {
+	out := AgentHistory{
+		Name:        rec.name,
+		Restarts:    rec.restarts,
+		FirstSeen:   rec.firstSeen,
+		LastWorkDir: rec.lastWorkDir,
+		LastRuntime: rec.lastRuntime,
+		Lifetimes:   make([]AgentLifetime, len(rec.lifetimes)),
+	}
+
+	total := rec.priorUptime
+	for i, lt := range rec.lifetimes {
+		end := now
+		if lt.StoppedAt != nil {
+			end = *lt.StoppedAt
+			stopped := *lt.StoppedAt
+			lt.StoppedAt = &stopped
+			out.LastStopped = &stopped
+		}
+		d := end.Sub(lt.StartedAt)
+		lt.DurationMs = d.Milliseconds()
+		total += d
+		out.Lifetimes[i] = lt
+	}
+	if n := len(rec.lifetimes); n > 0 {
+		last := rec.lifetimes[n-1]
+		out.LastStarted = last.StartedAt
+		out.Running = last.StoppedAt == nil
+	}
+	out.TotalUptimeMs = total.Milliseconds()
+	return out
+}
+
+func (h *lifecycleHistory) get(name string, now time.Time) (AgentHistory, bool) {
+	rec, ok := h.records[name]
+	if !ok {
+		return AgentHistory{}, false
+	}
+	return rec.snapshot(now), true
+}
+
+func (h *lifecycleHistory) all(now time.Time) []AgentHistory {
+	result := make([]AgentHistory, 0, len(h.records))
+	for _, rec := range h.records {
+		result = append(result, rec.snapshot(now))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
@@ -0,0 +1,187 @@
+package agents
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/tmux"
+)
+
+// fakeClock returns a controllable time source for registry history tests.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestHistoryTracksRestarts(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2026, 2, 14, 12, 0, 0, 0, time.UTC)}
+	mock := newMockControl()
+	mock.panes["gt-myrig-toast"] = tmux.PaneInfo{Command: "claude", PID: "100", WorkDir: "/tmp/gt/myrig/toast"}
+
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	r.now = clock.now
+
+	// Start, run 10s, crash, restart, run 5s
+	mock.sessions = []tmux.SessionInfo{{Name: "gt-myrig-toast"}}
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+	clock.advance(10 * time.Second)
+	mock.sessions = nil
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+	clock.advance(2 * time.Second)
+	mock.sessions = []tmux.SessionInfo{{Name: "gt-myrig-toast"}}
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+	clock.advance(5 * time.Second)
+
+	h, ok := r.GetAgentHistory("gt-myrig-toast")
+	if !ok {
+		t.Fatal("expected history for gt-myrig-toast")
+	}
+	if !h.Running {
+		t.Fatal("expected agent to be running")
+	}
+	if h.Restarts != 1 {
+		t.Fatalf("restarts = %d, want 1", h.Restarts)
+	}
+	if len(h.Lifetimes) != 2 {
+		t.Fatalf("lifetimes = %d, want 2", len(h.Lifetimes))
+	}
+	if h.Lifetimes[0].DurationMs != 10000 {
+		t.Fatalf("first lifetime = %dms, want 10000", h.Lifetimes[0].DurationMs)
+	}
+	if h.Lifetimes[1].StoppedAt != nil {
+		t.Fatal("current lifetime should have no stop time")
+	}
+	if h.TotalUptimeMs != 15000 {
+		t.Fatalf("total uptime = %dms, want 15000", h.TotalUptimeMs)
+	}
+	if h.LastStopped == nil || !h.LastStopped.Equal(h.Lifetimes[0].StartedAt.Add(10*time.Second)) {
+		t.Fatalf("unexpected last stopped time: %v", h.LastStopped)
+	}
+	if h.LastWorkDir != "/tmp/gt/myrig/toast" || h.LastRuntime != "claude" {
+		t.Fatalf("unexpected last known state: workDir=%q runtime=%q", h.LastWorkDir, h.LastRuntime)
+	}
+}
+
+func TestHistoryKeepsStoppedAgents(t *testing.T) {
+	mock := newMockControl()
+	mock.sessions = []tmux.SessionInfo{{Name: "hq-witness"}}
+	mock.panes["hq-witness"] = tmux.PaneInfo{Command: "claude", PID: "100", WorkDir: "/tmp/gt/work"}
+
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+	mock.sessions = nil
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+
+	if _, ok := r.GetAgent("hq-witness"); ok {
+		t.Fatal("stopped agent should not be live")
+	}
+	all := r.GetHistory()
+	if len(all) != 1 || all[0].Name != "hq-witness" || all[0].Running {
+		t.Fatalf("unexpected history: %+v", all)
+	}
+}
+
+func TestHistoryRecordsUpdatedWorkDir(t *testing.T) {
+	mock := newMockControl()
+	mock.sessions = []tmux.SessionInfo{{Name: "hq-witness"}}
+	mock.panes["hq-witness"] = tmux.PaneInfo{Command: "claude", PID: "100", WorkDir: "/tmp/gt/work"}
+
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+	mock.panes["hq-witness"] = tmux.PaneInfo{Command: "claude", PID: "100", WorkDir: "/tmp/gt/work/tree"}
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+
+	h, _ := r.GetAgentHistory("hq-witness")
+	if h.LastWorkDir != "/tmp/gt/work/tree" {
+		t.Fatalf("last workDir = %q, want %q", h.LastWorkDir, "/tmp/gt/work/tree")
+	}
+	if h.Lifetimes[0].WorkDir != "/tmp/gt/work/tree" {
+		t.Fatalf("current lifetime workDir = %q, want updated value", h.Lifetimes[0].WorkDir)
+	}
+}
+
+func TestHistoryBoundsLifetimes(t *testing.T) {
+	h := newLifecycleHistory()
+	start := time.Date(2026, 2, 14, 12, 0, 0, 0, time.UTC)
+	agent := Agent{Name: "gt-myrig-flaky", Runtime: "claude"}
+
+	for i := 0; i < maxLifetimesPerAgent+5; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		h.recordStart(agent, at)
+		h.recordStop(agent, at.Add(time.Second))
+	}
+
+	got, ok := h.get(agent.Name, start.Add(time.Hour))
+	if !ok {
+		t.Fatal("expected history entry")
+	}
+	if len(got.Lifetimes) != maxLifetimesPerAgent {
+		t.Fatalf("lifetimes = %d, want %d", len(got.Lifetimes), maxLifetimesPerAgent)
+	}
+	if got.Restarts != maxLifetimesPerAgent+4 {
+		t.Fatalf("restarts = %d, want %d", got.Restarts, maxLifetimesPerAgent+4)
+	}
+	// Evicted lifetimes still count toward total uptime.
+	if want := int64(maxLifetimesPerAgent+5) * 1000; got.TotalUptimeMs != want {
+		t.Fatalf("total uptime = %dms, want %d", got.TotalUptimeMs, want)
+	}
+}
+
+func TestHistoryEvictsOldestStoppedAgent(t *testing.T) {
+	h := newLifecycleHistory()
+	start := time.Date(2026, 2, 14, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < maxHistoryAgents; i++ {
+		a := Agent{Name: fmt.Sprintf("gt-rig-p%d", i)}
+		h.recordStart(a, start)
+		h.recordStop(a, start.Add(time.Duration(i+1)*time.Second))
+	}
+	h.recordStart(Agent{Name: "gt-rig-new"}, start.Add(time.Hour))
+
+	if len(h.records) != maxHistoryAgents {
+		t.Fatalf("records = %d, want %d", len(h.records), maxHistoryAgents)
+	}
+	if _, ok := h.records["gt-rig-p0"]; ok {
+		t.Fatal("expected the agent that stopped first to be evicted")
+	}
+	if _, ok := h.records["gt-rig-new"]; !ok {
+		t.Fatal("expected new agent to be tracked")
+	}
+}
+
+func TestHistoryEvictsOldestWhenAllRunning(t *testing.T) {
+	h := newLifecycleHistory()
+	start := time.Date(2026, 2, 14, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < maxHistoryAgents; i++ {
+		h.recordStart(Agent{Name: fmt.Sprintf("gt-rig-p%d", i)}, start.Add(time.Duration(i)*time.Second))
+	}
+	h.recordStart(Agent{Name: "gt-rig-new"}, start.Add(time.Hour))
+
+	if len(h.records) != maxHistoryAgents {
+		t.Fatalf("records = %d, want %d", len(h.records), maxHistoryAgents)
+	}
+	if _, ok := h.records["gt-rig-p0"]; ok {
+		t.Fatal("expected the agent first seen to be evicted")
+	}
+	if _, ok := h.records["gt-rig-new"]; !ok {
+		t.Fatal("expected new agent to be tracked")
+	}
+}
@@ -1,27 +1,98 @@
 package agents
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+// ErrAgentNotFound is returned when the named agent is not registered.
+var ErrAgentNotFound = errors.New("agent not found")
+
 // RegistryEvent represents a change in agent state.
 type RegistryEvent struct {
-	Type  string // "added", "removed", "updated"
-	Agent Agent
+	Type    string // "added", "removed", "updated"
+	Agent   Agent
+	Changes []AgentChange // for "updated" events: which fields changed
+}
+
+// AgentChange describes a single field-level change between two agent snapshots.
+type AgentChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// DiffAgents compares two snapshots of the same agent and returns the fields
+// that differ. Field names match the Agent JSON tags.
+func DiffAgents(oldAgent, newAgent Agent) []AgentChange {
+	var changes []AgentChange
+	if oldAgent.Role != newAgent.Role {
+		changes = append(changes, AgentChange{Field: "role", Old: oldAgent.Role, New: newAgent.Role})
+	}
+	if oldAgent.Runtime != newAgent.Runtime {
+		changes = append(changes, AgentChange{Field: "runtime", Old: oldAgent.Runtime, New: newAgent.Runtime})
+	}
+	if oldRig, newRig := rigValue(oldAgent.Rig), rigValue(newAgent.Rig); oldRig != newRig {
+		changes = append(changes, AgentChange{Field: "rig", Old: oldRig, New: newRig})
+	}
+	if oldAgent.WorkDir != newAgent.WorkDir {
+		changes = append(changes, AgentChange{Field: "workDir", Old: oldAgent.WorkDir, New: newAgent.WorkDir})
+	}
+	if oldAgent.Attached != newAgent.Attached {
+		changes = append(changes, AgentChange{Field: "attached", Old: oldAgent.Attached, New: newAgent.Attached})
+	}
+	return changes
+}
+
+// ChangesMatchFields reports whether any change touches one of the given fields.
+// A nil field set matches everything.
+func ChangesMatchFields(changes []AgentChange, fields map[string]bool) bool {
+	if fields == nil {
+		return true
+	}
+	for _, change := range changes {
+		if fields[change.Field] {
+			return true
+		}
+	}
+	return false
+}
+
+// rigValue flattens an optional rig into a comparable value (nil for town-level agents).
+func rigValue(rig *string) any {
+	if rig == nil {
+		return nil
+	}
+	return *rig
 }
 
+// subscriberBufferSize is the per-subscriber event buffer. A subscriber whose
+// buffer is full has its channel closed so scan never blocks.
+const subscriberBufferSize = 100
+
 // Registry tracks live agents and emits lifecycle events.
 type Registry struct {
 	ctrl         ControlModeInterface
 	mu           sync.RWMutex
 	agents       map[string]Agent // name -> agent
-	events       chan RegistryEvent
+	history      *lifecycleHistory
+	now          func() time.Time
 	gtDir        string
 	skipSessions []string
 	stopCh       chan struct{}
+
+	// subsMu serializes publishing with Subscribe so a replayed snapshot and
+	// the live stream never overlap or leave a gap.
+	subsMu    sync.Mutex
+	subs      map[int]chan RegistryEvent
+	nextSubID int
+	stopped   bool
 }
 
 // NewRegistry creates a new agent registry.
@@ -30,10 +101,12 @@ func NewRegistry(ctrl ControlModeInterface, gtDir string, skipSessions []string)
 	return &Registry{
 		ctrl:         ctrl,
 		agents:       make(map[string]Agent),
-		events:       make(chan RegistryEvent, 100),
+		history:      newLifecycleHistory(),
+		now:          time.Now,
 		gtDir:        gtDir,
 		skipSessions: skipSessions,
 		stopCh:       make(chan struct{}),
+		subs:         make(map[int]chan RegistryEvent),
 	}
 }
 
@@ -49,14 +122,119 @@ func (r *Registry) Start() error {
 	return nil
 }
 
-// Stop halts the registry watcher.
+// Stop halts the registry watcher and closes all subscriber channels.
 func (r *Registry) Stop() {
 	close(r.stopCh)
+
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+	r.stopped = true
+	for id, ch := range r.subs {
+		close(ch)
+		delete(r.subs, id)
+	}
+}
+
+// Subscribe registers a new consumer of lifecycle events and returns its ID
+// and a buffered channel. Each subscriber gets its own stream. A subscriber
+// that falls a full buffer behind has its channel closed rather than
+// blocking the scan loop; it should call Resubscribe unless Done is closed.
+// If replay is true, an "added" event for every currently known agent is
+// queued before any live event; the buffer grows to hold all of them.
+func (r *Registry) Subscribe(replay bool) (int, <-chan RegistryEvent) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	var catchUp []RegistryEvent
+	if replay {
+		catchUp = catchUpEvents(nil, r.GetAgents())
+	}
+	return r.subscribeLocked(catchUp)
+}
+
+// Resubscribe is Subscribe for a consumer whose channel was closed because
+// it fell behind. known is the consumer's last view of the agents; the new
+// stream starts with the "removed", "added" and "updated" events that bring
+// that view up to date.
+func (r *Registry) Resubscribe(known map[string]Agent) (int, <-chan RegistryEvent) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	return r.subscribeLocked(catchUpEvents(known, r.GetAgents()))
+}
+
+// subscribeLocked registers a subscriber whose stream starts with catchUp.
+// The caller must hold subsMu.
+func (r *Registry) subscribeLocked(catchUp []RegistryEvent) (int, <-chan RegistryEvent) {
+	ch := make(chan RegistryEvent, len(catchUp)+subscriberBufferSize)
+	if r.stopped {
+		close(ch)
+		return 0, ch
+	}
+	for _, event := range catchUp {
+		ch <- event
+	}
+
+	r.nextSubID++
+	id := r.nextSubID
+	r.subs[id] = ch
+	return id, ch
+}
+
+// catchUpEvents returns the events that turn the known agents into current.
+func catchUpEvents(known map[string]Agent, current []Agent) []RegistryEvent {
+	var events []RegistryEvent
+	seen := make(map[string]bool, len(current))
+	for _, a := range current {
+		seen[a.Name] = true
+	}
+	for name, a := range known {
+		if !seen[name] {
+			events = append(events, RegistryEvent{Type: "removed", Agent: a})
+		}
+	}
+	for _, a := range current {
+		old, ok := known[a.Name]
+		if !ok {
+			events = append(events, RegistryEvent{Type: "added", Agent: a})
+		} else if changes := DiffAgents(old, a); len(changes) > 0 {
+			events = append(events, RegistryEvent{Type: "updated", Agent: a, Changes: changes})
+		}
+	}
+	return events
+}
+
+// Done returns a channel that is closed when the registry stops. A consumer
+// whose channel closes checks it to tell shutdown from falling behind.
+func (r *Registry) Done() <-chan struct{} {
+	return r.stopCh
+}
+
+// Unsubscribe removes a subscriber by ID and closes its channel.
+func (r *Registry) Unsubscribe(id int) {
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
+	if ch, ok := r.subs[id]; ok {
+		delete(r.subs, id)
+		close(ch)
+	}
 }
 
-// Events returns the channel for receiving lifecycle events.
-func (r *Registry) Events() <-chan RegistryEvent {
-	return r.events
+// publishLocked fans an event out to every subscriber without blocking.
+// A subscriber whose buffer is full is closed and removed, so it knows to
+// resubscribe instead of silently missing the event. The caller must hold
+// subsMu.
+func (r *Registry) publishLocked(event RegistryEvent) {
+	for id, ch := range r.subs {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("registry: subscriber %d fell behind at %s event for %s; closing its stream", id, event.Type, event.Agent.Name)
+			close(ch)
+			delete(r.subs, id)
+		}
+	}
 }
 
 // GetAgents returns a snapshot of all currently known agents.
@@ -79,6 +257,59 @@ func (r *Registry) GetAgent(name string) (Agent, bool) {
 	return a, ok
 }
 
+// AgentPID resolves the PID of an agent's CLI process, using the same
+// detection order as scan: the pane process itself when it is the agent
+// (directly or via its binary), otherwise a matching descendant.
+func (r *Registry) AgentPID(name string) (int, error) {
+	agent, ok := r.GetAgent(name)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrAgentNotFound, name)
+	}
+	pane, err := r.ctrl.GetPaneInfo(name)
+	if err != nil {
+		return 0, fmt.Errorf("pane info for %s: %w", name, err)
+	}
+	if pane.PID == "" {
+		return 0, fmt.Errorf("no pane PID for %s", name)
+	}
+
+	processNames := GetProcessNames(agent.Runtime)
+	pid := ""
+	switch {
+	case IsAgentProcess(pane.Command, processNames):
+		pid = pane.PID
+	case IsShell(pane.Command):
+		pid = FindDescendant(pane.PID, processNames)
+	case CheckProcessBinary(pane.PID, processNames):
+		pid = pane.PID
+	default:
+		pid = FindDescendant(pane.PID, processNames)
+	}
+	if pid == "" {
+		return 0, fmt.Errorf("no %s process found for %s", agent.Runtime, name)
+	}
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PID %q for %s", pid, name)
+	}
+	return n, nil
+}
+
+// GetHistory returns lifecycle history for every agent name seen, sorted by name.
+// Stopped agents remain listed until evicted by the history bound.
+func (r *Registry) GetHistory() []AgentHistory {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.history.all(r.now())
+}
+
+// GetAgentHistory returns lifecycle history for a single agent name.
+func (r *Registry) GetAgentHistory(name string) (AgentHistory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.history.get(name, r.now())
+}
+
 func (r *Registry) shouldSkip(sessionName string) bool {
 	return slices.Contains(r.skipSessions, sessionName)
 }
@@ -192,14 +423,21 @@ func (r *Registry) scan() error {
 		}
 	}
 
-	// Diff against known agents
+	// Diff against known agents. subsMu is held across the diff and publish so
+	// a concurrent Subscribe sees either the old state plus these events or
+	// the new state without them.
+	r.subsMu.Lock()
+	defer r.subsMu.Unlock()
+
 	r.mu.Lock()
 	var pendingEvents []RegistryEvent
+	now := r.now()
 
 	// Find removed agents
 	for name, oldAgent := range r.agents {
 		if _, exists := discovered[name]; !exists {
 			delete(r.agents, name)
+			r.history.recordStop(oldAgent, now)
 			pendingEvents = append(pendingEvents, RegistryEvent{Type: "removed", Agent: oldAgent})
 		}
 	}
@@ -209,17 +447,21 @@ func (r *Registry) scan() error {
 		oldAgent, existed := r.agents[name]
 		if !existed {
 			r.agents[name] = newAgent
+			r.history.recordStart(newAgent, now)
 			pendingEvents = append(pendingEvents, RegistryEvent{Type: "added", Agent: newAgent})
-		} else if oldAgent.Attached != newAgent.Attached {
+		} else if changes := DiffAgents(oldAgent, newAgent); len(changes) > 0 {
 			r.agents[name] = newAgent
-			pendingEvents = append(pendingEvents, RegistryEvent{Type: "updated", Agent: newAgent})
+			r.history.recordUpdate(newAgent)
+			pendingEvents = append(pendingEvents, RegistryEvent{Type: "updated", Agent: newAgent, Changes: changes})
 		}
 	}
 	r.mu.Unlock()
 
-	// Send events outside the lock to avoid deadlocking GetAgents() callers
-	for _, event := range pendingEvents {
-		r.events <- event
+	// Publish outside the agents lock so GetAgents() callers are never held up
+	if !r.stopped {
+		for _, event := range pendingEvents {
+			r.publishLocked(event)
+		}
 	}
 
 	return nil
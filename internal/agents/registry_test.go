@@ -1,7 +1,10 @@
 package agents
 
 import (
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/gastownhall/tmux-adapter/internal/tmux"
 )
@@ -54,12 +57,15 @@ func (m *mockControl) Notifications() <-chan tmux.Notification {
 	return m.notifCh
 }
 
-// drainEvents reads all buffered events from a registry.
-func drainEvents(r *Registry) []RegistryEvent {
+// drainEvents reads all buffered events from a subscription channel.
+func drainEvents(ch <-chan RegistryEvent) []RegistryEvent {
 	var events []RegistryEvent
 	for {
 		select {
-		case e := <-r.events:
+		case e, ok := <-ch:
+			if !ok {
+				return events
+			}
 			events = append(events, e)
 		default:
 			return events
@@ -70,6 +76,7 @@ func drainEvents(r *Registry) []RegistryEvent {
 func TestScanNoSessions(t *testing.T) {
 	mock := newMockControl()
 	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, sub := r.Subscribe(false)
 
 	if err := r.scan(); err != nil {
 		t.Fatalf("scan() error: %v", err)
@@ -80,7 +87,7 @@ func TestScanNoSessions(t *testing.T) {
 		t.Fatalf("expected 0 agents, got %d", len(agents))
 	}
 
-	events := drainEvents(r)
+	events := drainEvents(sub)
 	if len(events) != 0 {
 		t.Fatalf("expected 0 events, got %d", len(events))
 	}
@@ -144,6 +151,7 @@ func TestScanDetectsAgents(t *testing.T) {
 	}
 
 	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, sub := r.Subscribe(false)
 	if err := r.scan(); err != nil {
 		t.Fatalf("scan() error: %v", err)
 	}
@@ -153,7 +161,7 @@ func TestScanDetectsAgents(t *testing.T) {
 		t.Fatalf("expected 2 agents, got %d", len(agents))
 	}
 
-	events := drainEvents(r)
+	events := drainEvents(sub)
 	if len(events) != 2 {
 		t.Fatalf("expected 2 added events, got %d", len(events))
 	}
@@ -176,10 +184,11 @@ func TestScanAgentRemoved(t *testing.T) {
 	}
 
 	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, sub := r.Subscribe(false)
 	if err := r.scan(); err != nil {
 		t.Fatalf("first scan() error: %v", err)
 	}
-	drainEvents(r) // discard initial "added" events
+	drainEvents(sub) // discard initial "added" events
 
 	// Remove the session
 	mock.sessions = nil
@@ -192,7 +201,7 @@ func TestScanAgentRemoved(t *testing.T) {
 		t.Fatalf("expected 0 agents after removal, got %d", len(agents))
 	}
 
-	events := drainEvents(r)
+	events := drainEvents(sub)
 	if len(events) != 1 {
 		t.Fatalf("expected 1 removed event, got %d", len(events))
 	}
@@ -216,10 +225,11 @@ func TestScanAgentUpdatedAttachState(t *testing.T) {
 	}
 
 	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, sub := r.Subscribe(false)
 	if err := r.scan(); err != nil {
 		t.Fatalf("first scan() error: %v", err)
 	}
-	drainEvents(r)
+	drainEvents(sub)
 
 	// Change attached state
 	mock.sessions[0].Attached = true
@@ -227,7 +237,7 @@ func TestScanAgentUpdatedAttachState(t *testing.T) {
 		t.Fatalf("second scan() error: %v", err)
 	}
 
-	events := drainEvents(r)
+	events := drainEvents(sub)
 	if len(events) != 1 {
 		t.Fatalf("expected 1 updated event, got %d", len(events))
 	}
@@ -237,6 +247,100 @@ func TestScanAgentUpdatedAttachState(t *testing.T) {
 	if !events[0].Agent.Attached {
 		t.Fatal("expected updated agent to be attached")
 	}
+	if len(events[0].Changes) != 1 || events[0].Changes[0].Field != "attached" {
+		t.Fatalf("expected a single 'attached' change, got %+v", events[0].Changes)
+	}
+}
+
+func TestScanAgentUpdatedWorkDirChange(t *testing.T) {
+	mock := newMockControl()
+	mock.sessions = []tmux.SessionInfo{
+		{Name: "gt-myrig-toast", Attached: false},
+	}
+	mock.panes["gt-myrig-toast"] = tmux.PaneInfo{
+		Command: "claude",
+		PID:     "100",
+		WorkDir: "/tmp/gt/myrig/polecats/toast",
+	}
+
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, sub := r.Subscribe(false)
+	if err := r.scan(); err != nil {
+		t.Fatalf("first scan() error: %v", err)
+	}
+	drainEvents(sub)
+
+	// Agent cd's into a worktree
+	mock.panes["gt-myrig-toast"] = tmux.PaneInfo{
+		Command: "claude",
+		PID:     "100",
+		WorkDir: "/tmp/gt/myrig/polecats/toast/worktree",
+	}
+	if err := r.scan(); err != nil {
+		t.Fatalf("second scan() error: %v", err)
+	}
+
+	events := drainEvents(sub)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 updated event, got %d", len(events))
+	}
+	if events[0].Type != "updated" {
+		t.Fatalf("expected 'updated' event, got %q", events[0].Type)
+	}
+	if len(events[0].Changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", events[0].Changes)
+	}
+	change := events[0].Changes[0]
+	if change.Field != "workDir" {
+		t.Fatalf("change field = %q, want %q", change.Field, "workDir")
+	}
+	if change.Old != "/tmp/gt/myrig/polecats/toast" || change.New != "/tmp/gt/myrig/polecats/toast/worktree" {
+		t.Fatalf("unexpected workDir change: %+v", change)
+	}
+}
+
+func TestDiffAgents(t *testing.T) {
+	rigA := "alpha"
+	rigB := "beta"
+	base := Agent{Name: "gt-alpha-witness", Role: "witness", Runtime: "claude", Rig: &rigA, WorkDir: "/w", Attached: false}
+
+	if changes := DiffAgents(base, base); len(changes) != 0 {
+		t.Fatalf("expected no changes for identical agents, got %+v", changes)
+	}
+
+	updated := base
+	updated.Role = "refinery"
+	updated.Runtime = "gemini"
+	updated.Rig = &rigB
+	updated.WorkDir = "/w2"
+	updated.Attached = true
+
+	changes := DiffAgents(base, updated)
+	wantFields := []string{"role", "runtime", "rig", "workDir", "attached"}
+	if len(changes) != len(wantFields) {
+		t.Fatalf("expected %d changes, got %+v", len(wantFields), changes)
+	}
+	for i, field := range wantFields {
+		if changes[i].Field != field {
+			t.Fatalf("changes[%d].Field = %q, want %q", i, changes[i].Field, field)
+		}
+	}
+
+	// Rig going from set to town-level is reported with a nil new value.
+	townLevel := base
+	townLevel.Rig = nil
+	changes = DiffAgents(base, townLevel)
+	if len(changes) != 1 || changes[0].Field != "rig" || changes[0].Old != "alpha" || changes[0].New != nil {
+		t.Fatalf("unexpected rig change: %+v", changes)
+	}
+
+	// Distinct pointers to equal rig names are not a change.
+	sameRig := "alpha"
+	samePtr := base
+	samePtr.Rig = &sameRig
+	if changes := DiffAgents(base, samePtr); len(changes) != 0 {
+		t.Fatalf("expected no changes for equal rig values, got %+v", changes)
+	}
 }
 
 func TestScanNoEventWhenUnchanged(t *testing.T) {
@@ -251,17 +355,18 @@ func TestScanNoEventWhenUnchanged(t *testing.T) {
 	}
 
 	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, sub := r.Subscribe(false)
 	if err := r.scan(); err != nil {
 		t.Fatalf("first scan() error: %v", err)
 	}
-	drainEvents(r)
+	drainEvents(sub)
 
 	// Scan again with same state
 	if err := r.scan(); err != nil {
 		t.Fatalf("second scan() error: %v", err)
 	}
 
-	events := drainEvents(r)
+	events := drainEvents(sub)
 	if len(events) != 0 {
 		t.Fatalf("expected 0 events for unchanged state, got %d", len(events))
 	}
@@ -358,6 +463,29 @@ func TestGetAgent(t *testing.T) {
 	}
 }
 
+func TestAgentPIDDirectCommand(t *testing.T) {
+	mock := newMockControl()
+	mock.sessions = []tmux.SessionInfo{{Name: "hq-overseer"}}
+	mock.panes["hq-overseer"] = tmux.PaneInfo{Command: "claude", PID: "4242", WorkDir: "/tmp/gt/work"}
+
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+
+	pid, err := r.AgentPID("hq-overseer")
+	if err != nil {
+		t.Fatalf("AgentPID() error: %v", err)
+	}
+	if pid != 4242 {
+		t.Fatalf("AgentPID() = %d, want 4242", pid)
+	}
+
+	if _, err := r.AgentPID("nonexistent"); !errors.Is(err, ErrAgentNotFound) {
+		t.Fatalf("AgentPID(unknown) error = %v, want ErrAgentNotFound", err)
+	}
+}
+
 func TestWatchLoopTriggersRescan(t *testing.T) {
 	mock := newMockControl()
 	mock.sessions = []tmux.SessionInfo{
@@ -370,6 +498,7 @@ func TestWatchLoopTriggersRescan(t *testing.T) {
 	}
 
 	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, sub := r.Subscribe(false)
 
 	// Start the registry (does initial scan + starts watchLoop)
 	if err := r.Start(); err != nil {
@@ -378,7 +507,7 @@ func TestWatchLoopTriggersRescan(t *testing.T) {
 	defer r.Stop()
 
 	// Drain initial "added" event
-	<-r.Events()
+	<-sub
 
 	// Now add a new session and send a notification
 	mock.sessions = append(mock.sessions, tmux.SessionInfo{Name: "hq-overseer", Attached: false})
@@ -390,7 +519,7 @@ func TestWatchLoopTriggersRescan(t *testing.T) {
 	mock.notifCh <- tmux.Notification{Type: "sessions-changed"}
 
 	// Should get an "added" event for the new agent
-	event := <-r.Events()
+	event := <-sub
 	if event.Type != "added" {
 		t.Fatalf("expected 'added' event, got %q", event.Type)
 	}
@@ -411,19 +540,20 @@ func TestWatchLoopWindowRenamed(t *testing.T) {
 	}
 
 	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, sub := r.Subscribe(false)
 	if err := r.Start(); err != nil {
 		t.Fatalf("Start() error: %v", err)
 	}
 	defer r.Stop()
 
 	// Drain initial event
-	<-r.Events()
+	<-sub
 
 	// Remove the session and send window-renamed notification
 	mock.sessions = nil
 	mock.notifCh <- tmux.Notification{Type: "window-renamed"}
 
-	event := <-r.Events()
+	event := <-sub
 	if event.Type != "removed" {
 		t.Fatalf("expected 'removed' event from window-renamed, got %q", event.Type)
 	}
@@ -432,6 +562,7 @@ func TestWatchLoopWindowRenamed(t *testing.T) {
 func TestWatchLoopIgnoresIrrelevantNotifications(t *testing.T) {
 	mock := newMockControl()
 	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, sub := r.Subscribe(false)
 	if err := r.Start(); err != nil {
 		t.Fatalf("Start() error: %v", err)
 	}
@@ -442,7 +573,7 @@ func TestWatchLoopIgnoresIrrelevantNotifications(t *testing.T) {
 
 	// No events should be produced
 	select {
-	case e := <-r.Events():
+	case e := <-sub:
 		t.Fatalf("unexpected event: %+v", e)
 	default:
 		// Good — no event
@@ -465,3 +596,199 @@ func TestWatchLoopStopsOnClosedChannel(t *testing.T) {
 	// for goroutine exit. The key correctness property is tested by the fact that
 	// this test completes without spinning.
 }
+
+func TestSubscribeMultipleConsumers(t *testing.T) {
+	mock := newMockControl()
+	mock.sessions = []tmux.SessionInfo{
+		{Name: "hq-witness", Attached: false},
+	}
+	mock.panes["hq-witness"] = tmux.PaneInfo{
+		Command: "claude",
+		PID:     "100",
+		WorkDir: "/tmp/gt/work",
+	}
+
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, first := r.Subscribe(false)
+	_, second := r.Subscribe(false)
+
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+
+	for i, ch := range []<-chan RegistryEvent{first, second} {
+		events := drainEvents(ch)
+		if len(events) != 1 || events[0].Type != "added" {
+			t.Fatalf("subscriber %d: expected 1 added event, got %+v", i, events)
+		}
+	}
+}
+
+func TestSubscribeReplaysCurrentAgents(t *testing.T) {
+	mock := newMockControl()
+	mock.sessions = []tmux.SessionInfo{
+		{Name: "hq-witness", Attached: false},
+		{Name: "hq-overseer", Attached: false},
+	}
+	mock.panes["hq-witness"] = tmux.PaneInfo{Command: "claude", PID: "100", WorkDir: "/tmp/gt/a"}
+	mock.panes["hq-overseer"] = tmux.PaneInfo{Command: "claude", PID: "200", WorkDir: "/tmp/gt/b"}
+
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+
+	_, replayed := r.Subscribe(true)
+	events := drainEvents(replayed)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 replayed events, got %d", len(events))
+	}
+	for _, e := range events {
+		if e.Type != "added" {
+			t.Fatalf("expected replayed 'added' event, got %q", e.Type)
+		}
+	}
+
+	_, live := r.Subscribe(false)
+	if events := drainEvents(live); len(events) != 0 {
+		t.Fatalf("expected no events without replay, got %d", len(events))
+	}
+}
+
+func TestSubscribeReplaysBeyondBufferSize(t *testing.T) {
+	mock := newMockControl()
+	n := subscriberBufferSize + 20
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("gt-rig-polecats-p%03d", i)
+		mock.sessions = append(mock.sessions, tmux.SessionInfo{Name: name})
+		mock.panes[name] = tmux.PaneInfo{Command: "claude", PID: fmt.Sprint(1000 + i), WorkDir: "/tmp/gt/rig"}
+	}
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+
+	_, replayed := r.Subscribe(true)
+	if got := len(drainEvents(replayed)); got != n {
+		t.Fatalf("replayed %d agents, want %d", got, n)
+	}
+}
+
+func TestSlowSubscriberDoesNotBlockScan(t *testing.T) {
+	mock := newMockControl()
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	_, slow := r.Subscribe(false) // never drained until the end
+
+	// Toggle an agent in and out more times than the subscriber buffer holds.
+	mock.panes["hq-witness"] = tmux.PaneInfo{Command: "claude", PID: "100", WorkDir: "/tmp/gt/work"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < subscriberBufferSize; i++ {
+			mock.sessions = []tmux.SessionInfo{{Name: "hq-witness"}}
+			if err := r.scan(); err != nil {
+				t.Errorf("scan() error: %v", err)
+				return
+			}
+			mock.sessions = nil
+			if err := r.scan(); err != nil {
+				t.Errorf("scan() error: %v", err)
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("scan blocked on a slow subscriber")
+	}
+
+	if got := len(drainEvents(slow)); got != subscriberBufferSize {
+		t.Fatalf("slow subscriber buffered %d events, want %d", got, subscriberBufferSize)
+	}
+	if _, ok := <-slow; ok {
+		t.Fatal("expected the slow subscriber's channel to be closed")
+	}
+}
+
+func TestResubscribeCatchesUp(t *testing.T) {
+	mock := newMockControl()
+	mock.sessions = []tmux.SessionInfo{{Name: "hq-witness"}, {Name: "hq-overseer"}}
+	mock.panes["hq-witness"] = tmux.PaneInfo{Command: "claude", PID: "100", WorkDir: "/tmp/gt/new"}
+	mock.panes["hq-overseer"] = tmux.PaneInfo{Command: "claude", PID: "200", WorkDir: "/tmp/gt/b"}
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	if err := r.scan(); err != nil {
+		t.Fatalf("scan() error: %v", err)
+	}
+	current := make(map[string]Agent)
+	for _, a := range r.GetAgents() {
+		current[a.Name] = a
+	}
+
+	// The consumer last saw hq-witness in its old workDir and hq-mayor,
+	// which has since gone, and never saw hq-overseer.
+	oldWitness := current["hq-witness"]
+	oldWitness.WorkDir = "/tmp/gt/old"
+	known := map[string]Agent{
+		"hq-witness": oldWitness,
+		"hq-mayor":   {Name: "hq-mayor", Runtime: "claude"},
+	}
+	_, ch := r.Resubscribe(known)
+
+	got := make(map[string]RegistryEvent)
+	for _, e := range drainEvents(ch) {
+		got[e.Agent.Name] = e
+	}
+	if len(got) != 3 {
+		t.Fatalf("catch-up events = %+v, want 3", got)
+	}
+	if e := got["hq-mayor"]; e.Type != "removed" {
+		t.Fatalf("hq-mayor event = %q, want removed", e.Type)
+	}
+	if e := got["hq-overseer"]; e.Type != "added" {
+		t.Fatalf("hq-overseer event = %q, want added", e.Type)
+	}
+	if e := got["hq-witness"]; e.Type != "updated" || len(e.Changes) != 1 || e.Changes[0].Field != "workDir" {
+		t.Fatalf("hq-witness event = %+v, want workDir update", e)
+	}
+
+	// Nothing changed since: an up-to-date consumer gets no catch-up.
+	_, ch = r.Resubscribe(current)
+	if events := drainEvents(ch); len(events) != 0 {
+		t.Fatalf("expected no catch-up events, got %+v", events)
+	}
+}
+
+func TestUnsubscribeClosesChannel(t *testing.T) {
+	mock := newMockControl()
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	id, ch := r.Subscribe(false)
+
+	r.Unsubscribe(id)
+	if _, ok := <-ch; ok {
+		t.Fatal("expected channel to be closed after Unsubscribe")
+	}
+
+	// Unsubscribing twice is a no-op
+	r.Unsubscribe(id)
+}
+
+func TestStopClosesSubscribers(t *testing.T) {
+	mock := newMockControl()
+	r := NewRegistry(mock, "/tmp/gt", nil)
+	if err := r.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	_, ch := r.Subscribe(false)
+
+	r.Stop()
+	if _, ok := <-ch; ok {
+		t.Fatal("expected channel to be closed after Stop")
+	}
+
+	_, late := r.Subscribe(true)
+	if _, ok := <-late; ok {
+		t.Fatal("expected subscription after Stop to be closed immediately")
+	}
+}
@@ -34,6 +34,11 @@ func NewConversationBuffer(conversationID, agentName string, maxSize int) *Conve
 	}
 }
 
+// AgentName returns the name of the agent the conversation belongs to.
+func (b *ConversationBuffer) AgentName() string {
+	return b.agentName
+}
+
 // Append adds an event to the buffer and broadcasts to subscribers.
 func (b *ConversationBuffer) Append(event ConversationEvent) {
 	b.mu.Lock()
@@ -0,0 +1,51 @@
+package conv
+
+import "strings"
+
+// WatchPromptEcho watches the agent's active conversation for a user event
+// containing prompt. It yields "user event <eventId>" on the first match.
+// ok is false when the agent has no active conversation. Only events
+// appended after the call are considered.
+func (w *ConversationWatcher) WatchPromptEcho(agentName, prompt string) (<-chan string, func(), bool) {
+	convID := w.GetActiveConversation(agentName)
+	if convID == "" {
+		return nil, nil, false
+	}
+	buf := w.GetBuffer(convID)
+	if buf == nil {
+		return nil, nil, false
+	}
+	want := collapseSpace(prompt)
+	if want == "" {
+		return nil, nil, false
+	}
+
+	_, subID, live := buf.Subscribe(EventFilter{Types: map[string]bool{EventUser: true}})
+	evidence := make(chan string, 1)
+	go func() {
+		for event := range live {
+			if strings.Contains(collapseSpace(eventText(event)), want) {
+				evidence <- "user event " + event.EventID
+				return
+			}
+		}
+	}()
+
+	stop := func() { buf.Unsubscribe(subID) }
+	return evidence, stop, true
+}
+
+// eventText concatenates the text blocks of an event.
+func eventText(event ConversationEvent) string {
+	var parts []string
+	for _, block := range event.Content {
+		if block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -19,6 +19,7 @@ type WatcherEvent struct {
 	Event     *ConversationEvent  // for conversation events
 	OldConvID string              // for conversation-switched events
 	NewConvID string              // for conversation-started and conversation-switched events
+	Changes   []agents.AgentChange // for agent-updated events
 }
 
 type fileStream struct {
@@ -128,14 +129,10 @@ type ConversationInfo struct {
 }
 
 // Start begins watching for agent changes and starts tailing conversations.
+// Agents already known to the registry are replayed as "added" events.
 func (w *ConversationWatcher) Start() {
-	// Process initial agents
-	for _, agent := range w.registry.GetAgents() {
-		w.emitEvent(WatcherEvent{Type: "agent-added", Agent: &agent})
-		w.startWatching(agent)
-	}
-
-	go w.watchLoop()
+	subID, events := w.registry.Subscribe(true)
+	go w.watchLoop(subID, events)
 }
 
 // Stop shuts down the watcher and all tailers.
@@ -158,24 +155,37 @@ func (w *ConversationWatcher) Stop() {
 	}
 }
 
-func (w *ConversationWatcher) watchLoop() {
+func (w *ConversationWatcher) watchLoop(subID int, events <-chan agents.RegistryEvent) {
+	defer func() { w.registry.Unsubscribe(subID) }()
+	known := make(map[string]agents.Agent)
 	for {
 		select {
 		case <-w.ctx.Done():
 			return
-		case event, ok := <-w.registry.Events():
+		case event, ok := <-events:
 			if !ok {
-				return
+				select {
+				case <-w.registry.Done():
+					return
+				default:
+				}
+				// Fell behind: catch up from what we last saw.
+				log.Printf("watcher: agent events fell behind; resubscribing")
+				subID, events = w.registry.Resubscribe(known)
+				continue
 			}
 			switch event.Type {
 			case "added":
+				known[event.Agent.Name] = event.Agent
 				w.emitEvent(WatcherEvent{Type: "agent-added", Agent: &event.Agent})
 				w.startWatching(event.Agent)
 			case "removed":
+				delete(known, event.Agent.Name)
 				w.stopWatching(event.Agent.Name)
 				w.emitEvent(WatcherEvent{Type: "agent-removed", Agent: &event.Agent})
 			case "updated":
-				w.emitEvent(WatcherEvent{Type: "agent-updated", Agent: &event.Agent})
+				known[event.Agent.Name] = event.Agent
+				w.emitEvent(WatcherEvent{Type: "agent-updated", Agent: &event.Agent, Changes: event.Changes})
 			}
 		}
 	}
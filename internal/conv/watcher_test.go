@@ -101,3 +101,33 @@ func TestWatcherEventChannel(t *testing.T) {
 
 	watcher.Stop()
 }
+
+func TestWatchPromptEcho(t *testing.T) {
+	watcher := NewConversationWatcher(nil, 100)
+	buf := NewConversationBuffer("claude:hq-agent:c1", "hq-agent", 100)
+	watcher.streams["claude:hq-agent:c1"] = &conversationStream{conversationID: "claude:hq-agent:c1", buffer: buf}
+	watcher.activeByAgent["hq-agent"] = "claude:hq-agent:c1"
+
+	if _, _, ok := watcher.WatchPromptEcho("other-agent", "hi"); ok {
+		t.Fatal("expected ok=false for agent without a conversation")
+	}
+
+	evidence, stop, ok := watcher.WatchPromptEcho("hq-agent", "please  rebase\non main")
+	if !ok {
+		t.Fatal("expected ok=true for agent with an active conversation")
+	}
+	defer stop()
+
+	buf.Append(ConversationEvent{EventID: "u1", Type: EventUser, Content: []ContentBlock{{Type: "text", Text: "something else"}}})
+	buf.Append(ConversationEvent{EventID: "a1", Type: EventAssistant, Content: []ContentBlock{{Type: "text", Text: "please rebase on main"}}})
+	buf.Append(ConversationEvent{EventID: "u2", Type: EventUser, Content: []ContentBlock{{Type: "text", Text: "please rebase on main"}}})
+
+	select {
+	case got := <-evidence:
+		if got != "user event u2" {
+			t.Fatalf("evidence = %q, want %q", got, "user event u2")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for prompt echo")
+	}
+}
@@ -9,38 +9,57 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
 	"github.com/gastownhall/tmux-adapter/internal/agents"
 	"github.com/gastownhall/tmux-adapter/internal/conv"
 	"github.com/gastownhall/tmux-adapter/internal/tmux"
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
 	"github.com/gastownhall/tmux-adapter/internal/wsconv"
 	"github.com/gastownhall/tmux-adapter/web"
 )
 
 // Converter is the structured conversation streaming service.
 type Converter struct {
-	ctrl          *tmux.ControlMode
-	registry      *agents.Registry
-	watcher       *conv.ConversationWatcher
-	wsSrv         *wsconv.Server
-	httpSrv       *http.Server
-	gtDir         string
-	listen        string
-	debugServeDir string
+	ctrl     *tmux.ControlMode
+	registry *agents.Registry
+	watcher  *conv.ConversationWatcher
+	wsSrv    *wsconv.Server
+	httpSrv  *http.Server
+	tls      *wsbase.TLSReloader
+	opts     Options
+}
+
+// Options configures a Converter. Empty fields keep the defaults.
+type Options struct {
+	GtDir         string
+	Listen        string // HTTP/WebSocket listen address
+	DebugServeDir string
+	PromptTimings string // JSON file of per-runtime prompt timing overrides
+	PastePolicy   string // JSON file of per-runtime paste policies
+	TokensFile    string // JSON file of named, scoped tokens
+	JWT           wsbase.JWTConfig
+	TLS           wsbase.TLSConfig
+	Uploads       agentio.UploadPolicy
 }
 
 // New creates a new Converter.
-func New(gtDir, listen, debugServeDir string) *Converter {
-	return &Converter{
-		gtDir:         gtDir,
-		listen:        listen,
-		debugServeDir: debugServeDir,
-	}
+func New(opts Options) *Converter {
+	return &Converter{opts: opts}
 }
 
 // Start initializes all components and starts the HTTP server.
 func (c *Converter) Start() error {
+	if c.opts.TLS.Enabled() {
+		reloader, err := wsbase.NewTLSReloader(c.opts.TLS)
+		if err != nil {
+			return err
+		}
+		c.tls = reloader
+	}
+
 	ctrl, err := tmux.NewControlMode("converter-monitor")
 	if err != nil {
 		return fmt.Errorf("tmux control mode: %w", err)
@@ -48,7 +67,7 @@ func (c *Converter) Start() error {
 	c.ctrl = ctrl
 	log.Println("converter: connected to tmux control mode")
 
-	c.registry = agents.NewRegistry(ctrl, c.gtDir, []string{"converter-monitor"})
+	c.registry = agents.NewRegistry(ctrl, c.opts.GtDir, []string{"converter-monitor"})
 
 	if err := c.registry.Start(); err != nil {
 		ctrl.Close()
@@ -72,6 +91,35 @@ func (c *Converter) Start() error {
 
 	// Set up WebSocket server
 	c.wsSrv = wsconv.NewServer(c.watcher, "", []string{"*"}, c.ctrl, c.registry)
+	c.wsSrv.SetUploadPolicy(c.opts.Uploads)
+
+	// fail undoes the steps above when loading the configuration fails.
+	fail := func(err error) error {
+		c.watcher.Stop()
+		c.registry.Stop()
+		ctrl.Close()
+		return err
+	}
+	if c.opts.PromptTimings != "" {
+		if err := c.wsSrv.LoadPromptTimings(c.opts.PromptTimings); err != nil {
+			return fail(err)
+		}
+	}
+	if c.opts.PastePolicy != "" {
+		if err := c.wsSrv.LoadPastePolicies(c.opts.PastePolicy); err != nil {
+			return fail(err)
+		}
+	}
+	if c.opts.TokensFile != "" {
+		if err := c.wsSrv.LoadTokens(c.opts.TokensFile); err != nil {
+			return fail(err)
+		}
+	}
+	if c.opts.JWT.KeyFile != "" {
+		if err := c.wsSrv.LoadJWTKeys(c.opts.JWT); err != nil {
+			return fail(err)
+		}
+	}
 
 	// Forward watcher events to WebSocket broadcast
 	go func() {
@@ -79,6 +127,8 @@ func (c *Converter) Start() error {
 			c.wsSrv.Broadcast(event)
 		}
 	}()
+	go c.wsSrv.ForwardPromptQueueEvents()
+	go c.wsSrv.RunUploadCleanup(time.Hour)
 
 	// Set up HTTP endpoints
 	mux := http.NewServeMux()
@@ -90,12 +140,15 @@ func (c *Converter) Start() error {
 		w.Header().Set("Content-Type", "application/json")
 		_, _ = fmt.Fprint(w, `{"ok":true}`)
 	})
-	mux.HandleFunc("/conversations", func(w http.ResponseWriter, _ *http.Request) {
+	mux.Handle("/conversations", c.wsSrv.RequireGrant(wsbase.ScopeView, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		convs := c.watcher.ListConversations()
+		grant := wsbase.GrantFromContext(r.Context())
+		convs := slices.DeleteFunc(c.watcher.ListConversations(), func(info conv.ConversationInfo) bool {
+			return !grant.SeesName(c.registry, info.AgentName)
+		})
 		data, _ := json.Marshal(convs)
 		_, _ = w.Write(data)
-	})
+	})))
 	mux.HandleFunc("/ws", c.wsSrv.HandleWebSocket)
 
 	// Serve embedded converter web component files at /tmux-converter-web/
@@ -110,19 +163,30 @@ func (c *Converter) Start() error {
 		http.StripPrefix("/shared/", http.FileServer(http.FS(sharedFS))),
 	))
 
-	if c.debugServeDir != "" {
-		log.Printf("converter: serving static files from %s at /", c.debugServeDir)
-		mux.Handle("/", http.FileServer(http.Dir(c.debugServeDir)))
+	if c.opts.DebugServeDir != "" {
+		log.Printf("converter: serving static files from %s at /", c.opts.DebugServeDir)
+		mux.Handle("/", http.FileServer(http.Dir(c.opts.DebugServeDir)))
 	}
 
 	c.httpSrv = &http.Server{
-		Addr:    c.listen,
+		Addr:    c.opts.Listen,
 		Handler: mux,
 	}
 
+	if c.tls != nil {
+		c.httpSrv.TLSConfig = c.tls.ServerConfig()
+	}
+
 	go func() {
-		log.Printf("converter listening on %s", c.listen)
-		if err := c.httpSrv.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if c.tls != nil {
+			log.Printf("converter listening on %s (TLS)", c.opts.Listen)
+			err = c.httpSrv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("converter listening on %s", c.opts.Listen)
+			err = c.httpSrv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			log.Fatalf("converter http server: %v", err)
 		}
 	}()
@@ -140,6 +204,7 @@ func (c *Converter) Stop() {
 		log.Printf("converter http shutdown: %v", err)
 	}
 
+	c.wsSrv.Stop()
 	c.watcher.Stop()
 	c.registry.Stop()
 	c.ctrl.Close()
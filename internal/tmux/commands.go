@@ -129,6 +129,17 @@ func (cm *ControlMode) SendKeysRaw(target string, keys ...string) error {
 // Uses a uniquely named buffer to avoid races when multiple control-mode
 // connections share the same tmux server.
 func (cm *ControlMode) PasteBytes(target string, data []byte) error {
+	return cm.pasteBytes(target, data, false)
+}
+
+// PasteBytesBracketed is PasteBytes with paste-buffer -p: tmux wraps the data
+// in bracketed-paste markers when the application has enabled bracketed paste
+// mode, so embedded newlines are not treated as Enter.
+func (cm *ControlMode) PasteBytesBracketed(target string, data []byte) error {
+	return cm.pasteBytes(target, data, true)
+}
+
+func (cm *ControlMode) pasteBytes(target string, data []byte, bracketed bool) error {
 	if len(data) == 0 {
 		return nil
 	}
@@ -160,7 +171,7 @@ func (cm *ControlMode) PasteBytes(target string, data []byte) error {
 	if err := cm.loadBufferNamed(f.Name(), bufName); err != nil {
 		return err
 	}
-	return cm.pasteBufferNamed(target, bufName)
+	return cm.pasteBufferNamed(target, bufName, bracketed)
 }
 
 func (cm *ControlMode) loadBufferNamed(path, bufName string) error {
@@ -171,8 +182,12 @@ func (cm *ControlMode) loadBufferNamed(path, bufName string) error {
 	return err
 }
 
-func (cm *ControlMode) pasteBufferNamed(target, bufName string) error {
-	_, err := cm.Execute(fmt.Sprintf("paste-buffer -d -b %s -t '%s'", bufName, target))
+func (cm *ControlMode) pasteBufferNamed(target, bufName string, bracketed bool) error {
+	flags := "-d"
+	if bracketed {
+		flags = "-d -p"
+	}
+	_, err := cm.Execute(fmt.Sprintf("paste-buffer %s -b %s -t '%s'", flags, bufName, target))
 	return err
 }
 
@@ -227,6 +242,12 @@ func (cm *ControlMode) CapturePaneHistory(session string) (string, error) {
 	return out, nil
 }
 
+// CapturePaneLines captures the visible screen plus up to n lines of
+// scrollback above it, with ANSI escape codes.
+func (cm *ControlMode) CapturePaneLines(session string, n int) (string, error) {
+	return cm.Execute(fmt.Sprintf("capture-pane -p -e -t '%s' -S -%d", session, n))
+}
+
 // ForceRedraw triggers a SIGWINCH by briefly changing the window size.
 // Uses resize-window (not resize-pane) because single-pane windows
 // constrain the pane to the window size, making resize-pane a no-op.
@@ -323,6 +344,32 @@ func (cm *ControlMode) ResizePaneTo(target string, cols, rows int) error {
 	return cm.ResizeWindow(target, cols, rows)
 }
 
+// WindowSize returns a session's window size in columns and rows.
+func (cm *ControlMode) WindowSize(session string) (int, int, error) {
+	sizeStr, err := cm.DisplayMessage(session, "#{window_width}:#{window_height}")
+	if err != nil {
+		return 0, 0, err
+	}
+	var cols, rows int
+	if _, err := fmt.Sscanf(sizeStr, "%d:%d", &cols, &rows); err != nil || cols <= 0 || rows <= 0 {
+		return 0, 0, fmt.Errorf("window size of %s: unexpected %q", session, sizeStr)
+	}
+	return cols, rows, nil
+}
+
+// PaneCursor returns the cursor position (0-based column and row) and the
+// height of a session's active pane.
+func (cm *ControlMode) PaneCursor(session string) (x, y, height int, err error) {
+	out, err := cm.DisplayMessage(session, "#{cursor_x},#{cursor_y},#{pane_height}")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if _, err := fmt.Sscanf(out, "%d,%d,%d", &x, &y, &height); err != nil || x < 0 || y < 0 || height <= 0 {
+		return 0, 0, 0, fmt.Errorf("cursor of %s: unexpected %q", session, out)
+	}
+	return x, y, height, nil
+}
+
 // ResizeWindow sets a session's window to an exact size.
 func (cm *ControlMode) ResizeWindow(target string, cols, rows int) error {
 	_, err := cm.Execute(fmt.Sprintf("resize-window -t '%s' -x %d -y %d", target, cols, rows))
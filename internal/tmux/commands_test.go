@@ -3,6 +3,7 @@ package tmux
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -203,3 +204,70 @@ func TestCapturePaneHistory_PropagatesOtherErrors(t *testing.T) {
 		t.Fatalf("CapturePaneHistory() = %q, want empty on error", out)
 	}
 }
+
+func TestCapturePaneLinesStartsAboveVisibleArea(t *testing.T) {
+	var got string
+	cm := newStubCM(func(cmd string) commandResponse {
+		got = cmd
+		return commandResponse{output: "scroll\nscreen"}
+	})
+
+	out, err := cm.CapturePaneLines("my-session", 500)
+	if err != nil {
+		t.Fatalf("CapturePaneLines() error = %v", err)
+	}
+	if out != "scroll\nscreen" {
+		t.Fatalf("CapturePaneLines() = %q", out)
+	}
+	if want := "capture-pane -p -e -t 'my-session' -S -500"; got != want {
+		t.Fatalf("command = %q, want %q", got, want)
+	}
+}
+
+func TestWindowSize(t *testing.T) {
+	cm := newStubCM(func(cmd string) commandResponse {
+		if cmd != "display-message -t 'hq-mayor' -p '#{window_width}:#{window_height}'" {
+			return commandResponse{err: fmt.Errorf("unexpected command %q", cmd)}
+		}
+		return commandResponse{output: "200:50\n"}
+	})
+	cols, rows, err := cm.WindowSize("hq-mayor")
+	if err != nil || cols != 200 || rows != 50 {
+		t.Fatalf("WindowSize() = %d, %d, %v", cols, rows, err)
+	}
+
+	bad := newStubCM(func(string) commandResponse { return commandResponse{output: "oops"} })
+	if _, _, err := bad.WindowSize("hq-mayor"); err == nil {
+		t.Fatal("WindowSize() with garbage output = nil error")
+	}
+}
+
+func TestPasteBytesBracketedUsesPasteFlag(t *testing.T) {
+	var executed []string
+	var mu sync.Mutex
+	cm := newStubCM(func(cmd string) commandResponse {
+		mu.Lock()
+		executed = append(executed, cmd)
+		mu.Unlock()
+		return commandResponse{}
+	})
+
+	if err := cm.PasteBytesBracketed("hq-mayor", []byte("line one\nline two")); err != nil {
+		t.Fatalf("PasteBytesBracketed() error = %v", err)
+	}
+	if err := cm.PasteBytes("hq-mayor", []byte("plain")); err != nil {
+		t.Fatalf("PasteBytes() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(executed) != 4 {
+		t.Fatalf("executed = %v, want load+paste twice", executed)
+	}
+	if !strings.HasPrefix(executed[1], "paste-buffer -d -p -b ta-") || !strings.HasSuffix(executed[1], "-t 'hq-mayor'") {
+		t.Fatalf("bracketed paste command = %q", executed[1])
+	}
+	if !strings.HasPrefix(executed[3], "paste-buffer -d -b ta-") {
+		t.Fatalf("plain paste command = %q", executed[3])
+	}
+}
@@ -2,6 +2,7 @@ package tmux
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -27,6 +28,18 @@ type commandResponse struct {
 
 const defaultExecuteTimeout = 10 * time.Second
 
+// ErrUnavailable matches Execute errors that mean tmux could not be reached:
+// control mode is closing or closed, the command could not be written, or
+// tmux did not answer in time. Errors reported by tmux itself don't match.
+var ErrUnavailable = errors.New("tmux unavailable")
+
+// unavailableError keeps its message and matches ErrUnavailable.
+type unavailableError struct{ err error }
+
+func (e unavailableError) Error() string        { return e.err.Error() }
+func (e unavailableError) Unwrap() error        { return e.err }
+func (e unavailableError) Is(target error) bool { return target == ErrUnavailable }
+
 // ControlMode manages a tmux control mode connection.
 // Commands are serialized — only one Execute() call runs at a time.
 type ControlMode struct {
@@ -92,7 +105,7 @@ func (cm *ControlMode) Execute(command string) (string, error) {
 	defer cm.execMu.Unlock()
 
 	if cm.closing.Load() {
-		return "", fmt.Errorf("tmux control mode closing")
+		return "", unavailableError{fmt.Errorf("tmux control mode closing")}
 	}
 
 	// Drain any stale response (shouldn't happen, but be safe)
@@ -104,7 +117,7 @@ func (cm *ControlMode) Execute(command string) (string, error) {
 	// Write command to stdin
 	_, err := fmt.Fprintf(cm.stdin, "%s\n", command)
 	if err != nil {
-		return "", fmt.Errorf("write command: %w", err)
+		return "", unavailableError{fmt.Errorf("write command: %w", err)}
 	}
 
 	// Wait for response
@@ -112,9 +125,9 @@ func (cm *ControlMode) Execute(command string) (string, error) {
 	case resp := <-cm.responseCh:
 		return resp.output, resp.err
 	case <-time.After(cm.executeTimeout):
-		return "", fmt.Errorf("tmux command timed out after %s: %s", cm.executeTimeout, command)
+		return "", unavailableError{fmt.Errorf("tmux command timed out after %s: %s", cm.executeTimeout, command)}
 	case <-cm.done:
-		return "", fmt.Errorf("tmux control mode closed")
+		return "", unavailableError{fmt.Errorf("tmux control mode closed")}
 	}
 }
 
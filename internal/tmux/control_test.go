@@ -1,6 +1,7 @@
 package tmux
 
 import (
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -41,6 +42,9 @@ func TestExecuteTimeout(t *testing.T) {
 	if !strings.Contains(err.Error(), "timed out") {
 		t.Fatalf("error = %q, expected timeout message", err)
 	}
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("timeout error %q does not match ErrUnavailable", err)
+	}
 	if elapsed := time.Since(start); elapsed < cm.executeTimeout {
 		t.Fatalf("elapsed = %v, expected at least %v", elapsed, cm.executeTimeout)
 	}
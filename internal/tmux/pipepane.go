@@ -12,15 +12,17 @@ import (
 
 // PipePaneManager manages pipe-pane output streaming per agent session.
 type PipePaneManager struct {
-	ctrl    *ControlMode
-	mu      sync.Mutex
-	streams map[string]*pipeStream
+	ctrl     *ControlMode
+	mu       sync.Mutex
+	streams  map[string]*pipeStream
+	observer func(session string, data []byte)
 }
 
 type pipeStream struct {
 	session     string
 	filePath    string
 	cancel      context.CancelFunc
+	observer    func(session string, data []byte)
 	subscribers map[int]chan []byte
 	nextSubID   int
 	mu          sync.Mutex
@@ -34,6 +36,16 @@ func NewPipePaneManager(ctrl *ControlMode) *PipePaneManager {
 	}
 }
 
+// SetObserver registers fn to see every chunk of output once per session,
+// before it is fanned out to subscribers, whatever the number of subscribers.
+// fn runs on the streaming goroutine and must not block. It applies to streams
+// started after the call.
+func (pm *PipePaneManager) SetObserver(fn func(session string, data []byte)) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.observer = fn
+}
+
 // Subscribe starts streaming output for a session and returns a subscriber ID
 // and channel for receiving raw bytes. If this is the first subscriber, pipe-pane is activated.
 func (pm *PipePaneManager) Subscribe(session string) (int, <-chan []byte, error) {
@@ -77,6 +89,7 @@ func (pm *PipePaneManager) Subscribe(session string) (int, <-chan []byte, error)
 		session:     session,
 		filePath:    filePath,
 		cancel:      cancel,
+		observer:    pm.observer,
 		subscribers: map[int]chan []byte{1: ch},
 		nextSubID:   1,
 	}
@@ -212,6 +225,10 @@ func (pm *PipePaneManager) tailFile(ctx context.Context, stream *pipeStream) {
 			pending = nil
 			pendingMu.Unlock()
 
+			if stream.observer != nil {
+				stream.observer(stream.session, data)
+			}
+
 			stream.mu.Lock()
 			for _, ch := range stream.subscribers {
 				select {
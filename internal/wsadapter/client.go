@@ -7,6 +7,9 @@ import (
 	"sync"
 
 	"nhooyr.io/websocket"
+
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
 )
 
 // outMsg wraps a WebSocket message with its type (text or binary).
@@ -23,14 +26,19 @@ type outputSub struct {
 
 // Client represents a single WebSocket connection.
 type Client struct {
-	conn       *websocket.Conn
-	server     *Server
-	send       chan outMsg
-	agentSub   bool                     // subscribed to agent lifecycle
-	outputSubs map[string]outputSub     // agent name -> subscription
-	mu         sync.Mutex
-	ctx        context.Context
-	cancel     context.CancelFunc
+	conn        *websocket.Conn
+	server      *Server
+	send        chan outMsg
+	agentSub    bool                 // subscribed to agent lifecycle
+	agentFields map[string]bool      // agent-updated field filter (nil = all fields)
+	outputSubs  map[string]outputSub // agent name -> subscription
+	remoteAddr  string               // default prompt submitter
+	protocol    string               // negotiated by hello ("" until then)
+	binarySeq   uint64               // binary frames received, for error correlation
+	grant       *wsbase.Grant        // what the connection's token allows
+	mu          sync.Mutex
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
 // NewClient creates a new WebSocket client.
@@ -40,6 +48,7 @@ func NewClient(conn *websocket.Conn, server *Server, ctx context.Context, cancel
 		server:     server,
 		send:       make(chan outMsg, 256),
 		outputSubs: make(map[string]outputSub),
+		grant:      wsbase.FullAccess,
 		ctx:        ctx,
 		cancel:     cancel,
 	}
@@ -62,7 +71,7 @@ func (c *Client) ReadPump() {
 
 		var req Request
 		if err := json.Unmarshal(data, &req); err != nil {
-			c.sendError("", "invalid JSON: "+err.Error())
+			c.sendError("", wsbase.NewError(wsbase.CodeInvalidArgument, "invalid JSON: "+err.Error()))
 			continue
 		}
 
@@ -118,17 +127,39 @@ func (c *Client) sendJSON(v any) {
 }
 
 // sendError sends an error response.
-func (c *Client) sendError(id, errMsg string) {
-	ok := false
-	resp := Response{
-		Type:  "error",
-		OK:    &ok,
-		Error: errMsg,
+func (c *Client) sendError(id string, e *wsbase.Error) {
+	c.sendJSON(errorResponse(id, "error", e))
+}
+
+// authorize checks the connection's token for scope and, when agent is
+// non-empty, for visibility of that agent.
+func (c *Client) authorize(scope wsbase.Scope, agent string) *wsbase.Error {
+	return c.grant.Authorize(scope, c.server.registry, agent)
+}
+
+// sees reports whether the connection's token can see the named agent.
+func (c *Client) sees(agent string) bool {
+	return c.grant.SeesName(c.server.registry, agent)
+}
+
+// chunkedUpload looks up a chunked upload, hiding uploads for agents the
+// connection's token cannot see.
+func (c *Client) chunkedUpload(id string) (agentio.ChunkedUpload, error) {
+	up, err := c.server.prompter.Chunks.Status(id)
+	if err == nil && !c.sees(up.Agent) {
+		return agentio.ChunkedUpload{}, agentio.ErrChunkedUploadNotFound
 	}
-	if id != "" {
-		resp.ID = id
+	return up, err
+}
+
+// queuedPrompt looks up a queued prompt, hiding prompts for agents the
+// connection's token cannot see.
+func (c *Client) queuedPrompt(id string) (agentio.QueuedPrompt, error) {
+	item, ok := c.server.queue.Get(id)
+	if !ok || !c.sees(item.Agent) {
+		return agentio.QueuedPrompt{}, agentio.ErrPromptNotFound
 	}
-	c.sendJSON(resp)
+	return item, nil
 }
 
 // Close cleans up all subscriptions and closes the connection.
@@ -143,6 +174,7 @@ func (c *Client) Close() {
 	}
 
 	c.agentSub = false
+	c.agentFields = nil
 	if err := c.conn.Close(websocket.StatusNormalClosure, ""); err != nil {
 		log.Printf("client close websocket: %v", err)
 	}
@@ -0,0 +1,70 @@
+package wsadapter
+
+import (
+	"log"
+	"sync"
+)
+
+// clipboardMirror copies agents' OSC 52 clipboard writes to the clipboard of
+// the machine running the adapter. One worker does the copying; writes that
+// arrive while it is busy are coalesced so only the latest is copied next,
+// and a burst of writes never piles up clipboard processes.
+type clipboardMirror struct {
+	copy func(data []byte) error
+
+	mu      sync.Mutex
+	pending *clipboardWrite // latest write not yet copied
+	wake    chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type clipboardWrite struct {
+	agent, text string
+}
+
+func newClipboardMirror(copy func([]byte) error) *clipboardMirror {
+	return &clipboardMirror{
+		copy: copy,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+}
+
+// set queues text as the next clipboard content, replacing any write the
+// worker has not reached yet.
+func (m *clipboardMirror) set(agent, text string) {
+	m.mu.Lock()
+	m.pending = &clipboardWrite{agent: agent, text: text}
+	m.mu.Unlock()
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run copies queued writes until close. Blocks.
+func (m *clipboardMirror) run() {
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-m.wake:
+		}
+		m.mu.Lock()
+		w := m.pending
+		m.pending = nil
+		m.mu.Unlock()
+		if w == nil {
+			continue
+		}
+		if err := m.copy([]byte(w.text)); err != nil {
+			log.Printf("mirror clipboard(%s): %v", w.agent, err)
+		}
+	}
+}
+
+// close stops the worker once its current copy finishes.
+func (m *clipboardMirror) close() {
+	m.once.Do(func() { close(m.stop) })
+}
@@ -0,0 +1,44 @@
+package wsadapter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClipboardMirrorCoalescesToLatest(t *testing.T) {
+	started := make(chan struct{}, 4)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var copied []string
+	m := newClipboardMirror(func(data []byte) error {
+		mu.Lock()
+		copied = append(copied, string(data))
+		mu.Unlock()
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	go m.run()
+	defer m.close()
+
+	m.set("hq-mayor", "first")
+	<-started
+	// Written while "first" is being copied: only the last one survives.
+	for _, text := range []string{"second", "third", "fourth"} {
+		m.set("hq-mayor", text)
+	}
+	close(release)
+	<-started
+
+	select {
+	case <-started:
+		t.Fatal("a superseded clipboard write was copied")
+	case <-time.After(50 * time.Millisecond):
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(copied) != 2 || copied[0] != "first" || copied[1] != "fourth" {
+		t.Fatalf("copied = %v, want [first fourth]", copied)
+	}
+}
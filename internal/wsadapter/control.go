@@ -0,0 +1,287 @@
+package wsadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
+)
+
+// Input control policies.
+const (
+	ControlFree          = "free"           // anyone with the input scope may type; control is advisory (default)
+	ControlSingle        = "single"         // only the driver may type; control must be released
+	ControlAdminOverride = "admin-override" // as single, but admin tokens may take control
+)
+
+// controlPolicies lists the accepted policies.
+var controlPolicies = []string{ControlFree, ControlSingle, ControlAdminOverride}
+
+// Actions reported in control-changed events.
+const (
+	ControlRequested    = "requested"    // request-control succeeded
+	ControlClaimed      = "claimed"      // input from a client claimed an undriven agent
+	ControlTaken        = "taken"        // take-control replaced the previous driver
+	ControlReleased     = "released"     // release-control, or the driver unsubscribed
+	ControlDisconnected = "disconnected" // the driver's connection closed
+)
+
+// ControlState describes who drives an agent's input, as seen by one client.
+type ControlState struct {
+	Policy string     `json:"policy"`
+	Driver string     `json:"driver,omitempty"` // identity of the driving connection
+	Since  *time.Time `json:"since,omitempty"`
+	You    bool       `json:"you"` // the receiving connection is the driver
+}
+
+// controlArbiter tracks the driver of each agent. Everything that writes to
+// the pane goes through admitInput: keystrokes, send-keys, interrupt-agent,
+// send-prompt, broadcast-prompt (per agent) and uploads, which are pasted.
+type controlArbiter struct {
+	mu      sync.Mutex
+	policy  string
+	drivers map[string]controlHolder // agent -> driver
+}
+
+type controlHolder struct {
+	client *Client
+	since  time.Time
+}
+
+func newControlArbiter() *controlArbiter {
+	return &controlArbiter{policy: ControlFree, drivers: make(map[string]controlHolder)}
+}
+
+func (a *controlArbiter) setPolicy(policy string) error {
+	if !slices.Contains(controlPolicies, policy) {
+		return fmt.Errorf("unknown control policy %q (use %s)", policy, strings.Join(controlPolicies, ", "))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policy = policy
+	return nil
+}
+
+func (a *controlArbiter) policyName() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.policy
+}
+
+// state reports the agent's control state as seen by viewer.
+func (a *controlArbiter) state(agent string, viewer *Client) ControlState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st := ControlState{Policy: a.policy}
+	if h, ok := a.drivers[agent]; ok {
+		since := h.since
+		st.Driver = h.client.remoteAddr
+		st.Since = &since
+		st.You = h.client == viewer
+	}
+	return st
+}
+
+// driver returns the client driving agent, or nil.
+func (a *controlArbiter) driver(agent string) *Client {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.drivers[agent].client
+}
+
+// notDriver is the error for a client blocked by another agent's driver.
+func notDriver(agent string, h controlHolder) *wsbase.Error {
+	return wsbase.Errorf(wsbase.CodeNotDriver, "%s is driven by %s", agent, h.client.remoteAddr).
+		WithDetail("agent", agent).WithDetail("driver", h.client.remoteAddr)
+}
+
+// request makes c the driver if the agent has none. changed is false when
+// c already drives it.
+func (a *controlArbiter) request(agent string, c *Client) (changed bool, e *wsbase.Error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if h, ok := a.drivers[agent]; ok {
+		if h.client == c {
+			return false, nil
+		}
+		return false, notDriver(agent, h)
+	}
+	a.drivers[agent] = controlHolder{client: c, since: time.Now()}
+	return true, nil
+}
+
+// take makes c the driver, displacing any other. It is refused under the
+// single policy, and needs the admin scope under admin-override.
+func (a *controlArbiter) take(agent string, c *Client) (changed bool, e *wsbase.Error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch a.policy {
+	case ControlSingle:
+		return false, wsbase.Errorf(wsbase.CodePermissionDenied, "take-control is disabled by the %s control policy", a.policy).
+			WithDetail("policy", a.policy)
+	case ControlAdminOverride:
+		if !c.grant.Has(wsbase.ScopeAdmin) {
+			return false, wsbase.Errorf(wsbase.CodePermissionDenied, "take-control needs the %s scope", wsbase.ScopeAdmin).
+				WithDetail("scope", wsbase.ScopeAdmin)
+		}
+	}
+	if h, ok := a.drivers[agent]; ok && h.client == c {
+		return false, nil
+	}
+	a.drivers[agent] = controlHolder{client: c, since: time.Now()}
+	return true, nil
+}
+
+// release gives up c's control of agent. changed is false when the agent
+// had no driver.
+func (a *controlArbiter) release(agent string, c *Client) (changed bool, e *wsbase.Error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	h, ok := a.drivers[agent]
+	if !ok {
+		return false, nil
+	}
+	if h.client != c {
+		return false, notDriver(agent, h)
+	}
+	delete(a.drivers, agent)
+	return true, nil
+}
+
+// releaseClient drops every agent c drives and returns their names.
+func (a *controlArbiter) releaseClient(c *Client) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var released []string
+	for agent, h := range a.drivers {
+		if h.client == c {
+			delete(a.drivers, agent)
+			released = append(released, agent)
+		}
+	}
+	slices.Sort(released)
+	return released
+}
+
+// forget drops the driver of a removed agent.
+func (a *controlArbiter) forget(agent string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.drivers, agent)
+}
+
+// admitInput decides whether c may send input to agent. Under the free
+// policy everyone may. Otherwise only the driver may, and input to an agent
+// without a driver makes c its driver (claimed).
+func (a *controlArbiter) admitInput(agent string, c *Client) (claimed bool, e *wsbase.Error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.policy == ControlFree {
+		return false, nil
+	}
+	h, ok := a.drivers[agent]
+	if !ok {
+		a.drivers[agent] = controlHolder{client: c, since: time.Now()}
+		return true, nil
+	}
+	if h.client != c {
+		return false, notDriver(agent, h)
+	}
+	return false, nil
+}
+
+// SetControlPolicy selects how input to an agent is arbitrated between
+// clients: ControlFree, ControlSingle or ControlAdminOverride.
+func (s *Server) SetControlPolicy(policy string) error {
+	return s.control.setPolicy(policy)
+}
+
+// admitInput checks that c may send input to agent, announcing an implicit
+// claim to the agent's viewers.
+func (s *Server) admitInput(c *Client, agent string) *wsbase.Error {
+	claimed, e := s.control.admitInput(agent, c)
+	if claimed {
+		log.Printf("control(%s): claimed by %s", agent, c.remoteAddr)
+		s.broadcastControl(agent, ControlClaimed)
+	}
+	return e
+}
+
+// releaseControl drops c's control of every agent it drives, announcing
+// each release with action.
+func (s *Server) releaseControl(c *Client, action string) {
+	for _, agent := range s.control.releaseClient(c) {
+		log.Printf("control(%s): %s by %s", agent, action, c.remoteAddr)
+		s.broadcastControl(agent, action)
+	}
+}
+
+// broadcastControl sends a control-changed event to every client subscribed
+// to the agent's output. Each viewer gets its own "you" flag. A new driver
+// may also change the window size under the driver size policy.
+func (s *Server) broadcastControl(agent, action string) {
+	s.mu.Lock()
+	for client := range s.clients {
+		client.mu.Lock()
+		_, viewing := client.outputSubs[agent]
+		client.mu.Unlock()
+
+		if viewing {
+			client.SendText(MakeControlEvent(agent, action, s.control.state(agent, client)))
+		}
+	}
+	s.mu.Unlock()
+
+	s.refreshSize(agent)
+}
+
+// MakeControlEvent creates a JSON event message for a change of an agent's driver.
+func MakeControlEvent(agentName, action string, state ControlState) []byte {
+	data, _ := json.Marshal(Response{Type: "control-changed", Name: agentName, Action: action, Control: &state})
+	return data
+}
+
+func handleRequestControl(c *Client, req Request) {
+	handleControl(c, req, ControlRequested, c.server.control.request)
+}
+
+func handleTakeControl(c *Client, req Request) {
+	handleControl(c, req, ControlTaken, c.server.control.take)
+}
+
+func handleReleaseControl(c *Client, req Request) {
+	handleControl(c, req, ControlReleased, c.server.control.release)
+}
+
+// handleControl runs one control change and answers with the resulting
+// state. Viewers are told about the change only if there was one.
+func handleControl(c *Client, req Request, action string, change func(string, *Client) (bool, *wsbase.Error)) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	if _, ok := c.server.registry.GetAgent(req.Agent); !ok {
+		c.sendJSON(errorResponse(req.ID, req.Type, wsbase.AgentNotFound(req.Agent)))
+		return
+	}
+	changed, e := change(req.Agent, c)
+	if e != nil {
+		resp := errorResponse(req.ID, req.Type, e)
+		st := c.server.control.state(req.Agent, c)
+		resp.Control = &st
+		c.sendJSON(resp)
+		return
+	}
+	if changed {
+		log.Printf("control(%s): %s by %s", req.Agent, action, c.remoteAddr)
+		c.server.broadcastControl(req.Agent, action)
+	}
+	st := c.server.control.state(req.Agent, c)
+	okVal := true
+	c.sendJSON(Response{ID: req.ID, Type: req.Type, OK: &okVal, Name: req.Agent, Control: &st})
+}
@@ -0,0 +1,119 @@
+package wsadapter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
+)
+
+func TestControlArbiterPolicies(t *testing.T) {
+	alice, bob := &Client{remoteAddr: "alice", grant: wsbase.FullAccess}, &Client{remoteAddr: "bob", grant: &wsbase.Grant{Scopes: []wsbase.Scope{wsbase.ScopeInput}}}
+
+	a := newControlArbiter()
+	if err := a.setPolicy("anarchy"); err == nil {
+		t.Fatal("setPolicy(unknown) = nil error")
+	}
+	if claimed, e := a.admitInput("hq-mayor", bob); claimed || e != nil {
+		t.Fatalf("free policy admitInput = %v, %v", claimed, e)
+	}
+
+	if err := a.setPolicy(ControlSingle); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, e := a.admitInput("hq-mayor", alice); !claimed || e != nil {
+		t.Fatalf("first input should claim control, got %v, %v", claimed, e)
+	}
+	if _, e := a.admitInput("hq-mayor", bob); e == nil || e.Code != wsbase.CodeNotDriver || e.Details["driver"] != "alice" {
+		t.Fatalf("non-driver input = %v, want NOT_DRIVER", e)
+	}
+	if _, e := a.request("hq-mayor", bob); e == nil || e.Code != wsbase.CodeNotDriver {
+		t.Fatalf("request while driven = %v, want NOT_DRIVER", e)
+	}
+	if _, e := a.take("hq-mayor", alice); e == nil || e.Code != wsbase.CodePermissionDenied {
+		t.Fatalf("take under single = %v, want PERMISSION_DENIED", e)
+	}
+	if _, e := a.release("hq-mayor", bob); e == nil {
+		t.Fatal("release by non-driver = nil error")
+	}
+	if changed, e := a.release("hq-mayor", alice); !changed || e != nil {
+		t.Fatalf("release by driver = %v, %v", changed, e)
+	}
+	if changed, e := a.request("hq-mayor", bob); !changed || e != nil {
+		t.Fatalf("request after release = %v, %v", changed, e)
+	}
+	if st := a.state("hq-mayor", bob); st.Driver != "bob" || !st.You || st.Since == nil {
+		t.Fatalf("state() = %+v", st)
+	}
+
+	if err := a.setPolicy(ControlAdminOverride); err != nil {
+		t.Fatal(err)
+	}
+	if changed, e := a.take("hq-mayor", alice); !changed || e != nil {
+		t.Fatalf("admin take = %v, %v", changed, e)
+	}
+	if _, e := a.take("hq-mayor", bob); e == nil || e.Details["scope"] != wsbase.ScopeAdmin {
+		t.Fatalf("non-admin take = %v, want PERMISSION_DENIED", e)
+	}
+
+	a.request("gt-toast", alice)
+	if released := a.releaseClient(alice); len(released) != 2 || released[0] != "gt-toast" || released[1] != "hq-mayor" {
+		t.Fatalf("releaseClient() = %v", released)
+	}
+}
+
+func TestControlChangesReachViewers(t *testing.T) {
+	driver := newTestClient(t)
+	s := driver.server
+	driver.remoteAddr = "alice"
+	viewer := &Client{server: s, send: make(chan outMsg, 8), outputSubs: map[string]outputSub{"hq-mayor": {}}, grant: wsbase.FullAccess, remoteAddr: "bob"}
+	other := &Client{server: s, send: make(chan outMsg, 8), outputSubs: map[string]outputSub{"gt-toast": {}}, grant: wsbase.FullAccess}
+	s.clients[viewer] = struct{}{}
+	s.clients[other] = struct{}{}
+
+	if err := s.SetControlPolicy(ControlSingle); err != nil {
+		t.Fatal(err)
+	}
+	if e := s.admitInput(driver, "hq-mayor"); e != nil {
+		t.Fatal(e)
+	}
+
+	resp := readResponse(t, viewer)
+	if resp.Type != "control-changed" || resp.Name != "hq-mayor" || resp.Action != ControlClaimed ||
+		resp.Control == nil || resp.Control.Driver != "alice" || resp.Control.You {
+		t.Fatalf("viewer event = %+v", resp)
+	}
+	if len(other.send) != 0 {
+		t.Fatal("client viewing another agent got the control event")
+	}
+
+	// Keystrokes from the viewer are refused with the frame reference.
+	handleBinaryMessage(viewer, []byte("\x02hq-mayor\x00x"))
+	resp = readResponse(t, viewer)
+	if resp.ErrorInfo == nil || resp.ErrorInfo.Code != wsbase.CodeNotDriver || resp.ErrorInfo.Frame == nil {
+		t.Fatalf("non-driver keystroke = %+v", resp)
+	}
+
+	// So are uploads, which get pasted into the pane.
+	handleBinaryMessage(viewer, []byte("\x04hq-mayor\x00notes.txt\x00text/plain\x00hi"))
+	resp = readResponse(t, viewer)
+	if resp.ErrorInfo == nil || resp.ErrorInfo.Code != wsbase.CodeNotDriver || resp.ErrorInfo.Frame == nil || resp.ErrorInfo.Frame.Type != "0x04" {
+		t.Fatalf("non-driver upload = %+v", resp)
+	}
+
+	s.releaseControl(driver, ControlDisconnected)
+	if resp := readResponse(t, viewer); resp.Action != ControlDisconnected || resp.Control.Driver != "" {
+		t.Fatalf("disconnect event = %+v", resp)
+	}
+}
+
+func TestMakeControlEvent(t *testing.T) {
+	var resp map[string]any
+	if err := json.Unmarshal(MakeControlEvent("hq-mayor", ControlTaken, ControlState{Policy: ControlAdminOverride, Driver: "alice"}), &resp); err != nil {
+		t.Fatal(err)
+	}
+	control, _ := resp["control"].(map[string]any)
+	if resp["type"] != "control-changed" || resp["action"] != "taken" || control["driver"] != "alice" || control["you"] != false {
+		t.Fatalf("control event = %v", resp)
+	}
+}
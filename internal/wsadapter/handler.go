@@ -4,109 +4,279 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gastownhall/tmux-adapter/internal/agentio"
 	"github.com/gastownhall/tmux-adapter/internal/agents"
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
 )
 
 // Request is a message from a WebSocket client.
 type Request struct {
-	ID     string `json:"id"`
-	Type   string `json:"type"`
-	Agent  string `json:"agent,omitempty"`
-	Prompt string `json:"prompt,omitempty"`
-	Stream *bool  `json:"stream,omitempty"`
+	ID               string                 `json:"id"`
+	Type             string                 `json:"type"`
+	Agent            string                 `json:"agent,omitempty"`
+	Prompt           string                 `json:"prompt,omitempty"`
+	Stream           *bool                  `json:"stream,omitempty"`
+	Fields           []string               `json:"fields,omitempty"`
+	Confirm          bool                   `json:"confirm,omitempty"`
+	ConfirmTimeoutMs int                    `json:"confirmTimeoutMs,omitempty"`
+	Priority         int                    `json:"priority,omitempty"`
+	Submitter        string                 `json:"submitter,omitempty"`
+	WaitIdle         bool                   `json:"waitIdle,omitempty"`
+	PromptID         string                 `json:"promptId,omitempty"`
+	Position         *int                   `json:"position,omitempty"`
+	Level            string                 `json:"level,omitempty"`
+	TimeoutMs        int                    `json:"timeoutMs,omitempty"`
+	Keys             []agentio.KeyInput     `json:"keys,omitempty"`
+	Selector         *agentio.AgentSelector `json:"selector,omitempty"`
+	Path             string                 `json:"path,omitempty"`
+	UploadID         string                 `json:"uploadId,omitempty"`
+	FileName         string                 `json:"fileName,omitempty"`
+	MimeType         string                 `json:"mimeType,omitempty"`
+	Size             int64                  `json:"size,omitempty"`
+	SHA256           string                 `json:"sha256,omitempty"`
+	Protocol         string                 `json:"protocol,omitempty"`
+	Snapshot         string                 `json:"snapshot,omitempty"`
 }
 
 // Response is a message sent to a WebSocket client.
 type Response struct {
-	ID      string         `json:"id,omitempty"`
-	Type    string         `json:"type"`
-	OK      *bool          `json:"ok,omitempty"`
-	Error   string         `json:"error,omitempty"`
-	Agents  []agents.Agent `json:"agents,omitempty"`
-	History string         `json:"history,omitempty"`
-	Agent   *agents.Agent  `json:"agent,omitempty"`
-	Name    string         `json:"name,omitempty"`
-	Data    string         `json:"data,omitempty"`
+	ID           string                    `json:"id,omitempty"`
+	Type         string                    `json:"type"`
+	OK           *bool                     `json:"ok,omitempty"`
+	Error        string                    `json:"error,omitempty"`
+	Agents       []agents.Agent            `json:"agents,omitempty"`
+	History      string                    `json:"history,omitempty"`
+	Agent        *agents.Agent             `json:"agent,omitempty"`
+	Name         string                    `json:"name,omitempty"`
+	Data         string                    `json:"data,omitempty"`
+	Changes      []agents.AgentChange      `json:"changes,omitempty"`
+	AgentHistory []agents.AgentHistory     `json:"agentHistory,omitempty"`
+	Delivery     *agentio.DeliveryResult   `json:"delivery,omitempty"`
+	PromptID     string                    `json:"promptId,omitempty"`
+	Action       string                    `json:"action,omitempty"`
+	QueueItem    *agentio.QueuedPrompt     `json:"queueItem,omitempty"`
+	Queue        []agentio.QueuedPrompt    `json:"queue,omitempty"`
+	Interrupt    *agentio.InterruptResult  `json:"interrupt,omitempty"`
+	Results      []agentio.BroadcastResult `json:"results,omitempty"`
+	Commands     []agentio.SlashCommand    `json:"commands,omitempty"`
+	Completions  []agentio.PathCompletion  `json:"completions,omitempty"`
+	Uploads      []agentio.UploadRecord    `json:"uploads,omitempty"`
+	Upload       *agentio.UploadRecord     `json:"upload,omitempty"`
+	Chunked      *agentio.ChunkedUpload    `json:"chunkedUpload,omitempty"`
+	File         *agentio.FileEntry        `json:"file,omitempty"`
+	Files        []agentio.FileEntry       `json:"files,omitempty"`
+	Truncated    bool                      `json:"truncated,omitempty"`
+	Content      []byte                    `json:"content,omitempty"`
+	UploadResult *agentio.UploadResult     `json:"uploadResult,omitempty"`
+	Terminal     *agentio.TerminalEvent    `json:"terminal,omitempty"`
+	ErrorInfo    *wsbase.Error             `json:"errorInfo,omitempty"`
+	Protocol     string                    `json:"protocol,omitempty"`
+	Version      string                    `json:"serverVersion,omitempty"`
+	Capabilities *Capabilities             `json:"capabilities,omitempty"`
+	Grant        *wsbase.Grant             `json:"grant,omitempty"`
+	Control      *ControlState             `json:"control,omitempty"`
+	Size         *SizeDecision             `json:"size,omitempty"`
+	UnknownType  string                    `json:"unknownType,omitempty"`
+}
+
+// requestHandlers maps each text request type to its handler. hello is
+// handled separately; the keys are advertised in its capabilities.
+var requestHandlers = map[string]func(*Client, Request){
+	"list-agents":        handleListAgents,
+	"send-prompt":        handleSendPrompt,
+	"broadcast-prompt":   handleBroadcastPrompt,
+	"subscribe-output":   handleSubscribeOutput,
+	"unsubscribe-output": handleUnsubscribeOutput,
+	"subscribe-agents":   handleSubscribeAgents,
+	"unsubscribe-agents": handleUnsubscribeAgents,
+	"list-agent-history": handleListAgentHistory,
+	"list-prompt-queue":  handleListPromptQueue,
+	"list-commands":      handleListCommands,
+	"complete-path":      handleCompletePath,
+	"list-files":         handleListFiles,
+	"read-file":          handleReadFile,
+	"list-uploads":       handleListUploads,
+	"delete-upload":      handleDeleteUpload,
+	"upload-init":        handleUploadInit,
+	"upload-status":      handleUploadStatus,
+	"upload-finalize":    handleUploadFinalize,
+	"upload-abort":       handleUploadAbort,
+	"cancel-prompt":      handleCancelPrompt,
+	"reorder-prompt":     handleReorderPrompt,
+	"interrupt-agent":    handleInterruptAgent,
+	"send-keys":          handleSendKeys,
+	"request-control":    handleRequestControl,
+	"release-control":    handleReleaseControl,
+	"take-control":       handleTakeControl,
+}
+
+// requestScopes names the token scope each request needs. A request that
+// names an agent also needs a token that can see that agent.
+var requestScopes = map[string]wsbase.Scope{
+	"list-agents":        wsbase.ScopeView,
+	"subscribe-output":   wsbase.ScopeView,
+	"unsubscribe-output": wsbase.ScopeView,
+	"subscribe-agents":   wsbase.ScopeView,
+	"unsubscribe-agents": wsbase.ScopeView,
+	"list-agent-history": wsbase.ScopeView,
+	"list-prompt-queue":  wsbase.ScopeView,
+	"list-commands":      wsbase.ScopeView,
+	"complete-path":      wsbase.ScopeView,
+	"list-files":         wsbase.ScopeView,
+	"read-file":          wsbase.ScopeView,
+	"list-uploads":       wsbase.ScopeView,
+	"upload-status":      wsbase.ScopeView,
+	"send-prompt":        wsbase.ScopePrompt,
+	"broadcast-prompt":   wsbase.ScopePrompt,
+	"cancel-prompt":      wsbase.ScopePrompt,
+	"reorder-prompt":     wsbase.ScopePrompt,
+	"send-keys":          wsbase.ScopeInput,
+	"interrupt-agent":    wsbase.ScopeInput,
+	"request-control":    wsbase.ScopeInput,
+	"release-control":    wsbase.ScopeInput,
+	"take-control":       wsbase.ScopeInput,
+	"delete-upload":      wsbase.ScopeUpload,
+	"upload-init":        wsbase.ScopeUpload,
+	"upload-finalize":    wsbase.ScopeUpload,
+	"upload-abort":       wsbase.ScopeUpload,
+}
+
+// binaryScopes names the token scope each client-to-server binary frame needs.
+var binaryScopes = map[byte]wsbase.Scope{
+	agentio.BinaryKeyboardInput: wsbase.ScopeInput,
+	agentio.BinaryResize:        wsbase.ScopeResize,
+	agentio.BinaryFileUpload:    wsbase.ScopeUpload,
+	agentio.BinaryUploadChunk:   wsbase.ScopeUpload,
+}
+
+// errorResponse builds a failed response to a request.
+func errorResponse(id, typ string, e *wsbase.Error) Response {
+	resp := Response{ID: id, Type: typ}
+	resp.fail(e)
+	return resp
+}
+
+// fail marks the response failed, with both the plain error string and the
+// structured error.
+func (r *Response) fail(e *wsbase.Error) {
+	ok := false
+	r.OK = &ok
+	r.Error = e.Message
+	r.ErrorInfo = e
 }
 
 // handleMessage routes a text request to the appropriate handler.
 func handleMessage(c *Client, req Request) {
-	switch req.Type {
-	case "list-agents":
-		handleListAgents(c, req)
-	case "send-prompt":
-		handleSendPrompt(c, req)
-	case "subscribe-output":
-		handleSubscribeOutput(c, req)
-	case "unsubscribe-output":
-		handleUnsubscribeOutput(c, req)
-	case "subscribe-agents":
-		handleSubscribeAgents(c, req)
-	case "unsubscribe-agents":
-		handleUnsubscribeAgents(c, req)
-	default:
-		c.sendError(req.ID, "unknown message type: "+req.Type)
+	if req.Type == "hello" {
+		handleHello(c, req)
+		return
 	}
+	handler, ok := requestHandlers[req.Type]
+	if !ok {
+		sendUnknownType(c, req.ID, req.Type, "unknown message type: "+req.Type, nil)
+		return
+	}
+	if e := c.authorize(requestScopes[req.Type], req.Agent); e != nil {
+		c.sendJSON(errorResponse(req.ID, req.Type, e))
+		return
+	}
+	handler(c, req)
 }
 
 // handleBinaryMessage routes binary WebSocket frames.
 // Format: msgType(1 byte) + agentName + \0 + payload
 func handleBinaryMessage(c *Client, data []byte) {
+	// Binary frames carry no request ID; errors name the frame by its
+	// sequence number on this connection instead.
+	c.binarySeq++
+	seq := c.binarySeq
 	msgType, agentName, payload, err := agentio.ParseBinaryEnvelope(data)
 	if err != nil {
-		c.sendError("", "invalid binary message: "+err.Error())
+		var frameType byte
+		if len(data) > 0 {
+			frameType = data[0]
+		}
+		c.sendError("", wsbase.Errorf(wsbase.CodeInvalidArgument, "invalid binary message: %v", err).WithFrame(frameType, "", seq))
 		return
 	}
+	frameError := func(e *wsbase.Error) {
+		c.sendError("", e.WithFrame(msgType, agentName, seq))
+	}
+	if scope, ok := binaryScopes[msgType]; ok {
+		if e := c.authorize(scope, agentName); e != nil {
+			frameError(e)
+			return
+		}
+	}
 
 	switch msgType {
 	case agentio.BinaryKeyboardInput:
+		if e := c.server.admitInput(c, agentName); e != nil {
+			frameError(e)
+			return
+		}
 		if err := sendKeyboardPayload(c, agentName, payload); err != nil {
 			log.Printf("keyboard input %s error: %v", agentName, err)
-			c.sendError("", "keyboard input "+agentName+": "+err.Error())
+			frameError(wsbase.ErrorFrom(fmt.Errorf("keyboard input %s: %w", agentName, err)))
 		}
 	case agentio.BinaryResize:
 		parts := strings.SplitN(string(payload), ":", 2)
 		if len(parts) != 2 {
-			c.sendError("", "invalid resize payload for "+agentName+": expected cols:rows")
+			frameError(wsbase.NewError(wsbase.CodeInvalidArgument, "invalid resize payload for "+agentName+": expected cols:rows"))
 			return
 		}
 		cols, err1 := strconv.Atoi(parts[0])
 		rows, err2 := strconv.Atoi(parts[1])
 		if err1 != nil || err2 != nil {
-			c.sendError("", "invalid resize payload for "+agentName+": non-numeric cols/rows")
+			frameError(wsbase.NewError(wsbase.CodeInvalidArgument, "invalid resize payload for "+agentName+": non-numeric cols/rows"))
 			return
 		}
 		if cols < 2 || rows < 1 {
-			c.sendError("", fmt.Sprintf("invalid resize payload for %s: %dx%d out of range", agentName, cols, rows))
+			frameError(wsbase.Errorf(wsbase.CodeInvalidArgument, "invalid resize payload for %s: %dx%d out of range", agentName, cols, rows))
 			return
 		}
 		log.Printf("binary resize %s -> %dx%d", agentName, cols, rows)
-		if err := c.server.ctrl.ResizePaneTo(agentName, cols, rows); err != nil {
+		if err := c.server.requestSize(c, agentName, termSize{cols, rows}); err != nil {
 			log.Printf("resize %s error: %v", agentName, err)
-			c.sendError("", "resize "+agentName+": "+err.Error())
+			frameError(wsbase.ErrorFrom(fmt.Errorf("resize %s: %w", agentName, err)))
 			return
 		}
 		// No snapshot needed — pipe-pane captures the app's SIGWINCH redraw naturally.
 	case agentio.BinaryFileUpload:
+		// The upload is pasted into the pane, so it counts as input.
+		if e := c.server.admitInput(c, agentName); e != nil {
+			frameError(e)
+			return
+		}
 		payloadCopy := append([]byte(nil), payload...)
 		go func() {
 			lock := c.server.prompter.GetLock(agentName)
 			lock.Lock()
 			defer lock.Unlock()
 
-			if err := c.server.prompter.HandleFileUpload(agentName, payloadCopy); err != nil {
+			result, err := c.server.prompter.HandleFileUpload(agentName, payloadCopy, c.remoteAddr)
+			ok := err == nil
+			resp := Response{Type: "upload-result", OK: &ok, Name: agentName}
+			if result.FileName != "" {
+				resp.UploadResult = &result
+			}
+			if err != nil {
 				log.Printf("file upload %s error: %v", agentName, err)
-				c.sendError("", "file upload "+agentName+": "+err.Error())
+				resp.fail(wsbase.ErrorFrom(fmt.Errorf("file upload %s: %w", agentName, err)).WithFrame(msgType, agentName, seq))
 			}
+			c.sendJSON(resp)
 		}()
+	case agentio.BinaryUploadChunk:
+		// Handled inline so chunks are written in the order they arrive.
+		handleUploadChunk(c, agentName, payload, seq)
 	default:
 		log.Printf("unknown binary message type: 0x%02x", msgType)
-		c.sendError("", fmt.Sprintf("unknown binary message type: 0x%02x", msgType))
+		frameType := fmt.Sprintf("0x%02x", msgType)
+		sendUnknownType(c, "", frameType, "unknown binary message type: "+frameType, &wsbase.FrameRef{Type: frameType, Agent: agentName, Seq: seq})
 	}
 }
 
@@ -172,11 +342,57 @@ func tmuxKeyNameFromVT(payload []byte) (string, bool) {
 	case "\x7f":
 		return "BSpace", true
 	}
-	return "", false
+	return tmuxModifiedKeyFromVT(string(payload))
+}
+
+// vtFinalKeys maps the final byte of CSI 1;<mod>X sequences to tmux key names.
+var vtFinalKeys = map[byte]string{
+	'A': "Up", 'B': "Down", 'C': "Right", 'D': "Left",
+	'H': "Home", 'F': "End",
+	'P': "F1", 'Q': "F2", 'R': "F3", 'S': "F4",
+}
+
+// vtTildeKeys maps the first parameter of CSI <n>;<mod>~ sequences to tmux key names.
+var vtTildeKeys = map[string]string{
+	"2": "IC", "3": "DC", "5": "PgUp", "6": "PgDn",
+	"15": "F5", "17": "F6", "18": "F7", "19": "F8",
+	"20": "F9", "21": "F10", "23": "F11", "24": "F12",
+}
+
+// tmuxModifiedKeyFromVT decodes xterm modified-key sequences such as
+// CSI 1;5A (Ctrl+Up), CSI 1;3C (Alt+Right) and CSI 5;2~ (Shift+PgUp).
+// The modifier parameter is 1 + a bitmask of Shift(1), Alt(2) and Ctrl(4).
+func tmuxModifiedKeyFromVT(seq string) (string, bool) {
+	body, ok := strings.CutPrefix(seq, "\x1b[")
+	if !ok || len(body) < 4 {
+		return "", false
+	}
+	final := body[len(body)-1]
+	first, modParam, ok := strings.Cut(body[:len(body)-1], ";")
+	if !ok {
+		return "", false
+	}
+
+	var key string
+	if final == '~' {
+		key = vtTildeKeys[first]
+	} else if first == "1" {
+		key = vtFinalKeys[final]
+	}
+	if key == "" {
+		return "", false
+	}
+
+	mod, err := strconv.Atoi(modParam)
+	if err != nil || mod < 2 || mod > 8 {
+		return "", false
+	}
+	bits := mod - 1
+	return agentio.TmuxModifiers(bits&4 != 0, bits&2 != 0, bits&1 != 0) + key, true
 }
 
 func handleListAgents(c *Client, req Request) {
-	agentList := c.server.registry.GetAgents()
+	agentList := c.grant.FilterAgents(c.server.registry.GetAgents())
 	c.sendJSON(Response{
 		ID:     req.ID,
 		Type:   "list-agents",
@@ -184,50 +400,455 @@ func handleListAgents(c *Client, req Request) {
 	})
 }
 
+func handleListAgentHistory(c *Client, req Request) {
+	if req.Agent == "" {
+		var history []agents.AgentHistory
+		for _, h := range c.server.registry.GetHistory() {
+			if c.sees(h.Name) {
+				history = append(history, h)
+			}
+		}
+		c.sendJSON(Response{
+			ID:           req.ID,
+			Type:         "list-agent-history",
+			AgentHistory: history,
+		})
+		return
+	}
+
+	history, ok := c.server.registry.GetAgentHistory(req.Agent)
+	if !ok {
+		c.sendJSON(errorResponse(req.ID, "list-agent-history", wsbase.AgentNotFound(req.Agent)))
+		return
+	}
+	c.sendJSON(Response{
+		ID:           req.ID,
+		Type:         "list-agent-history",
+		AgentHistory: []agents.AgentHistory{history},
+	})
+}
+
 func handleSendPrompt(c *Client, req Request) {
 	if req.Agent == "" {
-		c.sendError(req.ID, "agent field required")
+		c.sendError(req.ID, wsbase.MissingField("agent"))
 		return
 	}
 	if req.Prompt == "" {
-		c.sendError(req.ID, "prompt field required")
+		c.sendError(req.ID, wsbase.MissingField("prompt"))
 		return
 	}
 
-	// Verify agent exists before acquiring lock
+	// Verify agent exists before queueing
 	if _, ok := c.server.registry.GetAgent(req.Agent); !ok {
-		ok := false
-		c.sendJSON(Response{ID: req.ID, Type: "send-prompt", OK: &ok, Error: "agent not found"})
+		c.sendJSON(errorResponse(req.ID, "send-prompt", wsbase.AgentNotFound(req.Agent)))
+		return
+	}
+	if e := c.server.admitInput(c, req.Agent); e != nil {
+		c.sendJSON(errorResponse(req.ID, "send-prompt", e))
+		return
+	}
+
+	submitter := req.Submitter
+	if submitter == "" {
+		submitter = c.remoteAddr
+	}
+	_, err := c.server.queue.Enqueue(agentio.PromptRequest{
+		Agent:          req.Agent,
+		Prompt:         req.Prompt,
+		Submitter:      submitter,
+		Priority:       req.Priority,
+		WaitIdle:       req.WaitIdle,
+		Confirm:        req.Confirm,
+		ConfirmTimeout: agentio.ConfirmTimeout(req.ConfirmTimeoutMs),
+	}, func(out agentio.PromptOutcome) {
+		ok := out.Err == nil && !out.Cancelled
+		resp := Response{ID: req.ID, Type: "send-prompt", OK: &ok, PromptID: out.Item.ID, Delivery: out.Delivery}
+		switch {
+		case out.Cancelled:
+			resp.fail(wsbase.NewError(wsbase.CodeCancelled, "prompt cancelled"))
+		case out.Err != nil:
+			resp.fail(wsbase.ErrorFrom(out.Err))
+		}
+		c.sendJSON(resp)
+	})
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "send-prompt", wsbase.ErrorFrom(err)))
+	}
+}
+
+// handleBroadcastPrompt queues the prompt for every agent matching the
+// selector and replies once with the per-agent results. ok is true only when
+// every agent received the prompt.
+func handleBroadcastPrompt(c *Client, req Request) {
+	if req.Selector == nil {
+		c.sendError(req.ID, wsbase.MissingField("selector"))
+		return
+	}
+	if req.Prompt == "" {
+		c.sendError(req.ID, wsbase.MissingField("prompt"))
 		return
 	}
 
+	submitter := req.Submitter
+	if submitter == "" {
+		submitter = c.remoteAddr
+	}
+	go func() {
+		results, err := c.server.queue.Broadcast(*req.Selector, agentio.PromptRequest{
+			Prompt:         req.Prompt,
+			Submitter:      submitter,
+			Priority:       req.Priority,
+			WaitIdle:       req.WaitIdle,
+			Confirm:        req.Confirm,
+			ConfirmTimeout: agentio.ConfirmTimeout(req.ConfirmTimeoutMs),
+		}, c.grant.Sees, func(agent string) error {
+			if e := c.server.admitInput(c, agent); e != nil {
+				return e
+			}
+			return nil
+		})
+		if err != nil {
+			c.sendJSON(errorResponse(req.ID, "broadcast-prompt", wsbase.ErrorFrom(err)))
+			return
+		}
+		ok := true
+		for _, r := range results {
+			ok = ok && r.OK
+		}
+		c.sendJSON(Response{ID: req.ID, Type: "broadcast-prompt", OK: &ok, Results: results})
+	}()
+}
+
+func handleListPromptQueue(c *Client, req Request) {
+	queue := slices.DeleteFunc(c.server.queue.List(req.Agent), func(item agentio.QueuedPrompt) bool {
+		return !c.sees(item.Agent)
+	})
+	c.sendJSON(Response{ID: req.ID, Type: "list-prompt-queue", Queue: queue})
+}
+
+func handleListCommands(c *Client, req Request) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	commands, err := c.server.commands.Commands(req.Agent)
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "list-commands", wsbase.ErrorFrom(err)))
+		return
+	}
+	ok := true
+	c.sendJSON(Response{ID: req.ID, Type: "list-commands", OK: &ok, Name: req.Agent, Commands: commands})
+}
+
+func handleCompletePath(c *Client, req Request) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	completions, err := c.server.prompter.CompletePath(req.Agent, req.Path)
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "complete-path", wsbase.ErrorFrom(err)))
+		return
+	}
+	ok := true
+	c.sendJSON(Response{ID: req.ID, Type: "complete-path", OK: &ok, Name: req.Agent, Completions: completions})
+}
+
+func handleListFiles(c *Client, req Request) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	files := c.server.prompter.Files
+	dir, err := files.Stat(req.Agent, req.Path)
+	if err == nil && !dir.Dir {
+		err = wsbase.Errorf(wsbase.CodeInvalidArgument, "not a directory: %s", dir.Path)
+	}
+	var entries []agentio.FileEntry
+	var truncated bool
+	if err == nil {
+		entries, truncated, err = files.List(req.Agent, req.Path)
+	}
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "list-files", wsbase.ErrorFrom(err)))
+		return
+	}
+	ok := true
+	c.sendJSON(Response{ID: req.ID, Type: "list-files", OK: &ok, Name: req.Agent, File: &dir, Files: entries, Truncated: truncated})
+}
+
+func handleReadFile(c *Client, req Request) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	if req.Path == "" {
+		c.sendError(req.ID, wsbase.MissingField("path"))
+		return
+	}
+	entry, data, err := c.server.prompter.Files.ReadFile(req.Agent, req.Path)
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "read-file", wsbase.ErrorFrom(err)))
+		return
+	}
+	ok := true
+	c.sendJSON(Response{ID: req.ID, Type: "read-file", OK: &ok, Name: req.Agent, File: &entry, Content: data})
+}
+
+func handleListUploads(c *Client, req Request) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	uploads, err := c.server.prompter.Uploads.List(req.Agent)
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "list-uploads", wsbase.ErrorFrom(err)))
+		return
+	}
+	ok := true
+	c.sendJSON(Response{ID: req.ID, Type: "list-uploads", OK: &ok, Name: req.Agent, Uploads: uploads})
+}
+
+func handleDeleteUpload(c *Client, req Request) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	if req.UploadID == "" {
+		c.sendError(req.ID, wsbase.MissingField("uploadId"))
+		return
+	}
+	// Hold the agent lock so a delete can't race an upload pasting the same file.
 	lock := c.server.prompter.GetLock(req.Agent)
+	lock.Lock()
+	record, err := c.server.prompter.Uploads.Delete(req.Agent, req.UploadID)
+	lock.Unlock()
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "delete-upload", wsbase.ErrorFrom(err)))
+		return
+	}
+	ok := true
+	c.sendJSON(Response{ID: req.ID, Type: "delete-upload", OK: &ok, Name: req.Agent, Upload: &record})
+}
 
+func handleUploadInit(c *Client, req Request) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	if _, ok := c.server.registry.GetAgent(req.Agent); !ok {
+		c.sendJSON(errorResponse(req.ID, "upload-init", wsbase.AgentNotFound(req.Agent)))
+		return
+	}
+	if err := c.server.prompter.Uploads.CheckQuota(req.FileName, req.Size); err != nil {
+		c.sendJSON(errorResponse(req.ID, "upload-init", wsbase.ErrorFrom(err)))
+		return
+	}
+	up, err := c.server.prompter.Chunks.Init(req.Agent, req.FileName, req.MimeType, req.Size, req.SHA256)
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "upload-init", wsbase.ErrorFrom(err)))
+		return
+	}
+	ok := true
+	c.sendJSON(Response{ID: req.ID, Type: "upload-init", OK: &ok, Chunked: &up})
+}
+
+func handleUploadStatus(c *Client, req Request) {
+	if req.UploadID == "" {
+		c.sendError(req.ID, wsbase.MissingField("uploadId"))
+		return
+	}
+	up, err := c.chunkedUpload(req.UploadID)
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "upload-status", wsbase.ErrorFrom(err)))
+		return
+	}
+	ok := true
+	c.sendJSON(Response{ID: req.ID, Type: "upload-status", OK: &ok, Chunked: &up})
+}
+
+func handleUploadChunk(c *Client, agentName string, payload []byte, seq uint64) {
+	id, offset, data, err := agentio.ParseUploadChunkPayload(payload)
+	if err != nil {
+		c.sendError("", wsbase.ErrorFrom(fmt.Errorf("upload chunk %s: %w", agentName, err)).WithFrame(agentio.BinaryUploadChunk, agentName, seq))
+		return
+	}
+	up, err := c.server.prompter.Chunks.WriteChunk(id, agentName, offset, data)
+	ok := err == nil
+	resp := Response{Type: "upload-chunk", OK: &ok, Chunked: &up}
+	if err != nil {
+		resp.fail(wsbase.ErrorFrom(err).WithFrame(agentio.BinaryUploadChunk, agentName, seq).WithDetail("uploadId", id).WithDetail("offset", offset))
+		if up.ID == "" {
+			resp.Chunked = nil
+		}
+	}
+	c.sendJSON(resp)
+}
+
+func handleUploadFinalize(c *Client, req Request) {
+	if req.UploadID == "" {
+		c.sendError(req.ID, wsbase.MissingField("uploadId"))
+		return
+	}
+	up, err := c.chunkedUpload(req.UploadID)
+	if err != nil {
+		c.sendJSON(errorResponse(req.ID, "upload-finalize", wsbase.ErrorFrom(err)))
+		return
+	}
+	if e := c.server.admitInput(c, up.Agent); e != nil {
+		c.sendJSON(errorResponse(req.ID, "upload-finalize", e))
+		return
+	}
+	go func() {
+		lock := c.server.prompter.GetLock(up.Agent)
+		lock.Lock()
+		result, err := c.server.prompter.FinishChunkedUpload(req.UploadID, c.remoteAddr)
+		lock.Unlock()
+		ok := err == nil
+		resp := Response{ID: req.ID, Type: "upload-finalize", OK: &ok, Name: up.Agent, Upload: result.Upload}
+		if result.FileName != "" {
+			resp.UploadResult = &result
+		}
+		if err != nil {
+			log.Printf("chunked upload %s error: %v", req.UploadID, err)
+			resp.fail(wsbase.ErrorFrom(err))
+		}
+		c.sendJSON(resp)
+	}()
+}
+
+func handleUploadAbort(c *Client, req Request) {
+	if req.UploadID == "" {
+		c.sendError(req.ID, wsbase.MissingField("uploadId"))
+		return
+	}
+	if _, err := c.chunkedUpload(req.UploadID); err != nil {
+		c.sendJSON(errorResponse(req.ID, "upload-abort", wsbase.ErrorFrom(err)))
+		return
+	}
+	if err := c.server.prompter.Chunks.Abort(req.UploadID); err != nil {
+		c.sendJSON(errorResponse(req.ID, "upload-abort", wsbase.ErrorFrom(err)))
+		return
+	}
+	ok := true
+	c.sendJSON(Response{ID: req.ID, Type: "upload-abort", OK: &ok})
+}
+
+func handleCancelPrompt(c *Client, req Request) {
+	if req.PromptID == "" {
+		c.sendError(req.ID, wsbase.MissingField("promptId"))
+		return
+	}
+	item, err := c.queuedPrompt(req.PromptID)
+	if err == nil {
+		item, err = c.server.queue.Cancel(req.PromptID)
+	}
+	ok := err == nil
+	resp := Response{ID: req.ID, Type: "cancel-prompt", OK: &ok, PromptID: req.PromptID}
+	if err != nil {
+		resp.fail(wsbase.ErrorFrom(err))
+	} else {
+		resp.QueueItem = &item
+	}
+	c.sendJSON(resp)
+}
+
+func handleReorderPrompt(c *Client, req Request) {
+	if req.PromptID == "" {
+		c.sendError(req.ID, wsbase.MissingField("promptId"))
+		return
+	}
+	if req.Position == nil {
+		c.sendError(req.ID, wsbase.MissingField("position"))
+		return
+	}
+	item, err := c.queuedPrompt(req.PromptID)
+	if err == nil {
+		item, err = c.server.queue.Reorder(req.PromptID, *req.Position)
+	}
+	ok := err == nil
+	resp := Response{ID: req.ID, Type: "reorder-prompt", OK: &ok, PromptID: req.PromptID}
+	if err != nil {
+		resp.fail(wsbase.ErrorFrom(err))
+	} else {
+		resp.Queue = c.server.queue.List(item.Agent)
+	}
+	c.sendJSON(resp)
+}
+
+func handleSendKeys(c *Client, req Request) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	if len(req.Keys) == 0 {
+		c.sendError(req.ID, wsbase.MissingField("keys"))
+		return
+	}
+	if e := c.server.admitInput(c, req.Agent); e != nil {
+		c.sendJSON(errorResponse(req.ID, "send-keys", e))
+		return
+	}
+
+	lock := c.server.prompter.GetLock(req.Agent)
 	go func() {
 		lock.Lock()
 		defer lock.Unlock()
 
-		if err := c.server.prompter.SendPrompt(req.Agent, req.Prompt); err != nil {
-			ok := false
-			c.sendJSON(Response{ID: req.ID, Type: "send-prompt", OK: &ok, Error: err.Error()})
+		if err := c.server.prompter.SendKeys(req.Agent, req.Keys); err != nil {
+			c.sendJSON(errorResponse(req.ID, "send-keys", wsbase.ErrorFrom(err)))
+			return
+		}
+		ok := true
+		c.sendJSON(Response{ID: req.ID, Type: "send-keys", OK: &ok})
+	}()
+}
+
+func handleInterruptAgent(c *Client, req Request) {
+	if req.Agent == "" {
+		c.sendError(req.ID, wsbase.MissingField("agent"))
+		return
+	}
+	level := req.Level
+	if level == "" {
+		level = agentio.InterruptSoft
+	}
+	// Signalling the process goes beyond typing into the pane.
+	if level == agentio.InterruptKill {
+		if e := c.authorize(wsbase.ScopeAdmin, req.Agent); e != nil {
+			c.sendJSON(errorResponse(req.ID, "interrupt-agent", e))
 			return
 		}
+	}
+	if e := c.server.admitInput(c, req.Agent); e != nil {
+		c.sendJSON(errorResponse(req.ID, "interrupt-agent", e))
+		return
+	}
+
+	lock := c.server.prompter.GetLock(req.Agent)
+	go func() {
+		lock.Lock()
+		defer lock.Unlock()
 
+		result, err := c.server.prompter.Interrupt(req.Agent, level, agentio.InterruptTimeout(req.TimeoutMs))
+		if err != nil {
+			c.sendJSON(errorResponse(req.ID, "interrupt-agent", wsbase.ErrorFrom(err)))
+			return
+		}
 		ok := true
-		c.sendJSON(Response{ID: req.ID, Type: "send-prompt", OK: &ok})
+		c.sendJSON(Response{ID: req.ID, Type: "interrupt-agent", OK: &ok, Interrupt: &result})
 	}()
 }
 
 func handleSubscribeOutput(c *Client, req Request) {
 	if req.Agent == "" {
-		c.sendError(req.ID, "agent field required")
+		c.sendError(req.ID, wsbase.MissingField("agent"))
 		return
 	}
 
 	_, ok := c.server.registry.GetAgent(req.Agent)
 	if !ok {
-		okVal := false
-		c.sendJSON(Response{ID: req.ID, Type: "subscribe-output", OK: &okVal, Error: "agent not found"})
+		c.sendJSON(errorResponse(req.ID, "subscribe-output", wsbase.AgentNotFound(req.Agent)))
 		return
 	}
 
@@ -235,6 +856,12 @@ func handleSubscribeOutput(c *Client, req Request) {
 	wantStream := req.Stream == nil || *req.Stream
 
 	if wantStream {
+		mode, perr := parseSnapshotMode(req.Snapshot)
+		if perr != nil {
+			c.sendJSON(errorResponse(req.ID, "subscribe-output", perr))
+			return
+		}
+
 		// Clean up any existing subscription for this agent before creating a new one.
 		// This prevents leaking the old channel and its forwarding goroutine.
 		c.mu.Lock()
@@ -253,8 +880,7 @@ func handleSubscribeOutput(c *Client, req Request) {
 		subID, ch, err := c.server.pipeMgr.Subscribe(req.Agent)
 		if err != nil {
 			log.Printf("subscribe-output(%s): pipe-pane error: %v", req.Agent, err)
-			okVal := false
-			c.sendJSON(Response{ID: req.ID, Type: "subscribe-output", OK: &okVal, Error: err.Error()})
+			c.sendJSON(errorResponse(req.ID, "subscribe-output", wsbase.ErrorFrom(err)))
 			return
 		}
 		log.Printf("subscribe-output(%s): pipe-pane active", req.Agent)
@@ -263,44 +889,18 @@ func handleSubscribeOutput(c *Client, req Request) {
 		c.outputSubs[req.Agent] = outputSub{id: subID, ch: ch}
 		c.mu.Unlock()
 
+		control := c.server.control.state(req.Agent, c)
 		okVal := true
 		c.sendJSON(Response{
-			ID:   req.ID,
-			Type: "subscribe-output",
-			OK:   &okVal,
+			ID:      req.ID,
+			Type:    "subscribe-output",
+			OK:      &okVal,
+			Control: &control,
 		})
 
-		// Drain any output the agent was already producing — we only want
-		// the controlled redraw.
-		drained := 0
-	drain:
-		for {
-			select {
-			case _, ok := <-ch:
-				if !ok {
-					break drain
-				}
-				drained++
-			default:
-				break drain
-			}
+		if mode.kind != SnapshotNone {
+			sendOutputSnapshot(c, req.Agent, ch, mode)
 		}
-		if drained > 0 {
-			log.Printf("subscribe-output(%s): drained %d pre-redraw chunks", req.Agent, drained)
-		}
-
-		// Force a clean redraw. The resize dance triggers SIGWINCH, causing
-		// the app to repaint. pipe-pane captures all output in real-time.
-		log.Printf("subscribe-output(%s): forcing redraw", req.Agent)
-		c.server.ctrl.ForceRedraw(req.Agent)
-
-		// Let the app finish redrawing; pipe-pane buffers all output in ch.
-		time.Sleep(200 * time.Millisecond)
-
-		// Send a minimal 0x05 (clear screen) to trigger the client's reset+reveal.
-		// The actual content comes from pipe-pane data buffered in ch.
-		log.Printf("subscribe-output(%s): sending 0x05 clear-screen trigger", req.Agent)
-		c.SendBinary(agentio.MakeBinaryFrame(agentio.BinaryTerminalSnapshot, req.Agent, []byte("\x1b[2J\x1b[H")))
 
 		// Stream raw bytes in background — immediately flushes buffered pipe-pane data.
 		go func() {
@@ -321,9 +921,67 @@ func handleSubscribeOutput(c *Client, req Request) {
 	}
 }
 
+// sendOutputSnapshot primes a fresh output subscription with a 0x05 frame so
+// the client can reset its terminal before live bytes arrive.
+func sendOutputSnapshot(c *Client, agent string, ch <-chan []byte, mode snapshotMode) {
+	// Drain any output the agent was already producing — the snapshot
+	// replaces it.
+	drained := 0
+drain:
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				break drain
+			}
+			drained++
+		default:
+			break drain
+		}
+	}
+	if drained > 0 {
+		log.Printf("subscribe-output(%s): drained %d pre-snapshot chunks", agent, drained)
+	}
+
+	var (
+		capture string
+		err     error
+	)
+	switch mode.kind {
+	case SnapshotCaptureVisible:
+		capture, err = c.server.ctrl.CapturePaneVisible(agent)
+	case SnapshotCaptureScrollback:
+		capture, err = c.server.ctrl.CapturePaneLines(agent, mode.lines)
+	default:
+		// Force a clean redraw. The resize dance triggers SIGWINCH, causing
+		// the app to repaint; pipe-pane buffers the repaint in ch. Concurrent
+		// subscribers to the same agent share one redraw.
+		log.Printf("subscribe-output(%s): forcing redraw", agent)
+		c.server.redraws.Redraw(agent)
+	}
+	if err != nil {
+		// Fall through with an empty screen; live output still follows.
+		log.Printf("subscribe-output(%s): %s capture error: %v", agent, mode.kind, err)
+		capture = ""
+	}
+	var cursor *paneCursor
+	if capture != "" {
+		if x, y, height, err := c.server.ctrl.PaneCursor(agent); err != nil {
+			log.Printf("subscribe-output(%s): cursor position unknown: %v", agent, err)
+		} else {
+			cursor = &paneCursor{x: x, y: y, height: height}
+		}
+	}
+
+	// For redraw, a minimal 0x05 (clear screen) triggers the client's
+	// reset+reveal and the content comes from pipe-pane data buffered in ch.
+	log.Printf("subscribe-output(%s): sending 0x05 %s snapshot", agent, mode.kind)
+	c.SendBinary(agentio.MakeBinaryFrame(agentio.BinaryTerminalSnapshot, agent, snapshotFrame(capture, cursor)))
+}
+
 func handleUnsubscribeOutput(c *Client, req Request) {
 	if req.Agent == "" {
-		c.sendError(req.ID, "agent field required")
+		c.sendError(req.ID, wsbase.MissingField("agent"))
 		return
 	}
 
@@ -337,6 +995,13 @@ func handleUnsubscribeOutput(c *Client, req Request) {
 	if exists {
 		c.server.pipeMgr.Unsubscribe(req.Agent, sub.id)
 	}
+	// A client that stops watching no longer has a say in the window size.
+	c.server.dropSize(c, req.Agent)
+	// A driver that stops watching gives up control.
+	if released, _ := c.server.control.release(req.Agent, c); released {
+		log.Printf("control(%s): %s by %s", req.Agent, ControlReleased, c.remoteAddr)
+		c.server.broadcastControl(req.Agent, ControlReleased)
+	}
 
 	okVal := true
 	c.sendJSON(Response{ID: req.ID, Type: "unsubscribe-output", OK: &okVal})
@@ -345,9 +1010,16 @@ func handleUnsubscribeOutput(c *Client, req Request) {
 func handleSubscribeAgents(c *Client, req Request) {
 	c.mu.Lock()
 	c.agentSub = true
+	c.agentFields = nil
+	if len(req.Fields) > 0 {
+		c.agentFields = make(map[string]bool, len(req.Fields))
+		for _, f := range req.Fields {
+			c.agentFields[f] = true
+		}
+	}
 	c.mu.Unlock()
 
-	agentList := c.server.registry.GetAgents()
+	agentList := c.grant.FilterAgents(c.server.registry.GetAgents())
 	okVal := true
 	c.sendJSON(Response{
 		ID:     req.ID,
@@ -360,6 +1032,7 @@ func handleSubscribeAgents(c *Client, req Request) {
 func handleUnsubscribeAgents(c *Client, req Request) {
 	c.mu.Lock()
 	c.agentSub = false
+	c.agentFields = nil
 	c.mu.Unlock()
 
 	okVal := true
@@ -367,16 +1040,60 @@ func handleUnsubscribeAgents(c *Client, req Request) {
 }
 
 // MakeAgentEvent creates a JSON event message for agent lifecycle changes.
-func MakeAgentEvent(eventType string, agent agents.Agent) []byte {
+func MakeAgentEvent(event agents.RegistryEvent) []byte {
+	agent := event.Agent
 	var resp Response
-	switch eventType {
+	switch event.Type {
 	case "added":
 		resp = Response{Type: "agent-added", Agent: &agent}
 	case "removed":
 		resp = Response{Type: "agent-removed", Name: agent.Name}
 	case "updated":
-		resp = Response{Type: "agent-updated", Agent: &agent}
+		resp = Response{Type: "agent-updated", Agent: &agent, Changes: event.Changes}
 	}
 	data, _ := json.Marshal(resp)
 	return data
 }
+
+// MakePromptQueueEvent creates a JSON prompt-queue event message.
+func MakePromptQueueEvent(event agentio.QueueEvent) []byte {
+	item := event.Item
+	data, _ := json.Marshal(Response{
+		Type:      "prompt-queue",
+		Action:    event.Action,
+		Name:      item.Agent,
+		QueueItem: &item,
+		Queue:     event.Queue,
+		Error:     event.Error,
+	})
+	return data
+}
+
+// MakeCommandsChangedEvent builds a commands-changed event telling clients to
+// re-fetch an agent's slash commands with list-commands.
+func MakeCommandsChangedEvent(agentName string) []byte {
+	data, _ := json.Marshal(Response{Type: "commands-changed", Name: agentName})
+	return data
+}
+
+// MakeTerminalEvent builds a clipboard-set, agent-notification or bell event
+// for a sequence found in an agent's output.
+func MakeTerminalEvent(agentName string, event agentio.TerminalEvent) []byte {
+	resp := Response{Type: event.Type, Name: agentName}
+	if event.Type != agentio.TerminalBell {
+		resp.Terminal = &event
+	}
+	data, _ := json.Marshal(resp)
+	return data
+}
+
+// wantsAgentEvent reports whether a lifecycle subscriber with the given field
+// filter should receive an event. Added/removed events always pass; updated
+// events pass only when at least one changed field is in the filter.
+// A nil filter means all fields.
+func wantsAgentEvent(fields map[string]bool, event agents.RegistryEvent) bool {
+	if event.Type != "updated" {
+		return true
+	}
+	return agents.ChangesMatchFields(event.Changes, fields)
+}
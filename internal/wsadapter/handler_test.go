@@ -1,6 +1,15 @@
 package wsadapter
 
-import "testing"
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
+)
 
 func TestTmuxKeyNameFromVT(t *testing.T) {
 	cases := []struct {
@@ -16,6 +25,14 @@ func TestTmuxKeyNameFromVT(t *testing.T) {
 		{payload: "\x1b[6~", wantKey: "PgDn"},
 		{payload: "\x1b", wantKey: "Escape"},
 		{payload: "\x7f", wantKey: "BSpace"},
+		{payload: "\x1b[1;5A", wantKey: "C-Up"},
+		{payload: "\x1b[1;3C", wantKey: "M-Right"},
+		{payload: "\x1b[1;2D", wantKey: "S-Left"},
+		{payload: "\x1b[1;8H", wantKey: "C-M-S-Home"},
+		{payload: "\x1b[1;5P", wantKey: "C-F1"},
+		{payload: "\x1b[5;2~", wantKey: "S-PgUp"},
+		{payload: "\x1b[3;5~", wantKey: "C-DC"},
+		{payload: "\x1b[15;3~", wantKey: "M-F5"},
 	}
 
 	for _, tc := range cases {
@@ -30,7 +47,248 @@ func TestTmuxKeyNameFromVT(t *testing.T) {
 }
 
 func TestTmuxKeyNameFromVTUnknown(t *testing.T) {
-	if _, ok := tmuxKeyNameFromVT([]byte("not-a-vt-seq")); ok {
-		t.Fatal("expected unknown VT sequence to return ok=false")
+	for _, payload := range []string{"not-a-vt-seq", "\x1b[1;9A", "\x1b[1;1A", "\x1b[2;5A", "\x1b[99;5~", "\x1b[1;xA"} {
+		if _, ok := tmuxKeyNameFromVT([]byte(payload)); ok {
+			t.Fatalf("expected unknown VT sequence %q to return ok=false", payload)
+		}
+	}
+}
+
+func TestWantsAgentEvent(t *testing.T) {
+	workDirOnly := map[string]bool{"workDir": true}
+	attachChange := agents.RegistryEvent{
+		Type:    "updated",
+		Changes: []agents.AgentChange{{Field: "attached", Old: false, New: true}},
+	}
+	workDirChange := agents.RegistryEvent{
+		Type:    "updated",
+		Changes: []agents.AgentChange{{Field: "workDir", Old: "/a", New: "/b"}},
+	}
+
+	if !wantsAgentEvent(nil, attachChange) {
+		t.Fatal("nil field filter should receive every update")
+	}
+	if wantsAgentEvent(workDirOnly, attachChange) {
+		t.Fatal("workDir-only filter should not receive attached updates")
+	}
+	if !wantsAgentEvent(workDirOnly, workDirChange) {
+		t.Fatal("workDir-only filter should receive workDir updates")
+	}
+	if !wantsAgentEvent(workDirOnly, agents.RegistryEvent{Type: "added"}) {
+		t.Fatal("field filter should not suppress added events")
+	}
+	if !wantsAgentEvent(workDirOnly, agents.RegistryEvent{Type: "removed"}) {
+		t.Fatal("field filter should not suppress removed events")
+	}
+}
+
+func TestMakePromptQueueEvent(t *testing.T) {
+	item := agentio.QueuedPrompt{ID: "p3", Agent: "hq-mayor", Prompt: "hi", State: agentio.PromptQueued}
+	data := MakePromptQueueEvent(agentio.QueueEvent{
+		Action: agentio.QueueActionQueued,
+		Item:   item,
+		Queue:  []agentio.QueuedPrompt{item},
+	})
+
+	var got Response
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.Type != "prompt-queue" || got.Action != "queued" || got.Name != "hq-mayor" {
+		t.Fatalf("unexpected event header: %+v", got)
+	}
+	if got.QueueItem == nil || got.QueueItem.ID != "p3" || len(got.Queue) != 1 {
+		t.Fatalf("unexpected queue payload: %s", data)
+	}
+}
+
+func TestMakeCommandsChangedEvent(t *testing.T) {
+	data := MakeCommandsChangedEvent("hq-mayor")
+	if string(data) != `{"type":"commands-changed","name":"hq-mayor"}` {
+		t.Fatalf("event = %s", data)
+	}
+}
+
+func TestMakeTerminalEvent(t *testing.T) {
+	clip := MakeTerminalEvent("hq-mayor", agentio.TerminalEvent{Type: agentio.TerminalClipboardSet, Selection: "c", Text: "hi"})
+	if string(clip) != `{"type":"clipboard-set","name":"hq-mayor","terminal":{"selection":"c","text":"hi"}}` {
+		t.Fatalf("clipboard event = %s", clip)
+	}
+	bell := MakeTerminalEvent("hq-mayor", agentio.TerminalEvent{Type: agentio.TerminalBell})
+	if string(bell) != `{"type":"bell","name":"hq-mayor"}` {
+		t.Fatalf("bell event = %s", bell)
+	}
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	s := NewServer(nil, nil, nil, "", nil)
+	return &Client{server: s, send: make(chan outMsg, 8), outputSubs: make(map[string]outputSub), grant: wsbase.FullAccess}
+}
+
+func readResponse(t *testing.T, c *Client) Response {
+	t.Helper()
+	select {
+	case msg := <-c.send:
+		var resp Response
+		if err := json.Unmarshal(msg.data, &resp); err != nil {
+			t.Fatalf("unmarshal %s: %v", msg.data, err)
+		}
+		return resp
+	default:
+		t.Fatal("no response sent")
+		return Response{}
+	}
+}
+
+func TestHelloNegotiatesProtocol(t *testing.T) {
+	c := newTestClient(t)
+
+	handleMessage(c, Request{ID: "1", Type: "hello", Protocol: "tmux-adapter.v9"})
+	if resp := readResponse(t, c); resp.OK == nil || *resp.OK || resp.Capabilities != nil {
+		t.Fatalf("unsupported hello = %+v", resp)
+	}
+
+	handleMessage(c, Request{ID: "2", Type: "hello", Protocol: ProtocolV1})
+	resp := readResponse(t, c)
+	if resp.OK == nil || !*resp.OK || resp.Protocol != ProtocolV1 || resp.Version == "" || resp.Capabilities == nil {
+		t.Fatalf("hello = %+v", resp)
+	}
+	caps := resp.Capabilities
+	for _, want := range []string{"hello", "send-keys", "subscribe-output", "upload-init"} {
+		if !slices.Contains(caps.Messages, want) {
+			t.Errorf("messages %v missing %q", caps.Messages, want)
+		}
+	}
+	if len(caps.BinaryFrames) != 6 || caps.BinaryFrames[0].Type != "0x01" {
+		t.Errorf("binary frames = %+v", caps.BinaryFrames)
+	}
+	if caps.Uploads.MaxFileBytes != agentio.MaxFileUploadBytes || !slices.Contains(caps.Keys.Names, "Enter") {
+		t.Errorf("capabilities = %+v", caps)
+	}
+	if !slices.Contains(caps.Output.SnapshotModes, SnapshotCaptureVisible) {
+		t.Errorf("snapshot modes = %v", caps.Output.SnapshotModes)
+	}
+
+	handleMessage(c, Request{ID: "3", Type: "hello"})
+	if resp := readResponse(t, c); *resp.OK || resp.Protocol != ProtocolV1 {
+		t.Fatalf("second hello = %+v", resp)
+	}
+}
+
+func TestUnknownMessageType(t *testing.T) {
+	c := newTestClient(t)
+	handleMessage(c, Request{ID: "7", Type: "teleport-agent"})
+	resp := readResponse(t, c)
+	if resp.Type != "error" || resp.ID != "7" || resp.UnknownType != "teleport-agent" || resp.Protocol != ProtocolV1 {
+		t.Fatalf("unknown type response = %+v", resp)
+	}
+
+	if resp.ErrorInfo == nil || resp.ErrorInfo.Code != wsbase.CodeUnsupported {
+		t.Fatalf("unknown type errorInfo = %+v", resp.ErrorInfo)
+	}
+
+	handleBinaryMessage(c, []byte("\x09hq-mayor\x00data"))
+	if resp := readResponse(t, c); resp.UnknownType != "0x09" {
+		t.Fatalf("unknown frame response = %+v", resp)
+	}
+}
+
+func TestBinaryFrameErrorsCarryFrameRef(t *testing.T) {
+	c := newTestClient(t)
+	handleBinaryMessage(c, []byte("\x03hq-mayor\x00bad"))
+	handleBinaryMessage(c, []byte("\x03hq-mayor\x00100:x"))
+
+	readResponse(t, c)
+	resp := readResponse(t, c)
+	info := resp.ErrorInfo
+	if resp.ID != "" || info == nil || info.Code != wsbase.CodeInvalidArgument || resp.Error != info.Message {
+		t.Fatalf("resize error = %+v", resp)
+	}
+	if info.Frame == nil || *info.Frame != (wsbase.FrameRef{Type: "0x03", Agent: "hq-mayor", Seq: 2}) {
+		t.Fatalf("frame = %+v, want second resize frame", info.Frame)
+	}
+}
+
+func TestMissingFieldError(t *testing.T) {
+	c := newTestClient(t)
+	handleMessage(c, Request{ID: "4", Type: "send-prompt", Prompt: "hi"})
+	resp := readResponse(t, c)
+	if resp.ID != "4" || resp.Error != "agent field required" || resp.ErrorInfo.Code != wsbase.CodeInvalidArgument || resp.ErrorInfo.Details["field"] != "agent" {
+		t.Fatalf("missing field response = %+v", resp)
+	}
+}
+
+func TestStopEndsBackgroundWork(t *testing.T) {
+	s := newTestClient(t).server
+	done := make(chan struct{}, 3)
+	for _, run := range []func(){s.ForwardPromptQueueEvents, s.ForwardCommandChanges, func() { s.RunUploadCleanup(time.Hour) }} {
+		go func() {
+			run()
+			done <- struct{}{}
+		}()
+	}
+	s.Stop()
+	for range 3 {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("a background loop outlived Stop")
+		}
+	}
+}
+
+func TestEveryRequestHasScope(t *testing.T) {
+	for typ := range requestHandlers {
+		if _, ok := requestScopes[typ]; !ok {
+			t.Errorf("request %q has no token scope", typ)
+		}
+	}
+}
+
+func TestQueueRequestsForUnknownPrompt(t *testing.T) {
+	c := newTestClient(t)
+	pos := 0
+	for _, req := range []Request{
+		{ID: "1", Type: "cancel-prompt", PromptID: "p999"},
+		{ID: "2", Type: "reorder-prompt", PromptID: "p999", Position: &pos},
+	} {
+		handleMessage(c, req)
+		if resp := readResponse(t, c); resp.ErrorInfo == nil || resp.ErrorInfo.Code != wsbase.CodeNotFound || resp.PromptID != "p999" {
+			t.Fatalf("%s of unknown prompt = %+v", req.Type, resp)
+		}
+	}
+}
+
+func TestScopedTokenEnforcement(t *testing.T) {
+	c := newTestClient(t)
+	c.server = NewServer(agents.NewRegistry(nil, "", nil), nil, nil, "", nil)
+	c.grant = &wsbase.Grant{Name: "dash", Scopes: []wsbase.Scope{wsbase.ScopeView}, Agents: []agentio.AgentSelector{{Name: "gt-*"}}}
+
+	handleMessage(c, Request{ID: "1", Type: "send-keys", Agent: "gt-toast"})
+	if resp := readResponse(t, c); resp.ErrorInfo == nil || resp.ErrorInfo.Code != wsbase.CodePermissionDenied || resp.Type != "send-keys" {
+		t.Fatalf("send-keys without input scope = %+v", resp)
+	}
+
+	c.grant.Scopes = append(c.grant.Scopes, wsbase.ScopeInput)
+	handleMessage(c, Request{ID: "k", Type: "interrupt-agent", Agent: "gt-toast", Level: agentio.InterruptKill})
+	if resp := readResponse(t, c); resp.ErrorInfo == nil || resp.ErrorInfo.Code != wsbase.CodePermissionDenied || resp.ErrorInfo.Details["scope"] != string(wsbase.ScopeAdmin) {
+		t.Fatalf("kill-process without admin scope = %+v", resp)
+	}
+
+	handleMessage(c, Request{ID: "2", Type: "list-commands", Agent: "hq-mayor"})
+	if resp := readResponse(t, c); resp.ErrorInfo == nil || resp.ErrorInfo.Code != wsbase.CodeAgentNotFound {
+		t.Fatalf("request for hidden agent = %+v", resp)
+	}
+
+	handleBinaryMessage(c, []byte("\x03gt-toast\x0080:24"))
+	resp := readResponse(t, c)
+	if resp.ErrorInfo == nil || resp.ErrorInfo.Code != wsbase.CodePermissionDenied || resp.ErrorInfo.Frame == nil {
+		t.Fatalf("resize without resize scope = %+v", resp)
+	}
+
+	handleMessage(c, Request{ID: "3", Type: "hello"})
+	if resp := readResponse(t, c); resp.Grant == nil || resp.Grant.Name != "dash" {
+		t.Fatalf("hello grant = %+v", resp.Grant)
 	}
 }
@@ -0,0 +1,221 @@
+package wsadapter
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
+)
+
+const (
+	// ProtocolV1 is the adapter protocol version negotiated by hello.
+	ProtocolV1 = "tmux-adapter.v1"
+	// ServerVersion is reported in the hello response.
+	ServerVersion = "0.1.0"
+)
+
+// supportedProtocols lists the versions hello accepts, newest first.
+var supportedProtocols = []string{ProtocolV1}
+
+// serverEvents lists the JSON messages the server pushes without a request.
+var serverEvents = []string{
+	"agent-added", "agent-removed", "agent-updated", "prompt-queue", "commands-changed",
+	"upload-result", "upload-chunk", "control-changed", "terminal-size",
+	agentio.TerminalClipboardSet, agentio.TerminalNotification, agentio.TerminalBell,
+}
+
+// Capabilities describes what the server supports. It is sent in the hello
+// response so clients can adapt instead of probing.
+type Capabilities struct {
+	Messages     []string            `json:"messages"`
+	Events       []string            `json:"events"`
+	BinaryFrames []BinaryFrameInfo   `json:"binaryFrames"`
+	Output       OutputCapabilities  `json:"output"`
+	Uploads      UploadCapabilities  `json:"uploads"`
+	Files        FileCapabilities    `json:"files"`
+	Keys         KeyCapabilities     `json:"keys"`
+	Control      ControlCapabilities `json:"control"`
+	Size         SizeCapabilities    `json:"size"`
+}
+
+// BinaryFrameInfo describes one binary frame type.
+type BinaryFrameInfo struct {
+	Type      string `json:"type"` // "0x01"
+	Name      string `json:"name"`
+	Direction string `json:"direction"` // "server-to-client" or "client-to-server"
+}
+
+// OutputCapabilities describes subscribe-output.
+type OutputCapabilities struct {
+	Stream         bool     `json:"stream"`         // live pipe-pane frames
+	History        bool     `json:"history"`        // "stream": false returns history
+	Snapshot       bool     `json:"snapshot"`       // a snapshot frame precedes the stream
+	SnapshotModes  []string `json:"snapshotModes"`  // accepted "snapshot" values
+	TerminalEvents []string `json:"terminalEvents"` // JSON events parsed from the stream
+}
+
+// UploadCapabilities describes file upload limits. Zero means unlimited.
+type UploadCapabilities struct {
+	MaxFileBytes     int64    `json:"maxFileBytes"` // single 0x04 frame
+	MaxChunkedBytes  int64    `json:"maxChunkedBytes"`
+	ChunkBytes       int      `json:"chunkBytes"`
+	QuotaBytes       int64    `json:"quotaBytes"`
+	MaxFilesPerAgent int      `json:"maxFilesPerAgent"`
+	PasteModes       []string `json:"pasteModes"`
+}
+
+// FileCapabilities describes workDir browsing limits. Zero means unlimited.
+type FileCapabilities struct {
+	MaxFileBytes int64 `json:"maxFileBytes"` // GET /files downloads
+	MaxReadBytes int64 `json:"maxReadBytes"` // read-file
+	MaxEntries   int   `json:"maxEntries"`
+}
+
+// KeyCapabilities describes send-keys.
+type KeyCapabilities struct {
+	Names     []string `json:"names"`
+	Modifiers []string `json:"modifiers"`
+	MaxInputs int      `json:"maxInputs"`
+	MaxRepeat int      `json:"maxRepeat"`
+}
+
+// ControlCapabilities describes input control arbitration.
+type ControlCapabilities struct {
+	Policy   string   `json:"policy"` // policy in effect
+	Policies []string `json:"policies"`
+}
+
+// SizeCapabilities describes how the window size is chosen between clients.
+type SizeCapabilities struct {
+	Policy   string   `json:"policy"` // policy in effect
+	Policies []string `json:"policies"`
+}
+
+var binaryFrames = []BinaryFrameInfo{
+	{frameType(agentio.BinaryTerminalOutput), "terminal-output", "server-to-client"},
+	{frameType(agentio.BinaryKeyboardInput), "keyboard-input", "client-to-server"},
+	{frameType(agentio.BinaryResize), "resize", "client-to-server"},
+	{frameType(agentio.BinaryFileUpload), "file-upload", "client-to-server"},
+	{frameType(agentio.BinaryTerminalSnapshot), "terminal-snapshot", "server-to-client"},
+	{frameType(agentio.BinaryUploadChunk), "upload-chunk", "client-to-server"},
+}
+
+func frameType(t byte) string {
+	return fmt.Sprintf("0x%02x", t)
+}
+
+// capabilities reports the server's current capabilities.
+func (s *Server) capabilities() *Capabilities {
+	messages := make([]string, 0, len(requestHandlers)+1)
+	messages = append(messages, "hello")
+	for t := range requestHandlers {
+		messages = append(messages, t)
+	}
+	slices.Sort(messages)
+
+	uploads := s.prompter.Uploads.Policy()
+	files := s.prompter.Files.Policy()
+	return &Capabilities{
+		Messages:     messages,
+		Events:       serverEvents,
+		BinaryFrames: binaryFrames,
+		Output: OutputCapabilities{
+			Stream:        true,
+			History:       true,
+			Snapshot:      true,
+			SnapshotModes: snapshotModes,
+			TerminalEvents: []string{
+				agentio.TerminalClipboardSet, agentio.TerminalNotification, agentio.TerminalBell,
+			},
+		},
+		Uploads: UploadCapabilities{
+			MaxFileBytes:     agentio.MaxFileUploadBytes,
+			MaxChunkedBytes:  agentio.MaxChunkedUploadBytes,
+			ChunkBytes:       agentio.UploadChunkBytes,
+			QuotaBytes:       uploads.MaxBytesPerAgent,
+			MaxFilesPerAgent: uploads.MaxFilesPerAgent,
+			PasteModes: []string{
+				string(agentio.PasteInline), string(agentio.PasteFenced), string(agentio.PastePath),
+				string(agentio.PasteAbsolutePath), string(agentio.PasteRefuse),
+			},
+		},
+		Files: FileCapabilities{
+			MaxFileBytes: files.MaxFileBytes,
+			MaxReadBytes: agentio.MaxReadFileBytes,
+			MaxEntries:   files.MaxEntries,
+		},
+		Keys: KeyCapabilities{
+			Names:     agentio.KeyNames(),
+			Modifiers: []string{"ctrl", "alt", "shift"},
+			MaxInputs: agentio.MaxKeyInputs,
+			MaxRepeat: agentio.MaxKeyRepeat,
+		},
+		Control: ControlCapabilities{
+			Policy:   s.control.policyName(),
+			Policies: controlPolicies,
+		},
+		Size: SizeCapabilities{
+			Policy:   s.sizes.policyName(),
+			Policies: sizePolicies,
+		},
+	}
+}
+
+// handleHello negotiates the protocol version. hello is optional: clients
+// that skip it get the v1 behavior. An empty protocol picks the newest one.
+func handleHello(c *Client, req Request) {
+	c.mu.Lock()
+	negotiated := c.protocol
+	c.mu.Unlock()
+	if negotiated != "" {
+		resp := errorResponse(req.ID, "hello", wsbase.NewError(wsbase.CodeInvalidArgument, "already handshaked"))
+		resp.Protocol = negotiated
+		c.sendJSON(resp)
+		return
+	}
+
+	protocol := strings.TrimSpace(req.Protocol)
+	if protocol == "" {
+		protocol = supportedProtocols[0]
+	}
+	if !slices.Contains(supportedProtocols, protocol) {
+		e := wsbase.Errorf(wsbase.CodeUnsupported, "unsupported protocol version %q (supported: %s)", protocol, strings.Join(supportedProtocols, ", "))
+		c.sendJSON(errorResponse(req.ID, "hello", e.WithDetail("supported", supportedProtocols)))
+		return
+	}
+
+	c.mu.Lock()
+	c.protocol = protocol
+	c.mu.Unlock()
+	okVal := true
+	c.sendJSON(Response{
+		ID:           req.ID,
+		Type:         "hello",
+		OK:           &okVal,
+		Protocol:     protocol,
+		Version:      ServerVersion,
+		Capabilities: c.server.capabilities(),
+		Grant:        c.grant,
+	})
+}
+
+// sendUnknownType rejects a message or binary frame type the server doesn't
+// implement. The error carries the type and the protocol version in effect
+// so clients can tell an older server from a malformed request. frame is nil
+// for text messages.
+func sendUnknownType(c *Client, id, msgType, errMsg string, frame *wsbase.FrameRef) {
+	c.mu.Lock()
+	protocol := c.protocol
+	c.mu.Unlock()
+	if protocol == "" {
+		protocol = ProtocolV1
+	}
+	e := wsbase.NewError(wsbase.CodeUnsupported, errMsg).WithDetail("type", msgType)
+	e.Frame = frame
+	resp := errorResponse(id, "error", e)
+	resp.Protocol = protocol
+	resp.UnknownType = msgType
+	c.sendJSON(resp)
+}
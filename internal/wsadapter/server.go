@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gastownhall/tmux-adapter/internal/agentio"
 	"github.com/gastownhall/tmux-adapter/internal/agents"
@@ -19,28 +20,60 @@ type Server struct {
 	pipeMgr        *tmux.PipePaneManager
 	ctrl           *tmux.ControlMode
 	prompter       *agentio.Prompter
+	queue          *agentio.PromptQueue
+	commands       *agentio.CommandCatalog
+	redraws        *redrawCoalescer
+	control        *controlArbiter
+	sizes          *sizeArbiter
 	authToken      string
+	tokens         *wsbase.Tokens
 	originPatterns []string
 	clients        map[*Client]struct{}
 	mu             sync.Mutex
+
+	scanners   map[string]*agentio.TerminalEventScanner // agent name -> scanner
+	scannersMu sync.Mutex
+	clipboard  *clipboardMirror // nil unless mirroring the clipboard
+
+	stopCh chan struct{} // closed by Stop
 }
 
 // NewServer creates a new WebSocket server.
 func NewServer(registry *agents.Registry, pipeMgr *tmux.PipePaneManager, ctrl *tmux.ControlMode, authToken string, originPatterns []string) *Server {
-	return &Server{
+	s := &Server{
 		registry:       registry,
 		pipeMgr:        pipeMgr,
 		ctrl:           ctrl,
-		prompter:       agentio.NewPrompter(ctrl, registry),
 		authToken:      strings.TrimSpace(authToken),
+		tokens:         wsbase.SharedToken(strings.TrimSpace(authToken)),
 		originPatterns: originPatterns,
 		clients:        make(map[*Client]struct{}),
+		scanners:       make(map[string]*agentio.TerminalEventScanner),
+		control:        newControlArbiter(),
+		stopCh:         make(chan struct{}),
 	}
+	if pipeMgr != nil {
+		pipeMgr.SetObserver(s.observeOutput)
+	}
+	s.prompter = agentio.NewPrompter(ctrl, registry)
+	s.queue = agentio.NewPromptQueue(s.prompter)
+	s.commands = agentio.NewCommandCatalog(registry, "")
+	s.sizes = newSizeArbiter(
+		func(agent string, size termSize) error { return s.ctrl.ResizePaneTo(agent, size.cols, size.rows) },
+		func(agent string) (termSize, error) {
+			cols, rows, err := s.ctrl.WindowSize(agent)
+			return termSize{cols, rows}, err
+		},
+		s.control.driver,
+	)
+	s.redraws = newRedrawCoalescer(func(agent string) { s.ctrl.ForceRedraw(agent) }, redrawGather, redrawSettle)
+	return s
 }
 
 // ServeHTTP handles WebSocket upgrade requests at /ws.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if !wsbase.IsAuthorizedRequest(s.authToken, r) {
+	grant, ok := s.tokens.Authenticate(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -53,6 +86,8 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	ctx, cancel := context.WithCancel(r.Context())
 	client := NewClient(conn, s, ctx, cancel)
+	client.remoteAddr = grant.Identity(wsbase.PeerIdentity(r))
+	client.grant = grant
 
 	s.mu.Lock()
 	s.clients[client] = struct{}{}
@@ -69,14 +104,145 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.RemoveClient(client)
 }
 
-// BroadcastToAgentSubscribers sends a message to all clients subscribed to agent lifecycle events.
-func (s *Server) BroadcastToAgentSubscribers(msg []byte) {
+// LoadTokens replaces the access tokens with those in a JSON tokens file.
+// The --auth-token secret, if any, stays valid as an admin token.
+func (s *Server) LoadTokens(path string) error {
+	tokens, err := wsbase.LoadTokens(path, s.authToken)
+	if err != nil {
+		return err
+	}
+	s.tokens = tokens.WithJWT(s.tokens.JWT())
+	return nil
+}
+
+// LoadJWTKeys accepts signed JWTs verified against the keys in cfg.KeyFile,
+// alongside any static tokens. The key file is re-read when it changes.
+func (s *Server) LoadJWTKeys(cfg wsbase.JWTConfig) error {
+	v, err := wsbase.NewJWTVerifier(cfg)
+	if err != nil {
+		return err
+	}
+	s.tokens = s.tokens.WithJWT(v)
+	return nil
+}
+
+// RequireGrant wraps an HTTP handler so it accepts the same tokens as the
+// WebSocket endpoint and requires scope.
+func (s *Server) RequireGrant(scope wsbase.Scope, next http.Handler) http.Handler {
+	return wsbase.RequireGrant(s.tokens, s.registry, scope, next)
+}
+
+// LoadPromptTimings applies per-runtime prompt timing overrides from a JSON file.
+func (s *Server) LoadPromptTimings(path string) error {
+	return s.prompter.LoadPromptTimings(path)
+}
+
+// LoadPastePolicies applies per-runtime upload paste policies from a JSON file.
+func (s *Server) LoadPastePolicies(path string) error {
+	return s.prompter.LoadPastePolicies(path)
+}
+
+// SetUploadPolicy replaces the per-agent upload quotas and retention.
+func (s *Server) SetUploadPolicy(policy agentio.UploadPolicy) {
+	s.prompter.Uploads.SetPolicy(policy)
+}
+
+// SetFilePolicy replaces the size limits and deny globs for file browsing.
+func (s *Server) SetFilePolicy(policy agentio.FilePolicy) {
+	s.prompter.Files.SetPolicy(policy)
+}
+
+// FileHandler returns the HTTP handler for /files, guarded by the same
+// tokens as the WebSocket endpoint. It needs the view scope.
+func (s *Server) FileHandler() http.Handler {
+	return s.RequireGrant(wsbase.ScopeView, wsbase.FileHandler(s.prompter.Files))
+}
+
+// SetClipboardMirror controls whether OSC 52 clipboard writes from agents are
+// also copied to the clipboard of the machine running the adapter.
+func (s *Server) SetClipboardMirror(on bool) {
+	s.scannersMu.Lock()
+	defer s.scannersMu.Unlock()
+	switch {
+	case on && s.clipboard == nil:
+		s.clipboard = newClipboardMirror(agentio.CopyToLocalClipboard)
+		go s.clipboard.run()
+	case !on && s.clipboard != nil:
+		s.clipboard.close()
+		s.clipboard = nil
+	}
+}
+
+// observeOutput scans each chunk of an agent's pipe-pane output for clipboard,
+// notification and bell sequences and sends them as JSON events to the
+// clients subscribed to that agent's output. It runs once per chunk, however
+// many clients are subscribed.
+func (s *Server) observeOutput(agentName string, data []byte) {
+	s.scannersMu.Lock()
+	scanner, ok := s.scanners[agentName]
+	if !ok {
+		scanner = &agentio.TerminalEventScanner{}
+		s.scanners[agentName] = scanner
+	}
+	events := scanner.Scan(data)
+	mirror := s.clipboard
+	s.scannersMu.Unlock()
+
+	for _, event := range events {
+		if event.Type == agentio.TerminalClipboardSet && mirror != nil {
+			mirror.set(agentName, event.Text)
+		}
+		msg := MakeTerminalEvent(agentName, event)
+
+		s.mu.Lock()
+		for client := range s.clients {
+			client.mu.Lock()
+			_, subscribed := client.outputSubs[agentName]
+			client.mu.Unlock()
+
+			if subscribed {
+				client.SendText(msg)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// RunUploadCleanup removes expired uploads and abandoned chunked uploads
+// every interval. Blocks until Stop.
+func (s *Server) RunUploadCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.prompter.Uploads.Cleanup()
+			s.prompter.Chunks.Expire()
+		}
+	}
+}
+
+// BroadcastAgentEvent sends an agent lifecycle event to all clients subscribed
+// to agent lifecycle events, honoring each client's field filter.
+func (s *Server) BroadcastAgentEvent(event agents.RegistryEvent) {
+	msg := MakeAgentEvent(event)
+
+	if event.Type == "removed" {
+		s.scannersMu.Lock()
+		delete(s.scanners, event.Agent.Name)
+		s.scannersMu.Unlock()
+		s.control.forget(event.Agent.Name)
+		s.sizes.forget(event.Agent.Name)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for client := range s.clients {
 		client.mu.Lock()
-		subscribed := client.agentSub
+		subscribed := client.agentSub && wantsAgentEvent(client.agentFields, event) && client.grant.Sees(event.Agent)
 		client.mu.Unlock()
 
 		if subscribed {
@@ -85,6 +251,62 @@ func (s *Server) BroadcastToAgentSubscribers(msg []byte) {
 	}
 }
 
+// ForwardPromptQueueEvents pushes prompt queue changes to clients subscribed
+// to agent lifecycle events. Blocks until Stop.
+func (s *Server) ForwardPromptQueueEvents() {
+	id, events := s.queue.Subscribe()
+	defer s.queue.Unsubscribe(id)
+	for {
+		var event agentio.QueueEvent
+		select {
+		case <-s.stopCh:
+			return
+		case event = <-events:
+		}
+		msg := MakePromptQueueEvent(event)
+
+		s.mu.Lock()
+		for client := range s.clients {
+			client.mu.Lock()
+			subscribed := client.agentSub
+			client.mu.Unlock()
+
+			if subscribed && client.sees(event.Item.Agent) {
+				client.SendText(msg)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// ForwardCommandChanges tells clients subscribed to agent lifecycle events
+// when an agent's slash commands change on disk. Blocks until Stop.
+func (s *Server) ForwardCommandChanges() {
+	id, changes := s.commands.Subscribe()
+	defer s.commands.Unsubscribe(id)
+	for {
+		var name string
+		select {
+		case <-s.stopCh:
+			return
+		case name = <-changes:
+		}
+		msg := MakeCommandsChangedEvent(name)
+
+		s.mu.Lock()
+		for client := range s.clients {
+			client.mu.Lock()
+			subscribed := client.agentSub
+			client.mu.Unlock()
+
+			if subscribed && client.sees(name) {
+				client.SendText(msg)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
 // RemoveClient unsubscribes and removes a client from the server.
 func (s *Server) RemoveClient(client *Client) {
 	s.mu.Lock()
@@ -93,9 +315,22 @@ func (s *Server) RemoveClient(client *Client) {
 	s.mu.Unlock()
 
 	client.Close()
+	for _, agent := range s.sizes.clientAgents(client) {
+		s.dropSize(client, agent)
+	}
+	s.releaseControl(client, ControlDisconnected)
 	log.Printf("client disconnected (%d remaining)", count)
 }
 
+// Stop ends the event forwarders and upload cleanup, closes the command
+// catalog's file watcher and stops mirroring the clipboard. Call it once,
+// after CloseAll.
+func (s *Server) Stop() {
+	close(s.stopCh)
+	s.commands.Close()
+	s.SetClipboardMirror(false)
+}
+
 // CloseAll closes all connected clients.
 func (s *Server) CloseAll() {
 	s.mu.Lock()
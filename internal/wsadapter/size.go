@@ -0,0 +1,397 @@
+package wsadapter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Terminal size policies.
+const (
+	SizeSmallest = "smallest" // fit every web client: the smallest requested cols and rows (default)
+	SizeLargest  = "largest"  // the largest requested cols and rows
+	SizeDriver   = "driver"   // only the agent's driver (see Input control) sets the size
+	SizeFixed    = "fixed"    // "fixed" leaves the window alone; "fixed:COLSxROWS" holds it at that size
+)
+
+// sizePolicies lists the policies advertised in hello capabilities.
+var sizePolicies = []string{SizeSmallest, SizeLargest, SizeDriver, SizeFixed, SizeFixed + ":COLSxROWS"}
+
+// termSize is a terminal size in columns and rows.
+type termSize struct {
+	cols, rows int
+}
+
+func (t termSize) String() string {
+	return fmt.Sprintf("%dx%d", t.cols, t.rows)
+}
+
+// sizePolicy is a parsed size policy.
+type sizePolicy struct {
+	kind  string
+	fixed termSize // for fixed:COLSxROWS; zero = leave the window alone
+}
+
+func (p sizePolicy) String() string {
+	if p.kind == SizeFixed && p.fixed.cols > 0 {
+		return SizeFixed + ":" + p.fixed.String()
+	}
+	return p.kind
+}
+
+// parseSizePolicy parses a --size-policy value. Empty means smallest.
+func parseSizePolicy(s string) (sizePolicy, error) {
+	switch s {
+	case "", SizeSmallest:
+		return sizePolicy{kind: SizeSmallest}, nil
+	case SizeLargest, SizeDriver, SizeFixed:
+		return sizePolicy{kind: s}, nil
+	}
+	if rest, ok := strings.CutPrefix(s, SizeFixed+":"); ok {
+		var size termSize
+		if _, err := fmt.Sscanf(rest, "%dx%d", &size.cols, &size.rows); err != nil || size.cols < 2 || size.rows < 1 || rest != size.String() {
+			return sizePolicy{}, fmt.Errorf("size policy %q: want fixed:COLSxROWS", s)
+		}
+		return sizePolicy{kind: SizeFixed, fixed: size}, nil
+	}
+	return sizePolicy{}, fmt.Errorf("unknown size policy %q (use %s)", s, strings.Join(sizePolicies, ", "))
+}
+
+// target picks the window size for the clients' requests. ok is false when
+// the policy leaves the window as it is.
+func (p sizePolicy) target(requests map[*Client]termSize, driver *Client) (size termSize, reason string, ok bool) {
+	switch p.kind {
+	case SizeFixed:
+		if p.fixed.cols == 0 {
+			return termSize{}, "fixed policy leaves the window alone", false
+		}
+		return p.fixed, "fixed size", true
+	case SizeDriver:
+		if driver == nil {
+			return termSize{}, "no driver; window unchanged", false
+		}
+		size, ok := requests[driver]
+		if !ok {
+			return termSize{}, "driver has not sent a size; window unchanged", false
+		}
+		return size, "driver " + driver.remoteAddr, true
+	}
+	if len(requests) == 0 {
+		return termSize{}, "no sizes requested", false
+	}
+	first := true
+	for _, r := range requests {
+		if first {
+			size, first = r, false
+			continue
+		}
+		if p.kind == SizeLargest {
+			size.cols, size.rows = max(size.cols, r.cols), max(size.rows, r.rows)
+		} else {
+			size.cols, size.rows = min(size.cols, r.cols), min(size.rows, r.rows)
+		}
+	}
+	return size, fmt.Sprintf("%s of %d clients", p.kind, len(requests)), true
+}
+
+// SizeDecision reports the window size the adapter chose for an agent.
+type SizeDecision struct {
+	Policy   string `json:"policy"`
+	Cols     int    `json:"cols,omitempty"` // zero when the window size is unknown
+	Rows     int    `json:"rows,omitempty"`
+	Reason   string `json:"reason"`
+	Clients  int    `json:"clients"`            // web clients with a requested size
+	Restored bool   `json:"restored,omitempty"` // the window went back to its size before any web client resized it
+}
+
+// agentSizes is the size state of one agent. requests is guarded by the
+// arbiter's mu, the rest by the agent's lock.
+type agentSizes struct {
+	requests      map[*Client]termSize
+	original      termSize // window size before the first resize; zero if unknown
+	originalTried bool     // original was looked up; it is not retried on failure
+	applied       termSize // last size applied; zero until then
+}
+
+// sizeArbiter tracks each web client's requested terminal size per agent
+// and resizes the window according to the policy. When the last client with
+// a size leaves, the window is restored to its original size.
+//
+// tmux calls run under a per-agent lock, never under mu, so a slow resize of
+// one agent doesn't hold up the others.
+type sizeArbiter struct {
+	resize     func(agent string, size termSize) error
+	windowSize func(agent string) (termSize, error)
+	driver     func(agent string) *Client
+
+	mu     sync.Mutex
+	policy sizePolicy
+	agents map[string]*agentSizes
+	locks  map[string]*sync.Mutex // agent -> serializes its size changes
+}
+
+func newSizeArbiter(resize func(string, termSize) error, windowSize func(string) (termSize, error), driver func(string) *Client) *sizeArbiter {
+	return &sizeArbiter{
+		resize:     resize,
+		windowSize: windowSize,
+		driver:     driver,
+		policy:     sizePolicy{kind: SizeSmallest},
+		agents:     make(map[string]*agentSizes),
+		locks:      make(map[string]*sync.Mutex),
+	}
+}
+
+func (a *sizeArbiter) setPolicy(policy sizePolicy) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policy = policy
+}
+
+func (a *sizeArbiter) policyName() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.policy.String()
+}
+
+// lockAgent locks and returns the lock serializing size changes for agent.
+// The entry is removed once the agent has no sizes left, so a caller that
+// waited on a removed lock retries with the current one.
+func (a *sizeArbiter) lockAgent(agent string) *sync.Mutex {
+	for {
+		a.mu.Lock()
+		lock := a.locks[agent]
+		if lock == nil {
+			lock = &sync.Mutex{}
+			a.locks[agent] = lock
+		}
+		a.mu.Unlock()
+
+		lock.Lock()
+		a.mu.Lock()
+		current := a.locks[agent]
+		a.mu.Unlock()
+		if current == lock {
+			return lock
+		}
+		lock.Unlock()
+	}
+}
+
+// removeLock deletes agent's lock entry. The caller must hold that lock.
+func (a *sizeArbiter) removeLock(agent string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.locks, agent)
+}
+
+// request records c's size for agent and applies the policy. changed
+// reports whether the window was resized.
+func (a *sizeArbiter) request(agent string, c *Client, size termSize) (SizeDecision, bool, error) {
+	lock := a.lockAgent(agent)
+	defer lock.Unlock()
+
+	a.mu.Lock()
+	st, ok := a.agents[agent]
+	if !ok {
+		st = &agentSizes{requests: make(map[*Client]termSize)}
+		a.agents[agent] = st
+	}
+	st.requests[c] = size
+	a.mu.Unlock()
+	return a.apply(agent, st)
+}
+
+// refresh re-applies the policy, e.g. after the agent's driver changed.
+func (a *sizeArbiter) refresh(agent string) (SizeDecision, bool, error) {
+	lock := a.lockAgent(agent)
+	defer lock.Unlock()
+
+	a.mu.Lock()
+	st, ok := a.agents[agent]
+	a.mu.Unlock()
+	if !ok {
+		return SizeDecision{}, false, nil
+	}
+	return a.apply(agent, st)
+}
+
+// drop forgets c's size for agent. If no client has a size left, the
+// window is restored to its original size.
+func (a *sizeArbiter) drop(agent string, c *Client) (SizeDecision, bool, error) {
+	lock := a.lockAgent(agent)
+	defer lock.Unlock()
+
+	a.mu.Lock()
+	st, ok := a.agents[agent]
+	if !ok {
+		a.mu.Unlock()
+		return SizeDecision{}, false, nil
+	}
+	if _, had := st.requests[c]; !had {
+		a.mu.Unlock()
+		return SizeDecision{}, false, nil
+	}
+	delete(st.requests, c)
+	remaining := len(st.requests)
+	if remaining == 0 {
+		delete(a.agents, agent)
+	}
+	policy := a.policy.String()
+	a.mu.Unlock()
+
+	if remaining > 0 {
+		return a.apply(agent, st)
+	}
+	defer a.removeLock(agent)
+	d := SizeDecision{Policy: policy, Cols: st.original.cols, Rows: st.original.rows, Restored: true}
+	if st.original.cols == 0 {
+		d.Reason = "last web client left; original size unknown, window unchanged"
+		log.Printf("size(%s): %s", agent, d.Reason)
+		return d, false, nil
+	}
+	if st.applied == st.original {
+		d.Reason = "last web client left; window unchanged"
+		log.Printf("size(%s): %s", agent, d.Reason)
+		return d, false, nil
+	}
+	d.Reason = "last web client left; restored original size"
+	log.Printf("size(%s): %s %s", agent, d.Reason, st.original)
+	if err := a.resize(agent, st.original); err != nil {
+		return d, false, err
+	}
+	return d, true, nil
+}
+
+// clientAgents returns the agents c has a size for.
+func (a *sizeArbiter) clientAgents(c *Client) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var names []string
+	for agent, st := range a.agents {
+		if _, ok := st.requests[c]; ok {
+			names = append(names, agent)
+		}
+	}
+	return names
+}
+
+// forget drops the size state of a removed agent.
+func (a *sizeArbiter) forget(agent string) {
+	lock := a.lockAgent(agent)
+	defer lock.Unlock()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.agents, agent)
+	delete(a.locks, agent)
+}
+
+// apply picks the window size for st and resizes the window if it changed.
+// The caller must hold the agent's lock, and not mu.
+func (a *sizeArbiter) apply(agent string, st *agentSizes) (SizeDecision, bool, error) {
+	driver := a.driver(agent)
+	a.mu.Lock()
+	policy := a.policy
+	target, reason, ok := policy.target(st.requests, driver)
+	clients := len(st.requests)
+	a.mu.Unlock()
+
+	d := SizeDecision{Policy: policy.String(), Cols: st.applied.cols, Rows: st.applied.rows, Reason: reason, Clients: clients}
+	if !ok || target == st.applied {
+		return d, false, nil
+	}
+	if !st.originalTried {
+		st.originalTried = true
+		original, err := a.windowSize(agent)
+		if err != nil {
+			log.Printf("size(%s): original window size unknown, it will not be restored: %v", agent, err)
+		} else {
+			st.original = original
+		}
+	}
+	log.Printf("size(%s): %s (%s)", agent, target, reason)
+	if err := a.resize(agent, target); err != nil {
+		return d, false, err
+	}
+	st.applied = target
+	d.Cols, d.Rows = target.cols, target.rows
+	return d, true, nil
+}
+
+// SetSizePolicy selects how the window size of an agent is chosen from the
+// sizes its web clients request: "smallest", "largest", "driver", "fixed" or
+// "fixed:COLSxROWS".
+func (s *Server) SetSizePolicy(policy string) error {
+	p, err := parseSizePolicy(policy)
+	if err != nil {
+		return err
+	}
+	s.sizes.setPolicy(p)
+	return nil
+}
+
+// requestSize handles a 0x03 resize from c. Viewers hear about a resize;
+// a request the policy didn't act on is reported back to c alone.
+func (s *Server) requestSize(c *Client, agent string, size termSize) error {
+	d, changed, err := s.sizes.request(agent, c, size)
+	if err != nil {
+		return err
+	}
+	if changed {
+		s.broadcastSize(agent, d)
+	} else {
+		c.SendText(MakeSizeEvent(agent, d))
+	}
+	return nil
+}
+
+// refreshSize re-applies the size policy for agent.
+func (s *Server) refreshSize(agent string) {
+	d, changed, err := s.sizes.refresh(agent)
+	if err != nil {
+		log.Printf("size(%s): %v", agent, err)
+		return
+	}
+	if changed {
+		s.broadcastSize(agent, d)
+	}
+}
+
+// dropSize forgets c's size for agent, restoring the window when it was
+// the last web client with one.
+func (s *Server) dropSize(c *Client, agent string) {
+	d, changed, err := s.sizes.drop(agent, c)
+	if err != nil {
+		log.Printf("size(%s): %v", agent, err)
+		return
+	}
+	if changed {
+		s.broadcastSize(agent, d)
+	}
+}
+
+// broadcastSize sends a terminal-size event to every client subscribed to
+// the agent's output.
+func (s *Server) broadcastSize(agent string, d SizeDecision) {
+	msg := MakeSizeEvent(agent, d)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		client.mu.Lock()
+		_, viewing := client.outputSubs[agent]
+		client.mu.Unlock()
+
+		if viewing {
+			client.SendText(msg)
+		}
+	}
+}
+
+// MakeSizeEvent creates a JSON event message for a window size decision.
+func MakeSizeEvent(agentName string, d SizeDecision) []byte {
+	data, _ := json.Marshal(Response{Type: "terminal-size", Name: agentName, Size: &d})
+	return data
+}
@@ -0,0 +1,283 @@
+package wsadapter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
+)
+
+// fakeWindow records resizes applied by a sizeArbiter.
+type fakeWindow struct {
+	size    termSize
+	resizes []termSize
+	driver  *Client
+}
+
+func (w *fakeWindow) arbiter() *sizeArbiter {
+	return newSizeArbiter(
+		func(_ string, size termSize) error {
+			w.size = size
+			w.resizes = append(w.resizes, size)
+			return nil
+		},
+		func(string) (termSize, error) { return w.size, nil },
+		func(string) *Client { return w.driver },
+	)
+}
+
+func TestParseSizePolicy(t *testing.T) {
+	for in, want := range map[string]string{
+		"":              SizeSmallest,
+		"largest":       SizeLargest,
+		"driver":        SizeDriver,
+		"fixed":         SizeFixed,
+		"fixed:120x40":  "fixed:120x40",
+		"fixed:120x40x": "",
+		"fixed:1x40":    "",
+		"fixed:":        "",
+		"biggest":       "",
+	} {
+		p, err := parseSizePolicy(in)
+		if want == "" {
+			if err == nil {
+				t.Errorf("parseSizePolicy(%q) = %v, want error", in, p)
+			}
+			continue
+		}
+		if err != nil || p.String() != want {
+			t.Errorf("parseSizePolicy(%q) = %v, %v; want %s", in, p, err, want)
+		}
+	}
+}
+
+func TestSizeArbiterSmallestRestoresOriginal(t *testing.T) {
+	w := &fakeWindow{size: termSize{200, 50}}
+	a := w.arbiter()
+	alice, bob := &Client{remoteAddr: "alice"}, &Client{remoteAddr: "bob"}
+
+	if d, changed, err := a.request("hq-mayor", alice, termSize{120, 40}); err != nil || !changed || d.Cols != 120 || d.Rows != 40 {
+		t.Fatalf("first request = %+v, %v, %v", d, changed, err)
+	}
+	if d, changed, _ := a.request("hq-mayor", bob, termSize{100, 45}); !changed || d.Cols != 100 || d.Rows != 40 || d.Clients != 2 {
+		t.Fatalf("second request = %+v, %v; want 100x40 for 2 clients", d, changed)
+	}
+	// Repeating a size that doesn't change the result leaves the window alone.
+	if _, changed, _ := a.request("hq-mayor", bob, termSize{100, 45}); changed {
+		t.Fatal("repeated request resized the window")
+	}
+	if d, changed, _ := a.drop("hq-mayor", bob); !changed || d.Cols != 120 || d.Restored {
+		t.Fatalf("drop(bob) = %+v, %v; want 120x40", d, changed)
+	}
+	if d, changed, _ := a.drop("hq-mayor", alice); !changed || !d.Restored || d.Cols != 200 || d.Rows != 50 {
+		t.Fatalf("drop(alice) = %+v, %v; want restored 200x50", d, changed)
+	}
+	if len(w.resizes) != 4 || w.size != (termSize{200, 50}) {
+		t.Fatalf("resizes = %v", w.resizes)
+	}
+	if _, changed, _ := a.drop("hq-mayor", alice); changed {
+		t.Fatal("second drop changed the window")
+	}
+}
+
+func TestSizeArbiterPolicies(t *testing.T) {
+	alice, bob := &Client{remoteAddr: "alice"}, &Client{remoteAddr: "bob"}
+
+	w := &fakeWindow{size: termSize{80, 24}}
+	a := w.arbiter()
+	a.setPolicy(sizePolicy{kind: SizeLargest})
+	a.request("hq-mayor", alice, termSize{120, 30})
+	if d, _, _ := a.request("hq-mayor", bob, termSize{100, 45}); d.Cols != 120 || d.Rows != 45 {
+		t.Fatalf("largest = %+v, want 120x45", d)
+	}
+
+	w = &fakeWindow{size: termSize{80, 24}}
+	a = w.arbiter()
+	a.setPolicy(sizePolicy{kind: SizeDriver})
+	if d, changed, _ := a.request("hq-mayor", alice, termSize{120, 30}); changed || d.Reason == "" {
+		t.Fatalf("driver policy without driver = %+v, %v", d, changed)
+	}
+	w.driver = bob
+	a.request("hq-mayor", bob, termSize{100, 45})
+	w.driver = alice
+	if d, changed, _ := a.refresh("hq-mayor"); !changed || d.Cols != 120 {
+		t.Fatalf("refresh after driver change = %+v, %v; want 120x30", d, changed)
+	}
+
+	w = &fakeWindow{size: termSize{80, 24}}
+	a = w.arbiter()
+	a.setPolicy(sizePolicy{kind: SizeFixed})
+	a.request("hq-mayor", alice, termSize{120, 30})
+	if len(w.resizes) != 0 {
+		t.Fatalf("fixed policy resized the window: %v", w.resizes)
+	}
+	if _, changed, _ := a.drop("hq-mayor", alice); changed {
+		t.Fatal("fixed policy restored a window it never resized")
+	}
+	a.setPolicy(sizePolicy{kind: SizeFixed, fixed: termSize{132, 43}})
+	if d, _, _ := a.request("hq-mayor", alice, termSize{120, 30}); d.Cols != 132 || d.Rows != 43 {
+		t.Fatalf("fixed:132x43 = %+v", d)
+	}
+}
+
+func TestSizeArbiterResizeError(t *testing.T) {
+	a := newSizeArbiter(
+		func(string, termSize) error { return errors.New("no such session") },
+		func(string) (termSize, error) { return termSize{}, errors.New("no such session") },
+		func(string) *Client { return nil },
+	)
+	c := &Client{}
+	if _, _, err := a.request("hq-mayor", c, termSize{80, 24}); err == nil {
+		t.Fatal("request() = nil error")
+	}
+	// The failed resize wasn't applied, so there is nothing to restore.
+	if _, changed, err := a.drop("hq-mayor", c); changed || err != nil {
+		t.Fatalf("drop() = %v, %v", changed, err)
+	}
+}
+
+func TestSizeArbiterUnknownOriginal(t *testing.T) {
+	var lookups int
+	var resizes []termSize
+	a := newSizeArbiter(
+		func(_ string, size termSize) error { resizes = append(resizes, size); return nil },
+		func(string) (termSize, error) { lookups++; return termSize{}, errors.New("display-message failed") },
+		func(string) *Client { return nil },
+	)
+	alice, bob := &Client{remoteAddr: "alice"}, &Client{remoteAddr: "bob"}
+
+	a.request("hq-mayor", alice, termSize{120, 40})
+	a.request("hq-mayor", bob, termSize{100, 40})
+	if lookups != 1 {
+		t.Fatalf("window size looked up %d times, want once", lookups)
+	}
+	a.drop("hq-mayor", bob)
+	if d, changed, err := a.drop("hq-mayor", alice); changed || err != nil || d.Cols != 0 {
+		t.Fatalf("drop() = %+v, %v, %v; want the window left alone", d, changed, err)
+	}
+	if len(resizes) != 3 {
+		t.Fatalf("resizes = %v; want no restore", resizes)
+	}
+}
+
+func TestSizeArbiterResizesAgentsIndependently(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	a := newSizeArbiter(
+		func(agent string, _ termSize) error {
+			if agent == "hq-slow" {
+				close(entered)
+				<-release
+			}
+			return nil
+		},
+		func(string) (termSize, error) { return termSize{80, 24}, nil },
+		func(string) *Client { return nil },
+	)
+	c := &Client{}
+	slow := make(chan error, 1)
+	go func() {
+		_, _, err := a.request("hq-slow", c, termSize{120, 40})
+		slow <- err
+	}()
+	<-entered
+
+	done := make(chan struct{})
+	go func() {
+		a.request("hq-fast", c, termSize{120, 40})
+		a.policyName()
+		a.clientAgents(c)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a slow resize of one agent blocked another")
+	}
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSizeArbiterForgetWaitsAndDropsLock(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	a := newSizeArbiter(
+		func(_ string, size termSize) error {
+			if size.cols == 120 {
+				close(entered)
+				<-release
+			}
+			return nil
+		},
+		func(string) (termSize, error) { return termSize{80, 24}, nil },
+		func(string) *Client { return nil },
+	)
+	c := &Client{}
+	go a.request("hq-mayor", c, termSize{120, 40})
+	<-entered
+
+	forgotten := make(chan struct{})
+	go func() {
+		a.forget("hq-mayor")
+		close(forgotten)
+	}()
+	select {
+	case <-forgotten:
+		t.Fatal("forget ran during a resize")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-forgotten
+
+	if got := a.clientAgents(c); len(got) != 0 {
+		t.Fatalf("agents after forget = %v", got)
+	}
+	if len(a.locks) != 0 {
+		t.Fatalf("locks after forget = %d, want 0", len(a.locks))
+	}
+
+	// A later client starts afresh, and its lock goes once it leaves.
+	if _, _, err := a.request("hq-mayor", c, termSize{100, 30}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.drop("hq-mayor", c); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.locks) != 0 {
+		t.Fatalf("locks after drop = %d, want 0", len(a.locks))
+	}
+}
+
+func TestSizeChangesReachViewers(t *testing.T) {
+	w := &fakeWindow{size: termSize{200, 50}}
+	requester := newTestClient(t)
+	s := requester.server
+	s.sizes = w.arbiter()
+	requester.outputSubs["hq-mayor"] = outputSub{}
+	viewer := &Client{server: s, send: make(chan outMsg, 8), outputSubs: map[string]outputSub{"hq-mayor": {}}, grant: wsbase.FullAccess}
+	s.clients[requester] = struct{}{}
+	s.clients[viewer] = struct{}{}
+
+	handleBinaryMessage(requester, []byte("\x03hq-mayor\x00120:40"))
+	for _, c := range []*Client{requester, viewer} {
+		if resp := readResponse(t, c); resp.Type != "terminal-size" || resp.Size == nil || resp.Size.Cols != 120 || resp.Size.Policy != SizeSmallest {
+			t.Fatalf("resize event = %+v", resp)
+		}
+	}
+
+	// A request that leaves the window as is is answered to the sender only.
+	handleBinaryMessage(viewer, []byte("\x03hq-mayor\x00150:45"))
+	if resp := readResponse(t, viewer); resp.Size == nil || resp.Size.Cols != 120 || resp.Size.Clients != 2 {
+		t.Fatalf("ignored resize event = %+v", resp)
+	}
+	if len(requester.send) != 0 {
+		t.Fatal("unchanged size was broadcast")
+	}
+
+	s.dropSize(viewer, "hq-mayor")
+	s.dropSize(requester, "hq-mayor")
+	if resp := readResponse(t, requester); resp.Size == nil || !resp.Size.Restored || resp.Size.Cols != 200 {
+		t.Fatalf("restore event = %+v", resp)
+	}
+}
@@ -0,0 +1,161 @@
+package wsadapter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
+)
+
+// Snapshot modes accepted by subscribe-output.
+const (
+	SnapshotRedraw            = "redraw"             // resize dance, the app repaints itself (default)
+	SnapshotCaptureVisible    = "capture-visible"    // capture-pane of the visible screen, no resize
+	SnapshotCaptureScrollback = "capture-scrollback" // "capture-scrollback:N" adds N lines of history
+	SnapshotNone              = "none"               // stream only new output
+)
+
+// MaxSnapshotScrollback bounds N in "capture-scrollback:N".
+const MaxSnapshotScrollback = 50000
+
+// Redraw timing: how long a redraw waits for other subscribers to join it,
+// and how long the app gets to finish repainting before the stream starts.
+const (
+	redrawGather = 50 * time.Millisecond
+	redrawSettle = 200 * time.Millisecond
+)
+
+// snapshotModes lists the modes advertised in hello capabilities.
+var snapshotModes = []string{
+	SnapshotRedraw, SnapshotCaptureVisible, SnapshotCaptureScrollback + ":N", SnapshotNone,
+}
+
+// snapshotMode is a parsed subscribe-output snapshot option.
+type snapshotMode struct {
+	kind  string
+	lines int // scrollback lines for capture-scrollback
+}
+
+// parseSnapshotMode parses the snapshot option. Empty means redraw.
+func parseSnapshotMode(s string) (snapshotMode, *wsbase.Error) {
+	switch s {
+	case "", SnapshotRedraw:
+		return snapshotMode{kind: SnapshotRedraw}, nil
+	case SnapshotCaptureVisible, SnapshotNone:
+		return snapshotMode{kind: s}, nil
+	}
+	if rest, ok := strings.CutPrefix(s, SnapshotCaptureScrollback+":"); ok {
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 || n > MaxSnapshotScrollback {
+			return snapshotMode{}, wsbase.Errorf(wsbase.CodeInvalidArgument,
+				"snapshot %q: line count must be 0-%d", s, MaxSnapshotScrollback).
+				WithDetail("field", "snapshot")
+		}
+		return snapshotMode{kind: SnapshotCaptureScrollback, lines: n}, nil
+	}
+	return snapshotMode{}, wsbase.Errorf(wsbase.CodeInvalidArgument,
+		"unknown snapshot mode %q (use %s)", s, strings.Join(snapshotModes, ", ")).
+		WithDetail("field", "snapshot")
+}
+
+// paneCursor is the cursor position (0-based) of the captured pane and the
+// pane's height, which locates the visible screen at the end of a capture.
+type paneCursor struct {
+	x, y, height int
+}
+
+// snapshotFrame turns a capture-pane dump into a terminal snapshot payload:
+// clear the screen, home the cursor, then replay the captured lines. With a
+// cursor, it then moves to where the pane's cursor is. Trailing blank lines
+// are dropped, but never the cursor's own line.
+func snapshotFrame(capture string, cursor *paneCursor) []byte {
+	lines := strings.Split(strings.TrimSuffix(capture, "\n"), "\n")
+	keep := len(lines)
+	for keep > 0 && lines[keep-1] == "" {
+		keep--
+	}
+	var top, cursorLine int
+	if cursor != nil {
+		top = max(len(lines)-cursor.height, 0) // first line of the visible screen
+		cursorLine = min(top+cursor.y, len(lines)-1)
+		keep = max(keep, cursorLine+1)
+	}
+	frame := "\x1b[2J\x1b[H" + strings.Join(lines[:keep], "\r\n")
+	switch {
+	case cursor == nil:
+	case top == 0:
+		// The screen was replayed from the home position: CUP is exact.
+		frame += fmt.Sprintf("\x1b[%d;%dH", cursorLine+1, cursor.x+1)
+	default:
+		// Scrollback pushed the screen up by an amount that depends on the
+		// client's height, so move up from the last line written instead.
+		if up := keep - 1 - cursorLine; up > 0 {
+			frame += fmt.Sprintf("\x1b[%dA", up)
+		}
+		frame += fmt.Sprintf("\x1b[%dG", cursor.x+1)
+	}
+	return []byte(frame)
+}
+
+// redrawCoalescer merges concurrent redraw requests for the same agent.
+// Callers arriving within the gather window share one redraw; rounds for
+// one agent never overlap, so a caller that arrives mid-redraw waits for
+// the next round rather than joining a repaint it has partially missed.
+type redrawCoalescer struct {
+	redraw func(agent string)
+	gather time.Duration // how long a round waits for more callers
+	settle time.Duration // how long the app gets to repaint
+
+	mu      sync.Mutex
+	pending map[string]*redrawRound // agent -> round not yet started
+	running map[string]*sync.Mutex  // agent -> serializes rounds
+}
+
+type redrawRound struct {
+	done chan struct{}
+}
+
+func newRedrawCoalescer(redraw func(agent string), gather, settle time.Duration) *redrawCoalescer {
+	return &redrawCoalescer{
+		redraw:  redraw,
+		gather:  gather,
+		settle:  settle,
+		pending: make(map[string]*redrawRound),
+		running: make(map[string]*sync.Mutex),
+	}
+}
+
+// Redraw forces a repaint of agent and blocks until it has settled.
+func (r *redrawCoalescer) Redraw(agent string) {
+	r.mu.Lock()
+	round, ok := r.pending[agent]
+	if !ok {
+		round = &redrawRound{done: make(chan struct{})}
+		r.pending[agent] = round
+		lock := r.running[agent]
+		if lock == nil {
+			lock = &sync.Mutex{}
+			r.running[agent] = lock
+		}
+		go r.run(agent, round, lock)
+	}
+	r.mu.Unlock()
+	<-round.done
+}
+
+func (r *redrawCoalescer) run(agent string, round *redrawRound, lock *sync.Mutex) {
+	lock.Lock()
+	defer lock.Unlock()
+	time.Sleep(r.gather)
+
+	r.mu.Lock()
+	delete(r.pending, agent)
+	r.mu.Unlock()
+
+	r.redraw(agent)
+	time.Sleep(r.settle)
+	close(round.done)
+}
@@ -0,0 +1,108 @@
+package wsadapter
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
+)
+
+func TestParseSnapshotMode(t *testing.T) {
+	tests := []struct {
+		in    string
+		kind  string
+		lines int
+	}{
+		{"", SnapshotRedraw, 0},
+		{"redraw", SnapshotRedraw, 0},
+		{"capture-visible", SnapshotCaptureVisible, 0},
+		{"capture-scrollback:500", SnapshotCaptureScrollback, 500},
+		{"capture-scrollback:0", SnapshotCaptureScrollback, 0},
+		{"none", SnapshotNone, 0},
+	}
+	for _, tt := range tests {
+		mode, err := parseSnapshotMode(tt.in)
+		if err != nil {
+			t.Fatalf("parseSnapshotMode(%q) error = %v", tt.in, err)
+		}
+		if mode.kind != tt.kind || mode.lines != tt.lines {
+			t.Fatalf("parseSnapshotMode(%q) = %+v, want %s/%d", tt.in, mode, tt.kind, tt.lines)
+		}
+	}
+
+	for _, bad := range []string{"capture", "capture-scrollback", "capture-scrollback:", "capture-scrollback:-1", "capture-scrollback:x", "capture-scrollback:999999"} {
+		if _, err := parseSnapshotMode(bad); err == nil || err.Code != wsbase.CodeInvalidArgument {
+			t.Fatalf("parseSnapshotMode(%q) error = %v, want INVALID_ARGUMENT", bad, err)
+		}
+	}
+}
+
+func TestSnapshotFrame(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		capture string
+		cursor  *paneCursor
+		want    string
+	}{
+		{"no cursor", "one\ntwo\n\n", nil, "one\r\ntwo"},
+		{"visible", "one\ntwo\n\n", &paneCursor{x: 3, y: 1, height: 3}, "one\r\ntwo\x1b[2;4H"},
+		{"cursor on a blank line", "$ ls\n\n\n\n", &paneCursor{x: 0, y: 2, height: 4}, "$ ls\r\n\r\n\x1b[3;1H"},
+		{"scrollback", "old\nolder\n$ ls\nfile\n\n", &paneCursor{x: 2, y: 0, height: 3}, "old\r\nolder\r\n$ ls\r\nfile\x1b[1A\x1b[3G"},
+	} {
+		got := string(snapshotFrame(tc.capture, tc.cursor))
+		if want := "\x1b[2J\x1b[H" + tc.want; got != want {
+			t.Errorf("%s: snapshotFrame() = %q, want %q", tc.name, got, want)
+		}
+	}
+}
+
+func TestRedrawCoalescerMergesConcurrentRequests(t *testing.T) {
+	var calls atomic.Int32
+	r := newRedrawCoalescer(func(agent string) { calls.Add(1) }, 20*time.Millisecond, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Redraw("hq-mayor")
+		}()
+	}
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("redraw calls = %d, want 1", got)
+	}
+
+	// A later request starts a fresh round.
+	r.Redraw("hq-mayor")
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("redraw calls = %d, want 2", got)
+	}
+}
+
+func TestRedrawCoalescerSerializesRounds(t *testing.T) {
+	var active, overlaps atomic.Int32
+	r := newRedrawCoalescer(func(agent string) {
+		if active.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(10 * time.Millisecond)
+		active.Add(-1)
+	}, time.Millisecond, time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Redraw("hq-mayor")
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+	if overlaps.Load() != 0 {
+		t.Fatal("redraw rounds for one agent overlapped")
+	}
+}
@@ -6,23 +6,20 @@ import (
 	"strings"
 )
 
-// IsAuthorizedRequest checks if the request contains a valid auth token.
-// If expectedToken is empty, all requests are authorized.
-func IsAuthorizedRequest(expectedToken string, r *http.Request) bool {
-	token := strings.TrimSpace(expectedToken)
-	if token == "" {
-		return true
-	}
-
+// requestTokens returns the tokens a request presents: the Bearer token
+// first, then ?token=.
+func requestTokens(r *http.Request) []string {
+	var tokens []string
 	authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
 	if bearerToken, ok := strings.CutPrefix(authHeader, "Bearer "); ok {
-		if TokensEqual(token, strings.TrimSpace(bearerToken)) {
-			return true
+		if t := strings.TrimSpace(bearerToken); t != "" {
+			tokens = append(tokens, t)
 		}
 	}
-
-	queryToken := strings.TrimSpace(r.URL.Query().Get("token"))
-	return TokensEqual(token, queryToken)
+	if t := strings.TrimSpace(r.URL.Query().Get("token")); t != "" {
+		tokens = append(tokens, t)
+	}
+	return tokens
 }
 
 // TokensEqual performs constant-time comparison of two tokens.
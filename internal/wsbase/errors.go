@@ -0,0 +1,147 @@
+package wsbase
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
+	"github.com/gastownhall/tmux-adapter/internal/tmux"
+)
+
+// ErrorCode is a stable, machine-readable error code shared by both
+// WebSocket APIs. Clients should switch on the code, not the message.
+type ErrorCode string
+
+const (
+	CodeAgentNotFound     ErrorCode = "AGENT_NOT_FOUND"
+	CodeInvalidArgument   ErrorCode = "INVALID_ARGUMENT"
+	CodeTmuxUnavailable   ErrorCode = "TMUX_UNAVAILABLE"
+	CodeRateLimited       ErrorCode = "RATE_LIMITED"
+	CodePayloadTooLarge   ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeNotFound          ErrorCode = "NOT_FOUND"         // uploads, prompts, conversations, files
+	CodePermissionDenied  ErrorCode = "PERMISSION_DENIED" // denied paths, refused uploads
+	CodeUnsupported       ErrorCode = "UNSUPPORTED"       // unknown message types, protocol versions
+	CodeHandshakeRequired ErrorCode = "HANDSHAKE_REQUIRED"
+	CodeCancelled         ErrorCode = "CANCELLED"       // a queued prompt was cancelled
+	CodeDeliveryFailed    ErrorCode = "DELIVERY_FAILED" // the agent did not accept a confirmed prompt
+	CodeNotDriver         ErrorCode = "NOT_DRIVER"      // another client controls the agent's input
+	CodeInternal          ErrorCode = "INTERNAL"
+)
+
+// Retryable reports whether the same request may succeed if sent again later.
+func (c ErrorCode) Retryable() bool {
+	return c == CodeTmuxUnavailable || c == CodeRateLimited
+}
+
+// HTTPStatus maps the code to an HTTP status for the HTTP endpoints.
+func (c ErrorCode) HTTPStatus() int {
+	switch c {
+	case CodeAgentNotFound, CodeNotFound:
+		return http.StatusNotFound
+	case CodeInvalidArgument, CodeUnsupported, CodeHandshakeRequired:
+		return http.StatusBadRequest
+	case CodeTmuxUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeRateLimited:
+		return http.StatusTooManyRequests
+	case CodePayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodePermissionDenied:
+		return http.StatusForbidden
+	case CodeNotDriver:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// FrameRef identifies the binary frame an error was caused by. Seq counts
+// binary frames received on the connection, starting at 1, so a client can
+// match it against the frames it sent.
+type FrameRef struct {
+	Type  string `json:"type"` // "0x03"
+	Agent string `json:"agent,omitempty"`
+	Seq   uint64 `json:"seq"`
+}
+
+// Error is the structured error sent to WebSocket clients as "errorInfo".
+// Message matches the plain "error" string of the same response.
+type Error struct {
+	Code      ErrorCode      `json:"code"`
+	Message   string         `json:"message"`
+	Retryable bool           `json:"retryable"`
+	Details   map[string]any `json:"details,omitempty"`
+	Frame     *FrameRef      `json:"frame,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// NewError creates an error with the code's default retryability.
+func NewError(code ErrorCode, msg string) *Error {
+	return &Error{Code: code, Message: msg, Retryable: code.Retryable()}
+}
+
+// Errorf creates an error with a formatted message.
+func Errorf(code ErrorCode, format string, args ...any) *Error {
+	return NewError(code, fmt.Sprintf(format, args...))
+}
+
+// MissingField reports a required request field that was not set.
+func MissingField(field string) *Error {
+	return Errorf(CodeInvalidArgument, "%s field required", field).WithDetail("field", field)
+}
+
+// AgentNotFound reports an unknown agent name.
+func AgentNotFound(agent string) *Error {
+	return NewError(CodeAgentNotFound, "agent not found").WithDetail("agent", agent)
+}
+
+// WithDetail returns a copy of e with a detail added.
+func (e *Error) WithDetail(key string, value any) *Error {
+	c := *e
+	c.Details = make(map[string]any, len(e.Details)+1)
+	for k, v := range e.Details {
+		c.Details[k] = v
+	}
+	c.Details[key] = value
+	return &c
+}
+
+// WithFrame returns a copy of e correlated to a binary frame.
+func (e *Error) WithFrame(frameType byte, agent string, seq uint64) *Error {
+	c := *e
+	c.Frame = &FrameRef{Type: fmt.Sprintf("0x%02x", frameType), Agent: agent, Seq: seq}
+	return &c
+}
+
+// ErrorFrom classifies err by the sentinel errors it wraps. Errors that match
+// none of them are reported as INTERNAL.
+func ErrorFrom(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	code := CodeInternal
+	switch {
+	case errors.Is(err, agentio.ErrAgentNotFound):
+		code = CodeAgentNotFound
+	case errors.Is(err, tmux.ErrUnavailable):
+		code = CodeTmuxUnavailable
+	case errors.Is(err, agentio.ErrQueueFull):
+		code = CodeRateLimited
+	case errors.Is(err, agentio.ErrTooLarge), errors.Is(err, agentio.ErrFileTooLarge):
+		code = CodePayloadTooLarge
+	case errors.Is(err, agentio.ErrFileDenied), errors.Is(err, agentio.ErrUploadRefused):
+		code = CodePermissionDenied
+	case errors.Is(err, agentio.ErrUploadNotFound), errors.Is(err, agentio.ErrChunkedUploadNotFound),
+		errors.Is(err, agentio.ErrPromptNotFound), errors.Is(err, os.ErrNotExist):
+		code = CodeNotFound
+	case errors.Is(err, agentio.ErrDeliveryFailed):
+		code = CodeDeliveryFailed
+	case errors.Is(err, agentio.ErrInvalidArgument):
+		code = CodeInvalidArgument
+	}
+	return NewError(code, err.Error())
+}
@@ -0,0 +1,57 @@
+package wsbase
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
+	"github.com/gastownhall/tmux-adapter/internal/tmux"
+)
+
+func TestErrorFromClassifiesSentinels(t *testing.T) {
+	tests := []struct {
+		err       error
+		code      ErrorCode
+		retryable bool
+	}{
+		{fmt.Errorf("%w: hq-mayor", agentio.ErrAgentNotFound), CodeAgentNotFound, false},
+		{fmt.Errorf("resize hq-mayor: %w", tmux.ErrUnavailable), CodeTmuxUnavailable, true},
+		{fmt.Errorf("enqueue: %w", agentio.ErrQueueFull), CodeRateLimited, true},
+		{fmt.Errorf("%w: 9 bytes", agentio.ErrFileTooLarge), CodePayloadTooLarge, false},
+		{agentio.ErrUploadRefused, CodePermissionDenied, false},
+		{os.ErrNotExist, CodeNotFound, false},
+		{fmt.Errorf("keys[0]: %w", agentio.ErrInvalidArgument), CodeInvalidArgument, false},
+		{errors.New("disk on fire"), CodeInternal, false},
+		{NewError(CodeUnsupported, "nope"), CodeUnsupported, false},
+	}
+	for _, tt := range tests {
+		got := ErrorFrom(tt.err)
+		if got.Code != tt.code || got.Retryable != tt.retryable || got.Message != tt.err.Error() {
+			t.Errorf("ErrorFrom(%q) = %+v, want code %s retryable %v", tt.err, got, tt.code, tt.retryable)
+		}
+	}
+}
+
+func TestErrorWithDetailCopies(t *testing.T) {
+	base := MissingField("agent")
+	withFrame := base.WithDetail("hint", "set agent").WithFrame(0x03, "hq-mayor", 7)
+
+	if base.Details["field"] != "agent" || len(base.Details) != 1 || base.Frame != nil {
+		t.Fatalf("base error modified: %+v", base)
+	}
+	if withFrame.Details["hint"] != "set agent" || withFrame.Frame.Type != "0x03" || withFrame.Frame.Seq != 7 {
+		t.Fatalf("derived error = %+v", withFrame)
+	}
+}
+
+func TestErrorCodeHTTPStatus(t *testing.T) {
+	if got := CodePermissionDenied.HTTPStatus(); got != http.StatusForbidden {
+		t.Fatalf("PERMISSION_DENIED status = %d", got)
+	}
+	if got := CodeTmuxUnavailable.HTTPStatus(); got != http.StatusServiceUnavailable {
+		t.Fatalf("TMUX_UNAVAILABLE status = %d", got)
+	}
+}
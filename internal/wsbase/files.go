@@ -0,0 +1,83 @@
+package wsbase
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
+)
+
+// FileHandler serves read-only access to agent workDirs:
+//
+//	GET /files?agent=NAME&path=REL
+//
+// A directory returns a JSON listing; a file is sent as a download.
+// Wrap it in RequireGrant with ScopeView to guard it like /ws.
+func FileHandler(files *agentio.FileBrowser) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		agent := r.URL.Query().Get("agent")
+		if agent == "" {
+			writeHTTPError(w, NewError(CodeInvalidArgument, "agent parameter required"))
+			return
+		}
+		rel := r.URL.Query().Get("path")
+
+		entry, err := files.Stat(agent, rel)
+		if err != nil {
+			writeHTTPError(w, ErrorFrom(err))
+			return
+		}
+
+		if entry.Dir {
+			entries, truncated, err := files.List(agent, rel)
+			if err != nil {
+				writeHTTPError(w, ErrorFrom(err))
+				return
+			}
+			body, err := json.Marshal(map[string]any{
+				"ok":        true,
+				"name":      agent,
+				"entry":     entry,
+				"files":     entries,
+				"truncated": truncated,
+			})
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			if _, err := w.Write(body); err != nil {
+				log.Printf("write file listing: %v", err)
+			}
+			return
+		}
+
+		f, entry, err := files.Open(agent, rel)
+		if err != nil {
+			writeHTTPError(w, ErrorFrom(err))
+			return
+		}
+		defer func() { _ = f.Close() }()
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": entry.Name}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "no-store")
+		http.ServeContent(w, r, entry.Name, entry.ModTime, f)
+	})
+}
+
+// writeHTTPError writes e as JSON with the HTTP status for its code.
+func writeHTTPError(w http.ResponseWriter, e *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Code.HTTPStatus())
+	body, _ := json.Marshal(map[string]any{"ok": false, "error": e.Message, "errorInfo": e})
+	if _, err := w.Write(body); err != nil {
+		log.Printf("write file error: %v", err)
+	}
+}
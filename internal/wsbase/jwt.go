@@ -0,0 +1,501 @@
+package wsbase
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJWTClockSkew is the leeway applied to exp, nbf and iat.
+const DefaultJWTClockSkew = time.Minute
+
+// jwtReloadInterval bounds how often the key file is checked for changes.
+const jwtReloadInterval = 5 * time.Second
+
+// JWTConfig configures verification of signed bearer tokens.
+type JWTConfig struct {
+	KeyFile    string        // JWKS document or PEM public keys/certificates
+	Issuer     string        // required iss; empty = any
+	Audience   string        // required aud entry; empty = any
+	ClockSkew  time.Duration // leeway for exp, nbf and iat; zero = none
+	ScopeClaim string        // claim holding scopes; default "scope"
+	AgentClaim string        // claim holding agent selectors; default "agents"
+}
+
+// JWTVerifier verifies RS*, PS*, ES* and EdDSA tokens against keys read from
+// a local file. The file is re-read when its modification time changes, so
+// keys can be rotated without a restart; a file that fails to load leaves
+// the previous keys in place.
+type JWTVerifier struct {
+	cfg JWTConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	keys      []jwtKey
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+type jwtKey struct {
+	kid string
+	alg string // from the JWKS entry; empty = any compatible alg
+	key crypto.PublicKey
+}
+
+// jwtClaims are the registered claims the verifier checks.
+type jwtClaims struct {
+	Issuer    string      `json:"iss"`
+	Subject   string      `json:"sub"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *float64    `json:"exp"`
+	NotBefore *float64    `json:"nbf"`
+	IssuedAt  *float64    `json:"iat"`
+}
+
+// jwtAudience accepts aud as a string or an array of strings.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = jwtAudience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("aud must be a string or array of strings")
+	}
+	*a = many
+	return nil
+}
+
+// NewJWTVerifier loads cfg.KeyFile and returns a verifier.
+func NewJWTVerifier(cfg JWTConfig) (*JWTVerifier, error) {
+	if cfg.KeyFile == "" {
+		return nil, errors.New("jwt: key file required")
+	}
+	if cfg.ClockSkew < 0 {
+		return nil, fmt.Errorf("jwt: clock skew must not be negative, got %s", cfg.ClockSkew)
+	}
+	if cfg.ScopeClaim == "" {
+		cfg.ScopeClaim = "scope"
+	}
+	if cfg.AgentClaim == "" {
+		cfg.AgentClaim = "agents"
+	}
+	v := &JWTVerifier{cfg: cfg, now: time.Now}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Reload re-reads the key file.
+func (v *JWTVerifier) Reload() error {
+	info, err := os.Stat(v.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("jwt keys: %w", err)
+	}
+	data, err := os.ReadFile(v.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("jwt keys: %w", err)
+	}
+	keys, err := parseJWTKeys(data)
+	if err != nil {
+		return fmt.Errorf("jwt keys %s: %w", v.cfg.KeyFile, err)
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.modTime = info.ModTime()
+	v.checkedAt = v.now()
+	v.mu.Unlock()
+	return nil
+}
+
+// currentKeys returns the key set, reloading it first if the file changed
+// since the last check.
+func (v *JWTVerifier) currentKeys() []jwtKey {
+	v.mu.Lock()
+	due := v.now().Sub(v.checkedAt) >= jwtReloadInterval
+	if due {
+		v.checkedAt = v.now()
+	}
+	modTime := v.modTime
+	v.mu.Unlock()
+
+	if due {
+		if info, err := os.Stat(v.cfg.KeyFile); err == nil && !info.ModTime().Equal(modTime) {
+			if err := v.Reload(); err != nil {
+				log.Printf("jwt: keeping previous keys: %v", err)
+			} else {
+				log.Printf("jwt: reloaded keys from %s", v.cfg.KeyFile)
+			}
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.keys
+}
+
+// Verify checks the token's signature and claims and returns its grant.
+// The grant is named after the sub claim, takes its scopes from the scope
+// claim (a space-separated string or an array) and its agent selectors from
+// the agents claim.
+func (v *JWTVerifier) Verify(token string) (*Grant, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("jwt: malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("jwt header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("jwt: malformed signature")
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("jwt claims: %w", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := decodeJWTSegment(parts[1], &raw); err != nil {
+		return nil, fmt.Errorf("jwt claims: %w", err)
+	}
+	return v.grantFromClaims(claims.Subject, raw)
+}
+
+func (v *JWTVerifier) verifySignature(alg, kid string, signed, sig []byte) error {
+	hash, ok := jwtHashes[alg]
+	if !ok {
+		return fmt.Errorf("jwt: unsupported alg %q", alg)
+	}
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		_, _ = h.Write(signed) // hash.Hash writes never fail
+		digest = h.Sum(nil)
+	}
+	tried := false
+	for _, k := range v.currentKeys() {
+		if kid != "" && k.kid != kid {
+			continue
+		}
+		if k.alg != "" && k.alg != alg {
+			continue
+		}
+		if !jwtKeyFits(alg, k.key) {
+			continue
+		}
+		tried = true
+		if verifyJWTSignature(alg, hash, k.key, signed, digest, sig) {
+			return nil
+		}
+	}
+	if !tried {
+		return fmt.Errorf("jwt: no %s key matches kid %q", alg, kid)
+	}
+	return errors.New("jwt: invalid signature")
+}
+
+// jwtHashes maps each supported alg to its digest. EdDSA signs the message
+// itself.
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	"EdDSA": 0,
+}
+
+// jwtCurves maps ES* algs to the curve they require.
+var jwtCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521(),
+}
+
+func jwtKeyFits(alg string, key crypto.PublicKey) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return jwtCurves[alg] == k.Curve
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
+
+func verifyJWTSignature(alg string, hash crypto.Hash, key crypto.PublicKey, signed, digest, sig []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, signed, sig)
+	}
+	return false
+}
+
+func (v *JWTVerifier) checkClaims(c jwtClaims) error {
+	now := v.now()
+	skew := v.cfg.ClockSkew
+	if c.ExpiresAt == nil {
+		return errors.New("jwt: exp claim required")
+	}
+	if now.After(jwtTime(*c.ExpiresAt).Add(skew)) {
+		return errors.New("jwt: token expired")
+	}
+	if c.NotBefore != nil && now.Add(skew).Before(jwtTime(*c.NotBefore)) {
+		return errors.New("jwt: token not yet valid")
+	}
+	if c.IssuedAt != nil && now.Add(skew).Before(jwtTime(*c.IssuedAt)) {
+		return errors.New("jwt: token issued in the future")
+	}
+	if v.cfg.Issuer != "" && c.Issuer != v.cfg.Issuer {
+		return fmt.Errorf("jwt: issuer %q not accepted", c.Issuer)
+	}
+	if v.cfg.Audience != "" && !slices.Contains(c.Audience, v.cfg.Audience) {
+		return fmt.Errorf("jwt: audience %q not accepted", strings.Join(c.Audience, ","))
+	}
+	if c.Subject == "" {
+		return errors.New("jwt: sub claim required")
+	}
+	return nil
+}
+
+func (v *JWTVerifier) grantFromClaims(subject string, raw map[string]json.RawMessage) (*Grant, error) {
+	g := &Grant{Name: subject, Subject: subject}
+
+	var scopes []string
+	if data, ok := raw[v.cfg.ScopeClaim]; ok {
+		var s string
+		if err := json.Unmarshal(data, &s); err == nil {
+			scopes = strings.Fields(s)
+		} else if err := json.Unmarshal(data, &scopes); err != nil {
+			return nil, fmt.Errorf("jwt: %s claim must be a string or array of strings", v.cfg.ScopeClaim)
+		}
+	}
+	// Scopes from other applications may share the claim; keep only ours.
+	for _, s := range scopes {
+		if slices.Contains(validScopes, Scope(s)) {
+			g.Scopes = append(g.Scopes, Scope(s))
+		}
+	}
+	if len(g.Scopes) == 0 {
+		return nil, fmt.Errorf("jwt: token for %q carries no known scope", subject)
+	}
+
+	if data, ok := raw[v.cfg.AgentClaim]; ok {
+		if err := json.Unmarshal(data, &g.Agents); err != nil {
+			return nil, fmt.Errorf("jwt: %s claim: %w", v.cfg.AgentClaim, err)
+		}
+		for _, sel := range g.Agents {
+			if sel.Status != "" {
+				return nil, fmt.Errorf("jwt: %s claim: agent selectors cannot use status", v.cfg.AgentClaim)
+			}
+			if err := sel.Validate(); err != nil {
+				return nil, fmt.Errorf("jwt: %s claim: %w", v.cfg.AgentClaim, err)
+			}
+		}
+	}
+	return g, nil
+}
+
+func jwtTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func decodeJWTSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errors.New("malformed base64url")
+	}
+	return json.Unmarshal(data, v)
+}
+
+// looksLikeJWT reports whether a presented token has the three-segment shape
+// of a compact JWS, so static tokens are never handed to the verifier.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// parseJWTKeys reads a JWKS document or a PEM bundle of public keys and
+// certificates.
+func parseJWTKeys(data []byte) ([]jwtKey, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		return parseJWKS(data)
+	}
+	var keys []jwtKey
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		var key crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pem %s: %w", block.Type, err)
+		}
+		keys = append(keys, jwtKey{key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	return keys, nil
+}
+
+// jwk is the subset of RFC 7517 fields needed for RSA, EC and OKP keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(data []byte) ([]jwtKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+	var keys []jwtKey
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %d (kid %q): %w", i, k.Kid, err)
+		}
+		keys = append(keys, jwtKey{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := func(s string) ([]byte, error) {
+		if s == "" {
+			return nil, errors.New("missing key parameter")
+		}
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("bad RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("bad EC point")
+		}
+		// Build the uncompressed point so the stdlib validates it is on the curve.
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported kty %q", k.Kty)
+}
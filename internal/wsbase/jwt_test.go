@@ -0,0 +1,220 @@
+package wsbase
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	body, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		r, s, e := ecdsa.Sign(rand.Reader, k, digest[:])
+		err = e
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	data, _ := json.Marshal(map[string]any{"keys": keys})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func TestJWTVerifierJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path,
+		map[string]string{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+		map[string]string{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)},
+	)
+	v, err := NewJWTVerifier(JWTConfig{KeyFile: path, Issuer: "https://id.example", Audience: "tmux-adapter", ClockSkew: DefaultJWTClockSkew})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier() error: %v", err)
+	}
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{
+			"iss": "https://id.example", "aud": []string{"other", "tmux-adapter"}, "sub": "alice",
+			"exp": now.Add(time.Hour).Unix(), "scope": "openid view input",
+			"agents": []map[string]string{{"rig": "gastown"}},
+		}
+		for k, val := range extra {
+			c[k] = val
+		}
+		return c
+	}
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      crypto.Signer
+	}{{"RS256", "rsa", rsaKey}, {"ES256", "ec", ecKey}, {"EdDSA", "ed", edKey}} {
+		g, err := v.Verify(signJWT(t, tc.alg, tc.kid, tc.key, claims(nil)))
+		if err != nil {
+			t.Fatalf("Verify(%s) error: %v", tc.alg, err)
+		}
+		if g.Name != "alice" || g.Subject != "alice" || !g.Has(ScopeInput) || g.Has(ScopePrompt) || len(g.Agents) != 1 {
+			t.Fatalf("Verify(%s) grant = %+v", tc.alg, g)
+		}
+	}
+
+	bad := map[string]string{
+		"expired":         signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})),
+		"not yet valid":   signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()})),
+		"wrong issuer":    signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"iss": "https://evil.example"})),
+		"wrong audience":  signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"aud": "other"})),
+		"no exp":          signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"exp": nil})),
+		"no known scope":  signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"scope": "openid"})),
+		"status selector": signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"agents": []map[string]string{{"status": "attached"}}})),
+		"wrong key":       signJWT(t, "ES256", "rsa", ecKey, claims(nil)),
+		"unknown kid":     signJWT(t, "RS256", "nope", rsaKey, claims(nil)),
+		"alg none":        "eyJhbGciOiJub25lIn0." + b64([]byte(`{"sub":"alice"}`)) + ".",
+	}
+	for name, token := range bad {
+		if _, err := v.Verify(token); err == nil {
+			t.Errorf("Verify(%s) = nil error", name)
+		}
+	}
+
+	recent := signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()}))
+	if _, err := v.Verify(recent); err != nil {
+		t.Errorf("Verify(expired within clock skew) error: %v", err)
+	}
+
+	strict, err := NewJWTVerifier(JWTConfig{KeyFile: path, ClockSkew: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict.now = v.now
+	if _, err := strict.Verify(recent); err == nil {
+		t.Error("Verify(expired) with zero clock skew = nil error")
+	}
+	if _, err := NewJWTVerifier(JWTConfig{KeyFile: path, ClockSkew: -time.Second}); err == nil {
+		t.Error("NewJWTVerifier(negative clock skew) = nil error")
+	}
+}
+
+func TestJWTVerifierReloadsKeyFile(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pemFor := func(k *ecdsa.PrivateKey) []byte {
+		der, err := x509.MarshalPKIXPublicKey(&k.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.pem")
+	if err := os.WriteFile(path, pemFor(oldKey), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewJWTVerifier(JWTConfig{KeyFile: path})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier() error: %v", err)
+	}
+	now := time.Now()
+	v.now = func() time.Time { return now }
+	claims := map[string]any{"sub": "ci", "exp": now.Add(time.Hour).Unix(), "scope": []string{"view"}}
+
+	if _, err := v.Verify(signJWT(t, "ES256", "", oldKey, claims)); err != nil {
+		t.Fatalf("Verify(old key) error: %v", err)
+	}
+
+	if err := os.WriteFile(path, pemFor(newKey), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, now.Add(time.Minute), now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(jwtReloadInterval)
+	if _, err := v.Verify(signJWT(t, "ES256", "", newKey, claims)); err != nil {
+		t.Fatalf("Verify(new key after rotation) error: %v", err)
+	}
+	if _, err := v.Verify(signJWT(t, "ES256", "", oldKey, claims)); err == nil {
+		t.Fatal("Verify(old key after rotation) = nil error")
+	}
+
+	// A broken file keeps the previous keys.
+	if err := os.WriteFile(path, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, now.Add(2*time.Minute), now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(jwtReloadInterval)
+	if _, err := v.Verify(signJWT(t, "ES256", "", newKey, claims)); err != nil {
+		t.Fatalf("Verify() after bad reload error: %v", err)
+	}
+}
+
+func TestTokensAuthenticateJWT(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(edKey.Public())
+	path := filepath.Join(t.TempDir(), "keys.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewJWTVerifier(JWTConfig{KeyFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := SharedToken("").WithJWT(v)
+	if !tokens.Enabled() {
+		t.Fatal("a token set with JWT keys should require auth")
+	}
+
+	token := signJWT(t, "EdDSA", "", edKey, map[string]any{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix(), "scope": "view"})
+	req := httptest.NewRequest("GET", "http://localhost:8080/ws", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if g, ok := tokens.Authenticate(req); !ok || g.Subject != "bob" || !g.Has(ScopeView) {
+		t.Fatalf("Authenticate(jwt) = %+v, %v", g, ok)
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost:8080/ws?token="+token+"x", nil)
+	if _, ok := tokens.Authenticate(req); ok {
+		t.Fatal("Authenticate(tampered jwt) = ok")
+	}
+}
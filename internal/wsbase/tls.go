@@ -0,0 +1,194 @@
+package wsbase
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client certificate policies for TLSConfig.ClientAuth.
+const (
+	ClientAuthRequire  = "require"  // every connection must present a cert signed by the CA bundle
+	ClientAuthOptional = "optional" // a presented cert must verify; none is also accepted
+)
+
+// tlsReloadInterval bounds how often the certificate files are checked for
+// changes.
+const tlsReloadInterval = 5 * time.Second
+
+// TLSConfig configures native TLS serving.
+type TLSConfig struct {
+	CertFile     string // PEM certificate chain
+	KeyFile      string // PEM private key
+	ClientCAFile string // PEM CA bundle; enables client certificate verification
+	ClientAuth   string // ClientAuthRequire (default) or ClientAuthOptional
+}
+
+// Enabled reports whether any TLS option is set.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.ClientCAFile != ""
+}
+
+// Validate checks that the options are consistent.
+func (c TLSConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("tls: --tls-cert and --tls-key must be set together")
+	}
+	if c.ClientCAFile != "" && c.CertFile == "" {
+		return errors.New("tls: --tls-client-ca needs --tls-cert and --tls-key")
+	}
+	switch c.ClientAuth {
+	case "", ClientAuthRequire, ClientAuthOptional:
+	default:
+		return fmt.Errorf("tls: unknown client auth %q (use %s or %s)", c.ClientAuth, ClientAuthRequire, ClientAuthOptional)
+	}
+	return nil
+}
+
+// TLSReloader serves a certificate and client CA bundle that are re-read
+// when their files change, so certificates can be renewed without a
+// restart. Files that fail to load leave the previous ones in place.
+type TLSReloader struct {
+	cfg TLSConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  [3]time.Time // cert, key, client CA
+	checkedAt time.Time
+}
+
+// NewTLSReloader validates cfg and loads its files.
+func NewTLSReloader(cfg TLSConfig) (*TLSReloader, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.CertFile == "" {
+		return nil, errors.New("tls: certificate required")
+	}
+	r := &TLSReloader{cfg: cfg, now: time.Now}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *TLSReloader) files() [3]string {
+	return [3]string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile}
+}
+
+func (r *TLSReloader) statFiles() ([3]time.Time, error) {
+	var mods [3]time.Time
+	for i, path := range r.files() {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return mods, fmt.Errorf("tls: %w", err)
+		}
+		mods[i] = info.ModTime()
+	}
+	return mods, nil
+}
+
+// Reload re-reads the certificate, key and client CA bundle.
+func (r *TLSReloader) Reload() error {
+	mods, err := r.statFiles()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("tls: load certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		data, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("tls: no certificates in %s", r.cfg.ClientCAFile)
+		}
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.modTimes = mods
+	r.checkedAt = r.now()
+	r.mu.Unlock()
+	return nil
+}
+
+// current returns the certificate and CA pool, reloading them first if any
+// file changed since the last check.
+func (r *TLSReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	due := r.now().Sub(r.checkedAt) >= tlsReloadInterval
+	if due {
+		r.checkedAt = r.now()
+	}
+	known := r.modTimes
+	r.mu.Unlock()
+
+	if due {
+		if mods, err := r.statFiles(); err == nil && mods != known {
+			if err := r.Reload(); err != nil {
+				log.Printf("tls: keeping previous certificates: %v", err)
+			} else {
+				log.Printf("tls: reloaded certificates from %s", r.cfg.CertFile)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, r.clientCAs
+}
+
+// ServerConfig returns a tls.Config for http.Server that picks up reloaded
+// files on each handshake.
+func (r *TLSReloader) ServerConfig() *tls.Config {
+	clientAuth := tls.NoClientCert
+	if r.cfg.ClientCAFile != "" {
+		clientAuth = tls.RequireAndVerifyClientCert
+		if r.cfg.ClientAuth == ClientAuthOptional {
+			clientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientAuth:   clientAuth,
+				ClientCAs:    pool,
+			}, nil
+		},
+	}
+}
+
+// PeerIdentity names the client behind r: the subject of its verified TLS
+// client certificate (the common name, or the full subject when that is
+// empty), otherwise its remote address.
+func PeerIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		subject := r.TLS.VerifiedChains[0][0].Subject
+		if subject.CommonName != "" {
+			return subject.CommonName
+		}
+		return subject.String()
+	}
+	return r.RemoteAddr
+}
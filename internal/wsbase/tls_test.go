@@ -0,0 +1,166 @@
+package wsbase
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func issueCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfigValidate(t *testing.T) {
+	bad := []TLSConfig{
+		{CertFile: "c.pem"},
+		{KeyFile: "k.pem"},
+		{ClientCAFile: "ca.pem"},
+		{CertFile: "c.pem", KeyFile: "k.pem", ClientAuth: "sometimes"},
+	}
+	for _, cfg := range bad {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil", cfg)
+		}
+	}
+	if (TLSConfig{}).Enabled() {
+		t.Error("empty TLSConfig should be disabled")
+	}
+}
+
+func TestTLSReloaderMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, "test-ca", nil, true)
+	server := issueCert(t, "localhost", ca, false)
+	client := issueCert(t, "alice", ca, false)
+	stranger := issueCert(t, "mallory", issueCert(t, "other-ca", nil, true), false)
+
+	certPath, keyPath, caPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	start := time.Now().Add(-time.Minute)
+	writeFile(t, certPath, server.certPEM, start)
+	writeFile(t, keyPath, server.keyPEM, start)
+	writeFile(t, caPath, ca.certPEM, start)
+
+	reloader, err := NewTLSReloader(TLSConfig{CertFile: certPath, KeyFile: keyPath, ClientCAFile: caPath, ClientAuth: ClientAuthOptional})
+	if err != nil {
+		t.Fatalf("NewTLSReloader() error: %v", err)
+	}
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", reloader.ServerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, PeerIdentity(r))
+	})}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(c *testCert) (string, *x509.Certificate, error) {
+		cfg := &tls.Config{RootCAs: roots}
+		if c != nil {
+			cfg.Certificates = []tls.Certificate{{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true}}
+		resp, err := httpClient.Get("https://" + ln.Addr().String() + "/")
+		if err != nil {
+			return "", nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.TLS.PeerCertificates[0], nil
+	}
+
+	if id, _, err := get(client); err != nil || id != "alice" {
+		t.Fatalf("client cert identity = %q, %v; want alice", id, err)
+	}
+	if id, _, err := get(nil); err != nil || id == "alice" {
+		t.Fatalf("no client cert identity = %q, %v; want remote address", id, err)
+	}
+	// A cert from another CA is never trusted; with optional client auth the
+	// connection proceeds anonymously.
+	if id, _, err := get(stranger); err == nil && id == "mallory" {
+		t.Fatal("cert from an unknown CA was trusted")
+	}
+
+	// Renew the server certificate; the next handshake after the reload
+	// interval serves the new one.
+	renewed := issueCert(t, "localhost", ca, false)
+	writeFile(t, certPath, renewed.certPEM, start.Add(30*time.Second))
+	writeFile(t, keyPath, renewed.keyPEM, start.Add(30*time.Second))
+	now = now.Add(tlsReloadInterval)
+	_, served, err := get(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if served.SerialNumber.Cmp(renewed.cert.SerialNumber) != 0 {
+		t.Fatal("renewed certificate was not served after reload")
+	}
+}
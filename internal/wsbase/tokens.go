@@ -0,0 +1,273 @@
+package wsbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+// Scope is a permission granted to an access token.
+type Scope string
+
+const (
+	ScopeView   Scope = "view"   // list agents, stream output and conversations, browse files
+	ScopeInput  Scope = "input"  // keystrokes, send-keys, interrupts
+	ScopePrompt Scope = "prompt" // send and broadcast prompts, manage the prompt queue
+	ScopeUpload Scope = "upload" // upload and delete files
+	ScopeResize Scope = "resize" // resize panes
+	ScopeAdmin  Scope = "admin"  // every scope
+)
+
+// validScopes lists the scopes accepted in a tokens file.
+var validScopes = []Scope{ScopeView, ScopeInput, ScopePrompt, ScopeUpload, ScopeResize, ScopeAdmin}
+
+// SharedTokenName names the token created from --auth-token.
+const SharedTokenName = "auth-token"
+
+// TokenConfig is one entry of a tokens file.
+type TokenConfig struct {
+	Name   string                  `json:"name"`
+	Token  string                  `json:"token"`
+	Scopes []Scope                 `json:"scopes"`
+	Agents []agentio.AgentSelector `json:"agents,omitempty"` // any may match; empty = every agent
+}
+
+// Grant is what an authenticated connection may do.
+type Grant struct {
+	Name    string                  `json:"name,omitempty"`
+	Subject string                  `json:"subject,omitempty"` // verified client identity, if any
+	Scopes  []Scope                 `json:"scopes"`
+	Agents  []agentio.AgentSelector `json:"agents,omitempty"`
+}
+
+// FullAccess is the grant every request gets when no tokens are configured.
+var FullAccess = &Grant{Scopes: []Scope{ScopeAdmin}}
+
+// Has reports whether the grant includes scope. Admin includes every scope.
+func (g *Grant) Has(scope Scope) bool {
+	return slices.Contains(g.Scopes, ScopeAdmin) || slices.Contains(g.Scopes, scope)
+}
+
+// Identity names the client for prompt submitters and uploads: the verified
+// subject when the grant has one, otherwise peer (see PeerIdentity).
+func (g *Grant) Identity(peer string) string {
+	if g.Subject != "" {
+		return g.Subject
+	}
+	return peer
+}
+
+// Sees reports whether the grant's agent selectors admit a.
+func (g *Grant) Sees(a agents.Agent) bool {
+	if len(g.Agents) == 0 {
+		return true
+	}
+	for _, sel := range g.Agents {
+		if sel.Matches(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// SeesName reports whether the grant admits the named agent. An agent the
+// registry no longer knows is matched on its name alone, so role and rig
+// selectors hide it.
+func (g *Grant) SeesName(registry *agents.Registry, name string) bool {
+	if len(g.Agents) == 0 {
+		return true
+	}
+	a, ok := registry.GetAgent(name)
+	if !ok {
+		a = agents.Agent{Name: name}
+	}
+	return g.Sees(a)
+}
+
+// FilterAgents returns the agents the grant admits.
+func (g *Grant) FilterAgents(list []agents.Agent) []agents.Agent {
+	if len(g.Agents) == 0 {
+		return list
+	}
+	visible := make([]agents.Agent, 0, len(list))
+	for _, a := range list {
+		if g.Sees(a) {
+			visible = append(visible, a)
+		}
+	}
+	return visible
+}
+
+// Authorize checks that the grant holds scope and, when agent is non-empty,
+// can see that agent. Agents outside the grant are reported as not found so
+// a token cannot probe for them.
+func (g *Grant) Authorize(scope Scope, registry *agents.Registry, agent string) *Error {
+	if scope != "" && !g.Has(scope) {
+		return Errorf(CodePermissionDenied, "token %q lacks the %s scope", g.Name, scope).WithDetail("scope", scope)
+	}
+	if agent != "" && !g.SeesName(registry, agent) {
+		return AgentNotFound(agent)
+	}
+	return nil
+}
+
+// Tokens authenticates requests against a set of named, scoped tokens and,
+// optionally, signed JWTs. An empty set authorizes every request with
+// FullAccess.
+type Tokens struct {
+	entries []TokenConfig
+	jwt     *JWTVerifier
+}
+
+// NewTokens validates configs and builds a token set.
+func NewTokens(configs []TokenConfig) (*Tokens, error) {
+	names := make(map[string]bool, len(configs))
+	secrets := make(map[string]bool, len(configs))
+	for i, tc := range configs {
+		if tc.Name == "" {
+			return nil, fmt.Errorf("token %d: name required", i)
+		}
+		if names[tc.Name] {
+			return nil, fmt.Errorf("token %q: duplicate name", tc.Name)
+		}
+		names[tc.Name] = true
+		if tc.Token == "" {
+			return nil, fmt.Errorf("token %q: token required", tc.Name)
+		}
+		if secrets[tc.Token] {
+			return nil, fmt.Errorf("token %q: token reused by another entry", tc.Name)
+		}
+		secrets[tc.Token] = true
+		if len(tc.Scopes) == 0 {
+			return nil, fmt.Errorf("token %q: at least one scope required", tc.Name)
+		}
+		for _, s := range tc.Scopes {
+			if !slices.Contains(validScopes, s) {
+				return nil, fmt.Errorf("token %q: unknown scope %q", tc.Name, s)
+			}
+		}
+		for _, sel := range tc.Agents {
+			if sel.Status != "" {
+				return nil, fmt.Errorf("token %q: agent selectors cannot use status", tc.Name)
+			}
+			if err := sel.Validate(); err != nil {
+				return nil, fmt.Errorf("token %q: %w", tc.Name, err)
+			}
+		}
+	}
+	return &Tokens{entries: configs}, nil
+}
+
+// SharedToken returns the token set for a single all-powerful shared secret,
+// or an empty set when secret is empty.
+func SharedToken(secret string) *Tokens {
+	if secret == "" {
+		return &Tokens{}
+	}
+	return &Tokens{entries: []TokenConfig{sharedTokenConfig(secret)}}
+}
+
+func sharedTokenConfig(secret string) TokenConfig {
+	return TokenConfig{Name: SharedTokenName, Token: secret, Scopes: []Scope{ScopeAdmin}}
+}
+
+// LoadTokens reads a tokens file of the form
+// {"tokens": [{"name": "dashboard", "token": "...", "scopes": ["view"], "agents": [{"rig": "gastown"}]}]}.
+// A non-empty sharedSecret is added as an admin token named "auth-token".
+func LoadTokens(path, sharedSecret string) (*Tokens, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tokens: %w", err)
+	}
+	var file struct {
+		Tokens []TokenConfig `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse tokens %s: %w", path, err)
+	}
+	configs := file.Tokens
+	if sharedSecret != "" {
+		configs = append(configs, sharedTokenConfig(sharedSecret))
+	}
+	tokens, err := NewTokens(configs)
+	if err != nil {
+		return nil, fmt.Errorf("tokens %s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+// WithJWT returns a copy of the token set that also accepts JWTs verified
+// by v. A nil v removes JWT support.
+func (t *Tokens) WithJWT(v *JWTVerifier) *Tokens {
+	return &Tokens{entries: t.entries, jwt: v}
+}
+
+// JWT returns the token set's JWT verifier, or nil.
+func (t *Tokens) JWT() *JWTVerifier {
+	return t.jwt
+}
+
+// Enabled reports whether requests must present a token.
+func (t *Tokens) Enabled() bool {
+	return len(t.entries) > 0 || t.jwt != nil
+}
+
+// Authenticate returns the grant for the request's Bearer or ?token= value.
+// Static tokens are checked first; a value shaped like a JWT is then
+// verified against the JWT keys.
+func (t *Tokens) Authenticate(r *http.Request) (*Grant, bool) {
+	if !t.Enabled() {
+		return FullAccess, true
+	}
+	for _, presented := range requestTokens(r) {
+		for _, tc := range t.entries {
+			if TokensEqual(tc.Token, presented) {
+				return &Grant{Name: tc.Name, Scopes: tc.Scopes, Agents: tc.Agents}, true
+			}
+		}
+		if t.jwt != nil && looksLikeJWT(presented) {
+			g, err := t.jwt.Verify(presented)
+			if err == nil {
+				return g, true
+			}
+			log.Printf("auth: rejected jwt from %s: %v", r.RemoteAddr, err)
+		}
+	}
+	return nil, false
+}
+
+type grantKey struct{}
+
+// GrantFromContext returns the grant stored by RequireGrant, or FullAccess.
+func GrantFromContext(ctx context.Context) *Grant {
+	if g, ok := ctx.Value(grantKey{}).(*Grant); ok {
+		return g
+	}
+	return FullAccess
+}
+
+// RequireGrant wraps next so that only requests whose token holds scope get
+// through, with 401 for a missing or unknown token and 403 for a missing
+// scope. A request naming an agent with ?agent= that the token cannot see
+// gets 404. next reads the grant with GrantFromContext.
+func RequireGrant(tokens *Tokens, registry *agents.Registry, scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grant, ok := tokens.Authenticate(r)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if e := grant.Authorize(scope, registry, r.URL.Query().Get("agent")); e != nil {
+			writeHTTPError(w, e)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), grantKey{}, grant)))
+	})
+}
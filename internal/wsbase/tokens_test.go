@@ -0,0 +1,128 @@
+package wsbase
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
+	"github.com/gastownhall/tmux-adapter/internal/agents"
+)
+
+func TestGrantScopesAndAgents(t *testing.T) {
+	rig := "gastown"
+	polecat := agents.Agent{Name: "gt-gastown-toast", Role: "polecat", Rig: &rig}
+	mayor := agents.Agent{Name: "hq-mayor", Role: "mayor"}
+
+	g := &Grant{Name: "dash", Scopes: []Scope{ScopeView}, Agents: []agentio.AgentSelector{{Rig: "gastown"}, {Name: "hq-d*"}}}
+	if !g.Has(ScopeView) || g.Has(ScopeInput) {
+		t.Fatalf("Has() wrong for %+v", g.Scopes)
+	}
+	if !g.Sees(polecat) || g.Sees(mayor) {
+		t.Fatal("Sees() should admit the rig agent only")
+	}
+	if got := g.FilterAgents([]agents.Agent{mayor, polecat}); len(got) != 1 || got[0].Name != polecat.Name {
+		t.Fatalf("FilterAgents() = %+v", got)
+	}
+
+	registry := agents.NewRegistry(nil, "", nil)
+	if e := g.Authorize(ScopeInput, registry, ""); e == nil || e.Code != CodePermissionDenied {
+		t.Fatalf("Authorize(input) = %v, want PERMISSION_DENIED", e)
+	}
+	if e := g.Authorize(ScopeView, registry, "hq-mayor"); e == nil || e.Code != CodeAgentNotFound {
+		t.Fatalf("Authorize(hidden agent) = %v, want AGENT_NOT_FOUND", e)
+	}
+	if e := g.Authorize(ScopeView, registry, "hq-deacon"); e != nil {
+		t.Fatalf("Authorize(name glob) = %v", e)
+	}
+
+	admin := &Grant{Scopes: []Scope{ScopeAdmin}}
+	if !admin.Has(ScopeResize) || !admin.Sees(mayor) {
+		t.Fatal("admin grant without selectors should allow everything")
+	}
+}
+
+func TestNewTokensValidates(t *testing.T) {
+	bad := [][]TokenConfig{
+		{{Token: "a", Scopes: []Scope{ScopeView}}},
+		{{Name: "x", Scopes: []Scope{ScopeView}}},
+		{{Name: "x", Token: "a"}},
+		{{Name: "x", Token: "a", Scopes: []Scope{"write"}}},
+		{{Name: "x", Token: "a", Scopes: []Scope{ScopeView}, Agents: []agentio.AgentSelector{{Status: "attached"}}}},
+		{{Name: "x", Token: "a", Scopes: []Scope{ScopeView}}, {Name: "x", Token: "b", Scopes: []Scope{ScopeView}}},
+		{{Name: "x", Token: "a", Scopes: []Scope{ScopeView}}, {Name: "y", Token: "a", Scopes: []Scope{ScopeView}}},
+	}
+	for _, configs := range bad {
+		if _, err := NewTokens(configs); err == nil {
+			t.Errorf("NewTokens(%+v) = nil error", configs)
+		}
+	}
+}
+
+func TestTokensAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	body := `{"tokens": [{"name": "dash", "token": "view-secret", "scopes": ["view"], "agents": [{"role": "polecat"}]}]}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := LoadTokens(path, "shared-secret")
+	if err != nil {
+		t.Fatalf("LoadTokens() error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost:8080/ws?token=view-secret", nil)
+	g, ok := tokens.Authenticate(req)
+	if !ok || g.Name != "dash" || g.Has(ScopeInput) || len(g.Agents) != 1 {
+		t.Fatalf("Authenticate(view token) = %+v, %v", g, ok)
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost:8080/ws", nil)
+	req.Header.Set("Authorization", "Bearer shared-secret")
+	if g, ok := tokens.Authenticate(req); !ok || g.Name != SharedTokenName || !g.Has(ScopeResize) {
+		t.Fatalf("Authenticate(shared token) = %+v, %v", g, ok)
+	}
+
+	req = httptest.NewRequest("GET", "http://localhost:8080/ws?token=nope", nil)
+	if _, ok := tokens.Authenticate(req); ok {
+		t.Fatal("Authenticate(unknown token) = ok")
+	}
+
+	if g, ok := SharedToken("").Authenticate(req); !ok || g != FullAccess {
+		t.Fatal("empty token set should grant full access")
+	}
+}
+
+func TestRequireGrant(t *testing.T) {
+	tokens, err := NewTokens([]TokenConfig{
+		{Name: "dash", Token: "view-secret", Scopes: []Scope{ScopeView}, Agents: []agentio.AgentSelector{{Name: "gt-*"}}},
+		{Name: "typist", Token: "input-secret", Scopes: []Scope{ScopeInput}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := RequireGrant(tokens, agents.NewRegistry(nil, "", nil), ScopeView, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GrantFromContext(r.Context()).Name != "dash" {
+			t.Error("grant missing from context")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		query string
+		want  int
+	}{
+		{"agent=gt-toast", http.StatusUnauthorized},
+		{"agent=gt-toast&token=input-secret", http.StatusForbidden},
+		{"agent=hq-mayor&token=view-secret", http.StatusNotFound},
+		{"agent=gt-toast&token=view-secret", http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost:8080/files?"+tc.query, nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.query, rec.Code, tc.want)
+		}
+	}
+}
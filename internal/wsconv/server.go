@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 
@@ -27,28 +28,93 @@ type Server struct {
 	ctrl           *tmux.ControlMode
 	registry       *agents.Registry
 	prompter       *agentio.Prompter
+	queue          *agentio.PromptQueue
 	authToken      string
+	tokens         *wsbase.Tokens
 	originPatterns []string
 	clients        map[*Client]struct{}
 	mu             sync.Mutex
+	stopCh         chan struct{} // closed by Stop
 }
 
 // NewServer creates a new converter WebSocket server.
 func NewServer(watcher *conv.ConversationWatcher, authToken string, originPatterns []string, ctrl *tmux.ControlMode, registry *agents.Registry) *Server {
+	prompter := agentio.NewPrompter(ctrl, registry)
 	return &Server{
 		watcher:        watcher,
 		ctrl:           ctrl,
 		registry:       registry,
-		prompter:       agentio.NewPrompter(ctrl, registry),
+		prompter:       prompter,
+		queue:          agentio.NewPromptQueue(prompter),
 		authToken:      authToken,
+		tokens:         wsbase.SharedToken(authToken),
 		originPatterns: originPatterns,
 		clients:        make(map[*Client]struct{}),
+		stopCh:         make(chan struct{}),
 	}
 }
 
+// LoadPastePolicies applies per-runtime upload paste policies from a JSON file.
+func (s *Server) LoadPastePolicies(path string) error {
+	return s.prompter.LoadPastePolicies(path)
+}
+
+// SetUploadPolicy replaces the per-agent upload quotas and retention.
+func (s *Server) SetUploadPolicy(policy agentio.UploadPolicy) {
+	s.prompter.Uploads.SetPolicy(policy)
+}
+
+// LoadTokens replaces the access tokens with those in a JSON tokens file.
+// The shared auth token, if any, stays valid as an admin token.
+func (s *Server) LoadTokens(path string) error {
+	tokens, err := wsbase.LoadTokens(path, s.authToken)
+	if err != nil {
+		return err
+	}
+	s.tokens = tokens.WithJWT(s.tokens.JWT())
+	return nil
+}
+
+// LoadJWTKeys accepts signed JWTs verified against the keys in cfg.KeyFile,
+// alongside any static tokens. The key file is re-read when it changes.
+func (s *Server) LoadJWTKeys(cfg wsbase.JWTConfig) error {
+	v, err := wsbase.NewJWTVerifier(cfg)
+	if err != nil {
+		return err
+	}
+	s.tokens = s.tokens.WithJWT(v)
+	return nil
+}
+
+// RequireGrant wraps an HTTP handler so it accepts the same tokens as the
+// WebSocket endpoint and requires scope.
+func (s *Server) RequireGrant(scope wsbase.Scope, next http.Handler) http.Handler {
+	return wsbase.RequireGrant(s.tokens, s.registry, scope, next)
+}
+
+// RunUploadCleanup removes expired uploads every interval. Blocks until Stop.
+func (s *Server) RunUploadCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.prompter.Uploads.Cleanup()
+		}
+	}
+}
+
+// LoadPromptTimings applies per-runtime prompt timing overrides from a JSON file.
+func (s *Server) LoadPromptTimings(path string) error {
+	return s.prompter.LoadPromptTimings(path)
+}
+
 // HandleWebSocket is the HTTP handler for /ws.
 func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	if !wsbase.IsAuthorizedRequest(s.authToken, r) {
+	grant, ok := s.tokens.Authenticate(r)
+	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -60,6 +126,8 @@ func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn.SetReadLimit(int64(agentio.MaxFileUploadBytes + 64*1024))
 
 	client := newClient(conn, s)
+	client.remoteAddr = grant.Identity(wsbase.PeerIdentity(r))
+	client.grant = grant
 	s.addClient(client)
 	defer s.removeClient(client)
 
@@ -78,7 +146,7 @@ func (s *Server) Broadcast(event conv.WatcherEvent) {
 			Agent: event.Agent,
 		}
 		for c := range s.clients {
-			if c.subscribedAgents {
+			if c.subscribedAgents && c.seesAgent(event.Agent) {
 				c.sendJSON(msg)
 			}
 		}
@@ -90,17 +158,18 @@ func (s *Server) Broadcast(event conv.WatcherEvent) {
 			msg.Name = event.Agent.Name
 		}
 		for c := range s.clients {
-			if c.subscribedAgents {
+			if c.subscribedAgents && c.seesAgent(event.Agent) {
 				c.sendJSON(msg)
 			}
 		}
 	case "agent-updated":
 		msg := serverMessage{
-			Type:  "agent-updated",
-			Agent: event.Agent,
+			Type:    "agent-updated",
+			Agent:   event.Agent,
+			Changes: event.Changes,
 		}
 		for c := range s.clients {
-			if c.subscribedAgents {
+			if c.subscribedAgents && agents.ChangesMatchFields(event.Changes, c.agentFields) && c.seesAgent(event.Agent) {
 				c.sendJSON(msg)
 			}
 		}
@@ -122,6 +191,43 @@ func (s *Server) Broadcast(event conv.WatcherEvent) {
 	}
 }
 
+// ForwardPromptQueueEvents pushes prompt queue changes to clients subscribed
+// to agent lifecycle events. Blocks until Stop.
+func (s *Server) ForwardPromptQueueEvents() {
+	id, events := s.queue.Subscribe()
+	defer s.queue.Unsubscribe(id)
+	for {
+		var event agentio.QueueEvent
+		select {
+		case <-s.stopCh:
+			return
+		case event = <-events:
+		}
+		item := event.Item
+		msg := serverMessage{
+			Type:      "prompt-queue",
+			Action:    event.Action,
+			Name:      item.Agent,
+			QueueItem: &item,
+			Queue:     event.Queue,
+			Error:     event.Error,
+		}
+		s.mu.Lock()
+		for c := range s.clients {
+			if c.subscribedAgents && c.sees(item.Agent) {
+				c.sendJSON(msg)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Stop ends the prompt queue forwarder and upload cleanup. Call it once,
+// on shutdown.
+func (s *Server) Stop() {
+	close(s.stopCh)
+}
+
 func (s *Server) addClient(c *Client) {
 	s.mu.Lock()
 	s.clients[c] = struct{}{}
@@ -153,7 +259,11 @@ type Client struct {
 	follows  map[string]*subscription // agentName → subscription (follow-agent)
 	nextSub  int
 	subscribedAgents bool
+	agentFields      map[string]bool // agent-updated field filter (nil = all fields)
 	handshakeDone    bool
+	remoteAddr       string // default prompt submitter
+	binarySeq        uint64 // binary frames received, for error correlation
+	grant            *wsbase.Grant
 }
 
 type subscription struct {
@@ -176,6 +286,7 @@ func newClient(conn *websocket.Conn, server *Server) *Client {
 		cancel:  cancel,
 		subs:    make(map[string]*subscription),
 		follows: make(map[string]*subscription),
+		grant:   wsbase.FullAccess,
 	}
 }
 
@@ -232,12 +343,28 @@ func (c *Client) sendJSON(v any) {
 }
 
 func (c *Client) handleBinaryMessage(data []byte) {
+	// Binary frames carry no request ID; errors name the frame by its
+	// sequence number on this connection instead.
+	c.binarySeq++
+	seq := c.binarySeq
 	msgType, agentName, payload, err := agentio.ParseBinaryEnvelope(data)
 	if err != nil {
-		c.sendJSON(serverMessage{Type: "error", Error: "invalid binary message: " + err.Error()})
+		var frameType byte
+		if len(data) > 0 {
+			frameType = data[0]
+		}
+		e := wsbase.Errorf(wsbase.CodeInvalidArgument, "invalid binary message: %v", err)
+		c.sendJSON(errorMessage("", "error", e.WithFrame(frameType, "", seq)))
 		return
 	}
 
+	if msgType == agentio.BinaryFileUpload {
+		if e := c.authorize(wsbase.ScopeUpload, agentName); e != nil {
+			c.sendJSON(errorMessage("", "error", e.WithFrame(msgType, agentName, seq)))
+			return
+		}
+	}
+
 	switch msgType {
 	case agentio.BinaryFileUpload:
 		payloadCopy := append([]byte(nil), payload...)
@@ -245,35 +372,51 @@ func (c *Client) handleBinaryMessage(data []byte) {
 			lock := c.server.prompter.GetLock(agentName)
 			lock.Lock()
 			defer lock.Unlock()
-			if err := c.server.prompter.HandleFileUpload(agentName, payloadCopy); err != nil {
+			result, err := c.server.prompter.HandleFileUpload(agentName, payloadCopy, c.remoteAddr)
+			resp := serverMessage{Type: "upload-result", OK: boolPtr(err == nil), Name: agentName}
+			if result.FileName != "" {
+				resp.UploadResult = &result
+			}
+			if err != nil {
 				log.Printf("file upload %s error: %v", agentName, err)
-				c.sendJSON(serverMessage{Type: "error", Error: "file upload " + agentName + ": " + err.Error()})
+				resp.fail(wsbase.ErrorFrom(fmt.Errorf("file upload %s: %w", agentName, err)).WithFrame(msgType, agentName, seq))
 			}
+			c.sendJSON(resp)
 		}()
 	default:
-		c.sendJSON(serverMessage{Type: "error", Error: fmt.Sprintf("unsupported binary message type: 0x%02x", msgType)})
+		e := wsbase.Errorf(wsbase.CodeUnsupported, "unsupported binary message type: 0x%02x", msgType)
+		resp := errorMessage("", "error", e.WithFrame(msgType, agentName, seq))
+		resp.UnknownType = fmt.Sprintf("0x%02x", msgType)
+		c.sendJSON(resp)
 	}
 }
 
 func (c *Client) handleTextMessage(data []byte) {
 	var msg clientMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
-		c.sendJSON(serverMessage{Type: "error", Error: "invalid JSON"})
+		c.sendJSON(errorMessage("", "error", wsbase.NewError(wsbase.CodeInvalidArgument, "invalid JSON")))
 		return
 	}
 
 	if !c.handshakeDone {
 		if msg.Type != "hello" {
-			c.sendJSON(serverMessage{ID: msg.ID, Type: "error", Error: "handshake required: send hello first"})
+			c.sendJSON(errorMessage(msg.ID, "error", wsbase.NewError(wsbase.CodeHandshakeRequired, "handshake required: send hello first")))
 			return
 		}
 		c.handleHello(msg)
 		return
 	}
 
+	if scope, ok := messageScopes[msg.Type]; ok {
+		if e := c.authorize(scope, msg.Agent); e != nil {
+			c.sendJSON(errorMessage(msg.ID, msg.Type, e))
+			return
+		}
+	}
+
 	switch msg.Type {
 	case "hello":
-		c.sendJSON(serverMessage{ID: msg.ID, Type: "error", Error: "already handshaked"})
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.NewError(wsbase.CodeInvalidArgument, "already handshaked")))
 	case "list-agents":
 		c.handleListAgents(msg)
 	case "subscribe-agents":
@@ -290,18 +433,75 @@ func (c *Client) handleTextMessage(data []byte) {
 		c.handleUnsubscribeAgent(msg)
 	case "send-prompt":
 		c.handleSendPrompt(msg)
+	case "broadcast-prompt":
+		c.handleBroadcastPrompt(msg)
+	case "list-prompt-queue":
+		queue := slices.DeleteFunc(c.server.queue.List(msg.Agent), func(item agentio.QueuedPrompt) bool {
+			return !c.sees(item.Agent)
+		})
+		c.sendJSON(serverMessage{ID: msg.ID, Type: "list-prompt-queue", Queue: queue})
+	case "cancel-prompt":
+		c.handleCancelPrompt(msg)
+	case "reorder-prompt":
+		c.handleReorderPrompt(msg)
 	default:
-		c.sendJSON(serverMessage{ID: msg.ID, Type: "error", Error: "unknown message type", UnknownType: msg.Type})
+		resp := errorMessage(msg.ID, "error", wsbase.NewError(wsbase.CodeUnsupported, "unknown message type").WithDetail("type", msg.Type))
+		resp.UnknownType = msg.Type
+		c.sendJSON(resp)
+	}
+}
+
+// messageScopes names the token scope each request needs. A request that
+// names an agent also needs a token that can see that agent.
+var messageScopes = map[string]wsbase.Scope{
+	"list-agents":            wsbase.ScopeView,
+	"subscribe-agents":       wsbase.ScopeView,
+	"list-conversations":     wsbase.ScopeView,
+	"subscribe-conversation": wsbase.ScopeView,
+	"follow-agent":           wsbase.ScopeView,
+	"unsubscribe":            wsbase.ScopeView,
+	"unsubscribe-agent":      wsbase.ScopeView,
+	"list-prompt-queue":      wsbase.ScopeView,
+	"send-prompt":            wsbase.ScopePrompt,
+	"broadcast-prompt":       wsbase.ScopePrompt,
+	"cancel-prompt":          wsbase.ScopePrompt,
+	"reorder-prompt":         wsbase.ScopePrompt,
+}
+
+// authorize checks the connection's token for scope and, when agent is
+// non-empty, for visibility of that agent.
+func (c *Client) authorize(scope wsbase.Scope, agent string) *wsbase.Error {
+	return c.grant.Authorize(scope, c.server.registry, agent)
+}
+
+// sees reports whether the connection's token can see the named agent.
+func (c *Client) sees(agent string) bool {
+	return c.grant.SeesName(c.server.registry, agent)
+}
+
+// seesAgent reports whether the connection's token can see a watcher
+// event's agent.
+func (c *Client) seesAgent(a *agents.Agent) bool {
+	return a == nil || c.grant.Sees(*a)
+}
+
+// queuedPrompt looks up a queued prompt, hiding prompts for agents the
+// connection's token cannot see.
+func (c *Client) queuedPrompt(id string) (agentio.QueuedPrompt, error) {
+	item, ok := c.server.queue.Get(id)
+	if !ok || !c.sees(item.Agent) {
+		return agentio.QueuedPrompt{}, agentio.ErrPromptNotFound
 	}
+	return item, nil
 }
 
 func (c *Client) handleHello(msg clientMessage) {
 	if msg.Protocol != "tmux-converter.v1" {
-		c.sendJSON(serverMessage{ID: msg.ID, Type: "hello", OK: boolPtr(false), Error: "unsupported protocol version"})
+		c.sendJSON(errorMessage(msg.ID, "hello", wsbase.NewError(wsbase.CodeUnsupported, "unsupported protocol version").WithDetail("supported", []string{"tmux-converter.v1"})))
 		return
 	}
 	c.handshakeDone = true
-	c.sendJSON(serverMessage{ID: msg.ID, Type: "hello", OK: boolPtr(true), Protocol: "tmux-converter.v1", ServerVersion: "0.1.0"})
+	c.sendJSON(serverMessage{ID: msg.ID, Type: "hello", OK: boolPtr(true), Protocol: "tmux-converter.v1", ServerVersion: "0.1.0", Grant: c.grant})
 }
 
 func (c *Client) handleListAgents(msg clientMessage) {
@@ -311,12 +511,19 @@ func (c *Client) handleListAgents(msg clientMessage) {
 
 func (c *Client) handleSubscribeAgents(msg clientMessage) {
 	c.subscribedAgents = true
+	c.agentFields = nil
+	if len(msg.Fields) > 0 {
+		c.agentFields = make(map[string]bool, len(msg.Fields))
+		for _, f := range msg.Fields {
+			c.agentFields[f] = true
+		}
+	}
 	regAgents := c.buildAgentList()
 	c.sendJSON(serverMessage{ID: msg.ID, Type: "subscribe-agents", OK: boolPtr(true), Agents: regAgents})
 }
 
 func (c *Client) buildAgentList() []agentInfo {
-	agents := c.server.watcher.ListAgents()
+	agents := c.grant.FilterAgents(c.server.watcher.ListAgents())
 	result := make([]agentInfo, 0, len(agents))
 	for _, a := range agents {
 		info := agentInfo{
@@ -333,19 +540,21 @@ func (c *Client) buildAgentList() []agentInfo {
 }
 
 func (c *Client) handleListConversations(msg clientMessage) {
-	convs := c.server.watcher.ListConversations()
+	convs := slices.DeleteFunc(c.server.watcher.ListConversations(), func(info conv.ConversationInfo) bool {
+		return !c.sees(info.AgentName)
+	})
 	c.sendJSON(serverMessage{ID: msg.ID, Type: "list-conversations", Conversations: convs})
 }
 
 func (c *Client) handleSubscribeConversation(msg clientMessage) {
 	if msg.ConversationID == "" {
-		c.sendJSON(serverMessage{ID: msg.ID, Type: "error", Error: "conversationId required"})
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.NewError(wsbase.CodeInvalidArgument, "conversationId required").WithDetail("field", "conversationId")))
 		return
 	}
 
 	buf := c.server.watcher.GetBuffer(msg.ConversationID)
-	if buf == nil {
-		c.sendJSON(serverMessage{ID: msg.ID, Type: "error", Error: "conversation not found"})
+	if buf == nil || !c.sees(buf.AgentName()) {
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.NewError(wsbase.CodeNotFound, "conversation not found").WithDetail("conversationId", msg.ConversationID)))
 		return
 	}
 
@@ -382,7 +591,7 @@ func (c *Client) handleSubscribeConversation(msg clientMessage) {
 
 func (c *Client) handleFollowAgent(msg clientMessage) {
 	if msg.Agent == "" {
-		c.sendJSON(serverMessage{ID: msg.ID, Type: "error", Error: "agent required"})
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.MissingField("agent")))
 		return
 	}
 
@@ -527,27 +736,122 @@ func (c *Client) handleUnsubscribeAgent(msg clientMessage) {
 
 func (c *Client) handleSendPrompt(msg clientMessage) {
 	if msg.Agent == "" {
-		c.sendJSON(serverMessage{ID: msg.ID, Type: "error", Error: "agent field required"})
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.MissingField("agent")))
 		return
 	}
 	if msg.Prompt == "" {
-		c.sendJSON(serverMessage{ID: msg.ID, Type: "error", Error: "prompt field required"})
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.MissingField("prompt")))
 		return
 	}
 
-	lock := c.server.prompter.GetLock(msg.Agent)
-	go func() {
-		lock.Lock()
-		defer lock.Unlock()
+	submitter := msg.Submitter
+	if submitter == "" {
+		submitter = c.remoteAddr
+	}
+	_, err := c.server.queue.Enqueue(agentio.PromptRequest{
+		Agent:          msg.Agent,
+		Prompt:         msg.Prompt,
+		Submitter:      submitter,
+		Priority:       msg.Priority,
+		WaitIdle:       msg.WaitIdle,
+		Confirm:        msg.Confirm,
+		ConfirmTimeout: agentio.ConfirmTimeout(msg.ConfirmTimeoutMs),
+		// The conversation stream gives the most reliable confirmation
+		// evidence; the pane is still checked for agents without one.
+		Echo: c.server.watcher,
+	}, func(out agentio.PromptOutcome) {
+		resp := serverMessage{ID: msg.ID, Type: "send-prompt", OK: boolPtr(out.Err == nil && !out.Cancelled), PromptID: out.Item.ID, Delivery: out.Delivery}
+		switch {
+		case out.Cancelled:
+			resp.fail(wsbase.NewError(wsbase.CodeCancelled, "prompt cancelled"))
+		case out.Err != nil:
+			resp.fail(wsbase.ErrorFrom(out.Err))
+		}
+		c.sendJSON(resp)
+	})
+	if err != nil {
+		c.sendJSON(errorMessage(msg.ID, "send-prompt", wsbase.ErrorFrom(err)))
+	}
+}
+
+// handleBroadcastPrompt queues the prompt for every agent matching the
+// selector and replies once with the per-agent results.
+func (c *Client) handleBroadcastPrompt(msg clientMessage) {
+	if msg.Selector == nil {
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.MissingField("selector")))
+		return
+	}
+	if msg.Prompt == "" {
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.MissingField("prompt")))
+		return
+	}
 
-		if err := c.server.prompter.SendPrompt(msg.Agent, msg.Prompt); err != nil {
-			c.sendJSON(serverMessage{ID: msg.ID, Type: "send-prompt", OK: boolPtr(false), Error: err.Error()})
+	submitter := msg.Submitter
+	if submitter == "" {
+		submitter = c.remoteAddr
+	}
+	go func() {
+		results, err := c.server.queue.Broadcast(*msg.Selector, agentio.PromptRequest{
+			Prompt:         msg.Prompt,
+			Submitter:      submitter,
+			Priority:       msg.Priority,
+			WaitIdle:       msg.WaitIdle,
+			Confirm:        msg.Confirm,
+			ConfirmTimeout: agentio.ConfirmTimeout(msg.ConfirmTimeoutMs),
+			Echo:           c.server.watcher,
+		}, c.grant.Sees, nil)
+		if err != nil {
+			c.sendJSON(errorMessage(msg.ID, "broadcast-prompt", wsbase.ErrorFrom(err)))
 			return
 		}
-		c.sendJSON(serverMessage{ID: msg.ID, Type: "send-prompt", OK: boolPtr(true)})
+		ok := true
+		for _, r := range results {
+			ok = ok && r.OK
+		}
+		c.sendJSON(serverMessage{ID: msg.ID, Type: "broadcast-prompt", OK: boolPtr(ok), Results: results})
 	}()
 }
 
+func (c *Client) handleCancelPrompt(msg clientMessage) {
+	if msg.PromptID == "" {
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.MissingField("promptId")))
+		return
+	}
+	item, err := c.queuedPrompt(msg.PromptID)
+	if err == nil {
+		item, err = c.server.queue.Cancel(msg.PromptID)
+	}
+	if err != nil {
+		resp := errorMessage(msg.ID, "cancel-prompt", wsbase.ErrorFrom(err))
+		resp.PromptID = msg.PromptID
+		c.sendJSON(resp)
+		return
+	}
+	c.sendJSON(serverMessage{ID: msg.ID, Type: "cancel-prompt", OK: boolPtr(true), PromptID: msg.PromptID, QueueItem: &item})
+}
+
+func (c *Client) handleReorderPrompt(msg clientMessage) {
+	if msg.PromptID == "" {
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.MissingField("promptId")))
+		return
+	}
+	if msg.Position == nil {
+		c.sendJSON(errorMessage(msg.ID, "error", wsbase.MissingField("position")))
+		return
+	}
+	item, err := c.queuedPrompt(msg.PromptID)
+	if err == nil {
+		item, err = c.server.queue.Reorder(msg.PromptID, *msg.Position)
+	}
+	if err != nil {
+		resp := errorMessage(msg.ID, "reorder-prompt", wsbase.ErrorFrom(err))
+		resp.PromptID = msg.PromptID
+		c.sendJSON(resp)
+		return
+	}
+	c.sendJSON(serverMessage{ID: msg.ID, Type: "reorder-prompt", OK: boolPtr(true), PromptID: msg.PromptID, Queue: c.server.queue.List(item.Agent)})
+}
+
 func (c *Client) deliverConversationEvent(event *conv.ConversationEvent) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -727,15 +1031,24 @@ func (c *Client) cleanup() {
 // Helper types and functions
 
 type clientMessage struct {
-	ID             string           `json:"id"`
-	Type           string           `json:"type"`
-	Protocol       string           `json:"protocol,omitempty"`
-	ConversationID string           `json:"conversationId,omitempty"`
-	Agent          string           `json:"agent,omitempty"`
-	Prompt         string           `json:"prompt,omitempty"`
-	SubscriptionID string           `json:"subscriptionId,omitempty"`
-	Filter         *clientFilter    `json:"filter,omitempty"`
-	Cursor         string           `json:"cursor,omitempty"`
+	ID               string                 `json:"id"`
+	Type             string                 `json:"type"`
+	Protocol         string                 `json:"protocol,omitempty"`
+	ConversationID   string                 `json:"conversationId,omitempty"`
+	Agent            string                 `json:"agent,omitempty"`
+	Prompt           string                 `json:"prompt,omitempty"`
+	SubscriptionID   string                 `json:"subscriptionId,omitempty"`
+	Filter           *clientFilter          `json:"filter,omitempty"`
+	Cursor           string                 `json:"cursor,omitempty"`
+	Fields           []string               `json:"fields,omitempty"`
+	Confirm          bool                   `json:"confirm,omitempty"`
+	ConfirmTimeoutMs int                    `json:"confirmTimeoutMs,omitempty"`
+	Priority         int                    `json:"priority,omitempty"`
+	Submitter        string                 `json:"submitter,omitempty"`
+	WaitIdle         bool                   `json:"waitIdle,omitempty"`
+	PromptID         string                 `json:"promptId,omitempty"`
+	Position         *int                   `json:"position,omitempty"`
+	Selector         *agentio.AgentSelector `json:"selector,omitempty"`
 }
 
 type clientFilter struct {
@@ -752,6 +1065,7 @@ type serverMessage struct {
 	Protocol       string                    `json:"protocol,omitempty"`
 	ServerVersion  string                    `json:"serverVersion,omitempty"`
 	UnknownType    string                    `json:"unknownType,omitempty"`
+	Grant          *wsbase.Grant             `json:"grant,omitempty"`
 	Agents         []agentInfo               `json:"agents,omitempty"`
 	Conversations  []conv.ConversationInfo   `json:"conversations,omitempty"`
 	SubscriptionID string                    `json:"subscriptionId,omitempty"`
@@ -764,6 +1078,15 @@ type serverMessage struct {
 	From           string                    `json:"from,omitempty"`
 	To             string                    `json:"to,omitempty"`
 	Reason         string                    `json:"reason,omitempty"`
+	Changes        []agents.AgentChange      `json:"changes,omitempty"`
+	Delivery       *agentio.DeliveryResult   `json:"delivery,omitempty"`
+	PromptID       string                    `json:"promptId,omitempty"`
+	Action         string                    `json:"action,omitempty"`
+	QueueItem      *agentio.QueuedPrompt     `json:"queueItem,omitempty"`
+	Queue          []agentio.QueuedPrompt    `json:"queue,omitempty"`
+	Results        []agentio.BroadcastResult `json:"results,omitempty"`
+	UploadResult   *agentio.UploadResult     `json:"uploadResult,omitempty"`
+	ErrorInfo      *wsbase.Error             `json:"errorInfo,omitempty"`
 }
 
 type agentInfo struct {
@@ -838,3 +1161,18 @@ func encodeCursor(c conv.Cursor) string {
 func boolPtr(b bool) *bool {
 	return &b
 }
+
+// errorMessage builds a failed response to a request.
+func errorMessage(id, typ string, e *wsbase.Error) serverMessage {
+	msg := serverMessage{ID: id, Type: typ}
+	msg.fail(e)
+	return msg
+}
+
+// fail marks the message failed, with both the plain error string and the
+// structured error.
+func (m *serverMessage) fail(e *wsbase.Error) {
+	m.OK = boolPtr(false)
+	m.Error = e.Message
+	m.ErrorInfo = e
+}
@@ -9,8 +9,11 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gastownhall/tmux-adapter/internal/adapter"
+	"github.com/gastownhall/tmux-adapter/internal/agentio"
+	"github.com/gastownhall/tmux-adapter/internal/wsbase"
 )
 
 func main() {
@@ -22,24 +25,88 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  tmux-adapter --gt-dir ~/gt --port 8080\n")
 		fmt.Fprintf(os.Stderr, "  tmux-adapter --gt-dir ~/gt --auth-token SECRET\n")
+		fmt.Fprintf(os.Stderr, "  tmux-adapter --gt-dir ~/gt --tokens tokens.json\n")
+		fmt.Fprintf(os.Stderr, "  tmux-adapter --gt-dir ~/gt --jwt-keys jwks.json --jwt-issuer https://id.example.com --jwt-audience tmux-adapter\n")
+		fmt.Fprintf(os.Stderr, "  tmux-adapter --gt-dir ~/gt --tls-cert cert.pem --tls-key key.pem --tls-client-ca clients.pem\n")
 		fmt.Fprintf(os.Stderr, "  tmux-adapter --gt-dir ~/gt --debug-serve-dir ./samples\n")
 	}
 
 	gtDir := flag.String("gt-dir", filepath.Join(os.Getenv("HOME"), "gt"), "gastown town directory")
 	port := flag.Int("port", 8080, "WebSocket server port")
 	authToken := flag.String("auth-token", "", "optional WebSocket auth token (Bearer token or ?token=...)")
+	tokensFile := flag.String("tokens", "", "JSON file of named access tokens with scopes and agent selectors")
+	jwtKeys := flag.String("jwt-keys", "", "JWKS or PEM file of public keys for verifying JWT bearer tokens (reloaded on change)")
+	jwtIssuer := flag.String("jwt-issuer", "", "required JWT iss claim (default: any)")
+	jwtAudience := flag.String("jwt-audience", "", "required JWT aud claim (default: any)")
+	jwtClockSkew := flag.Duration("jwt-clock-skew", wsbase.DefaultJWTClockSkew, "leeway for JWT exp, nbf and iat")
+	jwtScopeClaim := flag.String("jwt-scope-claim", "scope", "JWT claim holding scopes (space-separated string or array)")
+	jwtAgentClaim := flag.String("jwt-agent-claim", "agents", "JWT claim holding agent selectors")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate chain; serve HTTPS/WSS (reloaded on change)")
+	tlsKey := flag.String("tls-key", "", "PEM private key for --tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", "", "PEM CA bundle for verifying client certificates (mutual TLS)")
+	tlsClientAuth := flag.String("tls-client-auth", wsbase.ClientAuthRequire, "with --tls-client-ca: require or optional client certificates")
 	allowedOrigins := flag.String("allowed-origins", "localhost:*", "comma-separated origin patterns for WebSocket CORS")
 	debugServeDir := flag.String("debug-serve-dir", "", "serve static files from this directory at / (development only)")
+	promptTimings := flag.String("prompt-timings", "", "JSON file of per-runtime send-prompt timing overrides")
+	pastePolicy := flag.String("paste-policy", "", "JSON file of per-runtime upload paste policies")
+	uploadQuotaMB := flag.Int64("upload-quota-mb", 256, "per-agent upload storage quota in MB (0 = unlimited)")
+	uploadMaxFiles := flag.Int("upload-max-files", 200, "per-agent maximum number of stored uploads (0 = unlimited)")
+	uploadMaxAge := flag.Duration("upload-max-age", 7*24*time.Hour, "delete uploads not re-uploaded within this duration (0 = keep forever)")
+	filesMaxMB := flag.Int64("files-max-mb", 50, "largest file downloadable from an agent workDir in MB (0 = unlimited)")
+	filesMaxEntries := flag.Int("files-max-entries", 1000, "most entries returned per workDir directory listing (0 = unlimited)")
+	filesDeny := flag.String("files-deny", ".env,.env.*,.git/objects", "comma-separated globs hidden from workDir file browsing")
+	controlPolicy := flag.String("control-policy", "free", "input control between adapter clients: free, single (one driver per agent) or admin-override (converter input is not covered)")
+	sizePolicy := flag.String("size-policy", "smallest", "window size between clients: smallest, largest, driver, fixed (leave alone) or fixed:COLSxROWS")
+	mirrorClipboard := flag.Bool("mirror-clipboard", false, "also copy OSC 52 clipboard writes from agents to this machine's clipboard")
 	flag.Parse()
 
-	var origins []string
-	for _, o := range strings.Split(*allowedOrigins, ",") {
-		if s := strings.TrimSpace(o); s != "" {
-			origins = append(origins, s)
-		}
+	origins := splitList(*allowedOrigins)
+
+	uploadPolicy := agentio.UploadPolicy{
+		MaxBytesPerAgent: *uploadQuotaMB * 1024 * 1024,
+		MaxFilesPerAgent: *uploadMaxFiles,
+		MaxAge:           *uploadMaxAge,
+	}
+
+	filePolicy := agentio.FilePolicy{
+		MaxFileBytes: *filesMaxMB * 1024 * 1024,
+		MaxEntries:   *filesMaxEntries,
+		Deny:         splitList(*filesDeny),
+	}
+
+	jwtConfig := wsbase.JWTConfig{
+		KeyFile:    *jwtKeys,
+		Issuer:     *jwtIssuer,
+		Audience:   *jwtAudience,
+		ClockSkew:  *jwtClockSkew,
+		ScopeClaim: *jwtScopeClaim,
+		AgentClaim: *jwtAgentClaim,
 	}
 
-	a := adapter.New(*gtDir, *port, *authToken, origins, *debugServeDir)
+	tlsConfig := wsbase.TLSConfig{
+		CertFile:     *tlsCert,
+		KeyFile:      *tlsKey,
+		ClientCAFile: *tlsClientCA,
+		ClientAuth:   *tlsClientAuth,
+	}
+
+	a := adapter.New(adapter.Options{
+		GtDir:           *gtDir,
+		Port:            *port,
+		AuthToken:       *authToken,
+		OriginPatterns:  origins,
+		DebugServeDir:   *debugServeDir,
+		PromptTimings:   *promptTimings,
+		PastePolicy:     *pastePolicy,
+		TokensFile:      *tokensFile,
+		JWT:             jwtConfig,
+		TLS:             tlsConfig,
+		Uploads:         uploadPolicy,
+		Files:           filePolicy,
+		MirrorClipboard: *mirrorClipboard,
+		ControlPolicy:   *controlPolicy,
+		SizePolicy:      *sizePolicy,
+	})
 	if err := a.Start(); err != nil {
 		log.Fatal(err)
 	}
@@ -51,3 +118,14 @@ func main() {
 
 	a.Stop()
 }
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}